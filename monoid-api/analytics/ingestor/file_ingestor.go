@@ -0,0 +1,56 @@
+package ingestor
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileIngestor appends events to a local file, with one JSON event per line.
+type FileIngestor struct {
+	UserID *string
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewFileIngestor(path string, userID *string) (Ingestor, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileIngestor{
+		UserID: userID,
+		file:   f,
+		enc:    json.NewEncoder(f),
+	}, nil
+}
+
+func (fi *FileIngestor) write(e Event) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.enc.Encode(e)
+}
+
+func (fi *FileIngestor) Identify(userID *string, traits map[string]interface{}) error {
+	e, err := newIdentifyEvent(userID, fi.UserID, traits)
+	if err != nil {
+		return err
+	}
+
+	return fi.write(e)
+}
+
+func (fi *FileIngestor) Track(event string, userID *string, properties map[string]interface{}) error {
+	return fi.write(newTrackEvent(event, userID, fi.UserID, properties))
+}
+
+func (fi *FileIngestor) Close() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.file.Close()
+}
@@ -0,0 +1,117 @@
+package ingestor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// httpQueueSize is the number of events that can be waiting to be sent. Events
+// are dropped if the queue is full, so a slow endpoint doesn't block callers.
+const httpQueueSize = 256
+
+// HTTPIngestor posts each event as JSON to an HTTP endpoint. Events are sent in
+// the background, in the order they were tracked.
+type HTTPIngestor struct {
+	UserID *string
+
+	url    string
+	token  string
+	client *http.Client
+	queue  chan Event
+	wg     sync.WaitGroup
+}
+
+func NewHTTPIngestor(url string, token string, userID *string) (Ingestor, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no analytics url")
+	}
+
+	hi := &HTTPIngestor{
+		UserID: userID,
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Event, httpQueueSize),
+	}
+
+	hi.wg.Add(1)
+	go hi.run()
+
+	return hi, nil
+}
+
+func (hi *HTTPIngestor) run() {
+	defer hi.wg.Done()
+
+	for e := range hi.queue {
+		if err := hi.send(e); err != nil {
+			log.Err(err).Msg("Error sending analytics event")
+		}
+	}
+}
+
+func (hi *HTTPIngestor) send(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hi.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if hi.token != "" {
+		req.Header.Set("Authorization", "Bearer "+hi.token)
+	}
+
+	res, err := hi.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("analytics endpoint returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (hi *HTTPIngestor) enqueue(e Event) error {
+	select {
+	case hi.queue <- e:
+		return nil
+	default:
+		return fmt.Errorf("analytics queue is full")
+	}
+}
+
+func (hi *HTTPIngestor) Identify(userID *string, traits map[string]interface{}) error {
+	e, err := newIdentifyEvent(userID, hi.UserID, traits)
+	if err != nil {
+		return err
+	}
+
+	return hi.enqueue(e)
+}
+
+func (hi *HTTPIngestor) Track(event string, userID *string, properties map[string]interface{}) error {
+	return hi.enqueue(newTrackEvent(event, userID, hi.UserID, properties))
+}
+
+// Close sends the events that are queued, and stops the ingestor.
+func (hi *HTTPIngestor) Close() error {
+	close(hi.queue)
+	hi.wg.Wait()
+
+	return nil
+}
@@ -1,7 +1,95 @@
 package ingestor
 
+import (
+	"fmt"
+	"time"
+)
+
 type Ingestor interface {
 	Identify(userID *string, traits map[string]interface{}) error
 	Track(event string, userID *string, properties map[string]interface{}) error
 	Close() error
 }
+
+const (
+	// SinkNone discards all events. It's used if no sink is configured.
+	SinkNone = "none"
+	// SinkSegment sends events to Segment.
+	SinkSegment = "segment"
+	// SinkFile appends events to a local JSONL file.
+	SinkFile = "file"
+	// SinkHTTP posts events to an HTTP endpoint.
+	SinkHTTP = "http"
+)
+
+// Config selects the sink that analytics events are sent to.
+type Config struct {
+	Sink       string
+	SegmentKey string
+	FilePath   string
+	HTTPURL    string
+	HTTPToken  string
+}
+
+// New creates an ingestor for the sink in the config. Events are only sent
+// outside the deployment if a sink is explicitly configured.
+func New(conf Config, userID *string) (Ingestor, error) {
+	switch conf.Sink {
+	case "", SinkNone:
+		return NewNoopIngestor(), nil
+	case SinkSegment:
+		return NewSegmentIngestor(conf.SegmentKey, userID), nil
+	case SinkFile:
+		return NewFileIngestor(conf.FilePath, userID)
+	case SinkHTTP:
+		return NewHTTPIngestor(conf.HTTPURL, conf.HTTPToken, userID)
+	default:
+		return nil, fmt.Errorf("unknown analytics sink %q", conf.Sink)
+	}
+}
+
+// Event is an analytics event, as it's written by the file and HTTP ingestors.
+type Event struct {
+	Type       string                 `json:"type"`
+	Event      string                 `json:"event,omitempty"`
+	UserID     string                 `json:"userId"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Traits     map[string]interface{} `json:"traits,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// newIdentifyEvent creates an identify event, using defaultUserID if userID isn't set.
+func newIdentifyEvent(userID *string, defaultUserID *string, traits map[string]interface{}) (Event, error) {
+	if userID == nil {
+		if defaultUserID == nil {
+			return Event{}, fmt.Errorf("no user id")
+		}
+
+		userID = defaultUserID
+	}
+
+	return Event{
+		Type:      "identify",
+		UserID:    *userID,
+		Traits:    traits,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// newTrackEvent creates a track event, using defaultUserID if userID isn't set.
+func newTrackEvent(event string, userID *string, defaultUserID *string, properties map[string]interface{}) Event {
+	e := Event{
+		Type:       "track",
+		Event:      event,
+		Properties: properties,
+		Timestamp:  time.Now(),
+	}
+
+	if userID != nil {
+		e.UserID = *userID
+	} else if defaultUserID != nil {
+		e.UserID = *defaultUserID
+	}
+
+	return e
+}
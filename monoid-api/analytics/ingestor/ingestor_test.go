@@ -0,0 +1,78 @@
+package ingestor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type jobStatus string
+
+func TestScrub(t *testing.T) {
+	props := Scrub(map[string]interface{}{
+		"action":      jobStatus("COMPLETED"),
+		"siloId":      "silo-1",
+		"siloName":    "Production DB",
+		"identifiers": []string{"user@example.com"},
+		"args": map[string]interface{}{
+			"jobType": "discover",
+			"query":   "user@example.com",
+		},
+	})
+
+	assert.Equal(t, "COMPLETED", props["action"])
+	assert.Equal(t, hashID("silo-1"), props["siloId"])
+	assert.NotEqual(t, "silo-1", props["siloId"])
+	assert.NotContains(t, props, "siloName")
+	assert.NotContains(t, props, "identifiers")
+	assert.Equal(t, map[string]interface{}{"jobType": "discover"}, props["args"])
+}
+
+func TestScrubbingIngestorDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	userID := "deployment"
+
+	sink, err := New(Config{Sink: SinkFile, FilePath: path}, &userID)
+	require.NoError(t, err)
+
+	ing := NewScrubbingIngestor(sink, func(properties map[string]interface{}) bool {
+		return properties["workspaceId"] == "anonymized"
+	})
+
+	require.NoError(t, ing.Track("siloAction", nil, map[string]interface{}{
+		"action":      "create",
+		"workspaceId": "anonymized",
+	}))
+	require.NoError(t, ing.Track("siloAction", nil, map[string]interface{}{
+		"action":      "create",
+		"workspaceId": "workspace",
+		"name":        "Production DB",
+		"siloName":    "Production DB",
+	}))
+	require.NoError(t, ing.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	events := []Event{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		e := Event{}
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		events = append(events, e)
+	}
+
+	require.Len(t, events, 1)
+	assert.Equal(t, "track", events[0].Type)
+	assert.Equal(t, "siloAction", events[0].Event)
+	assert.Equal(t, userID, events[0].UserID)
+	assert.Equal(t, hashID("workspace"), events[0].Properties["workspaceId"])
+	assert.NotContains(t, events[0].Properties, "name")
+	assert.NotContains(t, events[0].Properties, "siloName")
+}
@@ -0,0 +1,142 @@
+package ingestor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+)
+
+// allowedProperties are the properties that are sent as they are. Any other
+// property is dropped, so silo names and user identifiers can't be sent by
+// mistake.
+var allowedProperties = map[string]bool{
+	"action":        true,
+	"anonymizeData": true,
+	"args":          true,
+	"email":         true,
+	"jobType":       true,
+	"sendNews":      true,
+}
+
+// hashedProperties are IDs that are hashed before they are sent, so events
+// can be correlated without sending the IDs themselves.
+var hashedProperties = map[string]bool{
+	"jobId":       true,
+	"requestId":   true,
+	"siloId":      true,
+	"workspaceId": true,
+}
+
+// ScrubbingIngestor removes anything that could identify a silo or a user from
+// events before passing them to another ingestor.
+type ScrubbingIngestor struct {
+	ingestor Ingestor
+
+	// disabled returns true if the event (given its unscrubbed properties)
+	// shouldn't be sent at all.
+	disabled func(properties map[string]interface{}) bool
+}
+
+// NewScrubbingIngestor wraps the ingestor with a scrubber. disabled may be nil,
+// in which case all events are sent.
+func NewScrubbingIngestor(
+	ingestor Ingestor,
+	disabled func(properties map[string]interface{}) bool,
+) Ingestor {
+	return &ScrubbingIngestor{
+		ingestor: ingestor,
+		disabled: disabled,
+	}
+}
+
+func (si *ScrubbingIngestor) Identify(userID *string, traits map[string]interface{}) error {
+	if si.disabled != nil && si.disabled(traits) {
+		return nil
+	}
+
+	return si.ingestor.Identify(userID, Scrub(traits))
+}
+
+func (si *ScrubbingIngestor) Track(event string, userID *string, properties map[string]interface{}) error {
+	if si.disabled != nil && si.disabled(properties) {
+		return nil
+	}
+
+	return si.ingestor.Track(event, userID, Scrub(properties))
+}
+
+func (si *ScrubbingIngestor) Close() error {
+	return si.ingestor.Close()
+}
+
+// Scrub returns a copy of the properties with only the allowed properties, and
+// with IDs hashed. Values that aren't scalars or nested properties are dropped.
+func Scrub(properties map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+
+	for k, v := range properties {
+		switch {
+		case hashedProperties[k]:
+			s, ok := scalar(v)
+			if !ok {
+				continue
+			}
+
+			res[k] = hashID(s)
+		case allowedProperties[k]:
+			if m, ok := v.(map[string]interface{}); ok {
+				res[k] = Scrub(m)
+				continue
+			}
+
+			s, ok := scalar(v)
+			if !ok {
+				continue
+			}
+
+			res[k] = s
+		}
+	}
+
+	return res
+}
+
+// scalar returns v as a plain string, bool or number.
+func scalar(v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return rv.Bool(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, false
+		}
+
+		return scalar(rv.Elem().Interface())
+	default:
+		return nil, false
+	}
+}
+
+func hashID(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"encoding/json"
+
+	"github.com/monoid-privacy/monoid/model"
+	"gorm.io/gorm"
+)
+
+// AnonymizedWorkspace returns a function that reports whether an event belongs to
+// a workspace with AnonymizeData set, so the event shouldn't be sent. The
+// workspace is found from the event's workspaceId, siloId, or jobId property.
+func AnonymizedWorkspace(db *gorm.DB) func(properties map[string]interface{}) bool {
+	return func(properties map[string]interface{}) bool {
+		workspaceID, ok := eventWorkspaceID(db, properties)
+		if !ok {
+			return false
+		}
+
+		workspace := model.Workspace{}
+		if err := db.Select("settings").Where("id = ?", workspaceID).First(&workspace).Error; err != nil {
+			// The workspace's settings can't be checked, so the event is
+			// treated as anonymized.
+			return true
+		}
+
+		settings := model.WorkspaceSettings{}
+		if err := json.Unmarshal(workspace.Settings, &settings); err != nil {
+			return true
+		}
+
+		return settings.AnonymizeData
+	}
+}
+
+// eventWorkspaceID returns the ID of the workspace that the event is about, and
+// false if the event isn't about a workspace.
+func eventWorkspaceID(db *gorm.DB, properties map[string]interface{}) (string, bool) {
+	if id, ok := properties["workspaceId"].(string); ok {
+		return id, true
+	}
+
+	lookups := []struct {
+		property string
+		model    interface{}
+	}{
+		{"siloId", &model.SiloDefinition{}},
+		{"jobId", &model.Job{}},
+	}
+
+	for _, l := range lookups {
+		id, ok := properties[l.property].(string)
+		if !ok {
+			continue
+		}
+
+		// If the lookup fails, the empty ID won't match a workspace, so the
+		// event isn't sent.
+		workspaceID := ""
+		if err := db.Model(l.model).Where("id = ?", id).Select("workspace_id").Scan(&workspaceID).Error; err != nil {
+			return "", true
+		}
+
+		return workspaceID, true
+	}
+
+	return "", false
+}
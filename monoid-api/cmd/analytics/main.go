@@ -7,6 +7,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/monoid-privacy/monoid/analytics"
 	"github.com/monoid-privacy/monoid/analytics/ingestor"
+	"github.com/monoid-privacy/monoid/cmd"
 	"github.com/rs/zerolog/log"
 )
 
@@ -20,8 +21,13 @@ func main() {
 
 	router := mux.NewRouter()
 
+	sink, err := ingestor.New(cmd.AnalyticsConfig(os.Getenv("SEGMENT_WRITE_KEY")), nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error creating analytics sink")
+	}
+
 	analyticsHandler := analytics.AnalyticsHandler{
-		Ingestor: ingestor.NewSegmentIngestor(os.Getenv("SEGMENT_WRITE_KEY"), nil),
+		Ingestor: ingestor.NewScrubbingIngestor(sink, nil),
 	}
 
 	defer analyticsHandler.Ingestor.Close()
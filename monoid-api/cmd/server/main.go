@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -18,10 +19,14 @@ import (
 	"github.com/monoid-privacy/monoid/download"
 	"github.com/monoid-privacy/monoid/generated"
 	"github.com/monoid-privacy/monoid/resolver"
+	"github.com/monoid-privacy/monoid/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
 )
 
 const defaultPort = "8080"
+const defaultMetricsPort = "9090"
 
 func main() {
 	port := os.Getenv("PORT")
@@ -29,11 +34,23 @@ func main() {
 		port = defaultPort
 	}
 
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = defaultMetricsPort
+	}
+
 	conf := cmd.GetBaseConfig(nil)
 	defer conf.AnalyticsIngestor.Close()
 
+	shutdownTracing, err := telemetry.SetupTracing(context.Background(), "monoid-server")
+	if err != nil {
+		log.Fatalln("unable to set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	c, err := client.Dial(client.Options{
-		HostPort: os.Getenv("TEMPORAL"),
+		HostPort:     os.Getenv("TEMPORAL"),
+		Interceptors: []interceptor.ClientInterceptor{telemetry.TemporalInterceptor()},
 	})
 
 	if err != nil {
@@ -75,6 +92,7 @@ func main() {
 	srv.SetQueryCache(lru.New(1000))
 
 	srv.Use(extension.Introspection{})
+	srv.Use(telemetry.GraphQLExtension{})
 	srv.Use(extension.AutomaticPersistedQuery{
 		Cache: lru.New(100),
 	})
@@ -84,9 +102,14 @@ func main() {
 	}
 
 	router.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	router.HandleFunc("/downloads/public/{id}", dh.HandlePublicDownload)
 	router.HandleFunc("/downloads/{id}", dh.HandleDownload)
 	router.Handle("/query", srv)
 
+	// The metrics are served on their own port, so that they aren't exposed
+	// to the same clients as the API.
+	telemetry.ServeMetrics(":" + metricsPort)
+
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	log.Fatal(http.ListenAndServe(":"+port, otelhttp.NewHandler(router, "monoid-server")))
 }
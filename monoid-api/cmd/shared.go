@@ -7,19 +7,25 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/monoid-privacy/monoid/analytics"
 	"github.com/monoid-privacy/monoid/analytics/ingestor"
 	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/filestore/encryptedstore"
 	"github.com/monoid-privacy/monoid/filestore/gcloudstore"
 	"github.com/monoid-privacy/monoid/filestore/localstore"
+	"github.com/monoid-privacy/monoid/filestore/s3store"
+	"github.com/monoid-privacy/monoid/imageverify"
 	"google.golang.org/api/option"
 
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol/docker"
+	"github.com/monoid-privacy/monoid/secrets"
 	"github.com/rs/zerolog/log"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -48,16 +54,26 @@ var Models = []interface{}{
 	model.Purpose{},
 	model.SiloDefinition{},
 	model.SiloSpecification{},
+	model.SiloSpecificationVersion{},
 	model.Property{},
 	model.UserPrimaryKey{},
 	model.Job{},
 	model.Request{},
 	model.RequestStatus{},
 	model.PrimaryKeyValue{},
+	model.DiscoveryPolicy{},
 	model.DataDiscovery{},
+	model.DataSourceVersion{},
+	model.LineageEdge{},
+	model.PropertySample{},
 	model.OSSRegistration{},
 	model.QueryResult{},
 	model.DownloadableFile{},
+	model.DownloadGrant{},
+	model.DownloadAccessLog{},
+	model.JobLogStream{},
+	model.JobProgress{},
+	model.ExecutionSlot{},
 }
 
 func MigrateOSS(db *gorm.DB) {
@@ -127,7 +143,28 @@ func GetBaseConfig(migrator func(db *gorm.DB)) config.BaseConfig {
 		panic(err)
 	}
 
-	model.SetEncryptionKey(key)
+	// Keys that are being rotated out can still be used to decrypt
+	// existing data.
+	previousKeys := [][]byte{}
+	for _, k := range strings.Split(os.Getenv("PREVIOUS_ENCRYPTION_KEYS"), ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+
+		prev, err := base64.StdEncoding.DecodeString(strings.TrimSpace(k))
+		if err != nil {
+			panic(err)
+		}
+
+		previousKeys = append(previousKeys, prev)
+	}
+
+	keyring, err := model.NewKeyring(key, previousKeys...)
+	if err != nil {
+		panic(err)
+	}
+
+	model.SetKeyring(keyring)
 
 	reg := model.OSSRegistration{}
 	if err := db.First(&reg).Error; err != nil {
@@ -139,17 +176,51 @@ func GetBaseConfig(migrator func(db *gorm.DB)) config.BaseConfig {
 		tempStore = os.TempDir()
 	}
 
+	// Silo configs can reference secrets stored in these backends instead
+	// of storing them directly.
+	secretResolver := secrets.NewResolver()
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		vault := secrets.NewVaultBackend(addr, os.Getenv("VAULT_TOKEN"))
+		vault.Namespace = os.Getenv("VAULT_NAMESPACE")
+		if mount := os.Getenv("VAULT_KV_MOUNT"); mount != "" {
+			vault.Mount = mount
+		}
+
+		secretResolver.Register("vault", vault)
+	}
+
+	if fp := os.Getenv("SECRETS_FILE"); fp != "" {
+		secretResolver.Register("file", secrets.NewFileBackend(fp))
+	}
+
 	conf := config.BaseConfig{
 		DB:              db,
+		SecretResolver:  secretResolver,
+		EncryptionKey:   key,
 		WebURL:          os.Getenv("WEB_URL"),
 		TempStorePath:   tempStore,
 		ProtocolFactory: &docker.DockerProtocolFactory{},
-		AnalyticsIngestor: ingestor.NewSegmentIngestor(
-			os.Getenv("SEGMENT_KEY"),
-			&reg.ID,
-		),
 	}
 
+	// Connector images are only run if they're signed by the key, if it's set.
+	if fp := os.Getenv("CONNECTOR_VERIFICATION_KEY"); fp != "" {
+		verifier, err := imageverify.NewVerifierFromFile(fp)
+		if err != nil {
+			panic(err)
+		}
+
+		conf.ProtocolFactory = &docker.DockerProtocolFactory{Verifier: verifier}
+	}
+
+	// Analytics are only sent if a sink is configured, and are scrubbed of
+	// anything that identifies a silo or user before they leave the deployment.
+	sink, err := ingestor.New(AnalyticsConfig(os.Getenv("SEGMENT_KEY")), &reg.ID)
+	if err != nil {
+		panic(err)
+	}
+
+	conf.AnalyticsIngestor = ingestor.NewScrubbingIngestor(sink, analytics.AnonymizedWorkspace(db))
+
 	switch os.Getenv("STORAGE_TYPE") {
 	case "google_cloud":
 		cli, err := storage.NewClient(context.Background(), option.WithCredentialsFile(
@@ -164,9 +235,43 @@ func GetBaseConfig(migrator func(db *gorm.DB)) config.BaseConfig {
 			cli,
 			os.Getenv("GCS_BUCKET"),
 		)
+	case "s3":
+		store, err := s3store.NewS3Store(s3store.Config{
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			DisableSSL:      os.Getenv("S3_DISABLE_SSL") == "true",
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+			KMSKeyID:        os.Getenv("S3_KMS_KEY_ID"),
+		})
+
+		if err != nil {
+			panic(err)
+		}
+
+		conf.FileStore = store
 	default:
 		conf.FileStore = localstore.NewLocalFileStore(os.Getenv("FILESTORE_PATH"))
 	}
 
+	// Request results and job logs are encrypted at rest unless explicitly
+	// disabled.
+	if os.Getenv("FILESTORE_ENCRYPTION") != "disabled" {
+		conf.FileStore = encryptedstore.NewEncryptedFileStore(conf.FileStore, key, previousKeys...)
+	}
+
 	return conf
 }
+
+// AnalyticsConfig reads the analytics sink settings from the environment.
+func AnalyticsConfig(segmentKey string) ingestor.Config {
+	return ingestor.Config{
+		Sink:       os.Getenv("ANALYTICS_SINK"),
+		SegmentKey: segmentKey,
+		FilePath:   os.Getenv("ANALYTICS_FILE_PATH"),
+		HTTPURL:    os.Getenv("ANALYTICS_HTTP_URL"),
+		HTTPToken:  os.Getenv("ANALYTICS_HTTP_TOKEN"),
+	}
+}
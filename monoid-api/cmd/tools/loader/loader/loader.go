@@ -1,12 +1,14 @@
 package loader
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/imageverify"
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/specimport"
 	"github.com/rs/zerolog/log"
@@ -24,6 +26,8 @@ func LoadSpecs(conf *config.BaseConfig, configPath string) {
 		panic(err)
 	}
 
+	registry := imageverify.NewRegistry()
+
 	for _, s := range manifestSpecs {
 		schema, err := json.Marshal(s.Spec)
 		if err != nil {
@@ -40,33 +44,104 @@ func LoadSpecs(conf *config.BaseConfig, configPath string) {
 		}
 
 		newSiloSpec := model.SiloSpecification{
-			ID:          s.ID,
-			Name:        s.Name,
-			LogoURL:     logoUrl,
-			DockerImage: s.DockerImage,
-			DockerTag:   s.DockerTag,
-			Schema:      &schemaStr,
-			Manual:      s.Manual,
+			ID:              s.ID,
+			Name:            s.Name,
+			LogoURL:         logoUrl,
+			DockerImage:     s.DockerImage,
+			DockerTag:       s.DockerTag,
+			DockerDigest:    s.DockerDigest,
+			Schema:          &schemaStr,
+			Manual:          s.Manual,
+			ExecutionPolicy: s.ExecutionPolicy,
+			ExecutionLimits: s.ExecutionLimits,
+			RequestBatching: s.RequestBatching,
+			RunProfile:      s.RunProfile,
 		}
 
 		siloSpec := model.SiloSpecification{}
-		if err := conf.DB.Where("id = ?", s.ID).First(&siloSpec).Error; err != nil {
+		exists := conf.DB.Where("id = ?", s.ID).First(&siloSpec).Error == nil
+
+		if newSiloSpec.DockerDigest != nil {
+			if err := model.ValidateDockerDigest(*newSiloSpec.DockerDigest); err != nil {
+				fmt.Printf("Error registering %s: %v\n", s.Name, err)
+				break
+			}
+		} else if !s.Manual {
+			// The image is pinned to the digest its tag points to now, so
+			// it can't be replaced by re-tagging it.
+			digest, err := registry.ResolveDigest(context.Background(), s.DockerImage, s.DockerTag)
+			if err == nil {
+				newSiloSpec.DockerDigest = &digest
+			} else if exists && siloSpec.DockerImage == s.DockerImage && siloSpec.DockerTag == s.DockerTag {
+				// The tag hasn't changed, so the specification stays on the
+				// digest it already has.
+				fmt.Printf(
+					"Could not resolve the digest of %s:%s, keeping its current digest: %v\n",
+					s.DockerImage, s.DockerTag, err,
+				)
+
+				newSiloSpec.DockerDigest = siloSpec.DockerDigest
+			} else {
+				fmt.Printf(
+					"Error registering %s: could not resolve the digest of %s:%s: %v\n",
+					s.Name, s.DockerImage, s.DockerTag, err,
+				)
+
+				continue
+			}
+		}
+
+		if !exists {
 			if err := conf.DB.Create(&newSiloSpec).Error; err != nil {
 				fmt.Printf("Error registering %s: %v\n", s.Name, err)
 				break
 			}
 		} else {
+			// The silos of the specification keep running the version they
+			// were configured against until they're upgraded.
+			if siloSpec.VersionChanged(&newSiloSpec) {
+				if err := model.AssignSiloSpecificationVersion(conf.DB, &siloSpec); err != nil {
+					fmt.Printf("Error registering %s: %v\n", s.Name, err)
+					break
+				}
+			}
+
 			if err := conf.DB.Updates(&newSiloSpec).Error; err != nil {
 				fmt.Printf("Error registering %s: %v\n", s.Name, err)
 				break
 			}
+
+			// Updates skips nil fields, so the digest is set separately to
+			// clear a digest from an older tag.
+			if err := conf.DB.Model(&newSiloSpec).Update("docker_digest", newSiloSpec.DockerDigest).Error; err != nil {
+				fmt.Printf("Error registering %s: %v\n", s.Name, err)
+				break
+			}
+		}
+
+		version := 0
+		if !newSiloSpec.Manual {
+			v, err := model.RecordSiloSpecificationVersion(conf.DB, &newSiloSpec)
+			if err != nil {
+				fmt.Printf("Error registering %s: %v\n", s.Name, err)
+				break
+			}
+
+			version = v.Version
+		}
+
+		digest := ""
+		if newSiloSpec.DockerDigest != nil {
+			digest = "@" + *newSiloSpec.DockerDigest
 		}
 
 		fmt.Printf(
-			"Successfully registered %s (%s:%s)\n",
+			"Successfully registered %s (%s:%s%s, version %d)\n",
 			newSiloSpec.Name,
 			newSiloSpec.DockerImage,
 			newSiloSpec.DockerTag,
+			digest,
+			version,
 		)
 	}
 }
@@ -94,9 +169,22 @@ func LoadCategories(conf *config.BaseConfig, configPath string) {
 			continue
 		}
 
-		if err := conf.DB.Updates(&yamlCat).Error; err != nil {
+		// The export policy is only set when the category doesn't have one, so
+		// changes made in the app aren't overwritten.
+		if err := conf.DB.Omit("ExportPolicy").Updates(&yamlCat).Error; err != nil {
 			log.Err(err).Msgf("Error updating category: %s", yamlCat.Name)
 			continue
 		}
+
+		if yamlCat.ExportPolicy == nil {
+			continue
+		}
+
+		if err := conf.DB.Model(&model.Category{}).Where(
+			"id = ? AND export_policy IS NULL",
+			yamlCat.ID,
+		).Update("export_policy", *yamlCat.ExportPolicy).Error; err != nil {
+			log.Err(err).Msgf("Error setting export policy for category: %s", yamlCat.Name)
+		}
 	}
 }
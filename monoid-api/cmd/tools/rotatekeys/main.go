@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/monoid-privacy/monoid/cmd"
+	"github.com/monoid-privacy/monoid/filestore/encryptedstore"
+	"github.com/monoid-privacy/monoid/keyrotation"
+	"github.com/rs/zerolog/log"
+)
+
+// rotatekeys re-encrypts every secret and stored file with the current
+// ENCRYPTION_KEY. The keys being rotated out must be set in
+// PREVIOUS_ENCRYPTION_KEYS until the tool has completed successfully.
+func main() {
+	batchSize := flag.Int("batch-size", 500, "number of rows to read at a time")
+	skipFiles := flag.Bool("skip-files", false, "only re-encrypt database secrets")
+	flag.Parse()
+
+	conf := cmd.GetBaseConfig(nil)
+	defer conf.AnalyticsIngestor.Close()
+
+	failed := false
+
+	res, err := keyrotation.ReencryptSecrets(conf.DB, cmd.Models, *batchSize)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error re-encrypting secrets")
+	}
+
+	log.Info().Msgf(
+		"Re-encrypted %d of %d secrets, %d changed while running, %d failed",
+		res.Reencrypted, res.Checked, res.Changed, res.Failed,
+	)
+	failed = failed || res.Failed > 0
+
+	if !*skipFiles {
+		store, ok := conf.FileStore.(encryptedstore.KeyedFileStore)
+		if !ok {
+			log.Warn().Msg("File encryption is disabled, skipping files")
+		} else {
+			res, err := keyrotation.ReencryptFiles(context.Background(), conf.DB, store)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Error re-encrypting files")
+			}
+
+			log.Info().Msgf("Re-encrypted %d of %d files, %d failed", res.Reencrypted, res.Checked, res.Failed)
+			failed = failed || res.Failed > 0
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
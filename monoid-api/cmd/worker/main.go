@@ -1,29 +1,49 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/monoid-privacy/monoid/cmd"
 	mworker "github.com/monoid-privacy/monoid/cmd/worker/worker"
+	"github.com/monoid-privacy/monoid/telemetry"
 	"github.com/monoid-privacy/monoid/workflow"
 	"github.com/rs/zerolog"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/worker"
 	zerologadapter "logur.dev/adapter/zerolog"
 	"logur.dev/logur"
 )
 
+const defaultMetricsPort = "9090"
+
 func main() {
 	conf := cmd.GetBaseConfig(nil)
 	defer conf.AnalyticsIngestor.Close()
 
 	logger := logur.LoggerToKV(zerologadapter.New(zerolog.New(os.Stdout).Level(zerolog.InfoLevel)))
 
-	// Create the client object just once per process
+	shutdownTracing, err := telemetry.SetupTracing(context.Background(), "monoid-worker")
+	if err != nil {
+		log.Fatalln("unable to set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = defaultMetricsPort
+	}
+
+	telemetry.ServeMetrics(":" + metricsPort)
+
+	// Create the client object just once per process. The tracing interceptor
+	// is used by the worker as well as the client.
 	c, err := client.Dial(client.Options{
-		HostPort: os.Getenv("TEMPORAL"),
-		Logger:   logger,
+		HostPort:     os.Getenv("TEMPORAL"),
+		Logger:       logger,
+		Interceptors: []interceptor.ClientInterceptor{telemetry.TemporalInterceptor()},
 	})
 
 	if err != nil {
@@ -22,13 +22,25 @@ func DefaultActivites(conf *config.BaseConfig) []interface{} {
 		a.ValidateDataSiloDef,
 		a.DetectDataSources,
 		a.FindOrCreateJob,
+		a.FindExecutionPolicy,
+		a.FindExecutionLimits,
+		a.AcquireExecutionSlot,
+		a.ReleaseExecutionSlot,
 		a.UpdateJobStatus,
+		a.InferLineage,
+		a.FindSilosToUpgrade,
+		a.UpgradeSiloDefinition,
 		ra.UpdateRequestStatusActivity,
 		ra.FindDBSilos,
 		ra.ProcessRequestResults,
 		ra.RequestStatusActivity,
 		ra.StartSiloRequestActivity,
+		ra.StartSiloBatchRequestActivity,
+		ra.EnqueueBatchRequestActivity,
 		ra.BatchUpdateRequestStatusActivity,
+		ra.VerifyDeletionActivity,
+		ra.RecomputeRequestStatusActivity,
+		ra.FinishJobProgressActivity,
 	}
 }
 
@@ -44,8 +56,11 @@ func DefaultWorkflows(conf *config.BaseConfig) []interface{} {
 	return []interface{}{
 		mwf.ValidateDSWorkflow,
 		mwf.DetectDSWorkflow,
+		mwf.InferLineageWorkflow,
+		mwf.UpgradeSilosWorkflow,
 		rmwf.ExecuteRequestWorkflow,
 		rmwf.ExecuteSiloRequestWorkflow,
+		rmwf.ExecuteSiloBatchWorkflow,
 	}
 }
 
@@ -1,11 +1,13 @@
 package config
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/monoid-privacy/monoid/analytics/ingestor"
 	"github.com/monoid-privacy/monoid/filestore"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/monoid-privacy/monoid/secrets"
 	"go.temporal.io/sdk/client"
 	"gorm.io/gorm"
 )
@@ -20,6 +22,22 @@ type BaseConfig struct {
 	AnalyticsIngestor ingestor.Ingestor
 	EncryptionKey     []byte
 	ResourcePath      string
+	SecretResolver    *secrets.Resolver
+}
+
+// ResolveSiloConfig replaces the secret references in a silo's config with
+// their values. It should be called right before the config is passed to a
+// connector, and the result should never be stored.
+func (c BaseConfig) ResolveSiloConfig(
+	ctx context.Context,
+	conf map[string]interface{},
+) (map[string]interface{}, error) {
+	resolver := c.SecretResolver
+	if resolver == nil {
+		resolver = secrets.NewResolver()
+	}
+
+	return resolver.Resolve(ctx, conf)
 }
 
 func (c BaseConfig) PreFlightHandler(next http.Handler) http.Handler {
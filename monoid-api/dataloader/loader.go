@@ -6,6 +6,7 @@ import (
 
 	"github.com/graph-gophers/dataloader"
 	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/telemetry"
 )
 
 type ctxKey string
@@ -37,17 +38,25 @@ func NewLoaders(conf *config.BaseConfig) *Loaders {
 	reader := &Reader{conf: conf}
 
 	loaders := &Loaders{
-		PropertyCategoriesLoader:   dataloader.NewBatchedLoader(reader.propertiesCategories),
-		SiloDefinitionLoader:       dataloader.NewBatchedLoader(reader.siloDefinitions),
-		DataSourcePropertiesLoader: dataloader.NewBatchedLoader(reader.dataSourcesProperties),
-		DataSourceLoader:           dataloader.NewBatchedLoader(reader.dataSources),
-		QueryResultLoader:          dataloader.NewBatchedLoader(reader.queryResults),
-		SiloSpecificationLoader:    dataloader.NewBatchedLoader(reader.siloSpecifications),
-		JobLoader:                  dataloader.NewBatchedLoader(reader.jobs),
+		PropertyCategoriesLoader:   newLoader("property_categories", reader.propertiesCategories),
+		SiloDefinitionLoader:       newLoader("silo_definitions", reader.siloDefinitions),
+		DataSourcePropertiesLoader: newLoader("data_source_properties", reader.dataSourcesProperties),
+		DataSourceLoader:           newLoader("data_sources", reader.dataSources),
+		QueryResultLoader:          newLoader("query_results", reader.queryResults),
+		SiloSpecificationLoader:    newLoader("silo_specifications", reader.siloSpecifications),
+		JobLoader:                  newLoader("jobs", reader.jobs),
 	}
 	return loaders
 }
 
+// newLoader creates a batched loader that records the size of its batches.
+func newLoader(name string, fn dataloader.BatchFunc) *dataloader.Loader {
+	return dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		telemetry.DataloaderBatchSize.WithLabelValues(name).Observe(float64(len(keys)))
+		return fn(ctx, keys)
+	})
+}
+
 // Middleware injects data loaders into the context
 func Middleware(conf *config.BaseConfig, next http.Handler) http.Handler {
 	loaders := NewLoaders(conf)
@@ -1,4 +1,4 @@
-package resolver
+package discovery
 
 import (
 	"encoding/json"
@@ -36,7 +36,10 @@ func propertiesForDiscoveries(discoveries []model.NewPropertyDiscovery) []*model
 	return properties
 }
 
-func applyDiscoveries(
+// ApplyDiscoveries accepts or rejects each of the discoveries, updating the data map
+// accordingly. It returns the discoveries that were successfully applied, along with
+// any errors encountered.
+func ApplyDiscoveries(
 	conf *config.BaseConfig,
 	discoveries []*model.DataDiscovery,
 	action model.DiscoveryAction,
@@ -87,7 +90,12 @@ func applyDiscoveries(
 					return err
 				}
 
-				return nil
+				prop := model.Property{}
+				if err := tx.Where("id = ?", *data.PropertyID).First(&prop).Error; err != nil {
+					return err
+				}
+
+				return SnapshotDataSource(tx, prop.DataSourceID, &discovery.ID)
 			}); err != nil {
 				log.Err(err).Msgf("Error updating %s", discovery.ID)
 				errors = append(errors, err)
@@ -120,7 +128,7 @@ func applyDiscoveries(
 					return err
 				}
 
-				return nil
+				return SnapshotDataSource(tx, dataSource.ID, &discovery.ID)
 			}); err != nil {
 				log.Err(err).Msgf("Error updating %s", discovery.ID)
 				errors = append(errors, err)
@@ -148,7 +156,7 @@ func applyDiscoveries(
 					return err
 				}
 
-				return nil
+				return SnapshotDataSource(tx, prop.DataSourceID, &discovery.ID)
 			}); err != nil {
 				log.Err(err).Msgf("Error updating %s", discovery.ID)
 				errors = append(errors, err)
@@ -194,6 +202,33 @@ func applyDiscoveries(
 					return err
 				}
 
+				return SnapshotDataSource(tx, data.ID, &discovery.ID)
+			}); err != nil {
+				log.Err(err).Msgf("Error updating %s", discovery.ID)
+				errors = append(errors, err)
+				continue
+			}
+		case model.DiscoveryTypePrimaryKeyLink:
+			data := model.PrimaryKeyLinkDiscovery{}
+			if err := json.Unmarshal(discovery.Data, &data); err != nil {
+				log.Err(err).Msgf("Error updating %s", discovery.ID)
+				errors = append(errors, err)
+				continue
+			}
+
+			if err := conf.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&model.Property{}).Where(
+					"id = ?", data.PropertyID,
+				).Update("user_primary_key_id", data.UserPrimaryKeyID).Error; err != nil {
+					return err
+				}
+
+				if err := tx.Model(&discovery).Update(
+					"status", model.DiscoveryStatusAccepted,
+				).Error; err != nil {
+					return err
+				}
+
 				return nil
 			}); err != nil {
 				log.Err(err).Msgf("Error updating %s", discovery.ID)
@@ -209,6 +244,11 @@ func applyDiscoveries(
 			}
 
 			if err := conf.DB.Transaction(func(tx *gorm.DB) error {
+				prop := model.Property{}
+				if err := tx.Unscoped().Where("id = ?", data.ID).First(&prop).Error; err != nil {
+					return err
+				}
+
 				if err := tx.Select("Categories").Delete(&model.Property{ID: data.ID}).Error; err != nil {
 					return err
 				}
@@ -219,7 +259,7 @@ func applyDiscoveries(
 					return err
 				}
 
-				return nil
+				return SnapshotDataSource(tx, prop.DataSourceID, &discovery.ID)
 			}); err != nil {
 				log.Err(err).Msgf("Error updating %s", discovery.ID)
 				errors = append(errors, err)
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/monoid-privacy/monoid/model"
+)
+
+// PolicyTarget is the information about a discovery that is used to
+// evaluate discovery policies.
+type PolicyTarget struct {
+	Type model.DiscoveryType
+
+	// SchemaName and SchemaGroup identify the data source that the discovery
+	// refers to. SchemaName is empty if the data source could not be determined.
+	SchemaName  string
+	SchemaGroup *string
+
+	// Confidence is only set for category discoveries.
+	Confidence *model.DiscoveryConfidence
+}
+
+// SortPolicies orders policies in the order they should be evaluated: by
+// descending priority, with silo-specific policies before workspace-wide ones.
+func SortPolicies(policies []*model.DiscoveryPolicy) {
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Priority != policies[j].Priority {
+			return policies[i].Priority > policies[j].Priority
+		}
+
+		return policies[i].SiloDefinitionID != nil && policies[j].SiloDefinitionID == nil
+	})
+}
+
+// MatchPolicy returns the first policy in policies that matches the target,
+// or nil if none match. policies should already be sorted with SortPolicies.
+func MatchPolicy(policies []*model.DiscoveryPolicy, target PolicyTarget) *model.DiscoveryPolicy {
+	for _, p := range policies {
+		if policyMatches(p, target) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func policyMatches(p *model.DiscoveryPolicy, target PolicyTarget) bool {
+	if p.DiscoveryType != nil && *p.DiscoveryType != target.Type {
+		return false
+	}
+
+	if p.MinConfidence != nil {
+		if target.Confidence == nil || target.Confidence.Rank() < p.MinConfidence.Rank() {
+			return false
+		}
+	}
+
+	if p.SchemaPattern != nil {
+		if target.SchemaName == "" {
+			return false
+		}
+
+		names := []string{target.SchemaName}
+		if target.SchemaGroup != nil {
+			names = append(names, *target.SchemaGroup+"."+target.SchemaName)
+		}
+
+		matched := false
+		for _, n := range names {
+			if likeMatch(*p.SchemaPattern, n) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// likeMatch returns true if s matches the SQL LIKE pattern, where % matches
+// any sequence of characters, _ matches a single character, and \ escapes
+// the next character.
+func likeMatch(pattern string, s string) bool {
+	expr := strings.Builder{}
+	expr.WriteString("^")
+
+	escaped := false
+	for _, c := range pattern {
+		if escaped {
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+			continue
+		}
+
+		switch c {
+		case '\\':
+			escaped = true
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	re, err := regexp.Compile("(?s)" + expr.String())
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(s)
+}
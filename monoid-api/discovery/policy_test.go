@@ -0,0 +1,120 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestLikeMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{pattern: "tmp_%", s: "tmp_users", match: true},
+		{pattern: "tmp_%", s: "tmp", match: false},
+		{pattern: "tmp\\_%", s: "tmpxusers", match: false},
+		{pattern: "tmp\\_%", s: "tmp_users", match: true},
+		{pattern: "%.users", s: "public.users", match: true},
+		{pattern: "users", s: "users_old", match: false},
+		{pattern: "a+b%", s: "a+bc", match: true},
+	} {
+		assert.Equal(t, tc.match, likeMatch(tc.pattern, tc.s), "%s ~ %s", tc.pattern, tc.s)
+	}
+}
+
+func TestMatchPolicy(t *testing.T) {
+	categoryFound := model.DiscoveryTypeCategoryFound
+	sourceFound := model.DiscoveryTypeDataSourceFound
+
+	rejectTmp := &model.DiscoveryPolicy{
+		ID:            "reject_tmp",
+		Action:        model.DiscoveryActionReject,
+		SchemaPattern: ptr("tmp_%"),
+		Priority:      10,
+	}
+
+	acceptSources := &model.DiscoveryPolicy{
+		ID:            "accept_sources",
+		Action:        model.DiscoveryActionAccept,
+		DiscoveryType: &sourceFound,
+	}
+
+	acceptHighCategories := &model.DiscoveryPolicy{
+		ID:            "accept_categories",
+		Action:        model.DiscoveryActionAccept,
+		DiscoveryType: &categoryFound,
+		MinConfidence: ptr(model.DiscoveryConfidenceHigh),
+	}
+
+	siloAcceptAll := &model.DiscoveryPolicy{
+		ID:               "silo_accept_all",
+		Action:           model.DiscoveryActionAccept,
+		SiloDefinitionID: ptr("silo"),
+		SchemaPattern:    ptr("public.%"),
+	}
+
+	policies := []*model.DiscoveryPolicy{
+		acceptSources, acceptHighCategories, siloAcceptAll, rejectTmp,
+	}
+	SortPolicies(policies)
+
+	assert.Equal(t, []*model.DiscoveryPolicy{
+		rejectTmp, siloAcceptAll, acceptSources, acceptHighCategories,
+	}, policies)
+
+	for _, tc := range []struct {
+		name   string
+		target PolicyTarget
+		policy *model.DiscoveryPolicy
+	}{
+		{
+			name:   "tmp_source",
+			target: PolicyTarget{Type: sourceFound, SchemaName: "tmp_1"},
+			policy: rejectTmp,
+		},
+		{
+			name:   "source",
+			target: PolicyTarget{Type: sourceFound, SchemaName: "users"},
+			policy: acceptSources,
+		},
+		{
+			name:   "grouped",
+			target: PolicyTarget{Type: categoryFound, SchemaName: "users", SchemaGroup: ptr("public")},
+			policy: siloAcceptAll,
+		},
+		{
+			name: "high_confidence",
+			target: PolicyTarget{
+				Type:       categoryFound,
+				SchemaName: "users",
+				Confidence: ptr(model.DiscoveryConfidenceHigh),
+			},
+			policy: acceptHighCategories,
+		},
+		{
+			name: "low_confidence",
+			target: PolicyTarget{
+				Type:       categoryFound,
+				SchemaName: "users",
+				Confidence: ptr(model.DiscoveryConfidenceMedium),
+			},
+			policy: nil,
+		},
+		{
+			name:   "unknown_source",
+			target: PolicyTarget{Type: model.DiscoveryTypePropertyMissing},
+			policy: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.policy, MatchPolicy(policies, tc.target))
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/monoid-privacy/monoid/lineage"
+	"github.com/monoid-privacy/monoid/model"
+)
+
+// minPrimaryKeyOverlap is the minimum fraction of sampled values that a property
+// must share with a linked property to be suggested as a link to the same key.
+const minPrimaryKeyOverlap = 0.5
+
+// PrimaryKeyCandidate is a property that could be linked to a user primary key.
+type PrimaryKeyCandidate struct {
+	PropertyID  string
+	Name        string
+	CategoryIDs []string
+	Hashes      []string
+}
+
+// LinkedSample is the sampled value hashes of a property that is already linked
+// to a user primary key.
+type LinkedSample struct {
+	PropertyName     string
+	UserPrimaryKeyID string
+	Hashes           []string
+}
+
+// normalizeIdentifier lower-cases the identifier and removes separators,
+// so that e.g. userId and user_id are treated as the same.
+func normalizeIdentifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == ' ' || r == '.' {
+			return -1
+		}
+
+		return r
+	}, strings.ToLower(s))
+}
+
+type primaryKeySuggestion struct {
+	confidence model.DiscoveryConfidence
+	reasons    []string
+}
+
+func (s *primaryKeySuggestion) add(confidence model.DiscoveryConfidence, reason string) {
+	if confidence.Rank() > s.confidence.Rank() {
+		s.confidence = confidence
+	}
+
+	s.reasons = append(s.reasons, reason)
+}
+
+// SuggestPrimaryKeyLinks suggests links between the candidate properties and user primary keys
+// based on the property names, their categories, and overlap between their sampled values and
+// those of properties already linked to a key. At most one key is suggested per property.
+func SuggestPrimaryKeyLinks(
+	candidates []PrimaryKeyCandidate,
+	keys []*model.UserPrimaryKey,
+	linked []LinkedSample,
+) []model.PrimaryKeyLinkDiscovery {
+	res := []model.PrimaryKeyLinkDiscovery{}
+
+	for _, c := range candidates {
+		name := normalizeIdentifier(c.Name)
+		suggestions := map[string]*primaryKeySuggestion{}
+
+		suggestion := func(keyID string) *primaryKeySuggestion {
+			if _, ok := suggestions[keyID]; !ok {
+				suggestions[keyID] = &primaryKeySuggestion{}
+			}
+
+			return suggestions[keyID]
+		}
+
+		for _, k := range keys {
+			identifiers := []string{normalizeIdentifier(k.APIIdentifier), normalizeIdentifier(k.Name)}
+
+			for _, id := range identifiers {
+				if id == "" {
+					continue
+				}
+
+				if name == id {
+					suggestion(k.ID).add(model.DiscoveryConfidenceHigh, fmt.Sprintf(
+						"column name matches %s", k.Name,
+					))
+					break
+				}
+
+				// Very short identifiers (e.g. id) would match too many columns.
+				if len(id) >= 3 && (strings.HasPrefix(name, id) || strings.HasSuffix(name, id)) {
+					suggestion(k.ID).add(model.DiscoveryConfidenceMedium, fmt.Sprintf(
+						"column name contains %s", k.Name,
+					))
+					break
+				}
+			}
+
+			for _, cat := range c.CategoryIDs {
+				if normalizeIdentifier(cat) == normalizeIdentifier(k.APIIdentifier) {
+					suggestion(k.ID).add(model.DiscoveryConfidenceMedium, fmt.Sprintf(
+						"column is categorized as %s", cat,
+					))
+					break
+				}
+			}
+		}
+
+		for _, l := range linked {
+			if len(c.Hashes) == 0 {
+				break
+			}
+
+			overlap := lineage.ValueOverlap(c.Hashes, l.Hashes)
+			if overlap < minPrimaryKeyOverlap {
+				continue
+			}
+
+			suggestion(l.UserPrimaryKeyID).add(model.DiscoveryConfidenceHigh, fmt.Sprintf(
+				"%.0f%% of sampled values match linked column %s", overlap*100, l.PropertyName,
+			))
+		}
+
+		// Pick the most confident suggestion, breaking ties by the number of reasons
+		// and then the key ID, so that the result is deterministic.
+		keyIDs := make([]string, 0, len(suggestions))
+		for id := range suggestions {
+			keyIDs = append(keyIDs, id)
+		}
+
+		if len(keyIDs) == 0 {
+			continue
+		}
+
+		sort.Slice(keyIDs, func(i, j int) bool {
+			a, b := suggestions[keyIDs[i]], suggestions[keyIDs[j]]
+			if a.confidence.Rank() != b.confidence.Rank() {
+				return a.confidence.Rank() > b.confidence.Rank()
+			}
+
+			if len(a.reasons) != len(b.reasons) {
+				return len(a.reasons) > len(b.reasons)
+			}
+
+			return keyIDs[i] < keyIDs[j]
+		})
+
+		best := suggestions[keyIDs[0]]
+
+		res = append(res, model.PrimaryKeyLinkDiscovery{
+			PropertyID:       c.PropertyID,
+			UserPrimaryKeyID: keyIDs[0],
+			Reason:           strings.Join(best.reasons, ", "),
+			Confidence:       best.confidence,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestPrimaryKeyLinks(t *testing.T) {
+	keys := []*model.UserPrimaryKey{
+		{ID: "email_key", Name: "Email", APIIdentifier: "email"},
+		{ID: "user_id_key", Name: "User ID", APIIdentifier: "user_id"},
+	}
+
+	linked := []LinkedSample{{
+		PropertyName:     "uid",
+		UserPrimaryKeyID: "user_id_key",
+		Hashes:           []string{"a", "b", "c", "d"},
+	}}
+
+	links := SuggestPrimaryKeyLinks([]PrimaryKeyCandidate{
+		{PropertyID: "exact", Name: "Email"},
+		{PropertyID: "contains", Name: "customer_email"},
+		{PropertyID: "camel", Name: "userId"},
+		{PropertyID: "category", Name: "contact", CategoryIDs: []string{"email"}},
+		{PropertyID: "values", Name: "account", Hashes: []string{"a", "b", "x"}},
+		{PropertyID: "few_values", Name: "account_2", Hashes: []string{"a", "x", "y"}},
+		{PropertyID: "none", Name: "created_at"},
+	}, keys, linked)
+
+	res := map[string]model.PrimaryKeyLinkDiscovery{}
+	for _, l := range links {
+		res[l.PropertyID] = l
+	}
+
+	assert.Len(t, res, 5)
+
+	for _, tc := range []struct {
+		propertyID string
+		keyID      string
+		confidence model.DiscoveryConfidence
+	}{
+		{"exact", "email_key", model.DiscoveryConfidenceHigh},
+		{"contains", "email_key", model.DiscoveryConfidenceMedium},
+		{"camel", "user_id_key", model.DiscoveryConfidenceHigh},
+		{"category", "email_key", model.DiscoveryConfidenceMedium},
+		{"values", "user_id_key", model.DiscoveryConfidenceHigh},
+	} {
+		l, ok := res[tc.propertyID]
+		if !assert.True(t, ok, tc.propertyID) {
+			continue
+		}
+
+		assert.Equal(t, tc.keyID, l.UserPrimaryKeyID, tc.propertyID)
+		assert.Equal(t, tc.confidence, l.Confidence, tc.propertyID)
+		assert.NotEmpty(t, l.Reason, tc.propertyID)
+	}
+}
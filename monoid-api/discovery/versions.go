@@ -0,0 +1,158 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"gorm.io/gorm"
+)
+
+// newSnapshot builds a snapshot of the data source. The properties and categories are
+// sorted so that snapshots of the same data source can be compared.
+func newSnapshot(ds *model.DataSource) model.DataSourceSnapshot {
+	snapshot := model.DataSourceSnapshot{
+		Name:       ds.Name,
+		Group:      ds.Group,
+		Deleted:    ds.DeletedAt.Valid,
+		Properties: []model.PropertySnapshot{},
+	}
+
+	if snapshot.Deleted {
+		return snapshot
+	}
+
+	for _, p := range ds.Properties {
+		categoryIDs := make([]string, len(p.Categories))
+		for i, c := range p.Categories {
+			categoryIDs[i] = c.ID
+		}
+
+		sort.Strings(categoryIDs)
+
+		snapshot.Properties = append(snapshot.Properties, model.PropertySnapshot{
+			ID:          p.ID,
+			Name:        p.Name,
+			CategoryIDs: categoryIDs,
+		})
+	}
+
+	sort.Slice(snapshot.Properties, func(i, j int) bool {
+		return snapshot.Properties[i].Name < snapshot.Properties[j].Name
+	})
+
+	return snapshot
+}
+
+// SnapshotDataSource records a new version of the data source if it has changed since
+// the last version was taken. discoveryID is the discovery that caused the change, if any.
+func SnapshotDataSource(db *gorm.DB, dataSourceID string, discoveryID *string) error {
+	ds := model.DataSource{}
+	if err := db.Unscoped().Where("id = ?", dataSourceID).First(&ds).Error; err != nil {
+		return err
+	}
+
+	if !ds.DeletedAt.Valid {
+		if err := db.Preload("Categories").Where(
+			"data_source_id = ?", dataSourceID,
+		).Find(&ds.Properties).Error; err != nil {
+			return err
+		}
+	}
+
+	snapshot, err := json.Marshal(newSnapshot(&ds))
+	if err != nil {
+		return err
+	}
+
+	prev := model.DataSourceVersion{}
+	version := 1
+
+	if err := db.Where("data_source_id = ?", dataSourceID).Order(
+		"version desc",
+	).First(&prev).Error; err == nil {
+		if bytes.Equal(prev.Snapshot, snapshot) {
+			return nil
+		}
+
+		version = prev.Version + 1
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return db.Create(&model.DataSourceVersion{
+		ID:              uuid.NewString(),
+		DataSourceID:    dataSourceID,
+		Version:         version,
+		DataDiscoveryID: discoveryID,
+		Snapshot:        snapshot,
+	}).Error
+}
+
+// DiffSnapshots returns the properties that were added, removed, or had their
+// categories changed between the from and to snapshots.
+func DiffSnapshots(from model.DataSourceSnapshot, to model.DataSourceSnapshot) model.DataSourceVersionDiff {
+	diff := model.DataSourceVersionDiff{
+		AddedProperties:   []model.PropertySnapshot{},
+		RemovedProperties: []model.PropertySnapshot{},
+		ChangedProperties: []model.PropertyCategoryDiff{},
+	}
+
+	fromProps := map[string]model.PropertySnapshot{}
+	for _, p := range from.Properties {
+		fromProps[p.Name] = p
+	}
+
+	toProps := map[string]bool{}
+
+	for _, p := range to.Properties {
+		toProps[p.Name] = true
+
+		prev, ok := fromProps[p.Name]
+		if !ok {
+			diff.AddedProperties = append(diff.AddedProperties, p)
+			continue
+		}
+
+		added := difference(p.CategoryIDs, prev.CategoryIDs)
+		removed := difference(prev.CategoryIDs, p.CategoryIDs)
+
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		diff.ChangedProperties = append(diff.ChangedProperties, model.PropertyCategoryDiff{
+			Name:               p.Name,
+			AddedCategoryIDs:   added,
+			RemovedCategoryIDs: removed,
+		})
+	}
+
+	for _, p := range from.Properties {
+		if !toProps[p.Name] {
+			diff.RemovedProperties = append(diff.RemovedProperties, p)
+		}
+	}
+
+	return diff
+}
+
+// difference returns the elements of a that are not in b.
+func difference(a []string, b []string) []string {
+	bSet := map[string]bool{}
+	for _, v := range b {
+		bSet[v] = true
+	}
+
+	res := []string{}
+	for _, v := range a {
+		if !bSet[v] {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	ds := model.DataSource{
+		Name:  "users",
+		Group: ptr("public"),
+		Properties: []*model.Property{
+			{ID: "2", Name: "name", Categories: []*model.Category{{ID: "surname"}, {ID: "first_name"}}},
+			{ID: "1", Name: "email", Categories: []*model.Category{{ID: "email"}}},
+		},
+	}
+
+	assert.Equal(t, model.DataSourceSnapshot{
+		Name:  "users",
+		Group: ptr("public"),
+		Properties: []model.PropertySnapshot{
+			{ID: "1", Name: "email", CategoryIDs: []string{"email"}},
+			{ID: "2", Name: "name", CategoryIDs: []string{"first_name", "surname"}},
+		},
+	}, newSnapshot(&ds))
+
+	ds.DeletedAt = gorm.DeletedAt{Valid: true}
+
+	assert.Equal(t, model.DataSourceSnapshot{
+		Name:       "users",
+		Group:      ptr("public"),
+		Deleted:    true,
+		Properties: []model.PropertySnapshot{},
+	}, newSnapshot(&ds))
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from := model.DataSourceSnapshot{
+		Name: "users",
+		Properties: []model.PropertySnapshot{
+			{ID: "1", Name: "email", CategoryIDs: []string{}},
+			{ID: "2", Name: "name", CategoryIDs: []string{"first_name"}},
+			{ID: "3", Name: "created_at", CategoryIDs: []string{}},
+		},
+	}
+
+	to := model.DataSourceSnapshot{
+		Name: "users",
+		Properties: []model.PropertySnapshot{
+			{ID: "1", Name: "email", CategoryIDs: []string{"email"}},
+			{ID: "2", Name: "name", CategoryIDs: []string{"surname"}},
+			{ID: "4", Name: "ssn", CategoryIDs: []string{"ssn"}},
+		},
+	}
+
+	assert.Equal(t, model.DataSourceVersionDiff{
+		AddedProperties: []model.PropertySnapshot{
+			{ID: "4", Name: "ssn", CategoryIDs: []string{"ssn"}},
+		},
+		RemovedProperties: []model.PropertySnapshot{
+			{ID: "3", Name: "created_at", CategoryIDs: []string{}},
+		},
+		ChangedProperties: []model.PropertyCategoryDiff{
+			{Name: "email", AddedCategoryIDs: []string{"email"}, RemovedCategoryIDs: []string{}},
+			{Name: "name", AddedCategoryIDs: []string{"surname"}, RemovedCategoryIDs: []string{"first_name"}},
+		},
+	}, DiffSnapshots(from, to))
+
+	assert.Equal(t, model.DataSourceVersionDiff{
+		AddedProperties:   []model.PropertySnapshot{},
+		RemovedProperties: []model.PropertySnapshot{},
+		ChangedProperties: []model.PropertyCategoryDiff{},
+	}, DiffSnapshots(to, to))
+}
@@ -0,0 +1,112 @@
+package download
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"gorm.io/gorm"
+)
+
+// GrantOptions configures a new download grant.
+type GrantOptions struct {
+	// TTL is how long the link is valid for. Defaults to DefaultLinkTTL.
+	TTL time.Duration
+	// MaxDownloads limits the number of times the file can be downloaded
+	// through the link, if set.
+	MaxDownloads *int
+	// Public links are meant for the data subject, and require a one-time code.
+	Public bool
+}
+
+// NewGrant is a newly created download grant, along with its signed path and,
+// for public grants, the one-time code. The code is not stored, so it can't
+// be retrieved later.
+type NewGrant struct {
+	Grant *model.DownloadGrant
+	Path  string
+	Code  *string
+}
+
+// CreateGrant creates a new download grant for the file, signed with the
+// keyring's primary key.
+func CreateGrant(
+	db *gorm.DB,
+	kr *model.Keyring,
+	downloadableFileID string,
+	requestID *string,
+	opts GrantOptions,
+) (*NewGrant, error) {
+	if kr == nil {
+		return nil, fmt.Errorf("no signing key configured")
+	}
+
+	key := kr.Primary()
+	keyID := kr.PrimaryID()
+
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = DefaultLinkTTL
+	}
+
+	if ttl < 0 || ttl > MaxLinkTTL {
+		return nil, fmt.Errorf("links must expire within %s", MaxLinkTTL)
+	}
+
+	if opts.MaxDownloads != nil && *opts.MaxDownloads < 1 {
+		return nil, fmt.Errorf("max downloads must be at least 1")
+	}
+
+	grant := model.DownloadGrant{
+		ID:                 uuid.NewString(),
+		DownloadableFileID: downloadableFileID,
+		RequestID:          requestID,
+		ExpiresAt:          time.Now().Add(ttl).Truncate(time.Second),
+		MaxDownloads:       opts.MaxDownloads,
+		Public:             opts.Public,
+		KeyID:              &keyID,
+	}
+
+	res := NewGrant{Grant: &grant}
+
+	if opts.Public {
+		code, err := NewCode()
+		if err != nil {
+			return nil, err
+		}
+
+		hash := HashCode(key, code)
+		grant.CodeHash = &hash
+		res.Code = &code
+	}
+
+	if err := db.Create(&grant).Error; err != nil {
+		return nil, err
+	}
+
+	res.Path = SignedPath(key, grant.ID, grant.ExpiresAt, grant.Public)
+
+	return &res, nil
+}
+
+// RevokeGrant revokes the grant, so the link can no longer be used.
+func RevokeGrant(db *gorm.DB, grantID string) (*model.DownloadGrant, error) {
+	grant := model.DownloadGrant{}
+	if err := db.Where("id = ?", grantID).First(&grant).Error; err != nil {
+		return nil, err
+	}
+
+	if grant.RevokedAt != nil {
+		return &grant, nil
+	}
+
+	now := time.Now()
+	if err := db.Model(&grant).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	grant.RevokedAt = &now
+
+	return &grant, nil
+}
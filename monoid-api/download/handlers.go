@@ -2,46 +2,241 @@ package download
 
 import (
 	"context"
+	"fmt"
+	"html/template"
 	"io"
+	"mime"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/monoid-privacy/monoid/config"
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
+// maxCodeAttempts is the number of incorrect codes that can be entered for a
+// public link before it is revoked.
+const maxCodeAttempts = 5
+
+var codeForm = template.Must(template.New("code").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Download your data</title></head>
+<body>
+<form method="POST">
+<p>Enter the code you were sent to download your data.</p>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<input type="text" name="code" autocomplete="one-time-code" required>
+<button type="submit">Download</button>
+</form>
+</body>
+</html>`))
+
 type DownloadHandler struct {
 	Conf *config.BaseConfig
 }
 
-func (dh *DownloadHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+// logAccess records an attempt to use a grant.
+func (dh *DownloadHandler) logAccess(r *http.Request, grantID string, success bool, reason string) {
+	entry := model.DownloadAccessLog{
+		ID:              uuid.NewString(),
+		DownloadGrantID: grantID,
+		Success:         success,
+		Reason:          reason,
+		RemoteAddr:      r.RemoteAddr,
+		UserAgent:       r.UserAgent(),
+	}
 
-	id, ok := vars["id"]
+	if err := dh.Conf.DB.Create(&entry).Error; err != nil {
+		log.Err(err).Msg("Error logging download access")
+	}
+}
+
+// findGrant verifies the link's signature, and returns the grant if it can still be used.
+func (dh *DownloadHandler) findGrant(w http.ResponseWriter, r *http.Request) (*model.DownloadGrant, bool) {
+	id, ok := mux.Vars(r)["id"]
 	if !ok {
 		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+
+	grant := model.DownloadGrant{}
+	if err := dh.Conf.DB.Where("id = ?", id).First(&grant).Error; err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+
+	q := r.URL.Query()
+	if err := VerifyGrant(
+		model.GetKeyring(), &grant, q.Get("expires"), q.Get("signature"), time.Now(),
+	); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+
+	if grant.RevokedAt != nil {
+		dh.logAccess(r, grant.ID, false, "revoked")
+		w.WriteHeader(http.StatusGone)
+		return nil, false
+	}
+
+	return &grant, true
+}
+
+// serve claims a download from the grant, and writes the file to the response.
+func (dh *DownloadHandler) serve(w http.ResponseWriter, r *http.Request, grant *model.DownloadGrant) {
+	// Claim the download atomically, so concurrent requests can't exceed the limit.
+	res := dh.Conf.DB.Model(&model.DownloadGrant{}).Where("id = ?", grant.ID).Where(
+		"revoked_at IS NULL",
+	).Where("expires_at > ?", time.Now()).Where(
+		"(max_downloads IS NULL OR download_count < max_downloads)",
+	).Update("download_count", gorm.Expr("download_count + 1"))
+
+	if res.Error != nil {
+		log.Err(res.Error).Msg("Error updating download count")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if res.RowsAffected == 0 {
+		dh.logAccess(r, grant.ID, false, "download limit reached")
+		w.WriteHeader(http.StatusGone)
 		return
 	}
 
 	df := model.DownloadableFile{}
-	if err := dh.Conf.DB.Where("id = ?", id).First(&df).Error; err != nil {
+	if err := dh.Conf.DB.Where("id = ?", grant.DownloadableFileID).First(&df).Error; err != nil {
+		dh.logAccess(r, grant.ID, false, "file not found")
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	f, err := dh.Conf.FileStore.NewReader(context.Background(), df.StoragePath, false)
 	if err != nil {
+		dh.logAccess(r, grant.ID, false, "file not found")
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	defer f.Close()
-	w.Header().Set("Content-Disposition", "attachment; filename=\"result.tar.gz\"")
-	w.Header().Set("Content-Type", "application/octet-stream")
+
+	dh.logAccess(r, grant.ID, true, "downloaded")
+
+	fileName := "result.tar.gz"
+	if df.FileName != nil {
+		fileName = *df.FileName
+	}
+
+	contentType := "application/octet-stream"
+	if df.ContentType != nil {
+		contentType = *df.ContentType
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": fileName,
+	}))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
 
 	if _, err := io.Copy(w, f); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Err(err).Msg("Error writing file")
 	}
 }
+
+// HandleDownload serves files through signed operator links.
+func (dh *DownloadHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	grant, ok := dh.findGrant(w, r)
+	if !ok {
+		return
+	}
+
+	if grant.Public {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	dh.serve(w, r, grant)
+}
+
+// HandlePublicDownload serves files through signed links given to data subjects. A GET
+// request shows a form for the one-time code, and the file is served once the form is
+// submitted with the correct code.
+func (dh *DownloadHandler) HandlePublicDownload(w http.ResponseWriter, r *http.Request) {
+	grant, ok := dh.findGrant(w, r)
+	if !ok {
+		return
+	}
+
+	if !grant.Public || grant.CodeHash == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if grant.CodeUsedAt != nil {
+		dh.logAccess(r, grant.ID, false, "code already used")
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodPost {
+		if err := codeForm.Execute(w, map[string]string{}); err != nil {
+			log.Err(err).Msg("Error rendering form")
+		}
+
+		return
+	}
+
+	if !CheckGrantCode(model.GetKeyring(), grant, r.FormValue("code")) {
+		dh.logAccess(r, grant.ID, false, "incorrect code")
+
+		// The attempt is counted, and the grant revoked once there have been
+		// too many, in one statement so concurrent attempts can't get past the
+		// limit.
+		failedAttempts := 0
+		if err := dh.Conf.DB.Raw(
+			"UPDATE download_grants SET failed_attempts = failed_attempts + 1, "+
+				"revoked_at = CASE WHEN failed_attempts + 1 >= ? THEN COALESCE(revoked_at, ?) ELSE revoked_at END "+
+				"WHERE id = ? RETURNING failed_attempts",
+			maxCodeAttempts,
+			time.Now(),
+			grant.ID,
+		).Scan(&failedAttempts).Error; err != nil {
+			log.Err(err).Msg("Error updating failed attempts")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if failedAttempts >= maxCodeAttempts {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		if err := codeForm.Execute(w, map[string]string{
+			"Error": fmt.Sprintf("Incorrect code, %d attempts remaining.", maxCodeAttempts-failedAttempts),
+		}); err != nil {
+			log.Err(err).Msg("Error rendering form")
+		}
+
+		return
+	}
+
+	// Mark the code as used, so it can't be reused. The grant may have been
+	// revoked by a concurrent incorrect attempt.
+	res := dh.Conf.DB.Model(&model.DownloadGrant{}).Where("id = ?", grant.ID).Where(
+		"code_used_at IS NULL AND revoked_at IS NULL",
+	).Update("code_used_at", time.Now())
+
+	if res.Error != nil || res.RowsAffected == 0 {
+		dh.logAccess(r, grant.ID, false, "code already used")
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	dh.serve(w, r, grant)
+}
@@ -0,0 +1,155 @@
+package download
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+)
+
+const (
+	// DefaultLinkTTL is how long download links are valid for if no expiry is given.
+	DefaultLinkTTL = 24 * time.Hour
+	// MaxLinkTTL is the longest that a download link can be valid for.
+	MaxLinkTTL = 7 * 24 * time.Hour
+
+	codeLength = 8
+)
+
+// signingKey derives the key used to sign download links from the encryption key,
+// so that the encryption key isn't used directly for signing.
+func signingKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("monoid-download-links"))
+	return mac.Sum(nil)
+}
+
+// grantKeys returns the keys that the grant may have been signed with. Grants
+// record the ID of the key they were signed with, so their links keep working
+// after the key is rotated, as long as it's still in the keyring. Grants
+// created before the ID was recorded may have been signed with any of the keys.
+func grantKeys(kr *model.Keyring, grant *model.DownloadGrant) [][]byte {
+	if kr == nil {
+		return nil
+	}
+
+	if grant.KeyID == nil {
+		return kr.Keys()
+	}
+
+	key, ok := kr.Key(*grant.KeyID)
+	if !ok {
+		return nil
+	}
+
+	return [][]byte{key}
+}
+
+// VerifyGrant checks the link's signature and expiry time against the keys
+// that the grant may have been signed with.
+func VerifyGrant(
+	kr *model.Keyring,
+	grant *model.DownloadGrant,
+	expires string,
+	signature string,
+	now time.Time,
+) error {
+	err := fmt.Errorf("no signing key for grant")
+	for _, key := range grantKeys(kr, grant) {
+		if err = Verify(key, grant.ID, expires, signature, now); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// CheckGrantCode returns true if the code matches the grant's one-time code.
+func CheckGrantCode(kr *model.Keyring, grant *model.DownloadGrant, code string) bool {
+	if grant.CodeHash == nil {
+		return false
+	}
+
+	match := false
+	for _, key := range grantKeys(kr, grant) {
+		if subtle.ConstantTimeCompare([]byte(HashCode(key, code)), []byte(*grant.CodeHash)) == 1 {
+			match = true
+		}
+	}
+
+	return match
+}
+
+// Sign returns the signature for the grant ID and expiry time.
+func Sign(key []byte, grantID string, expires time.Time) string {
+	mac := hmac.New(sha256.New, signingKey(key))
+	mac.Write([]byte(fmt.Sprintf("%s:%d", grantID, expires.Unix())))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the signature matches the grant ID and expiry time, and that
+// the link hasn't expired.
+func Verify(key []byte, grantID string, expires string, signature string, now time.Time) error {
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry")
+	}
+
+	expected := Sign(key, grantID, time.Unix(expiresUnix, 0))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	if now.Unix() > expiresUnix {
+		return fmt.Errorf("link expired")
+	}
+
+	return nil
+}
+
+// SignedPath returns the signed path for the grant, relative to the API server.
+func SignedPath(key []byte, grantID string, expires time.Time, public bool) string {
+	base := "/downloads/"
+	if public {
+		base = "/downloads/public/"
+	}
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", Sign(key, grantID, expires))
+
+	return base + url.PathEscape(grantID) + "?" + q.Encode()
+}
+
+// NewCode generates a random numeric one-time code for a public download link.
+func NewCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < codeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", codeLength, n), nil
+}
+
+// HashCode hashes a one-time code for storage.
+func HashCode(key []byte, code string) string {
+	mac := hmac.New(sha256.New, signingKey(key))
+	mac.Write([]byte("code:" + code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,86 @@
+package download
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("test-key")
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+
+	sig := Sign(key, "grant", expires)
+
+	assert.NoError(t, Verify(key, "grant", expiresStr, sig, now))
+	assert.Error(t, Verify(key, "other", expiresStr, sig, now))
+	assert.Error(t, Verify([]byte("other-key"), "grant", expiresStr, sig, now))
+	assert.Error(t, Verify(key, "grant", strconv.FormatInt(expires.Unix()+60, 10), sig, now))
+	assert.Error(t, Verify(key, "grant", expiresStr, sig, expires.Add(time.Second)))
+	assert.Error(t, Verify(key, "grant", "abc", sig, now))
+}
+
+func TestSignedPath(t *testing.T) {
+	key := []byte("test-key")
+	expires := time.Now().Add(time.Hour)
+
+	path := SignedPath(key, "grant", expires, true)
+	assert.True(t, strings.HasPrefix(path, "/downloads/public/grant?"))
+
+	u, err := url.Parse(path)
+	assert.NoError(t, err)
+
+	q := u.Query()
+	assert.NoError(t, Verify(key, "grant", q.Get("expires"), q.Get("signature"), time.Now()))
+}
+
+func TestCode(t *testing.T) {
+	key := []byte("test-key")
+
+	code, err := NewCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, codeLength)
+
+	assert.Equal(t, HashCode(key, code), HashCode(key, code))
+	assert.NotEqual(t, HashCode(key, code), HashCode(key, code+"0"))
+}
+
+func TestVerifyGrantAfterRotation(t *testing.T) {
+	oldKey := []byte("0123456789abcdef")
+	newKey := []byte("fedcba9876543210")
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+
+	oldID := model.KeyID(oldKey)
+	code := "12345678"
+	codeHash := HashCode(oldKey, code)
+	grant := &model.DownloadGrant{ID: "grant", KeyID: &oldID, CodeHash: &codeHash}
+	sig := Sign(oldKey, grant.ID, expires)
+
+	rotated, err := model.NewKeyring(newKey, oldKey)
+	assert.NoError(t, err)
+
+	assert.NoError(t, VerifyGrant(rotated, grant, expiresStr, sig, now))
+	assert.True(t, CheckGrantCode(rotated, grant, code))
+	assert.False(t, CheckGrantCode(rotated, grant, "87654321"))
+
+	// Grants without a key ID are checked against every key in the ring.
+	legacy := &model.DownloadGrant{ID: "grant", CodeHash: &codeHash}
+	assert.NoError(t, VerifyGrant(rotated, legacy, expiresStr, sig, now))
+	assert.True(t, CheckGrantCode(rotated, legacy, code))
+
+	// Once the key is removed from the ring, its links stop working.
+	removed, err := model.NewKeyring(newKey)
+	assert.NoError(t, err)
+
+	assert.Error(t, VerifyGrant(removed, grant, expiresStr, sig, now))
+	assert.False(t, CheckGrantCode(removed, grant, code))
+}
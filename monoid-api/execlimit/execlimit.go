@@ -0,0 +1,181 @@
+// Package execlimit enforces the concurrency and rate limits on connector
+// executions with slots stored in the database, so the limits are shared by
+// every worker.
+package execlimit
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// rateWindow is the window that the per-minute limits are counted over.
+	rateWindow = time.Minute
+
+	// concurrencyRetry is how long to wait before trying again to acquire a
+	// slot that's limited by concurrency.
+	concurrencyRetry = 10 * time.Second
+)
+
+// Result is the result of trying to acquire a slot.
+type Result struct {
+	Acquired bool
+	// RetryAfter is how long to wait before trying again, if the slot wasn't
+	// acquired.
+	RetryAfter time.Duration
+}
+
+// Acquire tries to acquire a slot for the holder under each of the limits. The
+// slots are either all acquired or none are. ttl is how long the slots are held
+// for if they aren't released.
+func Acquire(
+	db *gorm.DB,
+	holderID string,
+	ttl time.Duration,
+	limits []model.ExecutionLimit,
+) (Result, error) {
+	if len(limits) == 0 {
+		return Result{Acquired: true}, nil
+	}
+
+	// Lock the keys in a consistent order, so concurrent calls can't
+	// deadlock.
+	limits = append([]model.ExecutionLimit{}, limits...)
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Key < limits[j].Key
+	})
+
+	res := Result{Acquired: true}
+	heldKeys := map[string]bool{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		for _, l := range limits {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", l.Key).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, l := range limits {
+			// The holder may already have the slot if the activity that
+			// acquired it was retried.
+			var held int64
+			if err := tx.Model(&model.ExecutionSlot{}).Where(
+				"key = ? AND holder_id = ? AND released_at IS NULL", l.Key, holderID,
+			).Count(&held).Error; err != nil {
+				return err
+			}
+
+			if held > 0 {
+				heldKeys[l.Key] = true
+				continue
+			}
+
+			retry, err := wait(tx, l, now)
+			if err != nil {
+				return err
+			}
+
+			if retry > res.RetryAfter {
+				res.RetryAfter = retry
+			}
+
+			if retry > 0 {
+				res.Acquired = false
+			}
+		}
+
+		if !res.Acquired {
+			return nil
+		}
+
+		res.RetryAfter = 0
+
+		for _, l := range limits {
+			if heldKeys[l.Key] {
+				continue
+			}
+
+			if err := tx.Create(&model.ExecutionSlot{
+				ID:         uuid.NewString(),
+				Key:        l.Key,
+				HolderID:   holderID,
+				AcquiredAt: now,
+				ExpiresAt:  now.Add(ttl),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, nil
+}
+
+// wait returns how long to wait until a slot is available under the limit, or
+// 0 if one is available now.
+func wait(tx *gorm.DB, l model.ExecutionLimit, now time.Time) (time.Duration, error) {
+	// Remove the slots that no longer count towards either limit.
+	if err := tx.Where(
+		"key = ? AND acquired_at < ? AND (released_at IS NOT NULL OR expires_at < ?)",
+		l.Key, now.Add(-rateWindow), now,
+	).Delete(&model.ExecutionSlot{}).Error; err != nil {
+		return 0, err
+	}
+
+	var retry time.Duration
+
+	if l.Limits.MaxConcurrent != nil {
+		var active int64
+		if err := tx.Model(&model.ExecutionSlot{}).Where(
+			"key = ? AND released_at IS NULL AND expires_at > ?", l.Key, now,
+		).Count(&active).Error; err != nil {
+			return 0, err
+		}
+
+		if active >= int64(*l.Limits.MaxConcurrent) {
+			retry = concurrencyRetry
+		}
+	}
+
+	if l.Limits.MaxPerMinute != nil {
+		recent := []model.ExecutionSlot{}
+		if err := tx.Where(
+			"key = ? AND acquired_at > ?", l.Key, now.Add(-rateWindow),
+		).Order("acquired_at DESC").Limit(*l.Limits.MaxPerMinute).Find(&recent).Error; err != nil {
+			return 0, err
+		}
+
+		// The next slot is available once the oldest of the most recent
+		// slots leaves the window.
+		if len(recent) >= *l.Limits.MaxPerMinute {
+			oldest := recent[len(recent)-1].AcquiredAt
+			if r := oldest.Add(rateWindow).Sub(now); r > retry {
+				retry = r
+			}
+		}
+	}
+
+	if retry < 0 {
+		retry = 0
+	}
+
+	return retry, nil
+}
+
+// Release releases the holder's slots.
+func Release(db *gorm.DB, holderID string) error {
+	return db.Model(&model.ExecutionSlot{}).Where(
+		"holder_id = ? AND released_at IS NULL", holderID,
+	).Update("released_at", time.Now()).Error
+}
@@ -1,9 +1,16 @@
-package localstore
+package encryptedstore
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
 	"io"
 
 	"github.com/minio/sio"
@@ -11,16 +18,218 @@ import (
 	"golang.org/x/crypto/hkdf"
 )
 
+// Encrypted objects start with a header that contains the data key for the
+// object, encrypted with the store's key:
+//
+//	magic (6 bytes) | version (1) | mode (1) | key id length (1) | key id |
+//	wrapped key length (2) | wrapped key
+//
+// Regular files are encrypted as a single DARE stream after the header. Segment
+// files are written as a sequence of independently sealed frames, so the data
+// that has been flushed so far can be read while the file is still being written.
+var magic = []byte("MNDENC")
+
+const (
+	version = 1
+
+	modeStream byte = 0
+	modeFramed byte = 1
+
+	dataKeySize  = 32
+	maxFrameSize = 64 * 1024
+)
+
+// KeyedFileStore is a FileStore that can report the key that each object is
+// encrypted with, so objects encrypted with old keys can be found and rewritten.
+type KeyedFileStore interface {
+	filestore.FileStore
+
+	// PrimaryKeyID returns the id of the key that new objects are encrypted with.
+	PrimaryKeyID() string
+
+	// ObjectKeyID returns the id of the key the object is encrypted with, or
+	// an empty string if the object isn't encrypted.
+	ObjectKeyID(ctx context.Context, objectName string, segmentFile bool) (string, error)
+}
+
 type encryptedFileStore struct {
 	filestore filestore.FileStore
-	key       []byte
+	keks      map[string][]byte
+	keyID     string
+}
+
+// deriveKEK derives the key that data keys are encrypted with, and its id.
+func deriveKEK(key []byte) ([]byte, string) {
+	kek := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, key, nil, []byte("monoid-filestore-kek"))
+	if _, err := io.ReadFull(kdf, kek); err != nil {
+		panic(err)
+	}
+
+	id := sha256.Sum256(kek)
+
+	return kek, hex.EncodeToString(id[:8])
 }
 
-func NewEncryptedFileStore(filestore filestore.FileStore, key []byte) filestore.FileStore {
-	return &encryptedFileStore{
+// NewEncryptedFileStore wraps the filestore, encrypting every object with
+// its own data key. The data keys are encrypted with a key derived from key,
+// and objects written with any of the previous keys can still be read.
+// Objects that weren't written by an encrypted store are read as plaintext.
+func NewEncryptedFileStore(
+	filestore filestore.FileStore,
+	key []byte,
+	previousKeys ...[]byte,
+) filestore.FileStore {
+	kek, keyID := deriveKEK(key)
+
+	fs := &encryptedFileStore{
 		filestore: filestore,
-		key:       key,
+		keks:      map[string][]byte{keyID: kek},
+		keyID:     keyID,
+	}
+
+	for _, k := range previousKeys {
+		prevKEK, prevID := deriveKEK(k)
+		fs.keks[prevID] = prevKEK
+	}
+
+	return fs
+}
+
+func (fs *encryptedFileStore) PrimaryKeyID() string {
+	return fs.keyID
+}
+
+func (fs *encryptedFileStore) ObjectKeyID(
+	ctx context.Context,
+	objectName string,
+	segmentFile bool,
+) (string, error) {
+	src, err := fs.filestore.NewReader(ctx, objectName, segmentFile)
+	if err != nil {
+		return "", err
+	}
+
+	defer src.Close()
+
+	br := bufio.NewReader(src)
+	encrypted, err := hasMagic(br)
+	if err != nil || !encrypted {
+		return "", err
+	}
+
+	_, keyID, _, err := readHeader(br)
+	return keyID, err
+}
+
+// hasMagic checks if the reader starts with the magic bytes, and
+// consumes them if it does.
+func hasMagic(br *bufio.Reader) (bool, error) {
+	prefix, err := br.Peek(len(magic))
+	if err == io.EOF || (err == nil && !bytes.Equal(prefix, magic)) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := br.Discard(len(magic)); err != nil {
+		return false, err
 	}
+
+	return true, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// header builds the object header for a new data key.
+func (fs *encryptedFileStore) header(dataKey []byte, mode byte) ([]byte, error) {
+	gcm, err := newGCM(fs.keks[fs.keyID])
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	wrapped := gcm.Seal(nonce, nonce, dataKey, []byte(fs.keyID))
+
+	buf := bytes.Buffer{}
+	buf.Write(magic)
+	buf.WriteByte(version)
+	buf.WriteByte(mode)
+	buf.WriteByte(byte(len(fs.keyID)))
+	buf.WriteString(fs.keyID)
+	binary.Write(&buf, binary.BigEndian, uint16(len(wrapped)))
+	buf.Write(wrapped)
+
+	return buf.Bytes(), nil
+}
+
+// readHeader reads the header after the magic bytes, and returns the mode,
+// key id and encrypted data key.
+func readHeader(r io.Reader) (byte, string, []byte, error) {
+	var fixed [3]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return 0, "", nil, err
+	}
+
+	if fixed[0] != version {
+		return 0, "", nil, fmt.Errorf("unsupported encrypted file version %d", fixed[0])
+	}
+
+	keyID := make([]byte, fixed[2])
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return 0, "", nil, err
+	}
+
+	var wrappedLen uint16
+	if err := binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+		return 0, "", nil, err
+	}
+
+	wrapped := make([]byte, wrappedLen)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return 0, "", nil, err
+	}
+
+	return fixed[1], string(keyID), wrapped, nil
+}
+
+// unwrapKey decrypts the data key with the key with the id.
+func (fs *encryptedFileStore) unwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	kek, ok := fs.keks[keyID]
+	if !ok {
+		return nil, fmt.Errorf("file was encrypted with unknown key %s", keyID)
+	}
+
+	gcm, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid data key")
+	}
+
+	dataKey, err := gcm.Open(
+		nil, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], []byte(keyID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt data key: %w", err)
+	}
+
+	return dataKey, nil
 }
 
 func (fs *encryptedFileStore) NewWriter(
@@ -35,31 +244,221 @@ func (fs *encryptedFileStore) NewWriter(
 
 	defer func() {
 		if err != nil {
-			wr.Close()
+			writer.Close()
 			fp = ""
 			wr = nil
 		}
 	}()
 
-	var nonce [32]byte
-	if _, err = io.ReadFull(rand.Reader, nonce[:]); err != nil {
+	dataKey := make([]byte, dataKeySize)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
 		return nil, "", err
 	}
 
-	var key [32]byte
-	kdf := hkdf.New(sha256.New, key[:], nonce[:], nil)
-	if _, err = io.ReadFull(kdf, key[:]); err != nil {
+	mode := modeStream
+	if segmentFile {
+		mode = modeFramed
+	}
+
+	header, err := fs.header(dataKey, mode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err = writer.Write(header); err != nil {
 		return nil, "", err
 	}
 
-	writer, err = sio.EncryptWriter(writer, sio.Config{Key: key[:]})
+	if segmentFile {
+		gcm, err := newGCM(dataKey)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return &frameWriter{dst: writer, gcm: gcm}, filePath, nil
+	}
+
+	encWriter, err := sio.EncryptWriter(writer, sio.Config{
+		MinVersion: sio.Version20,
+		Key:        dataKey,
+	})
 	if err != nil {
 		return nil, "", err
 	}
 
-	return writer, filePath, nil
+	return encWriter, filePath, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
-func (ls *encryptedFileStore) NewReader(ctx context.Context, objectName string, segmentFile bool) (io.ReadCloser, error) {
-	return ls.filestore.NewReader(ctx, objectName, segmentFile)
+func (fs *encryptedFileStore) NewReader(
+	ctx context.Context,
+	objectName string,
+	segmentFile bool,
+) (io.ReadCloser, error) {
+	src, err := fs.filestore.NewReader(ctx, objectName, segmentFile)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(src)
+
+	encrypted, err := hasMagic(br)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	if !encrypted {
+		// The object was stored unencrypted.
+		return readCloser{Reader: br, Closer: src}, nil
+	}
+
+	mode, keyID, wrapped, err := readHeader(br)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	dataKey, err := fs.unwrapKey(keyID, wrapped)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	switch mode {
+	case modeStream:
+		decReader, err := sio.DecryptReader(br, sio.Config{
+			MinVersion: sio.Version20,
+			Key:        dataKey,
+		})
+		if err != nil {
+			src.Close()
+			return nil, err
+		}
+
+		return readCloser{Reader: decReader, Closer: src}, nil
+	case modeFramed:
+		gcm, err := newGCM(dataKey)
+		if err != nil {
+			src.Close()
+			return nil, err
+		}
+
+		return readCloser{
+			Reader: &frameReader{src: br, gcm: gcm},
+			Closer: src,
+		}, nil
+	}
+
+	src.Close()
+	return nil, fmt.Errorf("unknown encryption mode %d", mode)
+}
+
+// frameWriter seals every write as one or more frames of the form
+// length (4 bytes) | nonce | ciphertext. The frame's index is used as
+// additional data, so frames can't be reordered.
+type frameWriter struct {
+	dst   io.WriteCloser
+	gcm   cipher.AEAD
+	index uint64
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+
+		nonce := make([]byte, w.gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return written, err
+		}
+
+		var ad [8]byte
+		binary.BigEndian.PutUint64(ad[:], w.index)
+
+		frame := make([]byte, 4, 4+len(nonce)+n+w.gcm.Overhead())
+		frame = append(frame, nonce...)
+		frame = w.gcm.Seal(frame, nonce, p[:n], ad[:])
+		binary.BigEndian.PutUint32(frame[:4], uint32(len(frame)-4))
+
+		if _, err := w.dst.Write(frame); err != nil {
+			return written, err
+		}
+
+		w.index++
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (w *frameWriter) Close() error {
+	return w.dst.Close()
+}
+
+// frameReader reads the frames written by a frameWriter. A partial frame at
+// the end of the stream is treated as the end of the data, since segment files
+// can be read while they're being written.
+type frameReader struct {
+	src   io.Reader
+	gcm   cipher.AEAD
+	index uint64
+	buf   []byte
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		var length uint32
+		if err := binary.Read(r.src, binary.BigEndian, &length); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, io.EOF
+			}
+
+			return 0, err
+		}
+
+		if int(length) > r.gcm.NonceSize()+maxFrameSize+r.gcm.Overhead() {
+			return 0, fmt.Errorf("invalid frame")
+		}
+
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r.src, frame); err != nil {
+			if err == io.ErrUnexpectedEOF || err == io.EOF {
+				return 0, io.EOF
+			}
+
+			return 0, err
+		}
+
+		if len(frame) < r.gcm.NonceSize() {
+			return 0, fmt.Errorf("invalid frame")
+		}
+
+		var ad [8]byte
+		binary.BigEndian.PutUint64(ad[:], r.index)
+
+		plain, err := r.gcm.Open(
+			nil, frame[:r.gcm.NonceSize()], frame[r.gcm.NonceSize():], ad[:],
+		)
+		if err != nil {
+			return 0, fmt.Errorf("could not decrypt frame: %w", err)
+		}
+
+		r.index++
+		r.buf = plain
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
 }
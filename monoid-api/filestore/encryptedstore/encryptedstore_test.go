@@ -0,0 +1,135 @@
+package encryptedstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/monoid-privacy/monoid/filestore/localstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewEncryptedFileStore(localstore.NewLocalFileStore(dir), []byte("test-key"))
+
+	data := bytes.Repeat([]byte("sensitive data\n"), 10000)
+
+	for _, segmentFile := range []bool{false, true} {
+		name := "stream"
+		if segmentFile {
+			name = "segment"
+		}
+
+		wr, path, err := store.NewWriter(ctx, name, segmentFile)
+		require.NoError(t, err)
+
+		_, err = wr.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, wr.Close())
+
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.False(t, bytes.Contains(raw, []byte("sensitive data")), name)
+
+		r, err := store.NewReader(ctx, path, segmentFile)
+		require.NoError(t, err)
+
+		res, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, data, res, name)
+		r.Close()
+
+		other := NewEncryptedFileStore(localstore.NewLocalFileStore(dir), []byte("other-key"))
+		_, err = other.NewReader(ctx, path, segmentFile)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPartialSegment(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewEncryptedFileStore(localstore.NewLocalFileStore(dir), []byte("test-key"))
+
+	wr, path, err := store.NewWriter(ctx, "log", true)
+	require.NoError(t, err)
+
+	_, err = wr.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	_, err = wr.Write([]byte("line 2\n"))
+	require.NoError(t, err)
+	require.NoError(t, wr.Close())
+
+	// Drop the end of the file, as if the last frame was still being written.
+	fp := filepath.Join(dir, path)
+	raw, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fp, raw[:len(raw)-3], 0600))
+
+	r, err := store.NewReader(ctx, path, true)
+	require.NoError(t, err)
+
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\n", string(res))
+}
+
+func TestPlaintextPassthrough(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain"), []byte("plain data"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "short"), []byte("ab"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty"), []byte{}, 0600))
+
+	store := NewEncryptedFileStore(localstore.NewLocalFileStore(dir), []byte("test-key"))
+
+	for name, expected := range map[string]string{
+		"plain": "plain data",
+		"short": "ab",
+		"empty": "",
+	} {
+		r, err := store.NewReader(ctx, name, false)
+		require.NoError(t, err)
+
+		res, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(res), name)
+		r.Close()
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	oldStore := NewEncryptedFileStore(localstore.NewLocalFileStore(dir), []byte("old-key"))
+
+	wr, path, err := oldStore.NewWriter(ctx, "file", false)
+	require.NoError(t, err)
+
+	_, err = wr.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, wr.Close())
+
+	store := NewEncryptedFileStore(
+		localstore.NewLocalFileStore(dir), []byte("new-key"), []byte("old-key"),
+	).(KeyedFileStore)
+
+	keyID, err := store.ObjectKeyID(ctx, path, false)
+	require.NoError(t, err)
+	assert.Equal(t, oldStore.(KeyedFileStore).PrimaryKeyID(), keyID)
+	assert.NotEqual(t, store.PrimaryKeyID(), keyID)
+
+	r, err := store.NewReader(ctx, path, false)
+	require.NoError(t, err)
+
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(res))
+	r.Close()
+}
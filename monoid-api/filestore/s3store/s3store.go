@@ -0,0 +1,256 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/monoid-privacy/monoid/filestore"
+	"github.com/monoid-privacy/monoid/filestore/segwriter"
+)
+
+// Config configures the connection to an S3-compatible object store.
+type Config struct {
+	Bucket string
+
+	// Endpoint is the host (and optionally port) of the S3 API, defaults to
+	// s3.amazonaws.com.
+	Endpoint string
+	Region   string
+
+	// AccessKeyID and SecretAccessKey are optional; if they aren't set, the
+	// credentials are read from the standard AWS environment variables, the
+	// shared credentials file or the instance metadata service.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// DisableSSL connects over plain HTTP, for local MinIO deployments.
+	DisableSSL bool
+
+	// PathStyle forces path-style addressing (endpoint/bucket/object) instead of
+	// virtual host addressing, which most on-prem deployments require.
+	PathStyle bool
+
+	// KMSKeyID enables SSE-KMS with the given key for all written objects.
+	KMSKeyID string
+}
+
+// objectClient is the subset of object storage operations used by the store.
+type objectClient interface {
+	PutObject(ctx context.Context, objectName string, r io.Reader) error
+	GetObject(ctx context.Context, objectName string) (io.ReadCloser, error)
+
+	// ListObjects returns the names of all the objects with the prefix, in
+	// lexicographic order.
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+}
+
+type s3Store struct {
+	client objectClient
+}
+
+// NewS3Store creates a FileStore backed by an S3-compatible bucket.
+func NewS3Store(conf Config) (filestore.FileStore, error) {
+	if conf.Bucket == "" {
+		return nil, fmt.Errorf("no bucket configured")
+	}
+
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	var creds *credentials.Credentials
+	if conf.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(conf.AccessKeyID, conf.SecretAccessKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+
+	lookup := minio.BucketLookupAuto
+	if conf.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	cli, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !conf.DisableSSL,
+		Region:       conf.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sse encrypt.ServerSide
+	if conf.KMSKeyID != "" {
+		sse, err = encrypt.NewSSEKMS(conf.KMSKeyID, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newS3Store(&minioClient{
+		client: cli,
+		bucket: conf.Bucket,
+		sse:    sse,
+	}), nil
+}
+
+func newS3Store(client objectClient) filestore.FileStore {
+	return &s3Store{client: client}
+}
+
+// objectWriter streams writes to an object upload, the upload completes
+// when the writer is closed.
+type objectWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (s *s3Store) newObjectWriter(ctx context.Context, objectName string) io.WriteCloser {
+	pr, pw := io.Pipe()
+	wr := &objectWriter{
+		pw:   pw,
+		done: make(chan error, 1),
+	}
+
+	go func() {
+		err := s.client.PutObject(ctx, objectName, pr)
+		pr.CloseWithError(err)
+		wr.done <- err
+	}()
+
+	return wr
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *objectWriter) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+func segmentPrefix(objectName string) string {
+	return objectName + "/"
+}
+
+func (s *s3Store) NewWriter(
+	ctx context.Context,
+	objectName string,
+	segmentFile bool,
+) (io.WriteCloser, string, error) {
+	if !segmentFile {
+		return s.newObjectWriter(ctx, objectName), objectName, nil
+	}
+
+	sw := segwriter.NewSegmentedWriter(func(i int) io.WriteCloser {
+		return s.newObjectWriter(ctx, fmt.Sprintf("%s%06d", segmentPrefix(objectName), i))
+	}, 1*time.Minute)
+
+	return sw, objectName, nil
+}
+
+func (s *s3Store) NewReader(
+	ctx context.Context,
+	objectName string,
+	segmentFile bool,
+) (io.ReadCloser, error) {
+	if !segmentFile {
+		return s.client.GetObject(ctx, objectName)
+	}
+
+	names, err := s.client.ListObjects(ctx, segmentPrefix(objectName))
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		for _, name := range names {
+			objReader, err := s.client.GetObject(ctx, name)
+			if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+
+			_, err = io.Copy(w, objReader)
+			objReader.Close()
+
+			if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+
+		w.Close()
+	}()
+
+	return r, nil
+}
+
+// uploadPartSize is the size of the parts that objects are uploaded in. The
+// length of streamed objects isn't known, and without a part size minio
+// buffers parts big enough for the largest object S3 allows (about 560MiB).
+const uploadPartSize = 16 << 20
+
+type minioClient struct {
+	client *minio.Client
+	bucket string
+	sse    encrypt.ServerSide
+}
+
+func (c *minioClient) PutObject(ctx context.Context, objectName string, r io.Reader) error {
+	_, err := c.client.PutObject(ctx, c.bucket, objectName, r, -1, c.putObjectOptions())
+	return err
+}
+
+func (c *minioClient) putObjectOptions() minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		ContentType:          "application/octet-stream",
+		ServerSideEncryption: c.sse,
+		PartSize:             uploadPartSize,
+	}
+}
+
+func (c *minioClient) GetObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	obj, err := c.client.GetObject(ctx, c.bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject doesn't make a request until the object is read, so stat the
+	// object to surface missing objects here.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (c *minioClient) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	names := []string{}
+	for obj := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		names = append(names, obj.Key)
+	}
+
+	return names, nil
+}
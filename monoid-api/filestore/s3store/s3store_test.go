@@ -0,0 +1,175 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{objects: map[string][]byte{}}
+}
+
+func (c *fakeClient) PutObject(ctx context.Context, objectName string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.objects[objectName] = data
+	return nil
+}
+
+func (c *fakeClient) GetObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	data, ok := c.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", objectName)
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *fakeClient) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	names := []string{}
+	for name := range c.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func testStore(t *testing.T, store filestore.FileStore, client objectClient) {
+	ctx := context.Background()
+	name := uuid.NewString()
+
+	w, path, err := store.NewWriter(ctx, name, false)
+	require.NoError(t, err)
+	assert.Equal(t, name, path)
+
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := store.NewReader(ctx, path, false)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	r.Close()
+	assert.Equal(t, "hello world", string(data))
+
+	_, err = store.NewReader(ctx, uuid.NewString(), false)
+	assert.Error(t, err)
+
+	// The segmented writer flushes the final segment in the background after
+	// Close, so wait for it to appear.
+	segName := uuid.NewString()
+	sw, segPath, err := store.NewWriter(ctx, segName, true)
+	require.NoError(t, err)
+
+	_, err = sw.Write([]byte("line 1\nline 2\n"))
+	require.NoError(t, err)
+	require.NoError(t, sw.Close())
+
+	assert.Eventually(t, func() bool {
+		names, err := client.ListObjects(ctx, segmentPrefix(segPath))
+		return err == nil && len(names) == 1
+	}, 10*time.Second, 100*time.Millisecond)
+
+	sr, err := store.NewReader(ctx, segPath, true)
+	require.NoError(t, err)
+
+	data, err = io.ReadAll(sr)
+	require.NoError(t, err)
+	sr.Close()
+	assert.Equal(t, "line 1\nline 2\n", string(data))
+}
+
+func TestS3Store(t *testing.T) {
+	client := newFakeClient()
+	testStore(t, newS3Store(client), client)
+}
+
+func TestSegmentOrder(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+	store := newS3Store(client)
+
+	for i := 11; i >= 0; i-- {
+		require.NoError(t, client.PutObject(
+			ctx, fmt.Sprintf("logs/%06d", i), strings.NewReader(fmt.Sprintf("%d,", i)),
+		))
+	}
+
+	// Objects sharing the name as a prefix shouldn't be read as segments.
+	require.NoError(t, client.PutObject(ctx, "logs2/000000", strings.NewReader("x")))
+
+	r, err := store.NewReader(ctx, "logs", true)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "0,1,2,3,4,5,6,7,8,9,10,11,", string(data))
+}
+
+// TestMinio runs against a real MinIO server if S3_TEST_ENDPOINT is set, e.g.
+// S3_TEST_ENDPOINT=localhost:9000 S3_TEST_BUCKET=monoid with the default
+// minioadmin credentials.
+func TestMinio(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	conf := Config{
+		Bucket:          os.Getenv("S3_TEST_BUCKET"),
+		Endpoint:        endpoint,
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+		DisableSSL:      true,
+		PathStyle:       true,
+	}
+
+	store, err := NewS3Store(conf)
+	require.NoError(t, err)
+
+	testStore(t, store, store.(*s3Store).client)
+}
+
+// TestPutObjectPartSize verifies that streamed uploads set a part size, since
+// minio otherwise allocates a buffer of about 560MiB for each upload.
+func TestPutObjectPartSize(t *testing.T) {
+	c := &minioClient{}
+	opts := c.putObjectOptions()
+
+	assert.Equal(t, uint64(16<<20), opts.PartSize)
+}
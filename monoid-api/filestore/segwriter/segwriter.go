@@ -14,6 +14,7 @@ type segmentedWriter struct {
 	activeBuffer *bytes.Buffer
 	lock         sync.Mutex
 	closeCh      chan bool
+	doneCh       chan error
 	closed       bool
 }
 
@@ -30,6 +31,7 @@ func NewSegmentedWriter(
 		activeBuffer: new(bytes.Buffer),
 		lock:         sync.Mutex{},
 		closeCh:      make(chan bool),
+		doneCh:       make(chan error, 1),
 	}
 
 	go func() {
@@ -48,11 +50,12 @@ func NewSegmentedWriter(
 
 				wr.Close()
 			case <-sw.closeCh:
-				if err := sw.pushData(wr); err != nil {
-					log.Err(err).Msg("Error pushing data")
+				err := sw.pushData(wr)
+				if closeErr := wr.Close(); err == nil {
+					err = closeErr
 				}
 
-				wr.Close()
+				sw.doneCh <- err
 				break L
 			}
 
@@ -87,8 +90,10 @@ func (s *segmentedWriter) Write(p []byte) (n int, err error) {
 	return s.activeBuffer.Write(p)
 }
 
+// Close flushes the remaining data to a final segment, and waits for
+// the segment to be written.
 func (s *segmentedWriter) Close() error {
 	s.closed = true
 	s.closeCh <- true
-	return nil
+	return <-s.doneCh
 }
@@ -0,0 +1,131 @@
+package imageverify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const imageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParseReference(t *testing.T) {
+	assert.Equal(t, reference{dockerHubRegistry, "library/postgres"}, parseReference("postgres"))
+	assert.Equal(t, reference{dockerHubRegistry, "monoidco/monoid-postgres"}, parseReference("monoidco/monoid-postgres"))
+	assert.Equal(t, reference{dockerHubRegistry, "library/redis"}, parseReference("docker.io/redis"))
+	assert.Equal(t, reference{"ghcr.io", "org/image"}, parseReference("ghcr.io/org/image"))
+	assert.Equal(t, reference{"localhost:5000", "image"}, parseReference("localhost:5000/image"))
+}
+
+// signedRegistry serves an image's cosign signature, signed by key, from
+// behind an anonymous token challenge.
+func signedRegistry(t *testing.T, key *ecdsa.PrivateKey, signedDigest string) *httptest.Server {
+	payload := []byte(fmt.Sprintf(
+		`{"critical":{"identity":{"docker-reference":"image"},"image":{"docker-manifest-digest":%q},`+
+			`"type":"cosign container image signature"},"optional":null}`,
+		signedDigest,
+	))
+
+	payloadSum := sha256.Sum256(payload)
+	payloadDigest := "sha256:" + hex.EncodeToString(payloadSum[:])
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, payloadSum[:])
+	require.NoError(t, err)
+
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:org/image:pull", r.URL.Query().Get("scope"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "abc"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/org/image/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", imageDigest)
+		case "/v2/org/image/manifests/" + strings.Replace(imageDigest, ":", "-", 1) + ".sig":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"layers": []map[string]interface{}{{
+					"digest": payloadDigest,
+					"annotations": map[string]string{
+						signatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+					},
+				}},
+			})
+		case "/v2/org/image/blobs/" + payloadDigest:
+			_, _ = w.Write(payload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return srv
+}
+
+func newTestVerifier(t *testing.T, srv *httptest.Server, key *ecdsa.PrivateKey) *Verifier {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	v, err := NewVerifier(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	v.Registry.Client = srv.Client()
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	srv := signedRegistry(t, key, imageDigest)
+	defer srv.Close()
+
+	image := strings.TrimPrefix(srv.URL, "https://") + "/org/image"
+	v := newTestVerifier(t, srv, key)
+
+	digest, err := v.Registry.ResolveDigest(context.Background(), image, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, imageDigest, digest)
+
+	assert.NoError(t, v.Verify(context.Background(), image, imageDigest))
+
+	// A digest without a signature isn't trusted.
+	assert.Error(t, v.Verify(context.Background(), image, "sha256:"+strings.Repeat("f", 64)))
+
+	// A signature from another key isn't trusted.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	assert.Error(t, newTestVerifier(t, srv, otherKey).Verify(context.Background(), image, imageDigest))
+}
+
+func TestVerifyWrongDigest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// The signature is stored under the image's digest, but signs another one.
+	srv := signedRegistry(t, key, "sha256:"+strings.Repeat("a", 64))
+	defer srv.Close()
+
+	image := strings.TrimPrefix(srv.URL, "https://") + "/org/image"
+	assert.Error(t, newTestVerifier(t, srv, key).Verify(context.Background(), image, imageDigest))
+}
@@ -0,0 +1,199 @@
+package imageverify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const dockerHubRegistry = "registry-1.docker.io"
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// reference is the registry and repository of an image name like
+// monoidco/monoid-postgres or ghcr.io/org/image.
+type reference struct {
+	registry   string
+	repository string
+}
+
+func parseReference(image string) reference {
+	parts := strings.SplitN(image, "/", 2)
+
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if parts[0] != "docker.io" && parts[0] != "index.docker.io" {
+			return reference{registry: parts[0], repository: parts[1]}
+		}
+
+		image = parts[1]
+	}
+
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+
+	return reference{registry: dockerHubRegistry, repository: image}
+}
+
+// Registry reads image manifests and blobs from a registry using the
+// anonymous token flow, so only public images are supported.
+type Registry struct {
+	Client *http.Client
+}
+
+// NewRegistry creates a registry client.
+func NewRegistry() *Registry {
+	return &Registry{Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// ResolveDigest returns the digest of the manifest that the image's tag
+// currently points to.
+func (r *Registry) ResolveDigest(ctx context.Context, image string, tag string) (string, error) {
+	ref := parseReference(image)
+
+	res, err := r.get(ctx, ref, http.MethodHead, "manifests/"+tag, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+
+	res.Body.Close()
+
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry didn't return a digest for %s:%s", image, tag)
+	}
+
+	return digest, nil
+}
+
+// get requests the path under the repository, fetching a token and retrying
+// if the registry asks for one. The caller must close the response's body.
+func (r *Registry) get(
+	ctx context.Context,
+	ref reference,
+	method string,
+	path string,
+	accept []string,
+) (*http.Response, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.registry, ref.repository, path)
+
+	res, err := r.do(ctx, method, u, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+
+		token, err := r.token(ctx, ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err = r.do(ctx, method, u, accept, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("registry returned %s for %s", res.Status, u)
+	}
+
+	return res, nil
+}
+
+func (r *Registry) do(
+	ctx context.Context,
+	method string,
+	u string,
+	accept []string,
+	token string,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accept) != 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return r.Client.Do(req)
+}
+
+// token gets an anonymous pull token from the realm in the registry's
+// challenge.
+func (r *Registry) token(ctx context.Context, ref reference, challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("unsupported registry challenge %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid registry challenge %q", challenge)
+	}
+
+	if params["scope"] == "" {
+		params["scope"] = "repository:" + ref.repository + ":pull"
+	}
+
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+
+	realm.RawQuery = q.Encode()
+
+	res, err := r.do(ctx, http.MethodGet, realm.String(), nil, "")
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request returned %s", res.Status)
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding registry token: %v", err)
+	}
+
+	if body.Token != "" {
+		return body.Token, nil
+	}
+
+	return body.AccessToken, nil
+}
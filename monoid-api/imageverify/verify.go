@@ -0,0 +1,171 @@
+package imageverify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+	maxPayloadSize      = 1 << 20
+)
+
+// signaturePayload is the simple signing payload that cosign signs.
+type signaturePayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+type signatureManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// Verifier checks that images are signed by a public key, using the signatures
+// that cosign stores in the registry next to the image.
+type Verifier struct {
+	Registry  *Registry
+	PublicKey crypto.PublicKey
+}
+
+// NewVerifier creates a verifier for the PEM encoded public key.
+func NewVerifier(publicKey []byte) (*Verifier, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, fmt.Errorf("public key isn't PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %v", err)
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	return &Verifier{Registry: NewRegistry(), PublicKey: key}, nil
+}
+
+// NewVerifierFromFile creates a verifier for the PEM encoded public key in the
+// file at path.
+func NewVerifierFromFile(path string) (*Verifier, error) {
+	publicKey, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVerifier(publicKey)
+}
+
+// Verify returns an error if none of the image's signatures are valid for the
+// digest.
+func (v *Verifier) Verify(ctx context.Context, image string, digest string) error {
+	ref := parseReference(image)
+	sigTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+
+	res, err := v.Registry.get(ctx, ref, http.MethodGet, "manifests/"+sigTag, []string{
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+	})
+	if err != nil {
+		return fmt.Errorf("image %s@%s isn't signed: %v", image, digest, err)
+	}
+
+	manifest := signatureManifest{}
+	err = json.NewDecoder(io.LimitReader(res.Body, maxPayloadSize)).Decode(&manifest)
+	res.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("error decoding signatures for %s@%s: %v", image, digest, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[signatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+
+		payload, err := v.blob(ctx, ref, layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		if !v.verifySignature(payload, sig) {
+			continue
+		}
+
+		p := signaturePayload{}
+		if err := json.Unmarshal(payload, &p); err != nil {
+			continue
+		}
+
+		if p.Critical.Image.DockerManifestDigest == digest {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("image %s@%s has no valid signature for the configured key", image, digest)
+}
+
+// blob reads the blob with the digest, checking that its content matches.
+func (v *Verifier) blob(ctx context.Context, ref reference, digest string) ([]byte, error) {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, fmt.Errorf("unsupported blob digest %s", digest)
+	}
+
+	res, err := v.Registry.get(ctx, ref, http.MethodGet, "blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxPayloadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s doesn't match its digest", digest)
+	}
+
+	return data, nil
+}
+
+func (v *Verifier) verifySignature(payload []byte, sig []byte) bool {
+	hash := sha256.Sum256(payload)
+
+	switch key := v.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, hash[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, sig)
+	}
+
+	return false
+}
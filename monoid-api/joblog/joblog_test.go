@@ -0,0 +1,125 @@
+package joblog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/monoid-privacy/monoid/filestore/localstore"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewLocalFileStore(t.TempDir())
+
+	wr, path, err := store.NewWriter(ctx, "stream", true)
+	require.NoError(t, err)
+
+	w := newWriter(wr)
+	w.SetSiloDefinitionID("silo")
+
+	require.NoError(t, w.Log(model.LogLevelInfo, "starting"))
+
+	logs := make(chan monoidprotocol.MonoidLogMessage, 2)
+	logs <- monoidprotocol.MonoidLogMessage{Message: "from container"}
+	close(logs)
+
+	forwarded := []string{}
+	w.ForwardContainerLogs(logs, func(message string) {
+		forwarded = append(forwarded, message)
+	})
+
+	require.NoError(t, w.LogDataSource(model.LogLevelError, "ds", "failed"))
+	require.NoError(t, w.Close())
+
+	// Entries written after the writer is closed are dropped.
+	require.NoError(t, w.Log(model.LogLevelInfo, "dropped"))
+
+	assert.Equal(t, []string{"from container"}, forwarded)
+
+	entries, err := readStream(ctx, store, path, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, SourceMonoid, entries[0].Source)
+	assert.Equal(t, "starting", entries[0].Message)
+	assert.Equal(t, "silo", *entries[0].SiloDefinitionID)
+	assert.Nil(t, entries[0].DataSourceID)
+
+	assert.Equal(t, SourceContainer, entries[1].Source)
+	assert.Equal(t, "from container", entries[1].Message)
+
+	assert.Equal(t, model.LogLevelError, entries[2].Level)
+	assert.Equal(t, "ds", *entries[2].DataSourceID)
+
+	errorsOnly := Filter{Levels: []model.LogLevel{model.LogLevelError}}
+	assert.False(t, errorsOnly.Match(entries[0]))
+	assert.True(t, errorsOnly.Match(entries[2]))
+	assert.True(t, Filter{}.Match(entries[0]))
+}
+
+func TestLegacyLines(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewLocalFileStore(t.TempDir())
+
+	wr, path, err := store.NewWriter(ctx, "legacy", true)
+	require.NoError(t, err)
+
+	_, err = wr.Write([]byte("plain line\n{not json}\npartial"))
+	require.NoError(t, err)
+	require.NoError(t, wr.Close())
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	entries, err := readStream(ctx, store, path, created)
+	require.NoError(t, err)
+
+	// The last line hasn't been terminated, so it isn't read yet.
+	require.Len(t, entries, 2)
+
+	for _, e := range entries {
+		assert.Equal(t, model.LogLevelInfo, e.Level)
+		assert.Equal(t, SourceContainer, e.Source)
+		assert.Equal(t, created, e.Time)
+	}
+
+	assert.Equal(t, "plain line", entries[0].Message)
+	assert.Equal(t, "{not json}", entries[1].Message)
+}
+
+func TestReadStreamFrom(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewLocalFileStore(t.TempDir())
+
+	write := func(data string) string {
+		wr, path, err := store.NewWriter(ctx, "tail", true)
+		require.NoError(t, err)
+
+		_, err = wr.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, wr.Close())
+
+		return path
+	}
+
+	path := write("first\nsecond\npart")
+
+	entries, offset, err := readStreamFrom(ctx, store, path, time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(len("first\nsecond\n")), offset)
+
+	// Only the lines after the offset are read once the stream has grown.
+	write("first\nsecond\npartial\nthird\n")
+
+	entries, offset, err = readStreamFrom(ctx, store, path, time.Time{}, offset)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "partial", entries[0].Message)
+	assert.Equal(t, "third", entries[1].Message)
+	assert.Equal(t, int64(len("first\nsecond\npartial\nthird\n")), offset)
+}
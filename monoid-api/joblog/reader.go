@@ -0,0 +1,383 @@
+package joblog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/monoid-privacy/monoid/filestore"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Filter selects the log entries that are returned.
+type Filter struct {
+	// Levels are the levels to include, all levels are included if it's empty.
+	Levels []model.LogLevel
+}
+
+// Match returns true if the entry passes the filter.
+func (f Filter) Match(e model.JobLogEntry) bool {
+	if len(f.Levels) == 0 {
+		return true
+	}
+
+	for _, l := range f.Levels {
+		if l == e.Level {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseLine parses a line of a log stream. Lines that aren't entries were written
+// before logs were structured, and are returned as container output at time t.
+func parseLine(line string, t time.Time) model.JobLogEntry {
+	if strings.HasPrefix(line, "{") {
+		e := model.JobLogEntry{}
+		if err := json.Unmarshal([]byte(line), &e); err == nil && e.Level.IsValid() {
+			return e
+		}
+	}
+
+	return model.JobLogEntry{
+		Time:    t,
+		Level:   model.LogLevelInfo,
+		Source:  SourceContainer,
+		Message: line,
+	}
+}
+
+// streamReader reads the entries in a log object one at a time.
+type streamReader struct {
+	r  io.ReadCloser
+	br *bufio.Reader
+	t  time.Time
+
+	// offset is the number of bytes of complete lines that have been read.
+	offset int64
+}
+
+// openStream opens the log object, skipping the first offset bytes, which must
+// be the end of a line. Entries from lines that aren't entries are given time t.
+func openStream(
+	ctx context.Context,
+	store filestore.FileStore,
+	objectName string,
+	t time.Time,
+	offset int64,
+) (*streamReader, error) {
+	r, err := store.NewReader(ctx, objectName, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		// Stores that can seek don't have to read the skipped bytes again.
+		if seeker, ok := r.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, r, offset)
+		}
+
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	return &streamReader{
+		r:      r,
+		br:     bufio.NewReader(r),
+		t:      t,
+		offset: offset,
+	}, nil
+}
+
+// next returns the next entry in the stream, or io.EOF if there are no more
+// complete lines. A trailing line without a newline is still being written, so
+// it is left for the next read.
+func (s *streamReader) next() (model.JobLogEntry, error) {
+	for {
+		line, err := s.br.ReadString('\n')
+		if err != nil {
+			return model.JobLogEntry{}, err
+		}
+
+		s.offset += int64(len(line))
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+
+		return parseLine(line, s.t), nil
+	}
+}
+
+func (s *streamReader) Close() error {
+	return s.r.Close()
+}
+
+// readStream reads the complete lines in a log object.
+func readStream(
+	ctx context.Context,
+	store filestore.FileStore,
+	objectName string,
+	t time.Time,
+) ([]model.JobLogEntry, error) {
+	entries, _, err := readStreamFrom(ctx, store, objectName, t, 0)
+	return entries, err
+}
+
+// readStreamFrom reads the complete lines in a log object after offset, and
+// returns the offset after the last complete line.
+func readStreamFrom(
+	ctx context.Context,
+	store filestore.FileStore,
+	objectName string,
+	t time.Time,
+	offset int64,
+) ([]model.JobLogEntry, int64, error) {
+	s, err := openStream(ctx, store, objectName, t, offset)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	defer s.Close()
+
+	entries := []model.JobLogEntry{}
+
+	for {
+		e, err := s.next()
+		if err == io.EOF {
+			return entries, s.offset, nil
+		}
+
+		if err != nil {
+			return nil, offset, err
+		}
+
+		entries = append(entries, e)
+	}
+}
+
+// streamObjects returns the log objects for the job. Jobs from before logs were
+// streamed have all their output in the job's LogObject.
+func streamObjects(db *gorm.DB, job *model.Job) ([]string, error) {
+	streams := []model.JobLogStream{}
+	if err := db.Where("job_id = ?", job.ID).Order("created_at").Find(&streams).Error; err != nil {
+		return nil, err
+	}
+
+	objects := make([]string, 0, len(streams)+1)
+	if job.LogObject != "" {
+		objects = append(objects, job.LogObject)
+	}
+
+	for _, s := range streams {
+		objects = append(objects, s.ObjectName)
+	}
+
+	return objects, nil
+}
+
+func sortEntries(entries []model.JobLogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+}
+
+// Page selects a page of the log entries that match a filter.
+type Page struct {
+	Offset int
+	// Limit is the most entries that are returned. All the entries from
+	// Offset on are returned if it's negative.
+	Limit int
+}
+
+// Read returns a page of the job's log entries that match the filter, in the
+// order they were written, and the total number of entries that match. The
+// streams are merged as they're read, since each is already in order, so only
+// the page is held in memory.
+func Read(
+	ctx context.Context,
+	db *gorm.DB,
+	store filestore.FileStore,
+	job *model.Job,
+	filter Filter,
+	page Page,
+) ([]model.JobLogEntry, int, error) {
+	objects, err := streamObjects(db, job)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type cursor struct {
+		obj    string
+		stream *streamReader
+		entry  model.JobLogEntry
+	}
+
+	// advance moves the cursor to the stream's next entry that matches the
+	// filter, and returns false if there are none left.
+	advance := func(c *cursor) bool {
+		for {
+			e, err := c.stream.next()
+			if err == io.EOF {
+				return false
+			}
+
+			if err != nil {
+				log.Warn().Err(err).Str("object", c.obj).Msg("Error reading job log stream")
+				return false
+			}
+
+			if filter.Match(e) {
+				c.entry = e
+				return true
+			}
+		}
+	}
+
+	cursors := []*cursor{}
+
+	for _, obj := range objects {
+		stream, err := openStream(ctx, store, obj, job.CreatedAt, 0)
+		if err != nil {
+			// A stream may not have been flushed yet, so it's skipped rather
+			// than failing the whole read.
+			log.Warn().Err(err).Str("object", obj).Msg("Error reading job log stream")
+			continue
+		}
+
+		defer stream.Close()
+
+		c := &cursor{obj: obj, stream: stream}
+		if advance(c) {
+			cursors = append(cursors, c)
+		}
+	}
+
+	res := []model.JobLogEntry{}
+	total := 0
+
+	for len(cursors) != 0 {
+		// Ties go to the earlier stream, to match a stable sort.
+		first := 0
+		for i, c := range cursors {
+			if c.entry.Time.Before(cursors[first].entry.Time) {
+				first = i
+			}
+		}
+
+		c := cursors[first]
+		if total >= page.Offset && (page.Limit < 0 || len(res) < page.Limit) {
+			res = append(res, c.entry)
+		}
+
+		total++
+
+		if !advance(c) {
+			cursors = append(cursors[:first], cursors[first+1:]...)
+		}
+	}
+
+	return res, total, nil
+}
+
+// Tail sends the job's log entries that match the filter on the returned
+// channel, polling for new entries every interval. The channel is closed once
+// the job has finished and all of its entries have been sent, or ctx is done.
+func Tail(
+	ctx context.Context,
+	db *gorm.DB,
+	store filestore.FileStore,
+	jobID string,
+	filter Filter,
+	interval time.Duration,
+) (<-chan *model.JobLogEntry, error) {
+	job := model.Job{}
+	if err := db.Where("id = ?", jobID).First(&job).Error; err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *model.JobLogEntry)
+
+	go func() {
+		defer close(ch)
+
+		// The offset after the last complete line that has been read from
+		// each stream, so that each poll only reads new lines.
+		offsets := map[string]int64{}
+
+		poll := func() bool {
+			objects, err := streamObjects(db, &job)
+			if err != nil {
+				log.Err(err).Msg("Error finding job log streams")
+				return true
+			}
+
+			batch := []model.JobLogEntry{}
+
+			for _, obj := range objects {
+				entries, offset, err := readStreamFrom(ctx, store, obj, job.CreatedAt, offsets[obj])
+				if err != nil {
+					continue
+				}
+
+				for _, e := range entries {
+					if filter.Match(e) {
+						batch = append(batch, e)
+					}
+				}
+
+				offsets[obj] = offset
+			}
+
+			sortEntries(batch)
+
+			for i := range batch {
+				select {
+				case ch <- &batch[i]:
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			return true
+		}
+
+		for {
+			// Check if the job has finished before reading, so the entries
+			// written before it finished are included in the last read.
+			finished := false
+			if err := db.Where("id = ?", jobID).First(&job).Error; err != nil {
+				log.Err(err).Msg("Error finding job")
+				return
+			}
+
+			if job.Status != model.JobStatusQueued && job.Status != model.JobStatusRunning {
+				finished = true
+			}
+
+			if !poll() || finished {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,159 @@
+// Package joblog writes and reads the structured logs of jobs. Each worker
+// activity writes its entries to its own segmented log stream, and the
+// streams are merged when the logs are read.
+package joblog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/filestore"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"gorm.io/gorm"
+)
+
+const (
+	// SourceMonoid is the source of entries logged by Monoid itself.
+	SourceMonoid = "monoid"
+	// SourceContainer is the source of entries logged by a silo's container.
+	SourceContainer = "container"
+)
+
+// Writer writes log entries for a job. A nil Writer discards all entries,
+// so callers don't need to check if logging is set up.
+type Writer struct {
+	mu  sync.Mutex
+	wr  io.WriteCloser
+	enc *json.Encoder
+
+	siloDefinitionID *string
+	closed           bool
+}
+
+// NewWriter creates a new log stream for the job, and returns a writer for it.
+func NewWriter(
+	ctx context.Context,
+	db *gorm.DB,
+	store filestore.FileStore,
+	jobID string,
+) (*Writer, error) {
+	wr, path, err := store.NewWriter(ctx, uuid.NewString(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Create(&model.JobLogStream{
+		ID:         uuid.NewString(),
+		JobID:      jobID,
+		ObjectName: path,
+	}).Error; err != nil {
+		wr.Close()
+		return nil, err
+	}
+
+	return newWriter(wr), nil
+}
+
+func newWriter(wr io.WriteCloser) *Writer {
+	return &Writer{wr: wr, enc: json.NewEncoder(wr)}
+}
+
+// SetSiloDefinitionID sets the silo that entries are attributed to, if they
+// don't have one set.
+func (w *Writer) SetSiloDefinitionID(id string) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.siloDefinitionID = &id
+}
+
+// Write writes an entry to the log. The entry's time is set to now if it
+// isn't set.
+func (w *Writer) Write(e model.JobLogEntry) error {
+	if w == nil {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Containers can still be sending logs after the writer is closed, so
+	// those entries are dropped.
+	if w.closed {
+		return nil
+	}
+
+	if e.SiloDefinitionID == nil {
+		e.SiloDefinitionID = w.siloDefinitionID
+	}
+
+	return w.enc.Encode(e)
+}
+
+// Log writes a message from Monoid to the log.
+func (w *Writer) Log(level model.LogLevel, message string) error {
+	return w.Write(model.JobLogEntry{
+		Level:   level,
+		Source:  SourceMonoid,
+		Message: message,
+	})
+}
+
+// LogDataSource writes a message from Monoid about a data source to the log.
+func (w *Writer) LogDataSource(level model.LogLevel, dataSourceID string, message string) error {
+	return w.Write(model.JobLogEntry{
+		Level:        level,
+		Source:       SourceMonoid,
+		Message:      message,
+		DataSourceID: &dataSourceID,
+	})
+}
+
+// ForwardContainerLogs writes the container's log messages to the log until
+// the channel is closed. Each message is also passed to fn, if it is set.
+func (w *Writer) ForwardContainerLogs(logs <-chan monoidprotocol.MonoidLogMessage, fn func(message string)) {
+	for l := range logs {
+		if fn != nil {
+			fn(l.Message)
+		}
+
+		// Errors are ignored, since the container's output shouldn't fail
+		// the job.
+		_ = w.Write(model.JobLogEntry{
+			Level:   model.LogLevelInfo,
+			Source:  SourceContainer,
+			Message: l.Message,
+		})
+	}
+}
+
+// Close flushes the entries to the file store.
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+
+	return w.wr.Close()
+}
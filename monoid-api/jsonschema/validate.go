@@ -0,0 +1,32 @@
+package jsonschema
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Validate returns an error describing the fields of the data that aren't
+// valid for the JSON schema. The error doesn't include the fields' values, so
+// it can be shown for configs with secrets.
+func Validate(data map[string]interface{}, schema string) error {
+	res, err := gojsonschema.Validate(
+		gojsonschema.NewStringLoader(schema),
+		gojsonschema.NewGoLoader(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(res.Errors()))
+	for _, e := range res.Errors() {
+		msgs = append(msgs, e.Field()+": "+e.Description())
+	}
+
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,27 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {
+			"password": {"type": "string", "secret": true},
+			"port": {"type": "integer"}
+		},
+		"required": ["port"]
+	}`
+
+	assert.NoError(t, Validate(map[string]interface{}{"port": 5432, "password": "hunter2"}, schema))
+
+	err := Validate(map[string]interface{}{"password": 1234}, schema)
+	assert.ErrorContains(t, err, "port")
+	assert.ErrorContains(t, err, "password")
+
+	// The values aren't included, since they can be secrets.
+	assert.NotContains(t, err.Error(), "1234")
+}
@@ -0,0 +1,393 @@
+package keyrotation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/filestore/encryptedstore"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Re-encryption only rewrites values and files that aren't encrypted with the
+// primary key, so it can be stopped and re-run at any point.
+
+// Result counts the values or files that were checked by a re-encryption run.
+type Result struct {
+	Checked     int
+	Reencrypted int
+	Failed      int
+	// Changed counts the values that were updated by something else while
+	// they were being re-encrypted, so they were left as they are.
+	Changed int
+}
+
+func (r *Result) add(o Result) {
+	r.Checked += o.Checked
+	r.Reencrypted += o.Reencrypted
+	r.Failed += o.Failed
+	r.Changed += o.Changed
+}
+
+// SecretColumn is a database column that stores SecretString values.
+type SecretColumn struct {
+	Table      string
+	PrimaryKey string
+	Column     string
+}
+
+var (
+	secretType    = reflect.TypeOf(model.SecretString(""))
+	secretPtrType = reflect.TypeOf((*model.SecretString)(nil))
+)
+
+// SecretColumns returns all the SecretString columns in the models.
+func SecretColumns(db *gorm.DB, models []interface{}) ([]SecretColumn, error) {
+	cols := []SecretColumn{}
+	cache := &sync.Map{}
+
+	for _, m := range models {
+		s, err := schema.Parse(m, cache, db.NamingStrategy)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range s.Fields {
+			if f.DBName == "" || (f.FieldType != secretType && f.FieldType != secretPtrType) {
+				continue
+			}
+
+			if len(s.PrimaryFields) != 1 {
+				return nil, fmt.Errorf("table %s must have a single primary key", s.Table)
+			}
+
+			cols = append(cols, SecretColumn{
+				Table:      s.Table,
+				PrimaryKey: s.PrimaryFields[0].DBName,
+				Column:     f.DBName,
+			})
+		}
+	}
+
+	return cols, nil
+}
+
+// ReencryptColumn re-encrypts all the values in the column that weren't
+// encrypted with the primary key of the keyring.
+func ReencryptColumn(db *gorm.DB, col SecretColumn, batchSize int) (Result, error) {
+	res := Result{}
+	primaryID := model.GetKeyring().PrimaryID()
+
+	table := db.Statement.Quote(col.Table)
+	pk := db.Statement.Quote(col.PrimaryKey)
+	column := db.Statement.Quote(col.Column)
+
+	cursor := ""
+
+	for {
+		rows, err := db.Raw(fmt.Sprintf(
+			"SELECT %s, %s FROM %s WHERE %s > ? AND %s IS NOT NULL ORDER BY %s LIMIT ?",
+			pk, column, table, pk, column, pk,
+		), cursor, batchSize).Rows()
+		if err != nil {
+			return res, err
+		}
+
+		type row struct {
+			id  string
+			raw []byte
+		}
+
+		batch := []row{}
+		for rows.Next() {
+			r := row{}
+			if err := rows.Scan(&r.id, &r.raw); err != nil {
+				rows.Close()
+				return res, err
+			}
+
+			batch = append(batch, r)
+		}
+
+		rows.Close()
+
+		if len(batch) == 0 {
+			return res, nil
+		}
+
+		for _, r := range batch {
+			cursor = r.id
+			res.Checked++
+
+			if model.SecretKeyID(r.raw) == primaryID {
+				continue
+			}
+
+			secret, err := model.DecryptSecret(r.raw)
+			if err != nil {
+				log.Err(err).Str("table", col.Table).Str("id", r.id).Msg("Error decrypting secret")
+				res.Failed++
+				continue
+			}
+
+			// Only update the row if it hasn't changed since it was read.
+			update := db.Exec(fmt.Sprintf(
+				"UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?",
+				table, column, pk, column,
+			), secret, r.id, r.raw)
+			if update.Error != nil {
+				log.Err(update.Error).Str("table", col.Table).Str("id", r.id).Msg("Error updating secret")
+				res.Failed++
+				continue
+			}
+
+			if update.RowsAffected == 0 {
+				res.Changed++
+				continue
+			}
+
+			res.Reencrypted++
+		}
+	}
+}
+
+// rewriteFile copies the object to a new object encrypted with the primary key,
+// if it isn't already, and returns the new object's path. The old object
+// is left in place.
+func rewriteFile(
+	ctx context.Context,
+	store encryptedstore.KeyedFileStore,
+	objectName string,
+	segmentFile bool,
+) (string, bool, error) {
+	keyID, err := store.ObjectKeyID(ctx, objectName, segmentFile)
+	if err != nil {
+		return "", false, err
+	}
+
+	if keyID == store.PrimaryKeyID() {
+		return objectName, false, nil
+	}
+
+	r, err := store.NewReader(ctx, objectName, segmentFile)
+	if err != nil {
+		return "", false, err
+	}
+
+	defer r.Close()
+
+	w, path, err := store.NewWriter(ctx, uuid.NewString(), segmentFile)
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return "", false, err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", false, err
+	}
+
+	return path, true, nil
+}
+
+// ReencryptFiles rewrites the request result files, streamed records and job
+// logs that weren't encrypted with the store's primary key, and points their
+// rows at the new files.
+func ReencryptFiles(
+	ctx context.Context,
+	db *gorm.DB,
+	store encryptedstore.KeyedFileStore,
+) (Result, error) {
+	res := Result{}
+
+	files := []model.DownloadableFile{}
+	if err := db.Find(&files).Error; err != nil {
+		return res, err
+	}
+
+	for _, f := range files {
+		res.Checked++
+
+		path, changed, err := rewriteFile(ctx, store, f.StoragePath, false)
+		if err != nil {
+			log.Err(err).Str("id", f.ID).Msg("Error re-encrypting downloadable file")
+			res.Failed++
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := db.Model(&f).Update("storage_path", path).Error; err != nil {
+			res.Failed++
+			continue
+		}
+
+		res.Reencrypted++
+	}
+
+	results := []model.QueryResult{}
+	if err := db.Where("result_type = ?", model.ResultTypeFile).Find(&results).Error; err != nil {
+		return res, err
+	}
+
+	for _, qr := range results {
+		if qr.Records == nil {
+			continue
+		}
+
+		res.Checked++
+
+		data := model.QueryResultFileData{}
+		if err := json.Unmarshal([]byte(*qr.Records), &data); err != nil {
+			log.Err(err).Str("id", qr.ID).Msg("Error reading query result")
+			res.Failed++
+			continue
+		}
+
+		path, changed, err := rewriteFile(ctx, store, data.FilePath, false)
+		if err != nil {
+			log.Err(err).Str("id", qr.ID).Msg("Error re-encrypting query result file")
+			res.Failed++
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		data.FilePath = path
+		rec, err := json.Marshal(data)
+		if err != nil {
+			res.Failed++
+			continue
+		}
+
+		if err := db.Model(&qr).Update("records", model.SecretString(rec)).Error; err != nil {
+			res.Failed++
+			continue
+		}
+
+		res.Reencrypted++
+	}
+
+	recordResults := []model.QueryResult{}
+	if err := db.Where("records_path IS NOT NULL").Find(&recordResults).Error; err != nil {
+		return res, err
+	}
+
+	for _, qr := range recordResults {
+		res.Checked++
+
+		path, changed, err := rewriteFile(ctx, store, *qr.RecordsPath, false)
+		if err != nil {
+			log.Err(err).Str("id", qr.ID).Msg("Error re-encrypting query result records")
+			res.Failed++
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := db.Model(&qr).Update("records_path", path).Error; err != nil {
+			res.Failed++
+			continue
+		}
+
+		res.Reencrypted++
+	}
+
+	jobs := []model.Job{}
+	if err := db.Where("log_object <> ''").Find(&jobs).Error; err != nil {
+		return res, err
+	}
+
+	for _, j := range jobs {
+		res.Checked++
+
+		path, changed, err := rewriteFile(ctx, store, j.LogObject, true)
+		if err != nil {
+			log.Err(err).Str("id", j.ID).Msg("Error re-encrypting job log")
+			res.Failed++
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := db.Model(&j).Update("log_object", path).Error; err != nil {
+			res.Failed++
+			continue
+		}
+
+		res.Reencrypted++
+	}
+
+	streams := []model.JobLogStream{}
+	if err := db.Find(&streams).Error; err != nil {
+		return res, err
+	}
+
+	for _, s := range streams {
+		res.Checked++
+
+		path, changed, err := rewriteFile(ctx, store, s.ObjectName, true)
+		if err != nil {
+			log.Err(err).Str("id", s.ID).Msg("Error re-encrypting job log stream")
+			res.Failed++
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := db.Model(&s).Update("object_name", path).Error; err != nil {
+			res.Failed++
+			continue
+		}
+
+		res.Reencrypted++
+	}
+
+	return res, nil
+}
+
+// ReencryptSecrets re-encrypts every SecretString column in the models.
+func ReencryptSecrets(db *gorm.DB, models []interface{}, batchSize int) (Result, error) {
+	res := Result{}
+
+	cols, err := SecretColumns(db, models)
+	if err != nil {
+		return res, err
+	}
+
+	for _, col := range cols {
+		colRes, err := ReencryptColumn(db, col, batchSize)
+		res.add(colRes)
+
+		if err != nil {
+			return res, fmt.Errorf("error re-encrypting %s.%s: %w", col.Table, col.Column, err)
+		}
+
+		log.Info().Msgf(
+			"Re-encrypted %d of %d values in %s.%s",
+			colRes.Reencrypted, colRes.Checked, col.Table, col.Column,
+		)
+	}
+
+	return res, nil
+}
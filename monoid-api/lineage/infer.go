@@ -0,0 +1,224 @@
+package lineage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minConfidence is the minimum confidence for an inferred edge to be created.
+const minConfidence = 0.6
+
+type PropertyInfo struct {
+	ID     string
+	Name   string
+	Hashes []string
+}
+
+// SourceInfo is the information about a data source used to infer lineage.
+type SourceInfo struct {
+	ID               string
+	SiloDefinitionID string
+	Name             string
+	CreatedAt        time.Time
+	Properties       []PropertyInfo
+}
+
+// Candidate is an inferred lineage edge. If the property IDs are set, the
+// edge is between two properties, otherwise it is between the data sources.
+type Candidate struct {
+	FromSourceID   string
+	ToSourceID     string
+	FromPropertyID *string
+	ToPropertyID   *string
+	Confidence     float64
+	Reason         string
+}
+
+// normalizeName lower-cases the name, and strips common schema prefixes
+// (e.g. public.users) so that names can be compared across silos.
+func normalizeName(name string) string {
+	name = strings.ToLower(name)
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+
+	return name
+}
+
+// ValueOverlap returns the fraction of the smaller set of hashes that
+// appear in the other set.
+func ValueOverlap(a []string, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	set := map[string]bool{}
+	for _, h := range a {
+		set[h] = true
+	}
+
+	n := 0
+	for _, h := range b {
+		if set[h] {
+			n += 1
+		}
+	}
+
+	min := len(a)
+	if len(b) < min {
+		min = len(b)
+	}
+
+	return float64(n) / float64(min)
+}
+
+type propertyMatch struct {
+	from    PropertyInfo
+	to      PropertyInfo
+	overlap float64
+	sampled bool
+}
+
+// inferPair infers the edges between two data sources, where from is assumed to be
+// upstream of to.
+func inferPair(from SourceInfo, to SourceInfo) []Candidate {
+	nameScore := 0.0
+	if normalizeName(from.Name) == normalizeName(to.Name) {
+		nameScore = 1
+	}
+
+	toProps := map[string]PropertyInfo{}
+	for _, p := range to.Properties {
+		toProps[normalizeName(p.Name)] = p
+	}
+
+	fromProps := map[string]bool{}
+	matches := []propertyMatch{}
+
+	for _, p := range from.Properties {
+		n := normalizeName(p.Name)
+		fromProps[n] = true
+
+		tp, ok := toProps[n]
+		if !ok {
+			continue
+		}
+
+		m := propertyMatch{from: p, to: tp}
+		if len(p.Hashes) != 0 && len(tp.Hashes) != 0 {
+			m.sampled = true
+			m.overlap = ValueOverlap(p.Hashes, tp.Hashes)
+		}
+
+		matches = append(matches, m)
+	}
+
+	union := len(toProps)
+	for n := range fromProps {
+		if _, ok := toProps[n]; !ok {
+			union += 1
+		}
+	}
+
+	columnScore := 0.0
+	if union != 0 {
+		columnScore = float64(len(matches)) / float64(union)
+	}
+
+	nSampled := 0
+	valueScore := 0.0
+
+	for _, m := range matches {
+		if m.sampled {
+			nSampled += 1
+			valueScore += m.overlap
+		}
+	}
+
+	confidence := 0.5*nameScore + 0.5*columnScore
+	reasons := []string{}
+
+	if nameScore != 0 {
+		reasons = append(reasons, "matching name")
+	}
+
+	reasons = append(reasons, fmt.Sprintf("%.0f%% of columns shared", columnScore*100))
+
+	if nSampled != 0 {
+		valueScore /= float64(nSampled)
+		confidence = 0.3*nameScore + 0.3*columnScore + 0.4*valueScore
+		reasons = append(reasons, fmt.Sprintf("%.0f%% of sampled values overlap", valueScore*100))
+	}
+
+	if confidence < minConfidence {
+		return nil
+	}
+
+	res := []Candidate{{
+		FromSourceID: from.ID,
+		ToSourceID:   to.ID,
+		Confidence:   confidence,
+		Reason:       strings.Join(reasons, ", "),
+	}}
+
+	for _, m := range matches {
+		fromID := m.from.ID
+		toID := m.to.ID
+
+		c := Candidate{
+			FromSourceID:   from.ID,
+			ToSourceID:     to.ID,
+			FromPropertyID: &fromID,
+			ToPropertyID:   &toID,
+			Confidence:     confidence,
+			Reason:         "matching column name",
+		}
+
+		if m.sampled {
+			if m.overlap < minConfidence {
+				continue
+			}
+
+			c.Confidence = m.overlap
+			c.Reason = fmt.Sprintf("matching column name, %.0f%% of sampled values overlap", m.overlap*100)
+		}
+
+		res = append(res, c)
+	}
+
+	return res
+}
+
+// Infer finds the likely lineage edges between data sources in different silos.
+// Since the direction of the copy can't be determined from the data, the data source
+// that was created first is assumed to be upstream.
+func Infer(sources []SourceInfo) []Candidate {
+	res := []Candidate{}
+
+	for i := range sources {
+		for j := i + 1; j < len(sources); j++ {
+			a, b := sources[i], sources[j]
+			if a.SiloDefinitionID == b.SiloDefinitionID {
+				continue
+			}
+
+			if b.CreatedAt.Before(a.CreatedAt) || (b.CreatedAt.Equal(a.CreatedAt) && b.ID < a.ID) {
+				a, b = b, a
+			}
+
+			res = append(res, inferPair(a, b)...)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].FromSourceID != res[j].FromSourceID {
+			return res[i].FromSourceID < res[j].FromSourceID
+		}
+
+		return res[i].ToSourceID < res[j].ToSourceID
+	})
+
+	return res
+}
@@ -0,0 +1,192 @@
+package lineage
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"gorm.io/gorm"
+)
+
+// InferWorkspaceLineage replaces the inferred lineage edges in the workspace with newly
+// inferred ones, and returns the new edges. Manually created edges are left in place.
+func InferWorkspaceLineage(db *gorm.DB, workspaceID string) ([]*model.LineageEdge, error) {
+	dataSources := []*model.DataSource{}
+	if err := db.Joins(
+		"JOIN silo_definitions ON silo_definitions.id = data_sources.silo_definition_id",
+	).Where(
+		"silo_definitions.workspace_id = ?", workspaceID,
+	).Preload("Properties").Find(&dataSources).Error; err != nil {
+		return nil, err
+	}
+
+	propertyIDs := []string{}
+	for _, ds := range dataSources {
+		for _, p := range ds.Properties {
+			propertyIDs = append(propertyIDs, p.ID)
+		}
+	}
+
+	samples := []model.PropertySample{}
+	if len(propertyIDs) != 0 {
+		if err := db.Where("property_id IN ?", propertyIDs).Find(&samples).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	hashes := map[string][]string{}
+	for _, s := range samples {
+		h, err := s.DeserializeHashes()
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[s.PropertyID] = h
+	}
+
+	sources := make([]SourceInfo, len(dataSources))
+	for i, ds := range dataSources {
+		props := make([]PropertyInfo, len(ds.Properties))
+		for j, p := range ds.Properties {
+			props[j] = PropertyInfo{
+				ID:     p.ID,
+				Name:   p.Name,
+				Hashes: hashes[p.ID],
+			}
+		}
+
+		sources[i] = SourceInfo{
+			ID:               ds.ID,
+			SiloDefinitionID: ds.SiloDefinitionID,
+			Name:             ds.Name,
+			CreatedAt:        ds.CreatedAt,
+			Properties:       props,
+		}
+	}
+
+	candidates := Infer(sources)
+
+	type edgeKey struct {
+		From string
+		To   string
+	}
+
+	manualEdges := []model.LineageEdge{}
+	if err := db.Where("workspace_id = ?", workspaceID).Where(
+		"type = ?", model.LineageEdgeTypeManual,
+	).Find(&manualEdges).Error; err != nil {
+		return nil, err
+	}
+
+	// Don't infer edges that have already been declared manually.
+	manual := map[edgeKey]bool{}
+	for _, e := range manualEdges {
+		from, to := e.FromDataSourceID, e.ToDataSourceID
+		if e.FromPropertyID != nil && e.ToPropertyID != nil {
+			from, to = *e.FromPropertyID, *e.ToPropertyID
+		}
+
+		manual[edgeKey{From: from, To: to}] = true
+		manual[edgeKey{From: to, To: from}] = true
+	}
+
+	edges := []*model.LineageEdge{}
+	for _, c := range candidates {
+		k := edgeKey{From: c.FromSourceID, To: c.ToSourceID}
+		if c.FromPropertyID != nil {
+			k = edgeKey{From: *c.FromPropertyID, To: *c.ToPropertyID}
+		}
+
+		if manual[k] {
+			continue
+		}
+
+		confidence := c.Confidence
+		reason := c.Reason
+
+		edges = append(edges, &model.LineageEdge{
+			ID:               uuid.NewString(),
+			WorkspaceID:      workspaceID,
+			FromDataSourceID: c.FromSourceID,
+			ToDataSourceID:   c.ToSourceID,
+			FromPropertyID:   c.FromPropertyID,
+			ToPropertyID:     c.ToPropertyID,
+			Type:             model.LineageEdgeTypeInferred,
+			Confidence:       &confidence,
+			Reason:           &reason,
+		})
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", workspaceID).Where(
+			"type = ?", model.LineageEdgeTypeInferred,
+		).Delete(&model.LineageEdge{}).Error; err != nil {
+			return err
+		}
+
+		if len(edges) == 0 {
+			return nil
+		}
+
+		return tx.Create(&edges).Error
+	}); err != nil {
+		return nil, err
+	}
+
+	return edges, nil
+}
+
+// DeletionWarnings follows the lineage edges downstream from the data sources in linked,
+// which are the data sources linked to a user primary key, and returns a warning for
+// each downstream data source that isn't linked itself, since user data in them
+// won't be found by requests.
+func DeletionWarnings(edges []*model.LineageEdge, linked map[string]bool) []*model.LineageWarning {
+	downstream := map[string][]string{}
+	for _, e := range edges {
+		downstream[e.FromDataSourceID] = append(downstream[e.FromDataSourceID], e.ToDataSourceID)
+	}
+
+	warnings := []*model.LineageWarning{}
+	visited := map[string]bool{}
+
+	type item struct {
+		id     string
+		origin string
+	}
+
+	roots := make([]string, 0, len(linked))
+	for id := range linked {
+		roots = append(roots, id)
+	}
+
+	sort.Strings(roots)
+
+	queue := []item{}
+	for _, id := range roots {
+		visited[id] = true
+		queue = append(queue, item{id: id, origin: id})
+	}
+
+	for len(queue) != 0 {
+		curr := queue[0]
+		queue = queue[1:]
+
+		for _, next := range downstream[curr.id] {
+			if visited[next] {
+				continue
+			}
+
+			visited[next] = true
+			queue = append(queue, item{id: next, origin: curr.origin})
+
+			warnings = append(warnings, &model.LineageWarning{
+				DataSourceID:         next,
+				UpstreamDataSourceID: curr.origin,
+				Message: "This data source is downstream of a data source with user data, " +
+					"but isn't linked to a user primary key, so it won't be included in requests.",
+			})
+		}
+	}
+
+	return warnings
+}
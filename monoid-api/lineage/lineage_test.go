@@ -0,0 +1,106 @@
+package lineage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfer(t *testing.T) {
+	kr, err := model.NewKeyring([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+
+	sampler, err := NewSampler(kr, "workspace")
+	assert.NoError(t, err)
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		sampler.Add("users", nil, map[string]interface{}{"email": email})
+	}
+
+	hashes := sampler.Hashes("users", nil, "email")
+	assert.Len(t, hashes, 3)
+
+	now := time.Now()
+
+	pgUsers := SourceInfo{
+		ID:               "pg_users",
+		SiloDefinitionID: "postgres",
+		Name:             "public.users",
+		CreatedAt:        now,
+		Properties: []PropertyInfo{
+			{ID: "pg_email", Name: "email", Hashes: hashes},
+			{ID: "pg_name", Name: "name"},
+		},
+	}
+
+	sfUsers := SourceInfo{
+		ID:               "sf_users",
+		SiloDefinitionID: "snowflake",
+		Name:             "USERS",
+		CreatedAt:        now.Add(time.Hour),
+		Properties: []PropertyInfo{
+			{ID: "sf_email", Name: "EMAIL", Hashes: hashes[:2]},
+			{ID: "sf_name", Name: "NAME"},
+		},
+	}
+
+	pgOrders := SourceInfo{
+		ID:               "pg_orders",
+		SiloDefinitionID: "postgres",
+		Name:             "orders",
+		CreatedAt:        now,
+		Properties: []PropertyInfo{
+			{ID: "pg_order_email", Name: "email", Hashes: hashes},
+		},
+	}
+
+	bqEvents := SourceInfo{
+		ID:               "bq_events",
+		SiloDefinitionID: "bigquery",
+		Name:             "events",
+		CreatedAt:        now,
+		Properties: []PropertyInfo{
+			{ID: "bq_type", Name: "type"},
+		},
+	}
+
+	candidates := Infer([]SourceInfo{sfUsers, pgUsers, pgOrders, bqEvents})
+
+	if !assert.Len(t, candidates, 3) {
+		return
+	}
+
+	assert.Equal(t, "pg_users", candidates[0].FromSourceID)
+	assert.Equal(t, "sf_users", candidates[0].ToSourceID)
+	assert.Nil(t, candidates[0].FromPropertyID)
+	assert.InDelta(t, 1.0, candidates[0].Confidence, 0.001)
+
+	assert.Equal(t, "pg_email", *candidates[1].FromPropertyID)
+	assert.Equal(t, "sf_email", *candidates[1].ToPropertyID)
+
+	assert.Equal(t, "pg_name", *candidates[2].FromPropertyID)
+	assert.Equal(t, "sf_name", *candidates[2].ToPropertyID)
+}
+
+func TestDeletionWarnings(t *testing.T) {
+	edges := []*model.LineageEdge{
+		{FromDataSourceID: "pg", ToDataSourceID: "snowflake"},
+		{FromDataSourceID: "snowflake", ToDataSourceID: "bigquery"},
+		{FromDataSourceID: "pg", ToDataSourceID: "linked_copy"},
+		{FromDataSourceID: "unlinked", ToDataSourceID: "other"},
+	}
+
+	warnings := DeletionWarnings(edges, map[string]bool{"pg": true, "linked_copy": true})
+
+	res := map[string]string{}
+	for _, w := range warnings {
+		res[w.DataSourceID] = w.UpstreamDataSourceID
+	}
+
+	assert.Equal(t, map[string]string{
+		"snowflake": "pg",
+		"bigquery":  "pg",
+	}, res)
+}
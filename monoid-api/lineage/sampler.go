@@ -0,0 +1,122 @@
+package lineage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/monoid-privacy/monoid/model"
+	"golang.org/x/crypto/hkdf"
+)
+
+// maxSamples is the maximum number of distinct value hashes kept for each property.
+const maxSamples = 100
+
+type sourceKey struct {
+	Name  string
+	Group string
+}
+
+func newSourceKey(name string, group *string) sourceKey {
+	gr := ""
+	if group != nil {
+		gr = *group
+	}
+
+	return sourceKey{Name: name, Group: gr}
+}
+
+// Sampler collects hashes of the values of each property of a set of
+// data sources. Values are hashed with a secret key that is specific to the
+// workspace, so that raw values are never stored and the hashes can't be
+// reversed by guessing values, but values from silos in the same workspace
+// can still be compared.
+type Sampler struct {
+	key     []byte
+	samples map[sourceKey]map[string]map[string]bool
+}
+
+// NewSampler creates a new sampler for data sources in the workspace. The
+// hashing key is derived from the keyring's primary key, so samples taken
+// before the key is rotated don't match new ones until they're re-sampled.
+func NewSampler(kr *model.Keyring, workspaceID string) (*Sampler, error) {
+	if kr == nil {
+		return nil, fmt.Errorf("no encryption key configured")
+	}
+
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(
+		sha256.New,
+		kr.Primary(),
+		nil,
+		[]byte("monoid-lineage-samples:"+workspaceID),
+	), key); err != nil {
+		return nil, err
+	}
+
+	return &Sampler{
+		key:     key,
+		samples: map[sourceKey]map[string]map[string]bool{},
+	}, nil
+}
+
+// HashValue hashes a value for the sampler's workspace.
+func (s *Sampler) HashValue(value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(value))
+
+	// Truncate the hash, since it only needs to be unique enough to
+	// estimate overlap between samples.
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Add adds the top-level, scalar values of a record to the samples for the data source.
+func (s *Sampler) Add(name string, group *string, data map[string]interface{}) {
+	k := newSourceKey(name, group)
+	if _, ok := s.samples[k]; !ok {
+		s.samples[k] = map[string]map[string]bool{}
+	}
+
+	for prop, v := range data {
+		switch v.(type) {
+		case string, float64, float32, int, int64, int32, bool:
+		default:
+			continue
+		}
+
+		if _, ok := s.samples[k][prop]; !ok {
+			s.samples[k][prop] = map[string]bool{}
+		}
+
+		if len(s.samples[k][prop]) >= maxSamples {
+			continue
+		}
+
+		s.samples[k][prop][s.HashValue(fmt.Sprint(v))] = true
+	}
+}
+
+// Hashes returns the sorted hashes sampled for a property of a data source.
+func (s *Sampler) Hashes(name string, group *string, property string) []string {
+	props, ok := s.samples[newSourceKey(name, group)]
+	if !ok {
+		return nil
+	}
+
+	hashes, ok := props[property]
+	if !ok {
+		return nil
+	}
+
+	res := make([]string, 0, len(hashes))
+	for h := range hashes {
+		res = append(res, h)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
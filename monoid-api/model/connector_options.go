@@ -0,0 +1,29 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+)
+
+var dockerDigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ValidateDockerDigest returns an error if the digest isn't a sha256 image
+// digest.
+func ValidateDockerDigest(digest string) error {
+	if !dockerDigestPattern.MatchString(digest) {
+		return fmt.Errorf("%q isn't a sha256 digest", digest)
+	}
+
+	return nil
+}
+
+// ConnectorOptions returns the options that the specification's connector is
+// run with.
+func (ss *SiloSpecification) ConnectorOptions() monoidprotocol.ConnectorOptions {
+	return monoidprotocol.ConnectorOptions{
+		Digest:     ss.DockerDigest,
+		RunProfile: ss.RunProfile.Protocol(),
+	}
+}
@@ -10,16 +10,30 @@ import (
 // SiloSpecification is the information about all silos that have
 // integrations with monoid
 type SiloSpecification struct {
-	ID              string
-	Name            string
-	LogoURL         *string
-	WorkspaceID     *string
-	Workspace       *Workspace `gorm:"constraint:OnDelete:CASCADE;"`
-	Manual          bool       `gorm:"default:false"`
-	DockerImage     string
-	DockerTag       string
+	ID          string
+	Name        string
+	LogoURL     *string
+	WorkspaceID *string
+	Workspace   *Workspace `gorm:"constraint:OnDelete:CASCADE;"`
+	Manual      bool       `gorm:"default:false"`
+	DockerImage string
+	DockerTag   string
+	// DockerDigest pins the connector's image, so a re-tagged image isn't
+	// run.
+	DockerDigest    *string
 	Schema          *string
 	SiloDefinitions []SiloDefinition
+
+	// ExecutionPolicy is the default policy for silos of this specification.
+	ExecutionPolicy *ExecutionPolicy
+	// ExecutionLimits apply to the executions against all silos of this
+	// specification together.
+	ExecutionLimits *ExecutionLimits
+	// RequestBatching is set if the specification's connector supports
+	// batches of requests.
+	RequestBatching *RequestBatching
+	// RunProfile is the sandbox that the specification's connector runs in.
+	RunProfile *RunProfile
 }
 
 func (ss *SiloSpecification) KeyField(field string) (string, error) {
@@ -43,6 +57,25 @@ type SiloDefinition struct {
 	Config              SecretString
 	DataDiscoveries     []DataDiscovery
 
+	// SiloSpecificationVersionID is the version of the specification that
+	// the silo's config was validated against, and that its connector runs.
+	// Silos without a version run the specification's current version.
+	SiloSpecificationVersionID *string
+	SiloSpecificationVersion   *SiloSpecificationVersion `gorm:"constraint:OnDelete:SET NULL;"`
+	// PreviousSiloSpecificationVersionID is the version the silo was on
+	// before its last upgrade, which it can be rolled back to.
+	PreviousSiloSpecificationVersionID *string
+	PreviousSiloSpecificationVersion   *SiloSpecificationVersion `gorm:"constraint:OnDelete:SET NULL;"`
+	// VersionPinned stops the silo from being upgraded or rolled back.
+	VersionPinned bool `gorm:"default:false"`
+
+	// ExecutionPolicy overrides the fields of the specification's policy
+	// that it sets.
+	ExecutionPolicy *ExecutionPolicy
+	// ExecutionLimits apply to the executions against this silo, as well as
+	// the specification's limits.
+	ExecutionLimits *ExecutionLimits
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -58,6 +91,12 @@ type DataSource struct {
 	Description      *string
 	RequestStatuses  []RequestStatus
 
+	// SchemaFingerprint is a hash of the JSON schema that was used
+	// the last time this data source was sampled, and LastScannedAt is the time
+	// of that sample. Together they allow discovery to skip unchanged sources.
+	SchemaFingerprint *string
+	LastScannedAt     *time.Time
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt
@@ -168,16 +207,21 @@ type Property struct {
 	UserPrimaryKeyID *string
 	UserPrimaryKey   *UserPrimaryKey `gorm:"constraint:OnUpdate:CASCADE;"`
 
+	// ExportPolicy overrides the policies of the property's categories
+	// when the user's data is exported.
+	ExportPolicy *ExportPolicy
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt
 }
 
 type Category struct {
-	ID          string
-	Name        string
-	WorkspaceID *string
-	Workspace   Workspace `gorm:"constraint:OnDelete:CASCADE;"`
+	ID           string
+	Name         string
+	ExportPolicy *ExportPolicy `yaml:"exportPolicy"`
+	WorkspaceID  *string
+	Workspace    Workspace `gorm:"constraint:OnDelete:CASCADE;"`
 }
 
 type Purpose struct {
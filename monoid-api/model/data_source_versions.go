@@ -0,0 +1,62 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// DataSourceVersion is a snapshot of a data source's properties and their
+// categories, taken whenever applying a discovery changes the data source.
+type DataSourceVersion struct {
+	ID           string
+	DataSourceID string     `gorm:"uniqueIndex:idx_data_source_version"`
+	DataSource   DataSource `gorm:"constraint:OnDelete:CASCADE;"`
+	Version      int        `gorm:"uniqueIndex:idx_data_source_version"`
+
+	// DataDiscoveryID is the discovery that caused this version to be created.
+	// The discovery may no longer exist.
+	DataDiscoveryID *string
+	Snapshot        datatypes.JSON
+
+	CreatedAt time.Time
+}
+
+func (v *DataSourceVersion) DeserializeSnapshot() (DataSourceSnapshot, error) {
+	res := DataSourceSnapshot{}
+	if err := json.Unmarshal(v.Snapshot, &res); err != nil {
+		return DataSourceSnapshot{}, err
+	}
+
+	return res, nil
+}
+
+type DataSourceSnapshot struct {
+	Name       string             `json:"name"`
+	Group      *string            `json:"group"`
+	Deleted    bool               `json:"deleted"`
+	Properties []PropertySnapshot `json:"properties"`
+}
+
+type PropertySnapshot struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	CategoryIDs []string `json:"categoryIds"`
+}
+
+// DataSourceVersionDiff is the difference between two versions of a data source.
+// Properties are matched by name.
+type DataSourceVersionDiff struct {
+	FromVersion       int
+	ToVersion         int
+	AddedProperties   []PropertySnapshot
+	RemovedProperties []PropertySnapshot
+	ChangedProperties []PropertyCategoryDiff
+}
+
+type PropertyCategoryDiff struct {
+	Name               string
+	AddedCategoryIDs   []string
+	RemovedCategoryIDs []string
+}
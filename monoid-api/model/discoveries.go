@@ -22,6 +22,12 @@ type DataDiscovery struct {
 	SiloDefinition   SiloDefinition
 	SiloDefinitionID string
 
+	// AutoApplied is true if the discovery was accepted or rejected by
+	// the DiscoveryPolicy with PolicyID, rather than by a user.
+	AutoApplied bool `gorm:"default:false"`
+	PolicyID    *string
+	Policy      *DiscoveryPolicy `gorm:"constraint:OnDelete:SET NULL;"`
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -63,6 +69,14 @@ func (dd *DataDiscovery) DeserializeData() (DataDiscoveryData, error) {
 		if err := json.Unmarshal(dd.Data, &res); err != nil {
 			return nil, err
 		}
+		return res, nil
+	case DiscoveryTypePrimaryKeyLink:
+		res := PrimaryKeyLinkDiscovery{}
+		if err := json.Unmarshal(dd.Data, &res); err != nil {
+			return nil, err
+		}
+		res.DataDiscoveryID = dd.ID
+
 		return res, nil
 	}
 
@@ -122,9 +136,10 @@ func (d NewPropertyDiscovery) Mappable() interface{} {
 }
 
 type NewCategoryDiscovery struct {
-	DataDiscoveryID string  `json:"-"`
-	PropertyID      *string `json:"propertyId"`
-	CategoryID      string  `json:"categoryId"`
+	DataDiscoveryID string               `json:"-"`
+	PropertyID      *string              `json:"propertyId"`
+	CategoryID      string               `json:"categoryId"`
+	Confidence      *DiscoveryConfidence `json:"confidence,omitempty"`
 }
 
 func (NewCategoryDiscovery) IsDataDiscoveryData() {}
@@ -163,3 +178,79 @@ func (DataSourceMissingDiscovery) IsDataDiscoveryData() {}
 func (d DataSourceMissingDiscovery) Mappable() interface{} {
 	return d
 }
+
+// PrimaryKeyLinkDiscovery is a suggestion to link a property to a user primary key,
+// so that the property's data source is included in user data requests.
+type PrimaryKeyLinkDiscovery struct {
+	DataDiscoveryID  string              `json:"-"`
+	PropertyID       string              `json:"propertyId"`
+	UserPrimaryKeyID string              `json:"userPrimaryKeyId"`
+	Reason           string              `json:"reason"`
+	Confidence       DiscoveryConfidence `json:"confidence"`
+}
+
+func (PrimaryKeyLinkDiscovery) IsDataDiscoveryData() {}
+
+type primaryKeyLinkDiscoveryKey struct {
+	PropertyID       string
+	UserPrimaryKeyID string
+}
+
+func (d PrimaryKeyLinkDiscovery) Mappable() interface{} {
+	return primaryKeyLinkDiscoveryKey{
+		PropertyID:       d.PropertyID,
+		UserPrimaryKeyID: d.UserPrimaryKeyID,
+	}
+}
+
+// DiscoveryPolicy is a rule that automatically accepts or rejects discoveries
+// when they are made. Policies with a SiloDefinitionID only apply to that silo,
+// otherwise they apply to every silo in the workspace.
+type DiscoveryPolicy struct {
+	ID               string
+	WorkspaceID      string
+	Workspace        Workspace `gorm:"constraint:OnDelete:CASCADE;"`
+	SiloDefinitionID *string
+	SiloDefinition   *SiloDefinition `gorm:"constraint:OnDelete:CASCADE;"`
+
+	// DiscoveryType restricts the policy to a single type of discovery.
+	DiscoveryType *DiscoveryType
+	Action        DiscoveryAction
+
+	// MinConfidence restricts the policy to category discoveries with at
+	// least the given confidence.
+	MinConfidence *DiscoveryConfidence
+
+	// SchemaPattern is a SQL LIKE pattern matched against the name of the data
+	// source that the discovery refers to (or group.name for grouped sources).
+	SchemaPattern *string
+
+	// Policies with a higher priority are evaluated first.
+	Priority int `gorm:"default:0"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Rank returns an ordering of the confidence levels, with higher
+// confidence levels having a higher rank.
+func (c DiscoveryConfidence) Rank() int {
+	switch c {
+	case DiscoveryConfidenceLow:
+		return 1
+	case DiscoveryConfidenceMedium:
+		return 2
+	case DiscoveryConfidenceHigh:
+		return 3
+	}
+
+	return 0
+}
+
+// PrimaryKeyCoverageGap is a data source with categorized properties but
+// no properties linked to a user primary key.
+type PrimaryKeyCoverageGap struct {
+	DataSourceID           string
+	SiloDefinitionID       string
+	CategorizedPropertyIDs []string
+}
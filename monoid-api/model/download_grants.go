@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// DownloadGrant gives access to a DownloadableFile through a signed link until
+// it expires, is revoked, or has been used MaxDownloads times. Public grants
+// are given to data subjects, and also require a one-time code.
+type DownloadGrant struct {
+	ID                 string
+	DownloadableFileID string
+	DownloadableFile   DownloadableFile `gorm:"constraint:OnDelete:CASCADE;"`
+	RequestID          *string
+	Request            *Request `gorm:"constraint:OnDelete:CASCADE;"`
+
+	ExpiresAt     time.Time
+	MaxDownloads  *int
+	DownloadCount int `gorm:"default:0"`
+	RevokedAt     *time.Time
+
+	Public         bool `gorm:"default:false"`
+	CodeHash       *string
+	CodeUsedAt     *time.Time
+	FailedAttempts int `gorm:"default:0"`
+
+	// KeyID is the ID of the encryption key that the link and code were
+	// signed with. It's nil for grants created before it was stored.
+	KeyID *string
+
+	AccessLogs []DownloadAccessLog
+
+	CreatedAt time.Time
+}
+
+// DownloadAccessLog records an attempt to download a file through a grant.
+type DownloadAccessLog struct {
+	ID              string
+	DownloadGrantID string
+	DownloadGrant   DownloadGrant `gorm:"constraint:OnDelete:CASCADE;"`
+	Success         bool
+	Reason          string
+	RemoteAddr      string
+	UserAgent       string
+
+	CreatedAt time.Time
+}
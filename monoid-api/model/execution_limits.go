@@ -0,0 +1,112 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ExecutionLimits caps the connector executions against a silo, or against all
+// the silos of a specification together. Fields that are nil aren't limited.
+type ExecutionLimits struct {
+	// MaxConcurrent is the most executions that can run at once.
+	MaxConcurrent *int `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty"`
+	// MaxPerMinute is the most executions that can start in a minute.
+	MaxPerMinute *int `json:"maxPerMinute,omitempty" yaml:"maxPerMinute,omitempty"`
+}
+
+// NewExecutionLimits converts the input to limits, returning nil if the input
+// is nil.
+func NewExecutionLimits(input *ExecutionLimitsInput) (*ExecutionLimits, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	l := &ExecutionLimits{
+		MaxConcurrent: input.MaxConcurrent,
+		MaxPerMinute:  input.MaxPerMinute,
+	}
+
+	if l.MaxConcurrent != nil && *l.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("maxConcurrent must be positive")
+	}
+
+	if l.MaxPerMinute != nil && *l.MaxPerMinute <= 0 {
+		return nil, fmt.Errorf("maxPerMinute must be positive")
+	}
+
+	return l, nil
+}
+
+// Empty returns true if the limits don't limit anything.
+func (l *ExecutionLimits) Empty() bool {
+	return l == nil || (l.MaxConcurrent == nil && l.MaxPerMinute == nil)
+}
+
+func (l ExecutionLimits) Value() (driver.Value, error) {
+	return json.Marshal(l)
+}
+
+func (l *ExecutionLimits) Scan(value interface{}) error {
+	var bytes []byte
+
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("could not scan execution limits")
+	}
+
+	return json.Unmarshal(bytes, l)
+}
+
+func (ExecutionLimits) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return "jsonb"
+}
+
+// ExecutionLimit is the limits that apply to the executions sharing a key.
+type ExecutionLimit struct {
+	Key    string          `json:"key"`
+	Limits ExecutionLimits `json:"limits"`
+}
+
+// ExecutionLimitList returns the limits that apply to executions against the silo,
+// from the silo and its specification. The SiloSpecification must be loaded.
+func (sd *SiloDefinition) ExecutionLimitList() []ExecutionLimit {
+	var limits []ExecutionLimit
+
+	if !sd.ExecutionLimits.Empty() {
+		limits = append(limits, ExecutionLimit{
+			Key:    "silo:" + sd.ID,
+			Limits: *sd.ExecutionLimits,
+		})
+	}
+
+	if !sd.SiloSpecification.ExecutionLimits.Empty() {
+		limits = append(limits, ExecutionLimit{
+			Key:    "spec:" + sd.SiloSpecificationID,
+			Limits: *sd.SiloSpecification.ExecutionLimits,
+		})
+	}
+
+	return limits
+}
+
+// ExecutionSlot is held by a connector execution while it runs. Released slots
+// are kept for a minute, so they still count towards the per-minute limit.
+type ExecutionSlot struct {
+	ID         string
+	Key        string `gorm:"index"`
+	HolderID   string `gorm:"index"`
+	AcquiredAt time.Time
+	// ExpiresAt is when the slot is freed if it isn't released, in case the
+	// execution's worker stopped.
+	ExpiresAt  time.Time
+	ReleasedAt *time.Time
+}
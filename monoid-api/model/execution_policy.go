@@ -0,0 +1,165 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultExecutionPolicy is used for the fields that aren't set by a silo or its
+// specification.
+var DefaultExecutionPolicy = ExecutionPolicy{
+	ActivityTimeoutSeconds:  intPtr(2 * 60),
+	MaxAttempts:             intPtr(5),
+	PollIntervalSeconds:     intPtr(60 * 60),
+	HeartbeatTimeoutSeconds: intPtr(30),
+}
+
+// ExecutionPolicy controls the timeouts, retries, and polling of the workflows
+// that run on a silo. Fields that are nil aren't set by the policy.
+type ExecutionPolicy struct {
+	// ActivityTimeoutSeconds is the longest a connector activity can run.
+	ActivityTimeoutSeconds *int `json:"activityTimeoutSeconds,omitempty" yaml:"activityTimeoutSeconds,omitempty"`
+	// MaxAttempts is the number of times a connector activity is tried.
+	MaxAttempts *int `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	// PollIntervalSeconds is how long to wait between checking the status of
+	// requests that are still in progress.
+	PollIntervalSeconds *int `json:"pollIntervalSeconds,omitempty" yaml:"pollIntervalSeconds,omitempty"`
+	// HeartbeatTimeoutSeconds is how long a connector activity can go without
+	// a heartbeat before it's considered failed.
+	HeartbeatTimeoutSeconds *int `json:"heartbeatTimeoutSeconds,omitempty" yaml:"heartbeatTimeoutSeconds,omitempty"`
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// NewExecutionPolicy converts the input to a policy, returning nil if the input
+// is nil.
+func NewExecutionPolicy(input *ExecutionPolicyInput) (*ExecutionPolicy, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	p := &ExecutionPolicy{
+		ActivityTimeoutSeconds:  input.ActivityTimeoutSeconds,
+		MaxAttempts:             input.MaxAttempts,
+		PollIntervalSeconds:     input.PollIntervalSeconds,
+		HeartbeatTimeoutSeconds: input.HeartbeatTimeoutSeconds,
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Validate returns an error if any of the policy's fields are out of range.
+func (p *ExecutionPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"activityTimeoutSeconds", p.ActivityTimeoutSeconds},
+		{"maxAttempts", p.MaxAttempts},
+		{"pollIntervalSeconds", p.PollIntervalSeconds},
+		{"heartbeatTimeoutSeconds", p.HeartbeatTimeoutSeconds},
+	}
+
+	for _, f := range fields {
+		if f.value != nil && *f.value <= 0 {
+			return fmt.Errorf("%s must be positive", f.name)
+		}
+	}
+
+	return nil
+}
+
+// Merge returns the policy with its unset fields taken from fallback.
+func (p *ExecutionPolicy) Merge(fallback *ExecutionPolicy) ExecutionPolicy {
+	res := ExecutionPolicy{}
+	if p != nil {
+		res = *p
+	}
+
+	if fallback == nil {
+		return res
+	}
+
+	if res.ActivityTimeoutSeconds == nil {
+		res.ActivityTimeoutSeconds = fallback.ActivityTimeoutSeconds
+	}
+
+	if res.MaxAttempts == nil {
+		res.MaxAttempts = fallback.MaxAttempts
+	}
+
+	if res.PollIntervalSeconds == nil {
+		res.PollIntervalSeconds = fallback.PollIntervalSeconds
+	}
+
+	if res.HeartbeatTimeoutSeconds == nil {
+		res.HeartbeatTimeoutSeconds = fallback.HeartbeatTimeoutSeconds
+	}
+
+	return res
+}
+
+// ActivityTimeout returns the policy's activity timeout, or the default.
+func (p ExecutionPolicy) ActivityTimeout() time.Duration {
+	return time.Duration(*p.Merge(&DefaultExecutionPolicy).ActivityTimeoutSeconds) * time.Second
+}
+
+// Attempts returns the policy's maximum number of attempts, or the default.
+func (p ExecutionPolicy) Attempts() int32 {
+	return int32(*p.Merge(&DefaultExecutionPolicy).MaxAttempts)
+}
+
+// PollInterval returns the policy's poll interval, or the default.
+func (p ExecutionPolicy) PollInterval() time.Duration {
+	return time.Duration(*p.Merge(&DefaultExecutionPolicy).PollIntervalSeconds) * time.Second
+}
+
+// HeartbeatTimeout returns the policy's heartbeat timeout, or the default.
+func (p ExecutionPolicy) HeartbeatTimeout() time.Duration {
+	return time.Duration(*p.Merge(&DefaultExecutionPolicy).HeartbeatTimeoutSeconds) * time.Second
+}
+
+func (p ExecutionPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *ExecutionPolicy) Scan(value interface{}) error {
+	var bytes []byte
+
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("could not scan execution policy")
+	}
+
+	return json.Unmarshal(bytes, p)
+}
+
+func (ExecutionPolicy) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return "jsonb"
+}
+
+// EffectiveExecutionPolicy returns the silo's policy, with the fields it doesn't
+// set taken from its specification's policy. The SiloSpecification must be
+// loaded.
+func (sd *SiloDefinition) EffectiveExecutionPolicy() ExecutionPolicy {
+	return sd.ExecutionPolicy.Merge(sd.SiloSpecification.ExecutionPolicy)
+}
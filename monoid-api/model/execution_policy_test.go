@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveExecutionPolicy(t *testing.T) {
+	silo := SiloDefinition{
+		ExecutionPolicy: &ExecutionPolicy{
+			PollIntervalSeconds: intPtr(60),
+		},
+		SiloSpecification: SiloSpecification{
+			ExecutionPolicy: &ExecutionPolicy{
+				ActivityTimeoutSeconds: intPtr(3600),
+				PollIntervalSeconds:    intPtr(600),
+			},
+		},
+	}
+
+	policy := silo.EffectiveExecutionPolicy()
+
+	assert.Equal(t, time.Minute, policy.PollInterval())
+	assert.Equal(t, time.Hour, policy.ActivityTimeout())
+	assert.Equal(t, int32(*DefaultExecutionPolicy.MaxAttempts), policy.Attempts())
+	assert.Equal(t, 30*time.Second, policy.HeartbeatTimeout())
+
+	empty := ExecutionPolicy{}
+	assert.Equal(t, 2*time.Minute, empty.ActivityTimeout())
+	assert.Equal(t, time.Hour, empty.PollInterval())
+}
+
+func TestExecutionPolicyValidate(t *testing.T) {
+	_, err := NewExecutionPolicy(&ExecutionPolicyInput{MaxAttempts: intPtr(0)})
+	assert.Error(t, err)
+
+	p, err := NewExecutionPolicy(&ExecutionPolicyInput{MaxAttempts: intPtr(3)})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), p.Attempts())
+
+	p, err = NewExecutionPolicy(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 )
@@ -28,25 +29,50 @@ type CreateDataSourceInput struct {
 	Properties       []*PropertyInput `json:"properties"`
 }
 
+type CreateDiscoveryPolicyInput struct {
+	WorkspaceID      string               `json:"workspaceId"`
+	SiloDefinitionID *string              `json:"siloDefinitionId"`
+	DiscoveryType    *DiscoveryType       `json:"discoveryType"`
+	Action           DiscoveryAction      `json:"action"`
+	MinConfidence    *DiscoveryConfidence `json:"minConfidence"`
+	SchemaPattern    *string              `json:"schemaPattern"`
+	Priority         *int                 `json:"priority"`
+}
+
+type CreateLineageEdgeInput struct {
+	WorkspaceID      string  `json:"workspaceId"`
+	FromDataSourceID string  `json:"fromDataSourceId"`
+	ToDataSourceID   string  `json:"toDataSourceId"`
+	FromPropertyID   *string `json:"fromPropertyId"`
+	ToPropertyID     *string `json:"toPropertyId"`
+}
+
 type CreatePropertyInput struct {
 	Property     *PropertyInput `json:"property"`
 	DataSourceID string         `json:"dataSourceID"`
 }
 
 type CreateSiloDefinitionInput struct {
-	Description         *string `json:"description"`
-	SiloSpecificationID string  `json:"siloSpecificationID"`
-	WorkspaceID         string  `json:"workspaceID"`
-	SiloData            *string `json:"siloData"`
-	Name                string  `json:"name"`
+	Description         *string               `json:"description"`
+	SiloSpecificationID string                `json:"siloSpecificationID"`
+	WorkspaceID         string                `json:"workspaceID"`
+	SiloData            *string               `json:"siloData"`
+	Name                string                `json:"name"`
+	ExecutionPolicy     *ExecutionPolicyInput `json:"executionPolicy"`
+	ExecutionLimits     *ExecutionLimitsInput `json:"executionLimits"`
 }
 
 type CreateSiloSpecificationInput struct {
-	Name        string  `json:"name"`
-	WorkspaceID string  `json:"workspaceID"`
-	LogoURL     *string `json:"logoURL"`
-	DockerImage string  `json:"dockerImage"`
-	Schema      *string `json:"schema"`
+	Name            string                `json:"name"`
+	WorkspaceID     string                `json:"workspaceID"`
+	LogoURL         *string               `json:"logoURL"`
+	DockerImage     string                `json:"dockerImage"`
+	DockerDigest    *string               `json:"dockerDigest"`
+	Schema          *string               `json:"schema"`
+	ExecutionPolicy *ExecutionPolicyInput `json:"executionPolicy"`
+	ExecutionLimits *ExecutionLimitsInput `json:"executionLimits"`
+	RequestBatching *RequestBatchingInput `json:"requestBatching"`
+	RunProfile      *RunProfileInput      `json:"runProfile"`
 }
 
 type CreateUserPrimaryKeyInput struct {
@@ -76,7 +102,32 @@ type DataMapResult struct {
 }
 
 type DownloadLink struct {
-	URL string `json:"url"`
+	// The signed path to download the file from, relative to the API server.
+	URL       string    `json:"url"`
+	GrantID   string    `json:"grantId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// The one-time code the data subject needs to use a public link. It is only
+	// returned when the link is created.
+	Code *string `json:"code"`
+}
+
+type DownloadLinkOptions struct {
+	// The number of minutes until the link expires. Defaults to 24 hours, and
+	// can be at most 7 days.
+	ExpiresInMinutes *int `json:"expiresInMinutes"`
+	MaxDownloads     *int `json:"maxDownloads"`
+}
+
+type ExecutionLimitsInput struct {
+	MaxConcurrent *int `json:"maxConcurrent"`
+	MaxPerMinute  *int `json:"maxPerMinute"`
+}
+
+type ExecutionPolicyInput struct {
+	ActivityTimeoutSeconds  *int `json:"activityTimeoutSeconds"`
+	MaxAttempts             *int `json:"maxAttempts"`
+	PollIntervalSeconds     *int `json:"pollIntervalSeconds"`
+	HeartbeatTimeoutSeconds *int `json:"heartbeatTimeoutSeconds"`
 }
 
 type HandleAllDiscoveriesInput struct {
@@ -89,6 +140,11 @@ type HandleDiscoveryInput struct {
 	Action      DiscoveryAction `json:"action"`
 }
 
+type JobLogEntriesResult struct {
+	Entries    []*JobLogEntry `json:"entries"`
+	NumEntries int            `json:"numEntries"`
+}
+
 type JobsResult struct {
 	Jobs    []*Job `json:"jobs"`
 	NumJobs int    `json:"numJobs"`
@@ -110,6 +166,11 @@ type PropertyInput struct {
 	CategoryIDs []string `json:"categoryIDs"`
 }
 
+type RequestBatchingInput struct {
+	WindowSeconds *int `json:"windowSeconds"`
+	MaxSize       *int `json:"maxSize"`
+}
+
 type RequestStatusListResult struct {
 	RequestStatusRows []*RequestStatus `json:"requestStatusRows"`
 	NumStatuses       int              `json:"numStatuses"`
@@ -124,6 +185,18 @@ type RequestsResult struct {
 	NumRequests int        `json:"numRequests"`
 }
 
+type RunProfileInput struct {
+	MemoryMb         *int     `json:"memoryMb"`
+	Cpus             *float64 `json:"cpus"`
+	PidsLimit        *int     `json:"pidsLimit"`
+	ReadOnlyRootFs   *bool    `json:"readOnlyRootFs"`
+	NoNewPrivileges  *bool    `json:"noNewPrivileges"`
+	DropCapabilities []string `json:"dropCapabilities"`
+	User             *string  `json:"user"`
+	NetworkMode      *string  `json:"networkMode"`
+	EgressProxy      *string  `json:"egressProxy"`
+}
+
 type UpdateCategoryInput struct {
 	Name *string `json:"name"`
 }
@@ -133,6 +206,15 @@ type UpdateDataSourceInput struct {
 	Description *string `json:"description"`
 }
 
+type UpdateDiscoveryPolicyInput struct {
+	ID            string               `json:"id"`
+	DiscoveryType *DiscoveryType       `json:"discoveryType"`
+	Action        DiscoveryAction      `json:"action"`
+	MinConfidence *DiscoveryConfidence `json:"minConfidence"`
+	SchemaPattern *string              `json:"schemaPattern"`
+	Priority      *int                 `json:"priority"`
+}
+
 type UpdatePropertyInput struct {
 	ID          string   `json:"id"`
 	CategoryIDs []string `json:"categoryIDs"`
@@ -149,14 +231,25 @@ type UpdateSiloDefinitionInput struct {
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
 	SiloData    *string `json:"siloData"`
+	// Replaces the silo's execution policy, if it's set.
+	ExecutionPolicy *ExecutionPolicyInput `json:"executionPolicy"`
+	// Replaces the silo's execution limits, if it's set.
+	ExecutionLimits *ExecutionLimitsInput `json:"executionLimits"`
 }
 
 type UpdateSiloSpecificationInput struct {
 	ID          string  `json:"id"`
 	DockerImage *string `json:"dockerImage"`
-	Schema      *string `json:"schema"`
-	Name        *string `json:"name"`
-	LogoURL     *string `json:"logoUrl"`
+	// The digest to pin the image to, or an empty string to unpin it. The digest
+	// is cleared if the image is changed without a new one.
+	DockerDigest    *string               `json:"dockerDigest"`
+	Schema          *string               `json:"schema"`
+	Name            *string               `json:"name"`
+	LogoURL         *string               `json:"logoUrl"`
+	ExecutionPolicy *ExecutionPolicyInput `json:"executionPolicy"`
+	ExecutionLimits *ExecutionLimitsInput `json:"executionLimits"`
+	RequestBatching *RequestBatchingInput `json:"requestBatching"`
+	RunProfile      *RunProfileInput      `json:"runProfile"`
 }
 
 type UpdateUserPrimaryKeyInput struct {
@@ -169,10 +262,23 @@ type UpdateWorkspaceSettingsInput struct {
 	Settings    []*KVPair `json:"settings"`
 }
 
+type UpgradeSiloDefinitionInput struct {
+	ID string `json:"id"`
+	// The version to upgrade to. Defaults to the silo specification's current
+	// version.
+	SiloSpecificationVersionID *string `json:"siloSpecificationVersionID"`
+}
+
 type UserDataRequestInput struct {
 	PrimaryKeys []*UserPrimaryKeyInput `json:"primaryKeys"`
 	WorkspaceID string                 `json:"workspaceId"`
 	Type        UserDataRequestType    `json:"type"`
+	// The format of the request's results package, defaults to the workspace's
+	// export format.
+	ExportFormat *ExportFormat `json:"exportFormat"`
+	// Re-run a query after a delete request completes, to check that the data
+	// was removed. Defaults to the workspace's verifyDeletions setting.
+	VerifyDeletion *bool `json:"verifyDeletion"`
 }
 
 type UserPrimaryKeyInput struct {
@@ -221,6 +327,49 @@ func (e DiscoveryAction) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type DiscoveryConfidence string
+
+const (
+	DiscoveryConfidenceLow    DiscoveryConfidence = "LOW"
+	DiscoveryConfidenceMedium DiscoveryConfidence = "MEDIUM"
+	DiscoveryConfidenceHigh   DiscoveryConfidence = "HIGH"
+)
+
+var AllDiscoveryConfidence = []DiscoveryConfidence{
+	DiscoveryConfidenceLow,
+	DiscoveryConfidenceMedium,
+	DiscoveryConfidenceHigh,
+}
+
+func (e DiscoveryConfidence) IsValid() bool {
+	switch e {
+	case DiscoveryConfidenceLow, DiscoveryConfidenceMedium, DiscoveryConfidenceHigh:
+		return true
+	}
+	return false
+}
+
+func (e DiscoveryConfidence) String() string {
+	return string(e)
+}
+
+func (e *DiscoveryConfidence) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DiscoveryConfidence(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DiscoveryConfidence", str)
+	}
+	return nil
+}
+
+func (e DiscoveryConfidence) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type DiscoveryStatus string
 
 const (
@@ -272,6 +421,7 @@ const (
 	DiscoveryTypePropertyFound     DiscoveryType = "PROPERTY_FOUND"
 	DiscoveryTypePropertyMissing   DiscoveryType = "PROPERTY_MISSING"
 	DiscoveryTypeCategoryFound     DiscoveryType = "CATEGORY_FOUND"
+	DiscoveryTypePrimaryKeyLink    DiscoveryType = "PRIMARY_KEY_LINK"
 )
 
 var AllDiscoveryType = []DiscoveryType{
@@ -280,11 +430,12 @@ var AllDiscoveryType = []DiscoveryType{
 	DiscoveryTypePropertyFound,
 	DiscoveryTypePropertyMissing,
 	DiscoveryTypeCategoryFound,
+	DiscoveryTypePrimaryKeyLink,
 }
 
 func (e DiscoveryType) IsValid() bool {
 	switch e {
-	case DiscoveryTypeDataSourceMissing, DiscoveryTypeDataSourceFound, DiscoveryTypePropertyFound, DiscoveryTypePropertyMissing, DiscoveryTypeCategoryFound:
+	case DiscoveryTypeDataSourceMissing, DiscoveryTypeDataSourceFound, DiscoveryTypePropertyFound, DiscoveryTypePropertyMissing, DiscoveryTypeCategoryFound, DiscoveryTypePrimaryKeyLink:
 		return true
 	}
 	return false
@@ -311,6 +462,102 @@ func (e DiscoveryType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+// The format that request results are packaged in.
+type ExportFormat string
+
+const (
+	// A .tar.gz archive with a JSON file per data source.
+	ExportFormatJSON ExportFormat = "JSON"
+	// A .tar.gz archive with a CSV file per data source.
+	ExportFormatCSV ExportFormat = "CSV"
+	// A self-contained HTML report, with the data map's category labels.
+	ExportFormatHTML ExportFormat = "HTML"
+	// A .zip archive with the JSON and CSV files, and the HTML report.
+	ExportFormatZip ExportFormat = "ZIP"
+)
+
+var AllExportFormat = []ExportFormat{
+	ExportFormatJSON,
+	ExportFormatCSV,
+	ExportFormatHTML,
+	ExportFormatZip,
+}
+
+func (e ExportFormat) IsValid() bool {
+	switch e {
+	case ExportFormatJSON, ExportFormatCSV, ExportFormatHTML, ExportFormatZip:
+		return true
+	}
+	return false
+}
+
+func (e ExportFormat) String() string {
+	return string(e)
+}
+
+func (e *ExportFormat) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ExportFormat(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ExportFormat", str)
+	}
+	return nil
+}
+
+func (e ExportFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// How a property's values are treated when a user's data is exported.
+type ExportPolicy string
+
+const (
+	ExportPolicyInclude ExportPolicy = "INCLUDE"
+	ExportPolicyExclude ExportPolicy = "EXCLUDE"
+	ExportPolicyHash    ExportPolicy = "HASH"
+	ExportPolicyMask    ExportPolicy = "MASK"
+)
+
+var AllExportPolicy = []ExportPolicy{
+	ExportPolicyInclude,
+	ExportPolicyExclude,
+	ExportPolicyHash,
+	ExportPolicyMask,
+}
+
+func (e ExportPolicy) IsValid() bool {
+	switch e {
+	case ExportPolicyInclude, ExportPolicyExclude, ExportPolicyHash, ExportPolicyMask:
+		return true
+	}
+	return false
+}
+
+func (e ExportPolicy) String() string {
+	return string(e)
+}
+
+func (e *ExportPolicy) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ExportPolicy(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ExportPolicy", str)
+	}
+	return nil
+}
+
+func (e ExportPolicy) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type FullRequestStatus string
 
 const (
@@ -405,6 +652,92 @@ func (e JobStatus) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type LineageEdgeType string
+
+const (
+	LineageEdgeTypeManual   LineageEdgeType = "MANUAL"
+	LineageEdgeTypeInferred LineageEdgeType = "INFERRED"
+)
+
+var AllLineageEdgeType = []LineageEdgeType{
+	LineageEdgeTypeManual,
+	LineageEdgeTypeInferred,
+}
+
+func (e LineageEdgeType) IsValid() bool {
+	switch e {
+	case LineageEdgeTypeManual, LineageEdgeTypeInferred:
+		return true
+	}
+	return false
+}
+
+func (e LineageEdgeType) String() string {
+	return string(e)
+}
+
+func (e *LineageEdgeType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LineageEdgeType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LineageEdgeType", str)
+	}
+	return nil
+}
+
+func (e LineageEdgeType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LogLevel string
+
+const (
+	LogLevelDebug LogLevel = "DEBUG"
+	LogLevelInfo  LogLevel = "INFO"
+	LogLevelWarn  LogLevel = "WARN"
+	LogLevelError LogLevel = "ERROR"
+)
+
+var AllLogLevel = []LogLevel{
+	LogLevelDebug,
+	LogLevelInfo,
+	LogLevelWarn,
+	LogLevelError,
+}
+
+func (e LogLevel) IsValid() bool {
+	switch e {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+		return true
+	}
+	return false
+}
+
+func (e LogLevel) String() string {
+	return string(e)
+}
+
+func (e *LogLevel) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LogLevel(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LogLevel", str)
+	}
+	return nil
+}
+
+func (e LogLevel) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type RequestStatusType string
 
 const (
@@ -413,6 +746,10 @@ const (
 	RequestStatusTypeManualNeeded RequestStatusType = "MANUAL_NEEDED"
 	RequestStatusTypeExecuted     RequestStatusType = "EXECUTED"
 	RequestStatusTypeFailed       RequestStatusType = "FAILED"
+	// The delete completed, but the data source still returned records for
+	// the user when it was queried afterwards.
+	RequestStatusTypeVerificationFailed RequestStatusType = "VERIFICATION_FAILED"
+	RequestStatusTypeCancelled          RequestStatusType = "CANCELLED"
 )
 
 var AllRequestStatusType = []RequestStatusType{
@@ -421,11 +758,13 @@ var AllRequestStatusType = []RequestStatusType{
 	RequestStatusTypeManualNeeded,
 	RequestStatusTypeExecuted,
 	RequestStatusTypeFailed,
+	RequestStatusTypeVerificationFailed,
+	RequestStatusTypeCancelled,
 }
 
 func (e RequestStatusType) IsValid() bool {
 	switch e {
-	case RequestStatusTypeCreated, RequestStatusTypeInProgress, RequestStatusTypeManualNeeded, RequestStatusTypeExecuted, RequestStatusTypeFailed:
+	case RequestStatusTypeCreated, RequestStatusTypeInProgress, RequestStatusTypeManualNeeded, RequestStatusTypeExecuted, RequestStatusTypeFailed, RequestStatusTypeVerificationFailed, RequestStatusTypeCancelled:
 		return true
 	}
 	return false
@@ -8,6 +8,8 @@ import (
 const (
 	JobTypeDiscoverSources = "discover_sources"
 	JobTypeExecuteRequest  = "execute_request"
+	JobTypeInferLineage    = "infer_lineage"
+	JobTypeUpgradeSilos    = "upgrade_silos"
 )
 
 type Job struct {
@@ -24,6 +26,54 @@ type Job struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// JobLogStream is a log object that a worker wrote a job's log entries to. Each
+// activity writes to its own stream, since they can run at the same time.
+type JobLogStream struct {
+	ID         string
+	JobID      string
+	Job        Job `gorm:"constraint:OnDelete:CASCADE;"`
+	ObjectName string
+
+	CreatedAt time.Time
+}
+
+// JobProgress tracks a request job's progress on a single silo.
+type JobProgress struct {
+	ID               string         `json:"id"`
+	JobID            string         `json:"jobId" gorm:"uniqueIndex:idx_job_progress_silo"`
+	Job              Job            `json:"job" gorm:"constraint:OnDelete:CASCADE;"`
+	SiloDefinitionID string         `json:"siloDefinitionId" gorm:"uniqueIndex:idx_job_progress_silo"`
+	SiloDefinition   SiloDefinition `json:"siloDefinition" gorm:"constraint:OnDelete:CASCADE;"`
+	Status           JobStatus      `json:"status"`
+
+	StartedAt  *time.Time `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+
+	// PollCount is the number of times the silo was asked for the status
+	// of the request.
+	PollCount       int   `json:"pollCount"`
+	RecordsReceived int   `json:"recordsReceived"`
+	BytesWritten    int64 `json:"bytesWritten"`
+
+	// DataSourcesTotal and DataSourcesCompleted are computed from the
+	// request's statuses when the progress is loaded.
+	DataSourcesTotal     int `json:"dataSourcesTotal" gorm:"-"`
+	DataSourcesCompleted int `json:"dataSourcesCompleted" gorm:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// JobLogEntry is a single line of a job's logs.
+type JobLogEntry struct {
+	Time             time.Time `json:"time"`
+	Level            LogLevel  `json:"level"`
+	Source           string    `json:"source"`
+	Message          string    `json:"message"`
+	SiloDefinitionID *string   `json:"siloDefinitionId,omitempty"`
+	DataSourceID     *string   `json:"dataSourceId,omitempty"`
+}
+
 func (j *Job) KeyField(field string) (string, error) {
 	if field == "id" {
 		return j.ID, nil
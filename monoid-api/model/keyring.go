@@ -0,0 +1,77 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Keyring holds the keys used to encrypt secrets. New values are always
+// encrypted with the primary key, and values encrypted with any of the
+// keys in the ring can be decrypted.
+type Keyring struct {
+	primaryID string
+	keys      map[string][]byte
+	order     []string
+}
+
+// KeyID returns the identifier that is stored with values encrypted
+// with the key.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// NewKeyring creates a keyring that encrypts with primary, and can also
+// decrypt values encrypted with any of the previous keys.
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	kr := &Keyring{
+		keys: map[string][]byte{},
+	}
+
+	for i, key := range append([][]byte{primary}, previous...) {
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("key %d must be 16, 24 or 32 bytes, got %d", i, len(key))
+		}
+
+		id := KeyID(key)
+		if _, ok := kr.keys[id]; ok {
+			continue
+		}
+
+		kr.keys[id] = key
+		kr.order = append(kr.order, id)
+	}
+
+	kr.primaryID = kr.order[0]
+
+	return kr, nil
+}
+
+// PrimaryID returns the ID of the key used for encryption.
+func (k *Keyring) PrimaryID() string {
+	return k.primaryID
+}
+
+// Primary returns the key used for encryption.
+func (k *Keyring) Primary() []byte {
+	return k.keys[k.primaryID]
+}
+
+// Key returns the key with the ID, if it's in the ring.
+func (k *Keyring) Key(id string) ([]byte, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// Keys returns all the keys in the ring, starting with the primary key.
+func (k *Keyring) Keys() [][]byte {
+	keys := make([][]byte, 0, len(k.order))
+	for _, id := range k.order {
+		keys = append(keys, k.keys[id])
+	}
+
+	return keys
+}
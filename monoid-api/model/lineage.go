@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LineageEdge records that the data in ToDataSource is copied or derived from
+// FromDataSource. If the property IDs are set, the edge is between two properties
+// of the data sources.
+type LineageEdge struct {
+	ID               string
+	WorkspaceID      string
+	Workspace        Workspace `gorm:"constraint:OnDelete:CASCADE;"`
+	FromDataSourceID string
+	FromDataSource   DataSource `gorm:"constraint:OnDelete:CASCADE;"`
+	ToDataSourceID   string
+	ToDataSource     DataSource `gorm:"constraint:OnDelete:CASCADE;"`
+	FromPropertyID   *string
+	FromProperty     *Property `gorm:"constraint:OnDelete:CASCADE;"`
+	ToPropertyID     *string
+	ToProperty       *Property `gorm:"constraint:OnDelete:CASCADE;"`
+
+	Type LineageEdgeType
+
+	// Confidence and Reason are only set for inferred edges.
+	Confidence *float64
+	Reason     *string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PropertySample holds hashes of values sampled from a property during
+// discovery, which are used to infer lineage between properties.
+type PropertySample struct {
+	PropertyID string   `gorm:"primaryKey"`
+	Property   Property `gorm:"constraint:OnDelete:CASCADE;"`
+	Hashes     datatypes.JSON
+
+	UpdatedAt time.Time
+}
+
+func (s *PropertySample) DeserializeHashes() ([]string, error) {
+	res := []string{}
+	if err := json.Unmarshal(s.Hashes, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// LineageGraph is the set of lineage edges in a workspace, along with
+// the data sources they connect.
+type LineageGraph struct {
+	DataSources []*DataSource
+	Edges       []*LineageEdge
+}
+
+// LineageWarning is raised for a data source that is downstream of a data source
+// with user data, but isn't linked to a user primary key itself.
+type LineageWarning struct {
+	DataSourceID         string
+	UpstreamDataSourceID string
+	Message              string
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	defaultBatchWindow  = time.Minute
+	defaultBatchMaxSize = 100
+)
+
+// RequestBatching enables batching for the silos of a specification. Requests
+// that arrive within the window are started together, with a single connector
+// invocation. The connector must tag the handles it returns with the request
+// IDs of the identifiers they're for.
+type RequestBatching struct {
+	// WindowSeconds is how long to wait for more requests after the first
+	// request of a batch arrives.
+	WindowSeconds *int `json:"windowSeconds,omitempty" yaml:"windowSeconds,omitempty"`
+	// MaxSize is the most requests in a batch.
+	MaxSize *int `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+}
+
+// NewRequestBatching converts the input to batching settings, returning nil if
+// the input is nil.
+func NewRequestBatching(input *RequestBatchingInput) (*RequestBatching, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	b := &RequestBatching{
+		WindowSeconds: input.WindowSeconds,
+		MaxSize:       input.MaxSize,
+	}
+
+	if b.WindowSeconds != nil && *b.WindowSeconds <= 0 {
+		return nil, fmt.Errorf("windowSeconds must be positive")
+	}
+
+	if b.MaxSize != nil && *b.MaxSize <= 0 {
+		return nil, fmt.Errorf("maxSize must be positive")
+	}
+
+	return b, nil
+}
+
+// Window returns the batch window, or the default.
+func (b RequestBatching) Window() time.Duration {
+	if b.WindowSeconds == nil {
+		return defaultBatchWindow
+	}
+
+	return time.Duration(*b.WindowSeconds) * time.Second
+}
+
+// Size returns the maximum batch size, or the default.
+func (b RequestBatching) Size() int {
+	if b.MaxSize == nil {
+		return defaultBatchMaxSize
+	}
+
+	return *b.MaxSize
+}
+
+func (b RequestBatching) Value() (driver.Value, error) {
+	return json.Marshal(b)
+}
+
+func (b *RequestBatching) Scan(value interface{}) error {
+	var bytes []byte
+
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("could not scan request batching")
+	}
+
+	return json.Unmarshal(bytes, b)
+}
+
+func (RequestBatching) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return "jsonb"
+}
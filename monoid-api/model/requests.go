@@ -1,8 +1,12 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type ResultType string
@@ -22,6 +26,12 @@ type RequestStatus struct {
 	RequestHandle SecretString
 
 	QueryResult *QueryResult
+
+	// ResidualRecordCount is the number of records returned by the query that
+	// verified a deletion, and is nil if the deletion wasn't verified.
+	ResidualRecordCount *int
+	VerifiedAt          *time.Time
+	VerificationError   *string
 }
 
 type UserPrimaryKey struct {
@@ -36,6 +46,13 @@ type UserPrimaryKey struct {
 type DownloadableFile struct {
 	ID          string
 	StoragePath string
+
+	// FileName and ContentType are sent when the file is downloaded.
+	FileName    *string
+	ContentType *string
+
+	// Format is the format that a request's results were packaged in.
+	Format *ExportFormat
 }
 
 type Request struct {
@@ -46,17 +63,33 @@ type Request struct {
 	RequestStatuses  []RequestStatus
 	Type             UserDataRequestType
 
+	// ExportFormat overrides the workspace's export format for the request.
+	ExportFormat *ExportFormat
+
+	// VerifyDeletion re-runs the query after a delete request completes,
+	// to check that the data was removed.
+	VerifyDeletion bool `gorm:"default:false"`
+
 	DownloadableFileID *string
 	DownloadableFile   *DownloadableFile
 
 	JobID *string
 	Job   *Job
 
+	// ResultStatus is the status of the request computed from its request
+	// statuses, which is used once the latest job has finished, since retries
+	// only run on some of the request's data sources.
+	ResultStatus *FullRequestStatus
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
 func (r *Request) Status() (FullRequestStatus, error) {
+	if r.Job.Status != JobStatusQueued && r.Job.Status != JobStatusRunning && r.ResultStatus != nil {
+		return *r.ResultStatus, nil
+	}
+
 	switch r.Job.Status {
 	case JobStatusCompleted:
 		return FullRequestStatusExecuted, nil
@@ -71,6 +104,45 @@ func (r *Request) Status() (FullRequestStatus, error) {
 	return FullRequestStatusCreated, fmt.Errorf("error finding status")
 }
 
+// AggregateRequestStatus returns the status of a request whose jobs have
+// finished, given the statuses of each of its data sources.
+func AggregateRequestStatus(statuses []RequestStatusType) FullRequestStatus {
+	executed := 0
+
+	for _, s := range statuses {
+		if s == RequestStatusTypeExecuted {
+			executed++
+		}
+	}
+
+	switch {
+	case executed == len(statuses):
+		return FullRequestStatusExecuted
+	case executed == 0:
+		return FullRequestStatusFailed
+	default:
+		return FullRequestStatusPartialFailed
+	}
+}
+
+// RecomputeRequestStatus updates the request's result status from the current
+// statuses of its data sources.
+func RecomputeRequestStatus(db *gorm.DB, requestID string) (FullRequestStatus, error) {
+	statuses := []RequestStatusType{}
+	if err := db.Model(&RequestStatus{}).Where(
+		"request_id = ?", requestID,
+	).Pluck("status", &statuses).Error; err != nil {
+		return "", err
+	}
+
+	status := AggregateRequestStatus(statuses)
+	if err := db.Model(&Request{ID: requestID}).Update("result_status", status).Error; err != nil {
+		return "", err
+	}
+
+	return status, nil
+}
+
 type PrimaryKeyValue struct {
 	ID               string
 	UserPrimaryKeyID string
@@ -89,6 +161,21 @@ type QueryResult struct {
 	ResultType ResultType
 	Records    *SecretString
 
+	// RecordsPath is the file store object that RECORDS_JSON results are
+	// streamed to, as gzipped JSONL. Records is only set for results that
+	// were stored before records were streamed.
+	RecordsPath *string
+	RecordCount *int
+
+	// Redacted is true if the data source's export policies were applied
+	// before the records were stored.
+	Redacted bool `gorm:"default:false"`
+
+	// RedactionPolicies are the export policies that were applied to the
+	// records, by property name. It's unset for results that were redacted
+	// before the policies were stored.
+	RedactionPolicies datatypes.JSON
+
 	RequestStatusID string
 	RequestStatus   RequestStatus
 
@@ -96,6 +183,21 @@ type QueryResult struct {
 	DownloadableFile   *DownloadableFile
 }
 
+// AppliedPolicies returns the export policies that were applied to the
+// records before they were stored, or nil if they weren't recorded.
+func (q *QueryResult) AppliedPolicies() (map[string]ExportPolicy, error) {
+	if len(q.RedactionPolicies) == 0 {
+		return nil, nil
+	}
+
+	res := map[string]ExportPolicy{}
+	if err := json.Unmarshal(q.RedactionPolicies, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (q *QueryResult) KeyField(field string) (string, error) {
 	if field == "id" {
 		return q.ID, nil
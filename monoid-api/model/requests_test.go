@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateRequestStatus(t *testing.T) {
+	for _, tc := range []struct {
+		statuses []RequestStatusType
+		expected FullRequestStatus
+	}{
+		{[]RequestStatusType{}, FullRequestStatusExecuted},
+		{[]RequestStatusType{RequestStatusTypeExecuted, RequestStatusTypeExecuted}, FullRequestStatusExecuted},
+		{[]RequestStatusType{RequestStatusTypeExecuted, RequestStatusTypeFailed}, FullRequestStatusPartialFailed},
+		{[]RequestStatusType{RequestStatusTypeExecuted, RequestStatusTypeCancelled}, FullRequestStatusPartialFailed},
+		{[]RequestStatusType{RequestStatusTypeVerificationFailed, RequestStatusTypeFailed}, FullRequestStatusFailed},
+	} {
+		assert.Equal(t, tc.expected, AggregateRequestStatus(tc.statuses), tc.statuses)
+	}
+}
+
+func TestRequestStatus(t *testing.T) {
+	executed := FullRequestStatusExecuted
+
+	// A retry job that succeeded on the failed silos completes the request.
+	r := Request{Job: &Job{Status: JobStatusPartialFailed}, ResultStatus: &executed}
+	status, err := r.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, FullRequestStatusExecuted, status)
+
+	// The request is in progress while a job is running, whatever the last result was.
+	r.Job.Status = JobStatusRunning
+	status, err = r.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, FullRequestStatusInProgress, status)
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// RunProfile is the sandbox that a specification's connector runs in.
+type RunProfile monoidprotocol.RunProfile
+
+// NewRunProfile converts the input to a run profile, returning nil if the input
+// is nil.
+func NewRunProfile(input *RunProfileInput) (*RunProfile, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	p := &RunProfile{
+		MemoryMB:         input.MemoryMb,
+		CPUs:             input.Cpus,
+		PidsLimit:        input.PidsLimit,
+		DropCapabilities: input.DropCapabilities,
+		User:             input.User,
+		NetworkMode:      input.NetworkMode,
+		EgressProxy:      input.EgressProxy,
+	}
+
+	if input.ReadOnlyRootFs != nil {
+		p.ReadOnlyRootFS = *input.ReadOnlyRootFs
+	}
+
+	if input.NoNewPrivileges != nil {
+		p.NoNewPrivileges = *input.NoNewPrivileges
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Validate returns an error if any of the profile's fields are invalid.
+func (p *RunProfile) Validate() error {
+	if p == nil {
+		return nil
+	}
+
+	if p.MemoryMB != nil && *p.MemoryMB <= 0 {
+		return fmt.Errorf("memoryMb must be positive")
+	}
+
+	if p.CPUs != nil && *p.CPUs <= 0 {
+		return fmt.Errorf("cpus must be positive")
+	}
+
+	if p.PidsLimit != nil && *p.PidsLimit <= 0 {
+		return fmt.Errorf("pidsLimit must be positive")
+	}
+
+	for _, c := range p.DropCapabilities {
+		if c == "" || strings.ContainsAny(c, " \t") {
+			return fmt.Errorf("invalid capability %q", c)
+		}
+	}
+
+	if p.User != nil && *p.User == "" {
+		return fmt.Errorf("user can't be empty")
+	}
+
+	if p.NetworkMode != nil && *p.NetworkMode == "" {
+		return fmt.Errorf("networkMode can't be empty")
+	}
+
+	if p.EgressProxy != nil {
+		u, err := url.Parse(*p.EgressProxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("egressProxy must be a URL")
+		}
+	}
+
+	return nil
+}
+
+// Protocol returns the profile to run the connector with, or nil if the
+// profile is nil.
+func (p *RunProfile) Protocol() *monoidprotocol.RunProfile {
+	return (*monoidprotocol.RunProfile)(p)
+}
+
+func (p RunProfile) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *RunProfile) Scan(value interface{}) error {
+	var bytes []byte
+
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("could not scan run profile")
+	}
+
+	return json.Unmarshal(bytes, p)
+}
+
+func (RunProfile) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return "jsonb"
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -8,21 +9,45 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
 
 type SecretString string
 
-var encryptionKey []byte
+// Secrets are stored as
+//
+//	secretPrefix | key id length (1 byte) | key id | nonce | ciphertext
+//
+// with the key id as additional data. Values written before key ids were
+// added are just the nonce and ciphertext, and are decrypted by trying every
+// key in the keyring.
+var secretPrefix = []byte("mk1:")
 
+var keyring *Keyring
+
+// SetEncryptionKey sets a keyring with just the key.
 func SetEncryptionKey(key []byte) {
-	encryptionKey = key
+	kr, err := NewKeyring(key)
+	if err != nil {
+		panic(err)
+	}
+
+	SetKeyring(kr)
+}
+
+// SetKeyring sets the keyring used to encrypt and decrypt secrets.
+func SetKeyring(kr *Keyring) {
+	keyring = kr
 }
 
-func gcmCipher() (cipher.AEAD, error) {
-	c, err := aes.NewCipher(encryptionKey)
+// GetKeyring returns the keyring used to encrypt and decrypt secrets.
+func GetKeyring() *Keyring {
+	return keyring
+}
+
+func gcmCipher(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
 
 	if err != nil {
 		return nil, err
@@ -37,30 +62,91 @@ func gcmCipher() (cipher.AEAD, error) {
 	return gcm, err
 }
 
-func (s *SecretString) Scan(value interface{}) error {
-	bytes, ok := value.([]byte)
-	if !ok {
-		return fmt.Errorf("could not scan value")
+// parseSecret splits a secret in the current format into the key id and the
+// encrypted data.
+func parseSecret(value []byte) (string, []byte, bool) {
+	if !bytes.HasPrefix(value, secretPrefix) || len(value) < len(secretPrefix)+1 {
+		return "", nil, false
 	}
 
-	gcm, err := gcmCipher()
+	rest := value[len(secretPrefix):]
+	idLen := int(rest[0])
+	if len(rest) < 1+idLen {
+		return "", nil, false
+	}
+
+	return string(rest[1 : 1+idLen]), rest[1+idLen:], true
+}
 
+func openSecret(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := gcmCipher(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
-	if len(bytes) < nonceSize {
-		log.Err(err).Msg("Invalid secret")
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("invalid secret")
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// SecretKeyID returns the id of the key that the stored secret was encrypted
+// with, or an empty string if it was stored without a key id.
+func SecretKeyID(value []byte) string {
+	id, _, ok := parseSecret(value)
+	if !ok {
+		return ""
+	}
+
+	if _, ok := keyring.Key(id); !ok {
+		return ""
+	}
+
+	return id
+}
+
+// DecryptSecret decrypts a stored secret with the keyring.
+func DecryptSecret(value []byte) (SecretString, error) {
+	if keyring == nil {
+		return "", fmt.Errorf("no encryption key configured")
+	}
+
+	if id, data, ok := parseSecret(value); ok {
+		if key, ok := keyring.Key(id); ok {
+			plaintext, err := openSecret(key, data, []byte(id))
+			if err != nil {
+				return "", fmt.Errorf("error decrypting secret with key %s: %w", id, err)
+			}
+
+			return SecretString(plaintext), nil
+		}
+	}
+
+	for _, key := range keyring.Keys() {
+		plaintext, err := openSecret(key, value, nil)
+		if err == nil {
+			return SecretString(plaintext), nil
+		}
 	}
 
-	nonce, ciphertext := bytes[:nonceSize], bytes[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	return "", fmt.Errorf("could not decrypt secret with any key in the keyring")
+}
+
+func (s *SecretString) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("could not scan value")
+	}
+
+	plaintext, err := DecryptSecret(bytes)
 	if err != nil {
-		log.Err(err).Msg("Error decoding token")
+		return err
 	}
 
-	*s = SecretString(plaintext)
+	*s = plaintext
 	return nil
 }
 
@@ -69,24 +155,32 @@ func (s SecretString) GormDBDataType(db *gorm.DB, field *schema.Field) string {
 }
 
 func (s SecretString) ValueBytes() ([]byte, error) {
-	gcm, err := gcmCipher()
+	if keyring == nil {
+		return nil, fmt.Errorf("no encryption key configured")
+	}
+
+	id := keyring.PrimaryID()
 
+	gcm, err := gcmCipher(keyring.Primary())
 	if err != nil {
 		return nil, err
 	}
 
-	// https://tutorialedge.net/golang/go-encrypt-decrypt-aes-tutorial/
-
 	// creates a new byte array the size of the nonce
 	// which must be passed to Seal
 	nonce := make([]byte, gcm.NonceSize())
 	// populates our nonce with a cryptographically secure
 	// random sequence
 	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		log.Err(err).Msg("Error decoding token")
+		return nil, err
 	}
 
-	res := gcm.Seal(nonce, nonce, []byte(s), nil)
+	res := make([]byte, 0, len(secretPrefix)+1+len(id)+len(nonce)+len(s)+gcm.Overhead())
+	res = append(res, secretPrefix...)
+	res = append(res, byte(len(id)))
+	res = append(res, id...)
+	res = append(res, nonce...)
+	res = gcm.Seal(res, nonce, []byte(s), []byte(id))
 
 	return res, nil
 }
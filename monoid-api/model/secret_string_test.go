@@ -0,0 +1,81 @@
+package model
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, key)
+	require.NoError(t, err)
+
+	return key
+}
+
+// legacySecret encrypts the value in the format used before key ids were added.
+func legacySecret(t *testing.T, key []byte, value string) []byte {
+	gcm, err := gcmCipher(key)
+	require.NoError(t, err)
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	require.NoError(t, err)
+
+	return gcm.Seal(nonce, nonce, []byte(value), nil)
+}
+
+func TestSecretStringRotation(t *testing.T) {
+	oldKey := newKey(t)
+	newKey := newKey(t)
+
+	SetEncryptionKey(oldKey)
+
+	oldSecret, err := SecretString("secret").ValueBytes()
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(oldKey), SecretKeyID(oldSecret))
+
+	legacy := legacySecret(t, oldKey, "legacy")
+
+	// The new key can't read the old values until the old key is added to the ring.
+	SetEncryptionKey(newKey)
+
+	var s SecretString
+	assert.Error(t, s.Scan(oldSecret))
+	assert.Error(t, s.Scan(legacy))
+
+	kr, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	SetKeyring(kr)
+
+	require.NoError(t, s.Scan(oldSecret))
+	assert.Equal(t, SecretString("secret"), s)
+
+	require.NoError(t, s.Scan(legacy))
+	assert.Equal(t, SecretString("legacy"), s)
+	assert.Equal(t, "", SecretKeyID(legacy))
+
+	newSecret, err := s.ValueBytes()
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(newKey), SecretKeyID(newSecret))
+
+	// Tampered values are errors rather than garbage.
+	newSecret[len(newSecret)-1] ^= 1
+	assert.Error(t, s.Scan(newSecret))
+	assert.Error(t, s.Scan([]byte("short")))
+}
+
+func TestNewKeyring(t *testing.T) {
+	_, err := NewKeyring([]byte("too short"))
+	assert.Error(t, err)
+
+	key := newKey(t)
+	kr, err := NewKeyring(key, key)
+	require.NoError(t, err)
+	assert.Len(t, kr.Keys(), 1)
+	assert.Equal(t, KeyID(key), kr.PrimaryID())
+}
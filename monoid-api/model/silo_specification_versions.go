@@ -0,0 +1,166 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SiloSpecificationVersion is a connector image and config schema that a
+// specification has had. Silos record the version they were configured
+// against, so changing the specification doesn't change the silos using it
+// until they're upgraded.
+type SiloSpecificationVersion struct {
+	ID                  string
+	SiloSpecificationID string            `gorm:"uniqueIndex:idx_silo_specification_version"`
+	SiloSpecification   SiloSpecification `gorm:"constraint:OnDelete:CASCADE;"`
+	Version             int               `gorm:"uniqueIndex:idx_silo_specification_version"`
+
+	DockerImage  string
+	DockerTag    string
+	DockerDigest *string
+	Schema       *string
+
+	CreatedAt time.Time
+}
+
+// RecordSiloSpecificationVersion returns the version with the specification's
+// current connector image and schema, creating it if it doesn't exist. A change
+// to just the digest isn't a new version; the digest is set on the version with
+// the same image, tag and schema instead.
+func RecordSiloSpecificationVersion(db *gorm.DB, spec *SiloSpecification) (*SiloSpecificationVersion, error) {
+	version := SiloSpecificationVersion{}
+
+	q := db.Where(
+		"silo_specification_id = ? AND docker_image = ? AND docker_tag = ?",
+		spec.ID,
+		spec.DockerImage,
+		spec.DockerTag,
+	)
+
+	if spec.Schema != nil {
+		q = q.Where("schema = ?", *spec.Schema)
+	} else {
+		q = q.Where("schema IS NULL")
+	}
+
+	err := q.Order("version DESC").First(&version).Error
+	if err == nil {
+		if spec.DockerDigest == nil || equalStringPtr(spec.DockerDigest, version.DockerDigest) {
+			return &version, nil
+		}
+
+		if err := db.Model(&version).Update("docker_digest", *spec.DockerDigest).Error; err != nil {
+			return nil, err
+		}
+
+		version.DockerDigest = spec.DockerDigest
+
+		return &version, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	latest := 0
+	if err := db.Model(&SiloSpecificationVersion{}).Where(
+		"silo_specification_id = ?",
+		spec.ID,
+	).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	version = SiloSpecificationVersion{
+		ID:                  uuid.NewString(),
+		SiloSpecificationID: spec.ID,
+		Version:             latest + 1,
+		DockerImage:         spec.DockerImage,
+		DockerTag:           spec.DockerTag,
+		DockerDigest:        spec.DockerDigest,
+		Schema:              spec.Schema,
+	}
+
+	if err := db.Create(&version).Error; err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// AssignSiloSpecificationVersion records the specification's current version
+// on its silos that don't have one. It should be called before the
+// specification's connector image or schema are changed, so that its silos
+// keep running the version they were configured against.
+func AssignSiloSpecificationVersion(db *gorm.DB, spec *SiloSpecification) error {
+	if spec.Manual {
+		return nil
+	}
+
+	version, err := RecordSiloSpecificationVersion(db, spec)
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&SiloDefinition{}).Where(
+		"silo_specification_id = ? AND silo_specification_version_id IS NULL",
+		spec.ID,
+	).Update("silo_specification_version_id", version.ID).Error
+}
+
+// SetVersion moves the silo to the version of its specification, and keeps
+// the version it was on so that it can be rolled back.
+func (sd *SiloDefinition) SetVersion(db *gorm.DB, versionID string, previousID string) error {
+	if err := db.Model(sd).Updates(map[string]interface{}{
+		"silo_specification_version_id":          versionID,
+		"previous_silo_specification_version_id": previousID,
+	}).Error; err != nil {
+		return err
+	}
+
+	sd.SiloSpecificationVersionID = &versionID
+	sd.PreviousSiloSpecificationVersionID = &previousID
+
+	return nil
+}
+
+// VersionChanged returns true if the connector image, tag or schema are
+// different in the other specification. A different digest for the same tag
+// doesn't make a new version.
+func (ss *SiloSpecification) VersionChanged(other *SiloSpecification) bool {
+	return ss.DockerImage != other.DockerImage ||
+		ss.DockerTag != other.DockerTag ||
+		!equalStringPtr(ss.Schema, other.Schema)
+}
+
+// EffectiveSpecification returns the silo's specification with the connector
+// image and schema of the version that the silo is configured against. The
+// SiloSpecification and SiloSpecificationVersion must be preloaded.
+func (sd *SiloDefinition) EffectiveSpecification() SiloSpecification {
+	if sd.SiloSpecificationVersion == nil {
+		return sd.SiloSpecification
+	}
+
+	return sd.SiloSpecificationVersion.Apply(sd.SiloSpecification)
+}
+
+// Apply returns the specification with the version's connector image and
+// schema.
+func (v *SiloSpecificationVersion) Apply(spec SiloSpecification) SiloSpecification {
+	spec.DockerImage = v.DockerImage
+	spec.DockerTag = v.DockerTag
+	spec.DockerDigest = v.DockerDigest
+	spec.Schema = v.Schema
+
+	return spec
+}
+
+func equalStringPtr(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
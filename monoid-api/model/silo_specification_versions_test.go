@@ -0,0 +1,46 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveSpecification(t *testing.T) {
+	oldSchema := `{"type": "object"}`
+	newSchema := `{"type": "object", "required": ["port"]}`
+
+	silo := SiloDefinition{
+		SiloSpecification: SiloSpecification{
+			Name:        "Postgres",
+			DockerImage: "monoidco/monoid-postgres",
+			DockerTag:   "0.0.2",
+			Schema:      &newSchema,
+		},
+	}
+
+	// Silos without a version run the specification's current version.
+	assert.Equal(t, silo.SiloSpecification, silo.EffectiveSpecification())
+
+	silo.SiloSpecificationVersion = &SiloSpecificationVersion{
+		DockerImage: "monoidco/monoid-postgres",
+		DockerTag:   "0.0.1",
+		Schema:      &oldSchema,
+	}
+
+	spec := silo.EffectiveSpecification()
+	assert.Equal(t, "Postgres", spec.Name)
+	assert.Equal(t, "0.0.1", spec.DockerTag)
+	assert.Equal(t, &oldSchema, spec.Schema)
+	assert.Nil(t, spec.DockerDigest)
+
+	assert.True(t, silo.SiloSpecification.VersionChanged(&spec))
+	assert.False(t, spec.VersionChanged(&spec))
+
+	// Pinning the same tag to a digest isn't a new version.
+	digest := "sha256:" + strings.Repeat("a", 64)
+	pinned := spec
+	pinned.DockerDigest = &digest
+	assert.False(t, spec.VersionChanged(&pinned))
+}
@@ -25,6 +25,12 @@ type WorkspaceSettings struct {
 	Email         string `json:"email"`
 	SendNews      bool   `json:"sendNews"`
 	AnonymizeData bool   `json:"anonymizeData"`
+
+	// ExportFormat is the default format for request results packages.
+	ExportFormat ExportFormat `json:"exportFormat,omitempty"`
+
+	// VerifyDeletions is the default for whether delete requests are verified.
+	VerifyDeletions bool `json:"verifyDeletions,omitempty"`
 }
 
 func ValidateEmail(email string) bool {
@@ -0,0 +1,61 @@
+package monoidprotocol
+
+import (
+	"context"
+	"errors"
+)
+
+var errUnsupportedOptions = errors.New("the protocol doesn't support connector options")
+
+// ConnectorOptions change how a connector's image is pulled and run.
+type ConnectorOptions struct {
+	// Digest pins the connector's image to a digest, e.g. sha256:abc...
+	Digest *string
+	// RunProfile is the sandbox the connector is run in.
+	RunProfile *RunProfile
+}
+
+// IsZero returns true if none of the options are set.
+func (o ConnectorOptions) IsZero() bool {
+	return o.Digest == nil && o.RunProfile == nil
+}
+
+// ImageVerifier checks the signature of a connector's image before it's run.
+type ImageVerifier interface {
+	// Verify returns an error if the image with the digest isn't signed by
+	// a trusted key.
+	Verify(ctx context.Context, image string, digest string) error
+}
+
+// ConfigurableProtocolFactory is implemented by protocol factories that can
+// run connectors with options.
+type ConfigurableProtocolFactory interface {
+	NewMonoidProtocolWithOptions(
+		image string,
+		tag string,
+		persistDir string,
+		opts ConnectorOptions,
+	) (MonoidProtocol, error)
+}
+
+// NewMonoidProtocol creates a protocol with the factory. If any options are set
+// and the factory doesn't support them, an error is returned, since the
+// connector shouldn't run without its sandbox or pinned image.
+func NewMonoidProtocol(
+	factory MonoidProtocolFactory,
+	image string,
+	tag string,
+	persistDir string,
+	opts ConnectorOptions,
+) (MonoidProtocol, error) {
+	if opts.IsZero() {
+		return factory.NewMonoidProtocol(image, tag, persistDir)
+	}
+
+	cf, ok := factory.(ConfigurableProtocolFactory)
+	if !ok {
+		return nil, errUnsupportedOptions
+	}
+
+	return cf.NewMonoidProtocolWithOptions(image, tag, persistDir, opts)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
@@ -14,12 +16,28 @@ import (
 
 type DockerMonoidProtocol struct {
 	client      *client.Client
+	image       string
 	imageName   string
 	containerID *string
 	volumes     []string
 	logChan     chan monoidprotocol.MonoidLogMessage
 	closeClient bool
 	persistDir  string
+
+	// digest is the digest that the image is pinned to, if it's set.
+	digest *string
+	// verifier checks the image's signature before it's run, if it's set.
+	verifier monoidprotocol.ImageVerifier
+	// profile is the sandbox that connectors are run in, if it's set.
+	profile *monoidprotocol.RunProfile
+
+	// violationMu guards reportedViolations, and violationChanMu guards
+	// violationChan, so that violations are sent without holding violationMu.
+	violationMu        sync.Mutex
+	reportedViolations map[string]bool
+	violationChanMu    sync.RWMutex
+	violationChan      chan monoidprotocol.SandboxViolation
+	droppedViolations  int64
 }
 
 func NewDockerMPWithClient(
@@ -33,16 +51,32 @@ func NewDockerMPWithClient(
 
 	return &DockerMonoidProtocol{
 		client:      cli,
+		image:       dockerImage,
 		imageName:   imageName,
 		volumes:     []string{},
 		persistDir:  persistDir,
 		logChan:     nil,
 		closeClient: closeClient,
+
+		reportedViolations: map[string]bool{},
 	}
 }
 
 // NewDockerMP creates an docker-based interface for the monoid protocol.
 func NewDockerMP(dockerImage string, dockerTag string, persistDir string) (monoidprotocol.MonoidProtocol, error) {
+	return NewDockerMPWithOptions(dockerImage, dockerTag, persistDir, monoidprotocol.ConnectorOptions{}, nil)
+}
+
+// NewDockerMPWithOptions creates a docker-based interface for the monoid protocol
+// that runs connectors with the options. If the verifier is set, the image's
+// signature is checked before it's run.
+func NewDockerMPWithOptions(
+	dockerImage string,
+	dockerTag string,
+	persistDir string,
+	opts monoidprotocol.ConnectorOptions,
+	verifier monoidprotocol.ImageVerifier,
+) (monoidprotocol.MonoidProtocol, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv)
 
 	if err != nil {
@@ -51,11 +85,20 @@ func NewDockerMP(dockerImage string, dockerTag string, persistDir string) (monoi
 
 	cli.NegotiateAPIVersion(context.Background())
 
-	return NewDockerMPWithClient(dockerImage, dockerTag, persistDir, cli, true), nil
+	mp := NewDockerMPWithClient(dockerImage, dockerTag, persistDir, cli, true).(*DockerMonoidProtocol)
+	mp.profile = opts.RunProfile
+	mp.verifier = verifier
+
+	if opts.Digest != nil {
+		mp.digest = opts.Digest
+		mp.imageName = dockerImage + "@" + *opts.Digest
+	}
+
+	return mp, nil
 }
 
 func (dp *DockerMonoidProtocol) InitConn(ctx context.Context) error {
-	_, _, err := dp.client.ImageInspectWithRaw(ctx, dp.imageName)
+	info, _, err := dp.client.ImageInspectWithRaw(ctx, dp.imageName)
 
 	if err != nil {
 		log.Info().Msgf("Pulling image: %s", dp.imageName)
@@ -70,9 +113,14 @@ func (dp *DockerMonoidProtocol) InitConn(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("error copying image pull output: %v", err)
 		}
+
+		info, _, err = dp.client.ImageInspectWithRaw(ctx, dp.imageName)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return dp.checkImage(ctx, info.RepoDigests)
 }
 
 func (dp *DockerMonoidProtocol) Spec(ctx context.Context) (*monoidprotocol.MonoidSiloSpec, error) {
@@ -88,7 +136,7 @@ func (dp *DockerMonoidProtocol) Spec(ctx context.Context) (*monoidprotocol.Monoi
 		return nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	var res *monoidprotocol.MonoidSiloSpec
 
 	for s := range msgChan {
@@ -125,7 +173,7 @@ func (dp *DockerMonoidProtocol) Validate(
 		return nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	var res *monoidprotocol.MonoidValidateMessage
 
 	for s := range msgChan {
@@ -166,7 +214,7 @@ func (dp *DockerMonoidProtocol) Query(
 		return nil, nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	ch := readResults(msgChan)
 
 	return ch, completeCh, nil
@@ -194,7 +242,7 @@ func (dp *DockerMonoidProtocol) Scan(
 		return nil, nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	recordChan := readRecords(msgChan)
 
 	return recordChan, completeCh, nil
@@ -222,7 +270,7 @@ func (dp *DockerMonoidProtocol) Delete(
 		return nil, nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	ch := readResults(msgChan)
 
 	return ch, completeCh, nil
@@ -246,7 +294,7 @@ func (dp *DockerMonoidProtocol) Schema(
 		return nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	var res *monoidprotocol.MonoidSchemasMessage
 
 	for msg := range msgChan {
@@ -287,7 +335,7 @@ func (dp *DockerMonoidProtocol) RequestResults(
 		return nil, nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	ch := readRecords(msgChan)
 
 	return ch, completeCh, nil
@@ -315,7 +363,7 @@ func (dp *DockerMonoidProtocol) RequestStatus(
 		return nil, nil, err
 	}
 
-	msgChan = collectLogs(msgChan, dp.logChan)
+	msgChan = collectLogs(msgChan, dp.logChan, dp.checkLogViolation)
 	ch := readRequestStatus(msgChan)
 
 	return ch, completeCh, nil
@@ -343,5 +391,17 @@ func (dp *DockerMonoidProtocol) Teardown(ctx context.Context) error {
 		close(dp.logChan)
 	}
 
+	dp.violationChanMu.Lock()
+	defer dp.violationChanMu.Unlock()
+
+	if dp.violationChan != nil {
+		close(dp.violationChan)
+		dp.violationChan = nil
+	}
+
+	if dropped := atomic.LoadInt64(&dp.droppedViolations); dropped != 0 {
+		log.Warn().Int64("dropped", dropped).Msg("Dropped sandbox violations")
+	}
+
 	return nil
 }
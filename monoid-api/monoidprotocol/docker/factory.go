@@ -2,10 +2,20 @@ package docker
 
 import "github.com/monoid-privacy/monoid/monoidprotocol"
 
-type DockerProtocolFactory struct{}
+type DockerProtocolFactory struct {
+	// Verifier checks the signatures of connector images before they're run,
+	// if it's set.
+	Verifier monoidprotocol.ImageVerifier
+}
 
 func (d *DockerProtocolFactory) NewMonoidProtocol(
 	dockerImage string, dockerTag string, persistDir string,
 ) (monoidprotocol.MonoidProtocol, error) {
-	return NewDockerMP(dockerImage, dockerTag, persistDir)
+	return NewDockerMPWithOptions(dockerImage, dockerTag, persistDir, monoidprotocol.ConnectorOptions{}, d.Verifier)
+}
+
+func (d *DockerProtocolFactory) NewMonoidProtocolWithOptions(
+	dockerImage string, dockerTag string, persistDir string, opts monoidprotocol.ConnectorOptions,
+) (monoidprotocol.MonoidProtocol, error) {
+	return NewDockerMPWithOptions(dockerImage, dockerTag, persistDir, opts, d.Verifier)
 }
@@ -72,12 +72,17 @@ func readMessages(stream chan []byte, closer io.Closer) chan monoidprotocol.Mono
 func collectLogs(
 	stream chan monoidprotocol.MonoidMessage,
 	logChan chan monoidprotocol.MonoidLogMessage,
+	check func(message string),
 ) chan monoidprotocol.MonoidMessage {
 	messageChan := make(chan monoidprotocol.MonoidMessage)
 
 	go func() {
 		for s := range stream {
 			if s.Type == monoidprotocol.MonoidMessageTypeLOG && s.Log != nil {
+				if check != nil {
+					check(s.Log.Message)
+				}
+
 				if logChan != nil {
 					logChan <- *s.Log
 				}
@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// checkImage makes sure that the local image is the one the connector is
+// pinned to, and that it's signed if a verifier is set.
+func (dp *DockerMonoidProtocol) checkImage(ctx context.Context, repoDigests []string) error {
+	if dp.digest == nil && dp.verifier == nil {
+		return nil
+	}
+
+	digest, err := imageDigest(dp.image, dp.digest, repoDigests)
+	if err != nil {
+		return err
+	}
+
+	if dp.verifier == nil {
+		return nil
+	}
+
+	if err := dp.verifier.Verify(ctx, dp.image, digest); err != nil {
+		return fmt.Errorf("error verifying image %s: %w", dp.image, err)
+	}
+
+	return nil
+}
+
+// imageDigest returns the digest of the image from its repo digests. If the
+// image is pinned, an error is returned unless it has the pinned digest.
+func imageDigest(image string, pinned *string, repoDigests []string) (string, error) {
+	if pinned != nil {
+		for _, rd := range repoDigests {
+			if strings.HasSuffix(rd, "@"+*pinned) {
+				return *pinned, nil
+			}
+		}
+
+		return "", fmt.Errorf("image %s doesn't match its pinned digest %s", image, *pinned)
+	}
+
+	for _, rd := range repoDigests {
+		name, digest, ok := strings.Cut(rd, "@")
+		if !ok {
+			continue
+		}
+
+		if name == image || strings.TrimPrefix(name, "docker.io/") == image || len(repoDigests) == 1 {
+			return digest, nil
+		}
+	}
+
+	return "", fmt.Errorf("image %s has no digest to verify, it may have been built locally", image)
+}
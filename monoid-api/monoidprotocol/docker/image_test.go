@@ -0,0 +1,28 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageDigest(t *testing.T) {
+	pinned := "sha256:abc"
+	repoDigests := []string{"monoidco/monoid-postgres@sha256:abc"}
+
+	digest, err := imageDigest("monoidco/monoid-postgres", &pinned, repoDigests)
+	assert.NoError(t, err)
+	assert.Equal(t, pinned, digest)
+
+	digest, err = imageDigest("monoidco/monoid-postgres", nil, repoDigests)
+	assert.NoError(t, err)
+	assert.Equal(t, pinned, digest)
+
+	other := "sha256:def"
+	_, err = imageDigest("monoidco/monoid-postgres", &other, repoDigests)
+	assert.ErrorContains(t, err, "doesn't match its pinned digest")
+
+	// Images that were built locally don't have a digest.
+	_, err = imageDigest("monoidco/monoid-postgres", nil, nil)
+	assert.Error(t, err)
+}
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -16,7 +18,10 @@ import (
 	"github.com/docker/docker/api/types/volume"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
 	"github.com/monoid-privacy/monoid/tartools"
+	"github.com/monoid-privacy/monoid/telemetry"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // createVolume creates a docker volume and returns the name of the volume
@@ -98,6 +103,11 @@ func (dp *DockerMonoidProtocol) teardownContainer(
 		return nil
 	}
 
+	start := time.Now()
+	defer func() {
+		telemetry.ContainerStopDuration.WithLabelValues(dp.imageName).Observe(time.Since(start).Seconds())
+	}()
+
 	return dp.client.ContainerRemove(ctx, *dp.containerID, types.ContainerRemoveOptions{
 		RemoveVolumes: true,
 	})
@@ -161,7 +171,7 @@ func (dp *DockerMonoidProtocol) createContainer(
 		Tty:   true,
 	}
 
-	var hostConfig *container.HostConfig = nil
+	hostConfig := &container.HostConfig{}
 
 	if len(volumes) != 0 || len(fileMounts) != 0 {
 		mounts := make([]mount.Mount, 0, len(volumes)+len(fileMounts))
@@ -183,11 +193,11 @@ func (dp *DockerMonoidProtocol) createContainer(
 			})
 		}
 
-		hostConfig = &container.HostConfig{
-			Mounts: mounts,
-		}
+		hostConfig.Mounts = mounts
 	}
 
+	dp.applyRunProfile(&cfg, hostConfig)
+
 	ctr, err := dp.client.ContainerCreate(ctx, &cfg, hostConfig, nil, nil, "")
 
 	if err != nil {
@@ -278,6 +288,24 @@ func (dp *DockerMonoidProtocol) runCmdLiveLogs(
 	persistenceArgs map[string]string,
 	copyFiles bool,
 ) (messageChan chan monoidprotocol.MonoidMessage, completeCh chan int64, err error) {
+	// The span ends when the container exits, so it can't use the context
+	// it creates, which would be cancelled by the caller before then.
+	_, span := telemetry.Tracer().Start(ctx, "connector."+cmd)
+	span.SetAttributes(
+		attribute.String("monoid.connector.image", dp.imageName),
+		attribute.String("monoid.connector.command", cmd),
+	)
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+		}
+	}()
+
+	start := time.Now()
+
 	fileMounts, err := dp.constructContainer(
 		ctx,
 		cmd,
@@ -298,6 +326,9 @@ func (dp *DockerMonoidProtocol) runCmdLiveLogs(
 		return nil, nil, err
 	}
 
+	telemetry.ContainerStartDuration.WithLabelValues(dp.imageName, cmd).Observe(time.Since(start).Seconds())
+	start = time.Now()
+
 	stream, closer, err := dp.containerLogsStream(ctx, true, true)
 	if err != nil {
 		return nil, nil, err
@@ -308,11 +339,27 @@ func (dp *DockerMonoidProtocol) runCmdLiveLogs(
 
 	waitCh, errCh := dp.client.ContainerWait(ctx, *dp.containerID, container.WaitConditionNextExit)
 	go func() {
+		defer span.End()
+
+		exited := func(code int64) {
+			telemetry.ContainerRunDuration.WithLabelValues(dp.imageName, cmd).Observe(time.Since(start).Seconds())
+			telemetry.ContainerExits.WithLabelValues(dp.imageName, cmd, strconv.FormatInt(code, 10)).Inc()
+			span.SetAttributes(attribute.Int64("monoid.connector.exit_code", code))
+
+			if code != 0 {
+				span.SetStatus(codes.Error, fmt.Sprintf("container exited with code %d", code))
+			}
+		}
+
 		select {
 		case <-ctx.Done():
+			span.SetStatus(codes.Error, ctx.Err().Error())
 			close(completeCh)
 			return
 		case w := <-waitCh:
+			exited(w.StatusCode)
+			dp.checkExitViolations(ctx)
+
 			if copyFiles {
 				for k, v := range fileMounts {
 					r, _, err := dp.client.CopyFromContainer(ctx, *dp.containerID, k)
@@ -339,6 +386,8 @@ func (dp *DockerMonoidProtocol) runCmdLiveLogs(
 				log.Err(err).Msg("Error waiting on container.")
 			}
 
+			exited(1)
+
 			completeCh <- 1
 			close(completeCh)
 			return
@@ -0,0 +1,192 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/rs/zerolog/log"
+)
+
+// logViolation is a container log message that shows the connector was stopped
+// by part of its run profile.
+type logViolation struct {
+	kind     string
+	patterns []string
+	applies  func(p *monoidprotocol.RunProfile) bool
+	message  string
+}
+
+var logViolations = []logViolation{
+	{
+		kind:     "read-only",
+		patterns: []string{"Read-only file system"},
+		applies: func(p *monoidprotocol.RunProfile) bool {
+			return p.ReadOnlyRootFS
+		},
+		message: "the connector tried to write to its read-only root filesystem",
+	},
+	{
+		kind:     "pids",
+		patterns: []string{"Resource temporarily unavailable", "can't start new thread"},
+		applies: func(p *monoidprotocol.RunProfile) bool {
+			return p.PidsLimit != nil
+		},
+		message: "the connector couldn't start a process or thread under its pids limit",
+	},
+	{
+		kind:     "permission",
+		patterns: []string{"Operation not permitted", "Permission denied"},
+		applies: func(p *monoidprotocol.RunProfile) bool {
+			return p.User != nil || p.NoNewPrivileges || len(p.DropCapabilities) != 0
+		},
+		message: "the connector was denied an operation by its user or capabilities",
+	},
+	{
+		kind: "network",
+		patterns: []string{
+			"Network is unreachable",
+			"Temporary failure in name resolution",
+			"Name or service not known",
+			"ProxyError",
+			"Tunnel connection failed",
+		},
+		applies: func(p *monoidprotocol.RunProfile) bool {
+			return p.NetworkMode != nil || p.EgressProxy != nil
+		},
+		message: "the connector was blocked from connecting to a host by its network profile",
+	},
+}
+
+// applyRunProfile sets up the container's sandbox from the protocol's run profile.
+func (dp *DockerMonoidProtocol) applyRunProfile(cfg *container.Config, hostConfig *container.HostConfig) {
+	p := dp.profile
+	if p == nil {
+		return
+	}
+
+	if p.MemoryMB != nil {
+		hostConfig.Memory = int64(*p.MemoryMB) * 1024 * 1024
+	}
+
+	if p.CPUs != nil {
+		hostConfig.NanoCPUs = int64(*p.CPUs * 1e9)
+	}
+
+	if p.PidsLimit != nil {
+		pids := int64(*p.PidsLimit)
+		hostConfig.PidsLimit = &pids
+	}
+
+	if p.ReadOnlyRootFS {
+		hostConfig.ReadonlyRootfs = true
+		hostConfig.Tmpfs = map[string]string{"/tmp": "rw,noexec,nosuid"}
+	}
+
+	if p.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	}
+
+	if len(p.DropCapabilities) != 0 {
+		hostConfig.CapDrop = strslice.StrSlice(p.DropCapabilities)
+	}
+
+	if p.User != nil {
+		cfg.User = *p.User
+	}
+
+	if p.NetworkMode != nil {
+		hostConfig.NetworkMode = container.NetworkMode(*p.NetworkMode)
+	}
+
+	if p.EgressProxy != nil {
+		for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+			cfg.Env = append(cfg.Env, name+"="+*p.EgressProxy)
+		}
+	}
+}
+
+// violationBufferSize is the number of violations that are buffered for the
+// attached channel before new ones are dropped.
+const violationBufferSize = 16
+
+func (dp *DockerMonoidProtocol) AttachViolations(ctx context.Context) (chan monoidprotocol.SandboxViolation, error) {
+	dp.violationChanMu.Lock()
+	defer dp.violationChanMu.Unlock()
+
+	dp.violationChan = make(chan monoidprotocol.SandboxViolation, violationBufferSize)
+	return dp.violationChan, nil
+}
+
+// reportViolation sends the violation to the attached channel. Each kind of
+// violation is only reported once, since it's usually repeated in the logs.
+// The send doesn't block, so a slow reader can't stall the container's log
+// handling; violations that don't fit in the buffer are dropped and counted.
+func (dp *DockerMonoidProtocol) reportViolation(kind string, message string) {
+	dp.violationChanMu.RLock()
+	defer dp.violationChanMu.RUnlock()
+
+	if dp.violationChan == nil {
+		return
+	}
+
+	dp.violationMu.Lock()
+	reported := dp.reportedViolations[kind]
+	dp.reportedViolations[kind] = true
+	dp.violationMu.Unlock()
+
+	if reported {
+		return
+	}
+
+	select {
+	case dp.violationChan <- monoidprotocol.SandboxViolation{Message: message}:
+	default:
+		atomic.AddInt64(&dp.droppedViolations, 1)
+	}
+}
+
+// checkLogViolation reports a violation if the container's log message shows
+// it was stopped by its run profile.
+func (dp *DockerMonoidProtocol) checkLogViolation(message string) {
+	if dp.profile == nil {
+		return
+	}
+
+	for _, v := range logViolations {
+		if !v.applies(dp.profile) {
+			continue
+		}
+
+		for _, pattern := range v.patterns {
+			if strings.Contains(message, pattern) {
+				dp.reportViolation(v.kind, v.message)
+				break
+			}
+		}
+	}
+}
+
+// checkExitViolations reports a violation if the container was killed for
+// going over its memory limit.
+func (dp *DockerMonoidProtocol) checkExitViolations(ctx context.Context) {
+	if dp.profile == nil || dp.profile.MemoryMB == nil || dp.containerID == nil {
+		return
+	}
+
+	info, err := dp.client.ContainerInspect(ctx, *dp.containerID)
+	if err != nil {
+		log.Err(err).Msg("Error inspecting container")
+		return
+	}
+
+	if info.State != nil && info.State.OOMKilled {
+		dp.reportViolation("memory", fmt.Sprintf(
+			"the connector was killed for going over its %d MB memory limit", *dp.profile.MemoryMB,
+		))
+	}
+}
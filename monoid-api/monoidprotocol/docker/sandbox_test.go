@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyRunProfile(t *testing.T) {
+	memory := 256
+	cpus := 0.5
+	pids := 64
+	user := "1000:1000"
+	network := "none"
+	proxy := "http://proxy:3128"
+
+	dp := &DockerMonoidProtocol{profile: &monoidprotocol.RunProfile{
+		MemoryMB:         &memory,
+		CPUs:             &cpus,
+		PidsLimit:        &pids,
+		ReadOnlyRootFS:   true,
+		NoNewPrivileges:  true,
+		DropCapabilities: []string{"ALL"},
+		User:             &user,
+		NetworkMode:      &network,
+		EgressProxy:      &proxy,
+	}}
+
+	cfg := container.Config{}
+	hostConfig := container.HostConfig{}
+	dp.applyRunProfile(&cfg, &hostConfig)
+
+	assert.Equal(t, int64(256*1024*1024), hostConfig.Memory)
+	assert.Equal(t, int64(5e8), hostConfig.NanoCPUs)
+	assert.Equal(t, int64(64), *hostConfig.PidsLimit)
+	assert.True(t, hostConfig.ReadonlyRootfs)
+	assert.Contains(t, hostConfig.Tmpfs, "/tmp")
+	assert.Equal(t, []string{"no-new-privileges"}, hostConfig.SecurityOpt)
+	assert.Equal(t, strslice.StrSlice{"ALL"}, hostConfig.CapDrop)
+	assert.Equal(t, container.NetworkMode("none"), hostConfig.NetworkMode)
+	assert.Equal(t, "1000:1000", cfg.User)
+	assert.Contains(t, cfg.Env, "HTTPS_PROXY=http://proxy:3128")
+}
+
+func TestApplyNoRunProfile(t *testing.T) {
+	dp := &DockerMonoidProtocol{}
+
+	cfg := container.Config{}
+	hostConfig := container.HostConfig{}
+	dp.applyRunProfile(&cfg, &hostConfig)
+
+	assert.Equal(t, container.Config{}, cfg)
+	assert.Equal(t, container.HostConfig{}, hostConfig)
+}
+
+func TestCheckLogViolation(t *testing.T) {
+	dp := &DockerMonoidProtocol{
+		profile:            &monoidprotocol.RunProfile{ReadOnlyRootFS: true},
+		reportedViolations: map[string]bool{},
+	}
+
+	violations, err := dp.AttachViolations(context.Background())
+	assert.NoError(t, err)
+
+	received := make(chan []monoidprotocol.SandboxViolation)
+	go func() {
+		res := []monoidprotocol.SandboxViolation{}
+		for v := range violations {
+			res = append(res, v)
+		}
+
+		received <- res
+	}()
+
+	// The network isn't limited by the profile, so its errors aren't
+	// violations, and the read-only error is only reported once.
+	dp.checkLogViolation("OSError: [Errno 101] Network is unreachable")
+	dp.checkLogViolation("OSError: [Errno 30] Read-only file system: '/app/cache'")
+	dp.checkLogViolation("OSError: [Errno 30] Read-only file system: '/app/cache'")
+
+	dp.violationChanMu.Lock()
+	close(dp.violationChan)
+	dp.violationChanMu.Unlock()
+
+	res := <-received
+	assert.Len(t, res, 1)
+	assert.Contains(t, res[0].Message, "read-only")
+}
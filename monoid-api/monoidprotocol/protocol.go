@@ -444,6 +444,9 @@ type MonoidQueryIdentifier struct {
 	// JsonSchema corresponds to the JSON schema field "json_schema".
 	JsonSchema MonoidQueryIdentifierJsonSchema `json:"json_schema"`
 
+	// RequestId corresponds to the JSON schema field "request_id".
+	RequestId *string `json:"request_id,omitempty"`
+
 	// SchemaGroup corresponds to the JSON schema field "schema_group".
 	SchemaGroup *string `json:"schema_group,omitempty"`
 
@@ -502,6 +505,9 @@ type MonoidRequestHandle struct {
 	// Data corresponds to the JSON schema field "data".
 	Data MonoidRequestHandleData `json:"data,omitempty"`
 
+	// RequestId corresponds to the JSON schema field "request_id".
+	RequestId *string `json:"request_id,omitempty"`
+
 	// RequestType corresponds to the JSON schema field "request_type".
 	RequestType MonoidRequestHandleRequestType `json:"request_type"`
 
@@ -0,0 +1,48 @@
+package monoidprotocol
+
+import "context"
+
+// RunProfile hardens the sandbox that a connector runs in. The fields that
+// aren't set are left to the runtime's defaults.
+type RunProfile struct {
+	// MemoryMB is the most memory the connector can use, in megabytes.
+	MemoryMB *int `json:"memoryMb,omitempty" yaml:"memoryMb,omitempty"`
+	// CPUs is the number of CPUs the connector can use, which can be
+	// fractional.
+	CPUs *float64 `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	// PidsLimit is the most processes and threads the connector can run.
+	PidsLimit *int `json:"pidsLimit,omitempty" yaml:"pidsLimit,omitempty"`
+	// ReadOnlyRootFS mounts the connector's root filesystem as read-only. A
+	// writable /tmp is still provided.
+	ReadOnlyRootFS bool `json:"readOnlyRootFs,omitempty" yaml:"readOnlyRootFs,omitempty"`
+	// NoNewPrivileges stops the connector's processes from gaining
+	// privileges, e.g. with setuid binaries.
+	NoNewPrivileges bool `json:"noNewPrivileges,omitempty" yaml:"noNewPrivileges,omitempty"`
+	// DropCapabilities are the Linux capabilities to drop, or ALL.
+	DropCapabilities []string `json:"dropCapabilities,omitempty" yaml:"dropCapabilities,omitempty"`
+	// User is the user (and optionally group) to run the connector as.
+	User *string `json:"user,omitempty" yaml:"user,omitempty"`
+	// NetworkMode is the network the connector is attached to. It can be
+	// none, or a network that only reaches the hosts the connector is
+	// allowed to connect to.
+	NetworkMode *string `json:"networkMode,omitempty" yaml:"networkMode,omitempty"`
+	// EgressProxy is the URL of the HTTP proxy that the connector's outbound
+	// connections are sent through. It's advisory: it's passed to the connector
+	// in the proxy environment variables, which the connector can ignore. To
+	// enforce it, set NetworkMode to a network that only reaches the proxy.
+	EgressProxy *string `json:"egressProxy,omitempty" yaml:"egressProxy,omitempty"`
+}
+
+// SandboxViolation is a connector breaking the limits of its run profile, like
+// being killed for using too much memory.
+type SandboxViolation struct {
+	Message string `json:"message"`
+}
+
+// SandboxedProtocol is implemented by protocols that report violations of their
+// run profile.
+type SandboxedProtocol interface {
+	// AttachViolations returns a channel that the violations are sent on. The
+	// channel is closed when the protocol is torn down.
+	AttachViolations(ctx context.Context) (chan SandboxViolation, error)
+}
@@ -0,0 +1,223 @@
+package recordstore
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/monoid-privacy/monoid/filestore"
+)
+
+// Records are stored in the file store as gzipped JSONL, one record per line,
+// so they can be written and read without holding them all in memory.
+
+// Writer streams records to an object in a file store.
+type Writer struct {
+	wr    io.WriteCloser
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	path  string
+	count int
+	size  *countingWriter
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// NewWriter creates a writer for a new records object.
+func NewWriter(ctx context.Context, store filestore.FileStore, objectName string) (*Writer, error) {
+	wr, path, err := store.NewWriter(ctx, objectName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	size := &countingWriter{w: wr}
+	gz := gzip.NewWriter(size)
+
+	return &Writer{
+		wr:   wr,
+		gz:   gz,
+		enc:  json.NewEncoder(gz),
+		path: path,
+		size: size,
+	}, nil
+}
+
+// Write appends a record to the object.
+func (w *Writer) Write(record interface{}) error {
+	if err := w.enc.Encode(record); err != nil {
+		return err
+	}
+
+	w.count++
+	return nil
+}
+
+// Count returns the number of records written.
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Size returns the number of compressed bytes written to the object, which
+// is only final once the writer is closed.
+func (w *Writer) Size() int64 {
+	return w.size.n
+}
+
+// Path returns the path of the object in the file store.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Close flushes the records and closes the object. The object isn't
+// complete until Close returns without an error.
+func (w *Writer) Close() error {
+	gzErr := w.gz.Close()
+	if err := w.wr.Close(); err != nil {
+		return err
+	}
+
+	return gzErr
+}
+
+// Reader reads records from an object in a file store.
+type Reader struct {
+	src io.ReadCloser
+	gz  *gzip.Reader
+	dec *json.Decoder
+}
+
+// NewReader opens the records object at path.
+func NewReader(ctx context.Context, store filestore.FileStore, path string) (*Reader, error) {
+	src, err := store.NewReader(ctx, path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	return &Reader{
+		src: src,
+		gz:  gz,
+		dec: json.NewDecoder(gz),
+	}, nil
+}
+
+// Next returns the next record, or io.EOF if there are no more records.
+func (r *Reader) Next() (json.RawMessage, error) {
+	if !r.dec.More() {
+		return nil, io.EOF
+	}
+
+	rec := json.RawMessage{}
+	if err := r.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (r *Reader) Close() error {
+	r.gz.Close()
+	return r.src.Close()
+}
+
+// ReadPage returns up to limit records, starting at offset. All the records
+// from offset on are returned if limit is negative.
+func ReadPage(
+	ctx context.Context,
+	store filestore.FileStore,
+	path string,
+	offset int,
+	limit int,
+) ([]json.RawMessage, error) {
+	r, err := NewReader(ctx, store, path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	records := []json.RawMessage{}
+	for i := 0; limit < 0 || len(records) < limit; i++ {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if i >= offset {
+			records = append(records, rec)
+		}
+	}
+
+	return records, nil
+}
+
+// WriteJSONArray writes all the records in the object to w as a single JSON
+// array, and returns the number of bytes written.
+func WriteJSONArray(
+	ctx context.Context,
+	store filestore.FileStore,
+	path string,
+	w io.Writer,
+) (int64, error) {
+	r, err := NewReader(ctx, store, path)
+	if err != nil {
+		return 0, err
+	}
+
+	defer r.Close()
+
+	written := int64(0)
+	write := func(b []byte) error {
+		n, err := w.Write(b)
+		written += int64(n)
+		return err
+	}
+
+	if err := write([]byte("[")); err != nil {
+		return written, err
+	}
+
+	for i := 0; ; i++ {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return written, err
+		}
+
+		if i > 0 {
+			if err := write([]byte(",")); err != nil {
+				return written, err
+			}
+		}
+
+		if err := write(rec); err != nil {
+			return written, err
+		}
+	}
+
+	return written, write([]byte("]"))
+}
@@ -0,0 +1,70 @@
+package recordstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/monoid-privacy/monoid/filestore/localstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecords(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewLocalFileStore(t.TempDir())
+
+	w, err := NewWriter(ctx, store, "records")
+	require.NoError(t, err)
+
+	for i := 0; i < 250; i++ {
+		require.NoError(t, w.Write(map[string]interface{}{"id": i}))
+	}
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, 250, w.Count())
+	assert.Greater(t, w.Size(), int64(0))
+
+	page, err := ReadPage(ctx, store, w.Path(), 100, 100)
+	require.NoError(t, err)
+	require.Len(t, page, 100)
+	assert.JSONEq(t, `{"id": 100}`, string(page[0]))
+	assert.JSONEq(t, `{"id": 199}`, string(page[99]))
+
+	page, err = ReadPage(ctx, store, w.Path(), 200, 100)
+	require.NoError(t, err)
+	assert.Len(t, page, 50)
+
+	page, err = ReadPage(ctx, store, w.Path(), 300, 100)
+	require.NoError(t, err)
+	assert.Len(t, page, 0)
+
+	page, err = ReadPage(ctx, store, w.Path(), 100, -1)
+	require.NoError(t, err)
+	assert.Len(t, page, 150)
+
+	buf := bytes.Buffer{}
+	n, err := WriteJSONArray(ctx, store, w.Path(), &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	all := []map[string]int{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &all))
+	require.Len(t, all, 250)
+	assert.Equal(t, 249, all[249]["id"])
+}
+
+func TestEmptyRecords(t *testing.T) {
+	ctx := context.Background()
+	store := localstore.NewLocalFileStore(t.TempDir())
+
+	w, err := NewWriter(ctx, store, "records")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	buf := bytes.Buffer{}
+	_, err = WriteJSONArray(ctx, store, w.Path(), &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", buf.String())
+}
@@ -0,0 +1,216 @@
+// Package redaction applies export policies to records before they are
+// given to a data subject, so that internal fields and data about other
+// people can be removed or obscured.
+package redaction
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/monoid-privacy/monoid/model"
+)
+
+// maskVisible is the number of trailing characters left visible by MASK.
+const maskVisible = 4
+
+// policyRank orders the policies from least to most restrictive, so the most
+// restrictive policy wins when a property's categories disagree.
+var policyRank = map[model.ExportPolicy]int{
+	model.ExportPolicyInclude: 0,
+	model.ExportPolicyMask:    1,
+	model.ExportPolicyHash:    2,
+	model.ExportPolicyExclude: 3,
+}
+
+// PropertyPolicy returns the policy for the property. The property's own
+// policy is used if it has one, otherwise the most restrictive policy of its
+// categories is used. The property's categories must be loaded.
+func PropertyPolicy(p *model.Property) model.ExportPolicy {
+	if p.ExportPolicy != nil && p.ExportPolicy.IsValid() {
+		return *p.ExportPolicy
+	}
+
+	policy := model.ExportPolicyInclude
+	for _, c := range p.Categories {
+		if c == nil || c.ExportPolicy == nil || !c.ExportPolicy.IsValid() {
+			continue
+		}
+
+		if policyRank[*c.ExportPolicy] > policyRank[policy] {
+			policy = *c.ExportPolicy
+		}
+	}
+
+	return policy
+}
+
+// Redactor applies the export policies of a data source's properties to
+// its records.
+type Redactor struct {
+	key      []byte
+	policies map[string]model.ExportPolicy
+}
+
+// NewRedactor creates a redactor for the properties, which must have their
+// categories loaded. Hashed values are keyed with key, so that they can't
+// be reversed by hashing guesses.
+func NewRedactor(key []byte, properties []*model.Property) *Redactor {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("monoid-export-redaction"))
+
+	r := Redactor{
+		key:      mac.Sum(nil),
+		policies: map[string]model.ExportPolicy{},
+	}
+
+	for _, p := range properties {
+		if policy := PropertyPolicy(p); policy != model.ExportPolicyInclude {
+			r.policies[p.Name] = policy
+		}
+	}
+
+	return &r
+}
+
+// Empty returns true if the redactor doesn't change any fields.
+func (r *Redactor) Empty() bool {
+	return len(r.policies) == 0
+}
+
+// Policies returns the policies the redactor applies, by property name.
+func (r *Redactor) Policies() map[string]model.ExportPolicy {
+	res := make(map[string]model.ExportPolicy, len(r.policies))
+	for name, policy := range r.policies {
+		res[name] = policy
+	}
+
+	return res
+}
+
+// Remaining returns a redactor with the policies that still need to be applied
+// to records that were redacted with the applied policies. A policy is skipped
+// if the property already had it, or a more restrictive one, applied.
+func (r *Redactor) Remaining(applied map[string]model.ExportPolicy) *Redactor {
+	res := Redactor{
+		key:      r.key,
+		policies: map[string]model.ExportPolicy{},
+	}
+
+	for name, policy := range r.policies {
+		if prev, ok := applied[name]; ok && policyRank[prev] >= policyRank[policy] {
+			continue
+		}
+
+		res.policies[name] = policy
+	}
+
+	return &res
+}
+
+// Reapplicable returns a redactor with the policies that can be applied again to
+// records that were already redacted. Excluding and masking give the same
+// result when they're repeated, but hashing a hashed value would change it.
+// It's used for records where the applied policies weren't recorded.
+func (r *Redactor) Reapplicable() *Redactor {
+	res := Redactor{
+		key:      r.key,
+		policies: map[string]model.ExportPolicy{},
+	}
+
+	for name, policy := range r.policies {
+		if policy == model.ExportPolicyExclude || policy == model.ExportPolicyMask {
+			res.policies[name] = policy
+		}
+	}
+
+	return &res
+}
+
+// Apply returns a copy of the record with the policies applied to its
+// top-level fields. Fields that don't match a property are included.
+func (r *Redactor) Apply(record map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(record))
+
+	for k, v := range record {
+		policy, ok := r.policies[k]
+		if !ok || v == nil {
+			res[k] = v
+			continue
+		}
+
+		switch policy {
+		case model.ExportPolicyExclude:
+			continue
+		case model.ExportPolicyHash:
+			res[k] = r.hash(v)
+		case model.ExportPolicyMask:
+			res[k] = mask(v)
+		default:
+			res[k] = v
+		}
+	}
+
+	return res
+}
+
+// ApplyJSON applies the policies to a JSON encoded record.
+func (r *Redactor) ApplyJSON(rec json.RawMessage) (json.RawMessage, error) {
+	if r.Empty() {
+		return rec, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(rec)))
+	dec.UseNumber()
+
+	m := map[string]interface{}{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(r.Apply(m))
+}
+
+func (r *Redactor) hash(v interface{}) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(stringValue(v)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mask replaces all but the last few characters of the value with *. Short
+// values are masked completely.
+func mask(v interface{}) string {
+	s := []rune(stringValue(v))
+	visible := maskVisible
+	if len(s) <= maskVisible*2 {
+		visible = 0
+	}
+
+	for i := 0; i < len(s)-visible; i++ {
+		s[i] = '*'
+	}
+
+	return string(s)
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
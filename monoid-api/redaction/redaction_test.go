@@ -0,0 +1,112 @@
+package redaction
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func policy(p model.ExportPolicy) *model.ExportPolicy {
+	return &p
+}
+
+func TestPropertyPolicy(t *testing.T) {
+	internal := &model.Category{ID: "internal", ExportPolicy: policy(model.ExportPolicyExclude)}
+	card := &model.Category{ID: "credit_card", ExportPolicy: policy(model.ExportPolicyMask)}
+	email := &model.Category{ID: "email"}
+
+	assert.Equal(t, model.ExportPolicyInclude, PropertyPolicy(&model.Property{
+		Categories: []*model.Category{email},
+	}))
+	assert.Equal(t, model.ExportPolicyExclude, PropertyPolicy(&model.Property{
+		Categories: []*model.Category{card, internal},
+	}))
+	assert.Equal(t, model.ExportPolicyHash, PropertyPolicy(&model.Property{
+		ExportPolicy: policy(model.ExportPolicyHash),
+		Categories:   []*model.Category{internal},
+	}))
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor([]byte("key"), []*model.Property{
+		{Name: "fraud_score", ExportPolicy: policy(model.ExportPolicyExclude)},
+		{Name: "recipient", ExportPolicy: policy(model.ExportPolicyHash)},
+		{Name: "card", ExportPolicy: policy(model.ExportPolicyMask)},
+		{Name: "pin", ExportPolicy: policy(model.ExportPolicyMask)},
+		{Name: "email"},
+	})
+
+	res := r.Apply(map[string]interface{}{
+		"fraud_score": 0.9,
+		"recipient":   "bob@example.com",
+		"card":        "4242424242424242",
+		"pin":         1234,
+		"email":       "alice@example.com",
+		"other":       "value",
+	})
+
+	assert.NotContains(t, res, "fraud_score")
+	assert.Equal(t, "************4242", res["card"])
+	assert.Equal(t, "****", res["pin"])
+	assert.Equal(t, "alice@example.com", res["email"])
+	assert.Equal(t, "value", res["other"])
+
+	hashed, ok := res["recipient"].(string)
+	assert.True(t, ok)
+	assert.Len(t, hashed, 64)
+	assert.NotContains(t, hashed, "bob")
+
+	// Hashes are stable, so the same value can be linked across records.
+	rec, err := r.ApplyJSON(json.RawMessage(`{"recipient": "bob@example.com"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"recipient": "`+hashed+`"}`, string(rec))
+
+	assert.True(t, NewRedactor([]byte("key"), []*model.Property{{Name: "email"}}).Empty())
+
+	// Records that were already redacted can have the policies applied again
+	// without changing masked or hashed values.
+	again := r.Reapplicable().Apply(res)
+	assert.Equal(t, "************4242", again["card"])
+	assert.Equal(t, "****", again["pin"])
+	assert.Equal(t, hashed, again["recipient"])
+
+	// A policy that was tightened after the records were redacted still applies.
+	tightened := NewRedactor([]byte("key"), []*model.Property{
+		{Name: "card", ExportPolicy: policy(model.ExportPolicyExclude)},
+	})
+	assert.NotContains(t, tightened.Reapplicable().Apply(res), "card")
+}
+
+func TestRedactorRemaining(t *testing.T) {
+	r := NewRedactor([]byte("key"), []*model.Property{
+		{Name: "recipient", ExportPolicy: policy(model.ExportPolicyHash)},
+		{Name: "card", ExportPolicy: policy(model.ExportPolicyMask)},
+	})
+
+	res := r.Apply(map[string]interface{}{
+		"recipient": "bob@example.com",
+		"card":      "4242424242424242",
+		"email":     "alice@example.com",
+	})
+
+	// The email was included when the records were stored, and is hashed
+	// after its policy was changed to HASH.
+	tightened := NewRedactor([]byte("key"), []*model.Property{
+		{Name: "recipient", ExportPolicy: policy(model.ExportPolicyHash)},
+		{Name: "card", ExportPolicy: policy(model.ExportPolicyHash)},
+		{Name: "email", ExportPolicy: policy(model.ExportPolicyHash)},
+	})
+
+	again := tightened.Remaining(r.Policies()).Apply(res)
+	assert.Equal(t, res["recipient"], again["recipient"])
+	assert.Equal(t, r.hash("alice@example.com"), again["email"])
+	assert.Equal(t, r.hash("************4242"), again["card"])
+
+	// Loosened policies can't be undone, so nothing is applied.
+	loosened := NewRedactor([]byte("key"), []*model.Property{
+		{Name: "recipient", ExportPolicy: policy(model.ExportPolicyMask)},
+	})
+	assert.True(t, loosened.Remaining(r.Policies()).Empty())
+}
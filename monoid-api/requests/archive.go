@@ -0,0 +1,129 @@
+package requests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/monoid-privacy/monoid/tartools"
+)
+
+// archiveWriter writes files to an archive format.
+type archiveWriter interface {
+	// AddFile adds a file with the contents written by write.
+	AddFile(name string, write func(w io.Writer) error) error
+
+	// CopyTar copies the files in the tar into the archive, under prefix.
+	CopyTar(prefix string, tr *tar.Reader) error
+
+	Close() error
+}
+
+type tarGzArchive struct {
+	gw      *gzip.Writer
+	tw      *tar.Writer
+	tempDir string
+}
+
+func newTarGzArchive(w io.Writer, tempDir string) archiveWriter {
+	gw := gzip.NewWriter(w)
+
+	return &tarGzArchive{
+		gw:      gw,
+		tw:      tar.NewWriter(gw),
+		tempDir: tempDir,
+	}
+}
+
+// AddFile writes the file to a temporary file first, since tar needs to
+// know the size of the file before it can be added.
+func (a *tarGzArchive) AddFile(name string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(a.tempDir, "package*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return tartools.AddFileFromReader(a.tw, name, tmp, size, 0600)
+}
+
+func (a *tarGzArchive) CopyTar(prefix string, tr *tar.Reader) error {
+	return tartools.CopyFilesFromTar(a.tw, prefix, tr)
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+
+	return a.gw.Close()
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func newZipArchive(w io.Writer) archiveWriter {
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+func (a *zipArchive) AddFile(name string, write func(w io.Writer) error) error {
+	w, err := a.zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	return write(w)
+}
+
+func (a *zipArchive) CopyTar(prefix string, tr *tar.Reader) error {
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		w, err := a.zw.CreateHeader(&zip.FileHeader{
+			Name:     filepath.Join(prefix, h.Name),
+			Method:   zip.Deflate,
+			Modified: h.ModTime,
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
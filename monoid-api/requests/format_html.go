@@ -0,0 +1,206 @@
+package requests
+
+import (
+	"archive/tar"
+	"context"
+	"html/template"
+	"io"
+
+	"github.com/monoid-privacy/monoid/config"
+)
+
+// The report is rendered a piece at a time, so that data sources with many
+// records don't need to be held in memory.
+var reportTemplates = template.Must(template.New("report").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Your data</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #111827; }
+h1, h2, h3 { margin-top: 2rem; }
+table { border-collapse: collapse; margin: 1rem 0; font-size: 0.875rem; }
+th, td { border: 1px solid #d1d5db; padding: 0.25rem 0.5rem; text-align: left; vertical-align: top; }
+th { background: #f3f4f6; }
+.category { display: inline-block; font-weight: normal; font-size: 0.75rem; background: #e0e7ff; border-radius: 0.25rem; padding: 0 0.25rem; margin: 0.125rem 0.125rem 0 0; }
+.muted { color: #6b7280; }
+</style>
+</head>
+<body>
+<h1>Your data</h1>
+<p class="muted">Request {{.RequestID}}, created {{.CreatedAt.Format "2006-01-02 15:04 MST"}}. Report generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}.</p>
+<h2>Summary</h2>
+<p>The following systems were searched for your data.</p>
+<table>
+<tr><th>System</th><th>Data source</th><th>Status</th><th>Records found</th></tr>
+{{range .Silos}}{{$silo := .Name}}{{range .Sources}}<tr><td>{{$silo}}</td><td>{{if .Group}}{{.Group}}.{{end}}{{.Name}}</td><td>{{.Status}}</td><td>{{if .RecordCount}}{{.RecordCount}}{{else if .ResultType}}{{.ResultType}}{{else}}None{{end}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+
+{{define "silo"}}<h2>{{.Name}}</h2>
+{{end}}
+
+{{define "sourceStart"}}<h3>{{.Name}}</h3>
+{{end}}
+
+{{define "tableHead"}}<table>
+<tr>{{range .}}<th>{{.Name}}{{if .Categories}}<br>{{range .Categories}}<span class="category">{{.}}</span>{{end}}{{end}}</th>{{end}}</tr>
+{{end}}
+
+{{define "row"}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}
+
+{{define "tableEnd"}}</table>
+{{end}}
+
+{{define "files"}}<p>The following files were found. They are included in the archive export formats.</p>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+
+{{define "noData"}}<p class="muted">No data was found.</p>
+{{end}}
+
+{{define "foot"}}</body>
+</html>
+{{end}}
+`))
+
+type htmlFormat struct{}
+
+func (f *htmlFormat) Extension() string {
+	return ".html"
+}
+
+func (f *htmlFormat) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func (f *htmlFormat) Write(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	pkg *Package,
+	w io.Writer,
+) error {
+	summary, err := pkg.Summary()
+	if err != nil {
+		return err
+	}
+
+	return writeHTMLReport(ctx, conf, pkg, summary, w)
+}
+
+type reportColumn struct {
+	Name       string
+	Categories []string
+}
+
+func writeHTMLReport(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	pkg *Package,
+	summary Summary,
+	w io.Writer,
+) error {
+	if err := reportTemplates.ExecuteTemplate(w, "head", summary); err != nil {
+		return err
+	}
+
+	for _, silo := range pkg.Silos {
+		if err := reportTemplates.ExecuteTemplate(w, "silo", silo.Silo); err != nil {
+			return err
+		}
+
+		for _, src := range silo.Sources {
+			src := src
+
+			if !src.hasRecords() && !src.hasFiles() {
+				continue
+			}
+
+			if err := reportTemplates.ExecuteTemplate(w, "sourceStart", src); err != nil {
+				return err
+			}
+
+			if src.hasFiles() {
+				if err := writeHTMLFiles(ctx, conf, &src, w); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := writeHTMLRecords(ctx, conf, &src, w); err != nil {
+				return err
+			}
+		}
+	}
+
+	return reportTemplates.ExecuteTemplate(w, "foot", nil)
+}
+
+func writeHTMLRecords(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	src *SourcePackage,
+	w io.Writer,
+) error {
+	labels := src.categoryLabels()
+	rows := 0
+
+	if err := forEachRow(ctx, conf, src, func(cols []string) error {
+		header := make([]reportColumn, len(cols))
+		for i, c := range cols {
+			header[i] = reportColumn{Name: c, Categories: labels[c]}
+		}
+
+		return reportTemplates.ExecuteTemplate(w, "tableHead", header)
+	}, func(row []string) error {
+		rows++
+		return reportTemplates.ExecuteTemplate(w, "row", row)
+	}); err != nil {
+		return err
+	}
+
+	if err := reportTemplates.ExecuteTemplate(w, "tableEnd", nil); err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return reportTemplates.ExecuteTemplate(w, "noData", nil)
+	}
+
+	return nil
+}
+
+func writeHTMLFiles(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	src *SourcePackage,
+	w io.Writer,
+) error {
+	tr, closeFiles, err := src.openFiles(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	defer closeFiles()
+
+	names := []string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if h.Typeflag == tar.TypeReg {
+			names = append(names, h.Name)
+		}
+	}
+
+	return reportTemplates.ExecuteTemplate(w, "files", names)
+}
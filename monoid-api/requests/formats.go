@@ -0,0 +1,316 @@
+package requests
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/rs/zerolog/log"
+)
+
+// Format writes a request's results package in a particular file format.
+type Format interface {
+	// Extension is the file extension of the package, including the leading dot.
+	Extension() string
+	ContentType() string
+	Write(ctx context.Context, conf *config.BaseConfig, pkg *Package, w io.Writer) error
+}
+
+var formats = map[model.ExportFormat]Format{
+	model.ExportFormatJSON: &archiveFormat{json: true},
+	model.ExportFormatCSV:  &archiveFormat{csv: true},
+	model.ExportFormatHTML: &htmlFormat{},
+	model.ExportFormatZip:  &archiveFormat{zip: true, json: true, csv: true, html: true},
+}
+
+// RegisterFormat sets the implementation for an export format.
+func RegisterFormat(format model.ExportFormat, impl Format) {
+	formats[format] = impl
+}
+
+// GetFormat returns the implementation of the export format.
+func GetFormat(format model.ExportFormat) (Format, error) {
+	f, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export format %s", format)
+	}
+
+	return f, nil
+}
+
+// archiveFormat packages the results as an archive of files, with a
+// directory per silo.
+type archiveFormat struct {
+	// zip creates a .zip archive instead of a .tar.gz
+	zip bool
+
+	// json, csv, and html choose which files are included in the archive.
+	json bool
+	csv  bool
+	html bool
+}
+
+func (f *archiveFormat) Extension() string {
+	if f.zip {
+		return ".zip"
+	}
+
+	return ".tar.gz"
+}
+
+func (f *archiveFormat) ContentType() string {
+	if f.zip {
+		return "application/zip"
+	}
+
+	return "application/gzip"
+}
+
+func (f *archiveFormat) Write(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	pkg *Package,
+	w io.Writer,
+) error {
+	var archive archiveWriter
+	if f.zip {
+		archive = newZipArchive(w)
+	} else {
+		archive = newTarGzArchive(w, conf.TempStorePath)
+	}
+
+	summary, err := pkg.Summary()
+	if err != nil {
+		return err
+	}
+
+	if err := archive.AddFile("summary.json", func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}); err != nil {
+		return err
+	}
+
+	for _, silo := range pkg.Silos {
+		fileAdded := false
+
+		for _, src := range silo.Sources {
+			src := src
+
+			if src.hasRecords() {
+				fileAdded = true
+
+				if f.json {
+					if err := archive.AddFile(
+						filepath.Join(silo.Silo.Name, src.Name+".json"),
+						func(w io.Writer) error { return writeJSONRecords(ctx, conf, &src, w) },
+					); err != nil {
+						return err
+					}
+				}
+
+				if f.csv {
+					if err := archive.AddFile(
+						filepath.Join(silo.Silo.Name, src.Name+".csv"),
+						func(w io.Writer) error { return writeCSVRecords(ctx, conf, &src, w) },
+					); err != nil {
+						return err
+					}
+				}
+			}
+
+			if src.hasFiles() {
+				fileAdded = true
+
+				tr, closeFiles, err := src.openFiles(ctx, conf)
+				if err != nil {
+					log.Err(err).Msg("Error opening file")
+					continue
+				}
+
+				err = archive.CopyTar(silo.Silo.Name, tr)
+				closeFiles()
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if !fileAdded {
+			if err := archive.AddFile(
+				filepath.Join(silo.Silo.Name, "no-data.txt"),
+				func(w io.Writer) error {
+					_, err := w.Write([]byte("No data here."))
+					return err
+				},
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	if f.html {
+		if err := archive.AddFile("report.html", func(w io.Writer) error {
+			return writeHTMLReport(ctx, conf, pkg, summary, w)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeJSONRecords(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	src *SourcePackage,
+	w io.Writer,
+) error {
+	if _, err := w.Write([]byte("[")); err != nil {
+		return err
+	}
+
+	first := true
+	if err := src.forEachRecord(ctx, conf, func(rec json.RawMessage) error {
+		if !first {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+
+		first = false
+
+		_, err := w.Write(rec)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	_, err := w.Write([]byte("]"))
+	return err
+}
+
+func decodeRecord(rec json.RawMessage) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(string(rec)))
+	dec.UseNumber()
+
+	m := map[string]interface{}{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// recordColumns returns the sorted names of all the fields in the source's records.
+func recordColumns(ctx context.Context, conf *config.BaseConfig, src *SourcePackage) ([]string, error) {
+	seen := map[string]bool{}
+
+	if err := src.forEachRecord(ctx, conf, func(rec json.RawMessage) error {
+		m, err := decodeRecord(rec)
+		if err != nil {
+			return err
+		}
+
+		for k := range m {
+			seen[k] = true
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	cols := make([]string, 0, len(seen))
+	for k := range seen {
+		cols = append(cols, k)
+	}
+
+	sort.Strings(cols)
+	return cols, nil
+}
+
+// recordRow formats the record's fields as strings, in the order of cols.
+func recordRow(rec json.RawMessage, cols []string) ([]string, error) {
+	m, err := decodeRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		switch v := m[c].(type) {
+		case nil:
+			row[i] = ""
+		case string:
+			row[i] = v
+		case json.Number:
+			row[i] = v.String()
+		case bool:
+			row[i] = fmt.Sprint(v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+
+			row[i] = string(b)
+		}
+	}
+
+	return row, nil
+}
+
+// forEachRow calls fn with the columns and then every row of the source's records.
+// The records are read twice, once to find the columns and once for the rows,
+// so they never need to be held in memory.
+func forEachRow(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	src *SourcePackage,
+	header func(cols []string) error,
+	fn func(row []string) error,
+) error {
+	cols, err := recordColumns(ctx, conf, src)
+	if err != nil {
+		return err
+	}
+
+	if err := header(cols); err != nil {
+		return err
+	}
+
+	return src.forEachRecord(ctx, conf, func(rec json.RawMessage) error {
+		row, err := recordRow(rec, cols)
+		if err != nil {
+			return err
+		}
+
+		return fn(row)
+	})
+}
+
+func writeCSVRecords(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	src *SourcePackage,
+	w io.Writer,
+) error {
+	cw := csv.NewWriter(w)
+
+	if err := forEachRow(ctx, conf, src, cw.Write, cw.Write); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
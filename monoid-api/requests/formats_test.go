@@ -0,0 +1,89 @@
+package requests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRow(t *testing.T) {
+	row, err := recordRow(
+		json.RawMessage(`{"name": "Alice", "age": 30, "active": true, "tags": ["a"], "big": 12345678901234567890}`),
+		[]string{"active", "age", "big", "missing", "name", "tags"},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"true", "30", "12345678901234567890", "", "Alice", `["a"]`}, row)
+}
+
+func TestArchives(t *testing.T) {
+	// Build a tar to copy into the archives, as silos return FILE results.
+	src := bytes.Buffer{}
+	tw := tar.NewWriter(&src)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "file.txt", Mode: 0600, Size: 5, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	write := func(a archiveWriter) {
+		assert.NoError(t, a.AddFile("summary.json", func(w io.Writer) error {
+			_, err := w.Write([]byte("{}"))
+			return err
+		}))
+		assert.NoError(t, a.CopyTar("silo", tar.NewReader(bytes.NewReader(src.Bytes()))))
+		assert.NoError(t, a.Close())
+	}
+
+	t.Run("TarGz", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		write(newTarGzArchive(&buf, t.TempDir()))
+
+		gr, err := gzip.NewReader(&buf)
+		assert.NoError(t, err)
+
+		files := map[string]string{}
+		tr := tar.NewReader(gr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+
+			assert.NoError(t, err)
+
+			b, err := io.ReadAll(tr)
+			assert.NoError(t, err)
+			files[h.Name] = string(b)
+		}
+
+		assert.Equal(t, map[string]string{"summary.json": "{}", "silo/file.txt": "hello"}, files)
+	})
+
+	t.Run("Zip", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		write(newZipArchive(&buf))
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+
+		files := map[string]string{}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			assert.NoError(t, err)
+
+			b, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			r.Close()
+
+			files[f.Name] = string(b)
+		}
+
+		assert.Equal(t, map[string]string{"summary.json": "{}", "silo/file.txt": "hello"}, files)
+	})
+}
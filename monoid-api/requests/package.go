@@ -0,0 +1,339 @@
+package requests
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/recordstore"
+	"github.com/monoid-privacy/monoid/redaction"
+	"github.com/rs/zerolog/log"
+)
+
+// Package is the data that is included in a request's results package.
+type Package struct {
+	Request     model.Request
+	GeneratedAt time.Time
+	Silos       []SiloPackage
+}
+
+// SiloPackage is the results for one silo in a package.
+type SiloPackage struct {
+	Silo    model.SiloDefinition
+	Sources []SourcePackage
+}
+
+// SourcePackage is the results for one data source in a package.
+type SourcePackage struct {
+	// Name is the file-safe name of the data source.
+	Name        string
+	DataSource  model.DataSource
+	Status      model.RequestStatusType
+	QueryResult *model.QueryResult
+
+	// redactor applies the data source's current export policies to the
+	// source's results.
+	redactor *redaction.Redactor
+}
+
+// Summary is the cover summary of a package, listing the silos that were
+// searched and what was found in each.
+type Summary struct {
+	RequestID   string                    `json:"requestId"`
+	RequestType model.UserDataRequestType `json:"requestType"`
+	CreatedAt   time.Time                 `json:"createdAt"`
+	GeneratedAt time.Time                 `json:"generatedAt"`
+	Silos       []SiloSummary             `json:"silos"`
+}
+
+type SiloSummary struct {
+	Name    string          `json:"name"`
+	Sources []SourceSummary `json:"dataSources"`
+}
+
+type SourceSummary struct {
+	Name        string                  `json:"name"`
+	Group       *string                 `json:"group,omitempty"`
+	Status      model.RequestStatusType `json:"status"`
+	ResultType  *model.ResultType       `json:"resultType,omitempty"`
+	RecordCount *int                    `json:"recordCount,omitempty"`
+}
+
+// loadPackage loads the results of the request, grouped by silo.
+func loadPackage(conf *config.BaseConfig, requestID string) (*Package, error) {
+	request := model.Request{}
+	dataSilos := []model.SiloDefinition{}
+
+	if err := conf.DB.Preload("RequestStatuses").Preload(
+		"RequestStatuses.QueryResult",
+	).Preload(
+		"RequestStatuses.DataSource",
+	).Preload(
+		"RequestStatuses.DataSource.Properties",
+	).Preload(
+		"RequestStatuses.DataSource.Properties.Categories",
+	).Where(
+		"id = ?",
+		requestID,
+	).First(&request).Error; err != nil {
+		return nil, err
+	}
+
+	if err := conf.DB.Where(
+		"workspace_id = ?", request.WorkspaceID,
+	).Order("name").Find(&dataSilos).Error; err != nil {
+		return nil, err
+	}
+
+	statusMap := map[string][]SourcePackage{}
+	for _, stat := range request.RequestStatuses {
+		stat := stat
+		statusMap[stat.DataSource.SiloDefinitionID] = append(
+			statusMap[stat.DataSource.SiloDefinitionID],
+			SourcePackage{
+				Name:        formatDataSourceName(stat.DataSource),
+				DataSource:  stat.DataSource,
+				Status:      stat.Status,
+				QueryResult: stat.QueryResult,
+				redactor:    redaction.NewRedactor(conf.EncryptionKey, stat.DataSource.Properties),
+			},
+		)
+	}
+
+	pkg := Package{
+		Request:     request,
+		GeneratedAt: time.Now(),
+	}
+
+	for _, silo := range dataSilos {
+		sources, ok := statusMap[silo.ID]
+		if !ok {
+			continue
+		}
+
+		delete(statusMap, silo.ID)
+
+		sort.Slice(sources, func(i, j int) bool {
+			return sources[i].Name < sources[j].Name
+		})
+
+		pkg.Silos = append(pkg.Silos, SiloPackage{
+			Silo:    silo,
+			Sources: sources,
+		})
+	}
+
+	for siloID := range statusMap {
+		log.Warn().Msgf("Did not find silo definition %s", siloID)
+	}
+
+	return &pkg, nil
+}
+
+// Summary returns the cover summary for the package.
+func (p *Package) Summary() (Summary, error) {
+	summary := Summary{
+		RequestID:   p.Request.ID,
+		RequestType: p.Request.Type,
+		CreatedAt:   p.Request.CreatedAt,
+		GeneratedAt: p.GeneratedAt,
+		Silos:       []SiloSummary{},
+	}
+
+	for _, silo := range p.Silos {
+		siloSummary := SiloSummary{
+			Name:    silo.Silo.Name,
+			Sources: []SourceSummary{},
+		}
+
+		for _, src := range silo.Sources {
+			sourceSummary := SourceSummary{
+				Name:   src.DataSource.Name,
+				Group:  src.DataSource.Group,
+				Status: src.Status,
+			}
+
+			if src.QueryResult != nil {
+				sourceSummary.ResultType = &src.QueryResult.ResultType
+
+				count, err := src.recordCount()
+				if err != nil {
+					return Summary{}, err
+				}
+
+				sourceSummary.RecordCount = count
+			}
+
+			siloSummary.Sources = append(siloSummary.Sources, sourceSummary)
+		}
+
+		summary.Silos = append(summary.Silos, siloSummary)
+	}
+
+	return summary, nil
+}
+
+// hasRecords returns true if the source has a records result.
+func (s *SourcePackage) hasRecords() bool {
+	return s.QueryResult != nil &&
+		s.QueryResult.ResultType == model.ResultTypeRecordsJSON &&
+		(s.QueryResult.RecordsPath != nil || s.QueryResult.Records != nil)
+}
+
+// hasFiles returns true if the source has a file result.
+func (s *SourcePackage) hasFiles() bool {
+	return s.QueryResult != nil &&
+		s.QueryResult.ResultType == model.ResultTypeFile &&
+		s.QueryResult.Records != nil
+}
+
+func (s *SourcePackage) recordCount() (*int, error) {
+	if !s.hasRecords() {
+		return nil, nil
+	}
+
+	if s.QueryResult.RecordCount != nil {
+		return s.QueryResult.RecordCount, nil
+	}
+
+	if s.QueryResult.RecordsPath != nil {
+		return nil, nil
+	}
+
+	records := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(*s.QueryResult.Records), &records); err != nil {
+		return nil, err
+	}
+
+	count := len(records)
+	return &count, nil
+}
+
+// forEachRecord calls fn with every record in the source's results, without
+// loading all of the records into memory for streamed results. The data
+// source's current export policies are applied before fn is called.
+func (s *SourcePackage) forEachRecord(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	fn func(rec json.RawMessage) error,
+) error {
+	if !s.hasRecords() {
+		return nil
+	}
+
+	redactor := s.redactor
+	if redactor != nil && s.QueryResult.Redacted {
+		// The policies may have been tightened since the records were
+		// redacted, so the ones that weren't applied yet are applied now.
+		applied, err := s.QueryResult.AppliedPolicies()
+		if err != nil {
+			return err
+		}
+
+		if applied != nil {
+			redactor = redactor.Remaining(applied)
+		} else {
+			redactor = redactor.Reapplicable()
+		}
+	}
+
+	if redactor != nil && !redactor.Empty() {
+		next := fn
+		fn = func(rec json.RawMessage) error {
+			redacted, err := redactor.ApplyJSON(rec)
+			if err != nil {
+				return err
+			}
+
+			return next(redacted)
+		}
+	}
+
+	if s.QueryResult.RecordsPath == nil {
+		records := []json.RawMessage{}
+		if err := json.Unmarshal([]byte(*s.QueryResult.Records), &records); err != nil {
+			return err
+		}
+
+		for _, rec := range records {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	r, err := recordstore.NewReader(ctx, conf.FileStore, *s.QueryResult.RecordsPath)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// openFiles opens the tar with the files in the source's file result.
+func (s *SourcePackage) openFiles(
+	ctx context.Context,
+	conf *config.BaseConfig,
+) (*tar.Reader, func(), error) {
+	data := model.QueryResultFileData{}
+	if err := json.Unmarshal([]byte(*s.QueryResult.Records), &data); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := conf.FileStore.NewReader(ctx, data.FilePath, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return tar.NewReader(gz), func() {
+		gz.Close()
+		f.Close()
+	}, nil
+}
+
+// categoryLabels maps the names of the source's properties to the names of
+// their categories in the data map.
+func (s *SourcePackage) categoryLabels() map[string][]string {
+	labels := map[string][]string{}
+
+	for _, p := range s.DataSource.Properties {
+		names := []string{}
+		for _, c := range p.Categories {
+			names = append(names, c.Name)
+		}
+
+		sort.Strings(names)
+		labels[p.Name] = names
+	}
+
+	return labels
+}
@@ -45,6 +45,19 @@ func (r *mutationResolver) CreateWorkspace(ctx context.Context, input model.Crea
 				workspaceSettings.SendNews = false
 			}
 		}
+
+		if s.Key == "exportFormat" {
+			format := model.ExportFormat(s.Value)
+			if !format.IsValid() {
+				return nil, handleError(fmt.Errorf("invalid export format %s", s.Value), "Invalid export format.")
+			}
+
+			workspaceSettings.ExportFormat = format
+		}
+
+		if s.Key == "verifyDeletions" {
+			workspaceSettings.VerifyDeletions = s.Value == "t"
+		}
 	}
 
 	if valid := model.ValidateEmail(workspaceSettings.Email); !valid {
@@ -68,7 +81,9 @@ func (r *mutationResolver) CreateWorkspace(ctx context.Context, input model.Crea
 		"workspaceId":   workspace.ID,
 	}
 
-	identifyData := map[string]interface{}{}
+	identifyData := map[string]interface{}{
+		"workspaceId": workspace.ID,
+	}
 
 	if !workspaceSettings.AnonymizeData {
 		data["email"] = workspaceSettings.Email
@@ -111,6 +126,19 @@ func (r *mutationResolver) UpdateWorkspaceSettings(ctx context.Context, input mo
 				settings.SendNews = false
 			}
 		}
+
+		if s.Key == "exportFormat" {
+			format := model.ExportFormat(s.Value)
+			if !format.IsValid() {
+				return nil, handleError(fmt.Errorf("invalid export format %s", s.Value), "Invalid export format.")
+			}
+
+			settings.ExportFormat = format
+		}
+
+		if s.Key == "verifyDeletions" {
+			settings.VerifyDeletions = s.Value == "t"
+		}
 	}
 
 	if valid := model.ValidateEmail(settings.Email); !valid {
@@ -129,7 +157,9 @@ func (r *mutationResolver) UpdateWorkspaceSettings(ctx context.Context, input mo
 		"workspaceId": workspace.ID,
 	}
 
-	identifyData := map[string]interface{}{}
+	identifyData := map[string]interface{}{
+		"workspaceId": workspace.ID,
+	}
 
 	if !settings.AnonymizeData {
 		data["email"] = settings.Email
@@ -140,12 +170,14 @@ func (r *mutationResolver) UpdateWorkspaceSettings(ctx context.Context, input mo
 		}
 	}
 
-	r.Conf.AnalyticsIngestor.Track("updateWorkspace", nil, data)
-
 	if err := r.Conf.DB.Updates(&workspace).Error; err != nil {
 		return nil, handleError(err, "Error updating workspace.")
 	}
 
+	// The event is tracked after the settings are saved, so it's dropped if
+	// the workspace was just anonymized.
+	r.Conf.AnalyticsIngestor.Track("updateWorkspace", nil, data)
+
 	return &workspace, nil
 }
 
@@ -157,10 +189,8 @@ func (r *mutationResolver) DeleteWorkspace(ctx context.Context, id string) (stri
 		return "", handleError(err, "Error finding workspace.")
 	}
 
-	if err := r.Conf.DB.Delete(workspace).Error; err != nil {
-		return "", handleError(err, "Error deleting workspace.")
-	}
-
+	// The event is tracked before the workspace is deleted, so its settings
+	// can still be checked.
 	data := map[string]interface{}{
 		"action":      "delete",
 		"workspaceId": workspace.ID,
@@ -168,6 +198,10 @@ func (r *mutationResolver) DeleteWorkspace(ctx context.Context, id string) (stri
 
 	r.Conf.AnalyticsIngestor.Track("workspaceAction", nil, data)
 
+	if err := r.Conf.DB.Delete(workspace).Error; err != nil {
+		return "", handleError(err, "Error deleting workspace.")
+	}
+
 	return id, nil
 }
 
@@ -5,14 +5,17 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/google/uuid"
 	"github.com/monoid-privacy/monoid/dataloader"
+	"github.com/monoid-privacy/monoid/discovery"
 	"github.com/monoid-privacy/monoid/generated"
 	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/redaction"
 	"github.com/monoid-privacy/monoid/workflow"
 	"github.com/rs/zerolog/log"
 	"github.com/vektah/gqlparser/v2/gqlerror"
@@ -35,6 +38,79 @@ func (r *dataSourceResolver) Deleted(ctx context.Context, obj *model.DataSource)
 	return obj.DeletedAt.Valid, nil
 }
 
+// Versions is the resolver for the versions field.
+func (r *dataSourceResolver) Versions(ctx context.Context, obj *model.DataSource) ([]*model.DataSourceVersion, error) {
+	versions := []*model.DataSourceVersion{}
+	if err := r.Conf.DB.Where("data_source_id = ?", obj.ID).Order(
+		"version desc",
+	).Find(&versions).Error; err != nil {
+		return nil, handleError(err, "Error finding versions.")
+	}
+
+	return versions, nil
+}
+
+// VersionDiff is the resolver for the versionDiff field.
+func (r *dataSourceResolver) VersionDiff(ctx context.Context, obj *model.DataSource, fromVersion int, toVersion int) (*model.DataSourceVersionDiff, error) {
+	versions := []*model.DataSourceVersion{}
+	if err := r.Conf.DB.Where("data_source_id = ?", obj.ID).Where(
+		"version IN ?", []int{fromVersion, toVersion},
+	).Find(&versions).Error; err != nil {
+		return nil, handleError(err, "Error finding versions.")
+	}
+
+	snapshots := map[int]model.DataSourceSnapshot{}
+	for _, v := range versions {
+		snapshot, err := v.DeserializeSnapshot()
+		if err != nil {
+			return nil, handleError(err, "Error processing version.")
+		}
+
+		snapshots[v.Version] = snapshot
+	}
+
+	from, fok := snapshots[fromVersion]
+	to, tok := snapshots[toVersion]
+
+	if !fok || !tok {
+		return nil, gqlerror.Errorf("Version not found.")
+	}
+
+	diff := discovery.DiffSnapshots(from, to)
+	diff.FromVersion = fromVersion
+	diff.ToVersion = toVersion
+
+	return &diff, nil
+}
+
+// Discovery is the resolver for the discovery field.
+func (r *dataSourceVersionResolver) Discovery(ctx context.Context, obj *model.DataSourceVersion) (*model.DataDiscovery, error) {
+	if obj.DataDiscoveryID == nil {
+		return nil, nil
+	}
+
+	dataDiscovery := model.DataDiscovery{}
+	if err := r.Conf.DB.Where("id = ?", *obj.DataDiscoveryID).First(&dataDiscovery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, handleError(err, "Error finding discovery.")
+	}
+
+	return &dataDiscovery, nil
+}
+
+// Snapshot is the resolver for the snapshot field.
+func (r *dataSourceVersionResolver) Snapshot(ctx context.Context, obj *model.DataSourceVersion) (*model.DataSourceSnapshot, error) {
+	snapshot, err := obj.DeserializeSnapshot()
+	if err != nil {
+		return nil, handleError(err, "Error processing version.")
+	}
+
+	return &snapshot, nil
+}
+
 // CreateDataSource is the resolver for the createDataSource field.
 func (r *mutationResolver) CreateDataSource(ctx context.Context, input model.CreateDataSourceInput) (*model.DataSource, error) {
 	dataSource := model.DataSource{
@@ -90,7 +166,50 @@ func (r *mutationResolver) CreateSiloSpecification(ctx context.Context, input *m
 		Schema:      input.Schema,
 	}
 
-	if err := r.Conf.DB.Create(&siloSpecification).Error; err != nil {
+	if input.DockerDigest != nil {
+		if err := model.ValidateDockerDigest(*input.DockerDigest); err != nil {
+			return nil, gqlerror.Errorf("Invalid docker digest: %s.", err.Error())
+		}
+
+		siloSpecification.DockerDigest = input.DockerDigest
+	}
+
+	policy, err := model.NewExecutionPolicy(input.ExecutionPolicy)
+	if err != nil {
+		return nil, gqlerror.Errorf("Invalid execution policy: %s.", err.Error())
+	}
+
+	siloSpecification.ExecutionPolicy = policy
+
+	limits, err := model.NewExecutionLimits(input.ExecutionLimits)
+	if err != nil {
+		return nil, gqlerror.Errorf("Invalid execution limits: %s.", err.Error())
+	}
+
+	siloSpecification.ExecutionLimits = limits
+
+	batching, err := model.NewRequestBatching(input.RequestBatching)
+	if err != nil {
+		return nil, gqlerror.Errorf("Invalid request batching: %s.", err.Error())
+	}
+
+	siloSpecification.RequestBatching = batching
+
+	profile, err := model.NewRunProfile(input.RunProfile)
+	if err != nil {
+		return nil, gqlerror.Errorf("Invalid run profile: %s.", err.Error())
+	}
+
+	siloSpecification.RunProfile = profile
+
+	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&siloSpecification).Error; err != nil {
+			return err
+		}
+
+		_, err := model.RecordSiloSpecificationVersion(tx, &siloSpecification)
+		return err
+	}); err != nil {
 		return nil, handleError(err, "Error creating silo specification.")
 	}
 
@@ -147,8 +266,24 @@ func (r *mutationResolver) UpdateSiloSpecification(ctx context.Context, input *m
 		return nil, handleError(err, "Error finding silo specification.")
 	}
 
-	if input.DockerImage != nil {
+	oldSpecification := siloSpecification
+
+	if input.DockerImage != nil && *input.DockerImage != siloSpecification.DockerImage {
 		siloSpecification.DockerImage = *input.DockerImage
+
+		// The digest was for the old image, so it's cleared unless a new one
+		// is given.
+		siloSpecification.DockerDigest = nil
+	}
+
+	if input.DockerDigest != nil {
+		if *input.DockerDigest == "" {
+			siloSpecification.DockerDigest = nil
+		} else if err := model.ValidateDockerDigest(*input.DockerDigest); err != nil {
+			return nil, gqlerror.Errorf("Invalid docker digest: %s.", err.Error())
+		} else {
+			siloSpecification.DockerDigest = input.DockerDigest
+		}
 	}
 
 	if input.Name != nil {
@@ -159,7 +294,70 @@ func (r *mutationResolver) UpdateSiloSpecification(ctx context.Context, input *m
 
 	siloSpecification.Schema = input.Schema
 
-	if err := r.Conf.DB.Save(&siloSpecification).Error; err != nil {
+	if input.ExecutionPolicy != nil {
+		policy, err := model.NewExecutionPolicy(input.ExecutionPolicy)
+		if err != nil {
+			return nil, gqlerror.Errorf("Invalid execution policy: %s.", err.Error())
+		}
+
+		siloSpecification.ExecutionPolicy = policy
+	}
+
+	if input.ExecutionLimits != nil {
+		limits, err := model.NewExecutionLimits(input.ExecutionLimits)
+		if err != nil {
+			return nil, gqlerror.Errorf("Invalid execution limits: %s.", err.Error())
+		}
+
+		siloSpecification.ExecutionLimits = limits
+	}
+
+	if input.RequestBatching != nil {
+		batching, err := model.NewRequestBatching(input.RequestBatching)
+		if err != nil {
+			return nil, gqlerror.Errorf("Invalid request batching: %s.", err.Error())
+		}
+
+		siloSpecification.RequestBatching = batching
+	}
+
+	if input.RunProfile != nil {
+		profile, err := model.NewRunProfile(input.RunProfile)
+		if err != nil {
+			return nil, gqlerror.Errorf("Invalid run profile: %s.", err.Error())
+		}
+
+		siloSpecification.RunProfile = profile
+	}
+
+	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
+		if !oldSpecification.VersionChanged(&siloSpecification) {
+			if err := tx.Save(&siloSpecification).Error; err != nil {
+				return err
+			}
+
+			if siloSpecification.Manual || siloSpecification.DockerDigest == nil {
+				return nil
+			}
+
+			// A new digest is set on the specification's current version.
+			_, err := model.RecordSiloSpecificationVersion(tx, &siloSpecification)
+			return err
+		}
+
+		// The silos of the specification keep running the version they were
+		// configured against until they're upgraded.
+		if err := model.AssignSiloSpecificationVersion(tx, &oldSpecification); err != nil {
+			return err
+		}
+
+		if err := tx.Save(&siloSpecification).Error; err != nil {
+			return err
+		}
+
+		_, err := model.RecordSiloSpecificationVersion(tx, &siloSpecification)
+		return err
+	}); err != nil {
 		return nil, handleError(err, "Error updating silo specification.")
 	}
 
@@ -194,6 +392,46 @@ func (r *mutationResolver) UpdateProperty(ctx context.Context, input *model.Upda
 	return &property, nil
 }
 
+// UpdatePropertyExportPolicy is the resolver for the updatePropertyExportPolicy field.
+func (r *mutationResolver) UpdatePropertyExportPolicy(ctx context.Context, propertyID string, exportPolicy *model.ExportPolicy) (*model.Property, error) {
+	if exportPolicy != nil && !exportPolicy.IsValid() {
+		return nil, gqlerror.Errorf("Invalid export policy.")
+	}
+
+	property := model.Property{}
+	if err := r.Conf.DB.Where("id = ?", propertyID).First(&property).Error; err != nil {
+		return nil, handleError(err, "Error finding property.")
+	}
+
+	if err := r.Conf.DB.Model(&property).Update("export_policy", exportPolicy).Error; err != nil {
+		return nil, handleError(err, "Error updating property.")
+	}
+
+	property.ExportPolicy = exportPolicy
+
+	return &property, nil
+}
+
+// UpdateCategoryExportPolicy is the resolver for the updateCategoryExportPolicy field.
+func (r *mutationResolver) UpdateCategoryExportPolicy(ctx context.Context, categoryID string, exportPolicy *model.ExportPolicy) (*model.Category, error) {
+	if exportPolicy != nil && !exportPolicy.IsValid() {
+		return nil, gqlerror.Errorf("Invalid export policy.")
+	}
+
+	category := model.Category{}
+	if err := r.Conf.DB.Where("id = ?", categoryID).First(&category).Error; err != nil {
+		return nil, handleError(err, "Error finding category.")
+	}
+
+	if err := r.Conf.DB.Model(&category).Update("export_policy", exportPolicy).Error; err != nil {
+		return nil, handleError(err, "Error updating category.")
+	}
+
+	category.ExportPolicy = exportPolicy
+
+	return &category, nil
+}
+
 // DeleteDataSource is the resolver for the deleteDataSource field.
 func (r *mutationResolver) DeleteDataSource(ctx context.Context, id string) (*string, error) {
 	if err := model.DeleteDataSource(id, r.Conf.DB); err != nil {
@@ -230,7 +468,7 @@ func (r *mutationResolver) DeleteProperty(ctx context.Context, id string) (*stri
 }
 
 // DetectSiloSources is the resolver for the detectSiloSources field.
-func (r *mutationResolver) DetectSiloSources(ctx context.Context, workspaceID string, id string) (*model.Job, error) {
+func (r *mutationResolver) DetectSiloSources(ctx context.Context, workspaceID string, id string, fullScan *bool) (*model.Job, error) {
 	silo := model.SiloDefinition{}
 	if err := r.Conf.DB.Where("id = ?", id).Where(
 		"workspace_id = ?", workspaceID,
@@ -247,8 +485,9 @@ func (r *mutationResolver) DetectSiloSources(ctx context.Context, workspaceID st
 	}
 
 	analyticsData := map[string]interface{}{
-		"action": "detect_silos",
-		"siloId": silo.ID,
+		"action":      "detect_silos",
+		"siloId":      silo.ID,
+		"workspaceId": workspaceID,
 	}
 
 	r.Conf.AnalyticsIngestor.Track("siloAction", nil, analyticsData)
@@ -276,6 +515,7 @@ func (r *mutationResolver) DetectSiloSources(ctx context.Context, workspaceID st
 				SiloDefID:   silo.ID,
 				WorkspaceID: silo.WorkspaceID,
 				JobID:       job.ID,
+				FullScan:    fullScan != nil && *fullScan,
 			},
 		)
 
@@ -314,6 +554,34 @@ func (r *propertyResolver) DataSource(ctx context.Context, obj *model.Property)
 	return &ds, nil
 }
 
+// EffectiveExportPolicy is the resolver for the effectiveExportPolicy field.
+func (r *propertyResolver) EffectiveExportPolicy(ctx context.Context, obj *model.Property) (model.ExportPolicy, error) {
+	categories, err := dataloader.PropertyCategories(ctx, obj.ID)
+	if err != nil {
+		return "", err
+	}
+
+	property := *obj
+	property.Categories = categories
+
+	return redaction.PropertyPolicy(&property), nil
+}
+
+// AddedCategories is the resolver for the addedCategories field.
+func (r *propertyCategoryDiffResolver) AddedCategories(ctx context.Context, obj *model.PropertyCategoryDiff) ([]*model.Category, error) {
+	return findCategories(r.Conf.DB, obj.AddedCategoryIDs)
+}
+
+// RemovedCategories is the resolver for the removedCategories field.
+func (r *propertyCategoryDiffResolver) RemovedCategories(ctx context.Context, obj *model.PropertyCategoryDiff) ([]*model.Category, error) {
+	return findCategories(r.Conf.DB, obj.RemovedCategoryIDs)
+}
+
+// Categories is the resolver for the categories field.
+func (r *propertySnapshotResolver) Categories(ctx context.Context, obj *model.PropertySnapshot) ([]*model.Category, error) {
+	return findCategories(r.Conf.DB, obj.CategoryIDs)
+}
+
 // DataSource is the resolver for the dataSource field.
 func (r *queryResolver) DataSource(ctx context.Context, id string) (*model.DataSource, error) {
 	return findObjectByID[model.DataSource](id, r.Conf.DB, "Error finding data source.")
@@ -349,6 +617,18 @@ func (r *siloSpecificationResolver) Logo(ctx context.Context, obj *model.SiloSpe
 	return &sdata, nil
 }
 
+// Versions is the resolver for the versions field.
+func (r *siloSpecificationResolver) Versions(ctx context.Context, obj *model.SiloSpecification) ([]*model.SiloSpecificationVersion, error) {
+	versions := []*model.SiloSpecificationVersion{}
+	if err := r.Conf.DB.Where("silo_specification_id = ?", obj.ID).Order(
+		"version desc",
+	).Find(&versions).Error; err != nil {
+		return nil, handleError(err, "Error finding versions.")
+	}
+
+	return versions, nil
+}
+
 // DataMap is the resolver for the dataMap field.
 func (r *workspaceResolver) DataMap(ctx context.Context, obj *model.Workspace, query *model.DataMapQuery, limit int, offset *int) (*model.DataMapResult, error) {
 	dataMap := []*model.DataMapRow{}
@@ -423,14 +703,32 @@ func (r *workspaceResolver) DataMap(ctx context.Context, obj *model.Workspace, q
 // DataSource returns generated.DataSourceResolver implementation.
 func (r *Resolver) DataSource() generated.DataSourceResolver { return &dataSourceResolver{r} }
 
+// DataSourceVersion returns generated.DataSourceVersionResolver implementation.
+func (r *Resolver) DataSourceVersion() generated.DataSourceVersionResolver {
+	return &dataSourceVersionResolver{r}
+}
+
 // Property returns generated.PropertyResolver implementation.
 func (r *Resolver) Property() generated.PropertyResolver { return &propertyResolver{r} }
 
+// PropertyCategoryDiff returns generated.PropertyCategoryDiffResolver implementation.
+func (r *Resolver) PropertyCategoryDiff() generated.PropertyCategoryDiffResolver {
+	return &propertyCategoryDiffResolver{r}
+}
+
+// PropertySnapshot returns generated.PropertySnapshotResolver implementation.
+func (r *Resolver) PropertySnapshot() generated.PropertySnapshotResolver {
+	return &propertySnapshotResolver{r}
+}
+
 // SiloSpecification returns generated.SiloSpecificationResolver implementation.
 func (r *Resolver) SiloSpecification() generated.SiloSpecificationResolver {
 	return &siloSpecificationResolver{r}
 }
 
 type dataSourceResolver struct{ *Resolver }
+type dataSourceVersionResolver struct{ *Resolver }
 type propertyResolver struct{ *Resolver }
+type propertyCategoryDiffResolver struct{ *Resolver }
+type propertySnapshotResolver struct{ *Resolver }
 type siloSpecificationResolver struct{ *Resolver }
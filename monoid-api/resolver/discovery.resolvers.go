@@ -9,7 +9,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/monoid-privacy/monoid/dataloader"
+	"github.com/monoid-privacy/monoid/discovery"
 	"github.com/monoid-privacy/monoid/generated"
 	"github.com/monoid-privacy/monoid/model"
 	"gorm.io/gorm"
@@ -30,6 +32,24 @@ func (r *dataDiscoveryResolver) Data(ctx context.Context, obj *model.DataDiscove
 	return data, nil
 }
 
+// Policy is the resolver for the policy field.
+func (r *dataDiscoveryResolver) Policy(ctx context.Context, obj *model.DataDiscovery) (*model.DiscoveryPolicy, error) {
+	if obj.PolicyID == nil {
+		return nil, nil
+	}
+
+	policy := model.DiscoveryPolicy{}
+	if err := r.Conf.DB.Where("id = ?", *obj.PolicyID).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, handleError(err, "Error finding discovery policy.")
+	}
+
+	return &policy, nil
+}
+
 // DataSource is the resolver for the dataSource field.
 func (r *dataSourceMissingDiscoveryResolver) DataSource(ctx context.Context, obj *model.DataSourceMissingDiscovery) (*model.DataSource, error) {
 	dataSource := model.DataSource{}
@@ -44,14 +64,84 @@ func (r *dataSourceMissingDiscoveryResolver) DataSource(ctx context.Context, obj
 	return &dataSource, nil
 }
 
+// SiloDefinition is the resolver for the siloDefinition field.
+func (r *discoveryPolicyResolver) SiloDefinition(ctx context.Context, obj *model.DiscoveryPolicy) (*model.SiloDefinition, error) {
+	if obj.SiloDefinitionID == nil {
+		return nil, nil
+	}
+
+	return dataloader.SiloDefinition(ctx, *obj.SiloDefinitionID)
+}
+
+// CreateDiscoveryPolicy is the resolver for the createDiscoveryPolicy field.
+func (r *mutationResolver) CreateDiscoveryPolicy(ctx context.Context, input model.CreateDiscoveryPolicyInput) (*model.DiscoveryPolicy, error) {
+	if input.SiloDefinitionID != nil {
+		silo := model.SiloDefinition{}
+		if err := r.Conf.DB.Where("id = ?", *input.SiloDefinitionID).Where(
+			"workspace_id = ?", input.WorkspaceID,
+		).First(&silo).Error; err != nil {
+			return nil, handleError(err, "Error finding silo.")
+		}
+	}
+
+	policy := model.DiscoveryPolicy{
+		ID:               uuid.NewString(),
+		WorkspaceID:      input.WorkspaceID,
+		SiloDefinitionID: input.SiloDefinitionID,
+		DiscoveryType:    input.DiscoveryType,
+		Action:           input.Action,
+		MinConfidence:    input.MinConfidence,
+		SchemaPattern:    input.SchemaPattern,
+	}
+
+	if input.Priority != nil {
+		policy.Priority = *input.Priority
+	}
+
+	if err := r.Conf.DB.Create(&policy).Error; err != nil {
+		return nil, handleError(err, "Error creating discovery policy.")
+	}
+
+	return &policy, nil
+}
+
+// UpdateDiscoveryPolicy is the resolver for the updateDiscoveryPolicy field.
+func (r *mutationResolver) UpdateDiscoveryPolicy(ctx context.Context, input model.UpdateDiscoveryPolicyInput) (*model.DiscoveryPolicy, error) {
+	policy := model.DiscoveryPolicy{}
+	if err := r.Conf.DB.Where("id = ?", input.ID).First(&policy).Error; err != nil {
+		return nil, handleError(err, "Error finding discovery policy.")
+	}
+
+	policy.DiscoveryType = input.DiscoveryType
+	policy.Action = input.Action
+	policy.MinConfidence = input.MinConfidence
+	policy.SchemaPattern = input.SchemaPattern
+	policy.Priority = 0
+
+	if input.Priority != nil {
+		policy.Priority = *input.Priority
+	}
+
+	if err := r.Conf.DB.Save(&policy).Error; err != nil {
+		return nil, handleError(err, "Error updating discovery policy.")
+	}
+
+	return &policy, nil
+}
+
+// DeleteDiscoveryPolicy is the resolver for the deleteDiscoveryPolicy field.
+func (r *mutationResolver) DeleteDiscoveryPolicy(ctx context.Context, id string) (*string, error) {
+	return DeleteObjectByID[model.DiscoveryPolicy](id, r.Conf.DB, "Error deleting discovery policy.")
+}
+
 // HandleDiscovery is the resolver for the handleDiscovery field.
 func (r *mutationResolver) HandleDiscovery(ctx context.Context, input *model.HandleDiscoveryInput) (*model.DataDiscovery, error) {
-	discovery := model.DataDiscovery{}
-	if err := r.Conf.DB.Where("id = ?", input.DiscoveryID).First(&discovery).Error; err != nil {
+	dataDiscovery := model.DataDiscovery{}
+	if err := r.Conf.DB.Where("id = ?", input.DiscoveryID).First(&dataDiscovery).Error; err != nil {
 		return nil, handleError(err, "Could not find discovery.")
 	}
 
-	res, errs := applyDiscoveries(r.Conf, []*model.DataDiscovery{&discovery}, input.Action)
+	res, errs := discovery.ApplyDiscoveries(r.Conf, []*model.DataDiscovery{&dataDiscovery}, input.Action)
 	if len(errs) != 0 {
 		return nil, handleError(errs[0], "Error applying discovery.")
 	}
@@ -72,7 +162,7 @@ func (r *mutationResolver) HandleAllOpenDiscoveries(ctx context.Context, input *
 		return nil, handleError(err, "Error finding discoveries.")
 	}
 
-	res, errs := applyDiscoveries(r.Conf, discoveries, input.Action)
+	res, errs := discovery.ApplyDiscoveries(r.Conf, discoveries, input.Action)
 	if len(errs) != 0 {
 		return nil, handleError(errs[0], fmt.Sprintf("Errors applying %d discoveries.", len(errs)))
 	}
@@ -126,6 +216,54 @@ func (r *newPropertyDiscoveryResolver) DataSource(ctx context.Context, obj *mode
 	return &dataSource, nil
 }
 
+// DataSource is the resolver for the dataSource field.
+func (r *primaryKeyCoverageGapResolver) DataSource(ctx context.Context, obj *model.PrimaryKeyCoverageGap) (*model.DataSource, error) {
+	return dataloader.DataSource(ctx, obj.DataSourceID)
+}
+
+// SiloDefinition is the resolver for the siloDefinition field.
+func (r *primaryKeyCoverageGapResolver) SiloDefinition(ctx context.Context, obj *model.PrimaryKeyCoverageGap) (*model.SiloDefinition, error) {
+	return dataloader.SiloDefinition(ctx, obj.SiloDefinitionID)
+}
+
+// CategorizedProperties is the resolver for the categorizedProperties field.
+func (r *primaryKeyCoverageGapResolver) CategorizedProperties(ctx context.Context, obj *model.PrimaryKeyCoverageGap) ([]*model.Property, error) {
+	properties := []*model.Property{}
+	if err := r.Conf.DB.Where("id IN ?", obj.CategorizedPropertyIDs).Find(&properties).Error; err != nil {
+		return nil, handleError(err, "Error finding properties.")
+	}
+
+	return properties, nil
+}
+
+// Property is the resolver for the property field.
+func (r *primaryKeyLinkDiscoveryResolver) Property(ctx context.Context, obj *model.PrimaryKeyLinkDiscovery) (*model.Property, error) {
+	property := model.Property{}
+	if err := r.Conf.DB.Where("id = ?", obj.PropertyID).First(&property).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, handleError(err, "Error finding property.")
+	}
+
+	return &property, nil
+}
+
+// UserPrimaryKey is the resolver for the userPrimaryKey field.
+func (r *primaryKeyLinkDiscoveryResolver) UserPrimaryKey(ctx context.Context, obj *model.PrimaryKeyLinkDiscovery) (*model.UserPrimaryKey, error) {
+	userPrimaryKey := model.UserPrimaryKey{}
+	if err := r.Conf.DB.Where("id = ?", obj.UserPrimaryKeyID).First(&userPrimaryKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, handleError(err, "Error finding user primary key.")
+	}
+
+	return &userPrimaryKey, nil
+}
+
 // Property is the resolver for the property field.
 func (r *propertyMissingDiscoveryResolver) Property(ctx context.Context, obj *model.PropertyMissingDiscovery) (*model.Property, error) {
 	property := model.Property{}
@@ -175,6 +313,48 @@ func (r *siloDefinitionResolver) Discoveries(ctx context.Context, obj *model.Sil
 	}, nil
 }
 
+// PrimaryKeyCoverageGaps is the resolver for the primaryKeyCoverageGaps field.
+func (r *workspaceResolver) PrimaryKeyCoverageGaps(ctx context.Context, obj *model.Workspace) ([]*model.PrimaryKeyCoverageGap, error) {
+	type categorizedProperty struct {
+		ID               string
+		DataSourceID     string
+		SiloDefinitionID string
+	}
+
+	properties := []categorizedProperty{}
+	if err := r.Conf.DB.Table("properties").Select(
+		"DISTINCT properties.id, properties.data_source_id, data_sources.silo_definition_id",
+	).Joins(
+		"JOIN property_categories ON property_categories.property_id = properties.id",
+	).Joins(
+		"JOIN data_sources ON data_sources.id = properties.data_source_id",
+	).Joins(
+		"JOIN silo_definitions ON silo_definitions.id = data_sources.silo_definition_id",
+	).Where("silo_definitions.workspace_id = ?", obj.ID).Where(
+		"properties.deleted_at IS NULL AND data_sources.deleted_at IS NULL",
+	).Where(
+		"NOT EXISTS (SELECT 1 FROM properties linked WHERE linked.data_source_id = properties.data_source_id " +
+			"AND linked.user_primary_key_id IS NOT NULL AND linked.deleted_at IS NULL)",
+	).Order("properties.data_source_id, properties.id").Scan(&properties).Error; err != nil {
+		return nil, handleError(err, "Error finding coverage gaps.")
+	}
+
+	gaps := []*model.PrimaryKeyCoverageGap{}
+	for _, p := range properties {
+		if len(gaps) == 0 || gaps[len(gaps)-1].DataSourceID != p.DataSourceID {
+			gaps = append(gaps, &model.PrimaryKeyCoverageGap{
+				DataSourceID:     p.DataSourceID,
+				SiloDefinitionID: p.SiloDefinitionID,
+			})
+		}
+
+		gap := gaps[len(gaps)-1]
+		gap.CategorizedPropertyIDs = append(gap.CategorizedPropertyIDs, p.ID)
+	}
+
+	return gaps, nil
+}
+
 // Discoveries is the resolver for the discoveries field.
 func (r *workspaceResolver) Discoveries(ctx context.Context, obj *model.Workspace, statuses []*model.DiscoveryStatus, query *string, limit int, offset *int) (*model.DataDiscoveriesListResult, error) {
 	offsetVal := 0
@@ -213,6 +393,18 @@ func (r *workspaceResolver) Discoveries(ctx context.Context, obj *model.Workspac
 	}, nil
 }
 
+// DiscoveryPolicies is the resolver for the discoveryPolicies field.
+func (r *workspaceResolver) DiscoveryPolicies(ctx context.Context, obj *model.Workspace) ([]*model.DiscoveryPolicy, error) {
+	policies := []*model.DiscoveryPolicy{}
+	if err := r.Conf.DB.Where("workspace_id = ?", obj.ID).Order(
+		"priority desc, created_at asc",
+	).Find(&policies).Error; err != nil {
+		return nil, handleError(err, "Error finding discovery policies.")
+	}
+
+	return policies, nil
+}
+
 // DataDiscovery returns generated.DataDiscoveryResolver implementation.
 func (r *Resolver) DataDiscovery() generated.DataDiscoveryResolver { return &dataDiscoveryResolver{r} }
 
@@ -221,6 +413,11 @@ func (r *Resolver) DataSourceMissingDiscovery() generated.DataSourceMissingDisco
 	return &dataSourceMissingDiscoveryResolver{r}
 }
 
+// DiscoveryPolicy returns generated.DiscoveryPolicyResolver implementation.
+func (r *Resolver) DiscoveryPolicy() generated.DiscoveryPolicyResolver {
+	return &discoveryPolicyResolver{r}
+}
+
 // NewCategoryDiscovery returns generated.NewCategoryDiscoveryResolver implementation.
 func (r *Resolver) NewCategoryDiscovery() generated.NewCategoryDiscoveryResolver {
 	return &newCategoryDiscoveryResolver{r}
@@ -231,6 +428,16 @@ func (r *Resolver) NewPropertyDiscovery() generated.NewPropertyDiscoveryResolver
 	return &newPropertyDiscoveryResolver{r}
 }
 
+// PrimaryKeyCoverageGap returns generated.PrimaryKeyCoverageGapResolver implementation.
+func (r *Resolver) PrimaryKeyCoverageGap() generated.PrimaryKeyCoverageGapResolver {
+	return &primaryKeyCoverageGapResolver{r}
+}
+
+// PrimaryKeyLinkDiscovery returns generated.PrimaryKeyLinkDiscoveryResolver implementation.
+func (r *Resolver) PrimaryKeyLinkDiscovery() generated.PrimaryKeyLinkDiscoveryResolver {
+	return &primaryKeyLinkDiscoveryResolver{r}
+}
+
 // PropertyMissingDiscovery returns generated.PropertyMissingDiscoveryResolver implementation.
 func (r *Resolver) PropertyMissingDiscovery() generated.PropertyMissingDiscoveryResolver {
 	return &propertyMissingDiscoveryResolver{r}
@@ -238,6 +445,9 @@ func (r *Resolver) PropertyMissingDiscovery() generated.PropertyMissingDiscovery
 
 type dataDiscoveryResolver struct{ *Resolver }
 type dataSourceMissingDiscoveryResolver struct{ *Resolver }
+type discoveryPolicyResolver struct{ *Resolver }
 type newCategoryDiscoveryResolver struct{ *Resolver }
 type newPropertyDiscoveryResolver struct{ *Resolver }
+type primaryKeyCoverageGapResolver struct{ *Resolver }
+type primaryKeyLinkDiscoveryResolver struct{ *Resolver }
 type propertyMissingDiscoveryResolver struct{ *Resolver }
@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/download"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/requests"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"gorm.io/gorm"
+)
+
+// requestDownloadableFile returns the ID of the downloadable file with the
+// request's results, generating the file if it doesn't exist yet or was
+// generated in a different export format.
+func (r *Resolver) requestDownloadableFile(ctx context.Context, requestID string) (string, error) {
+	request := model.Request{}
+
+	if err := r.Conf.DB.Where("id = ?", requestID).Preload("Job").Preload(
+		"DownloadableFile",
+	).First(&request).Error; err != nil {
+		return "", handleError(err, "Could not find the request")
+	}
+
+	status, err := request.Status()
+	if err != nil {
+		return "", err
+	}
+
+	if status == model.FullRequestStatusInProgress ||
+		status == model.FullRequestStatusCreated ||
+		status == model.FullRequestStatusFailed {
+		return "", handleError(
+			fmt.Errorf("request must be completed to get file results"),
+			"The request must be completed in order to get file URLs.",
+		)
+	}
+
+	format, err := requests.ExportFormat(r.Conf, &request)
+	if err != nil {
+		return "", handleError(err, "Error finding export format.")
+	}
+
+	// Files generated before export formats were added are JSON packages.
+	if request.DownloadableFile != nil {
+		fileFormat := model.ExportFormatJSON
+		if request.DownloadableFile.Format != nil {
+			fileFormat = *request.DownloadableFile.Format
+		}
+
+		if fileFormat == format {
+			return request.DownloadableFile.ID, nil
+		}
+	}
+
+	dlfile, err := requests.GenerateRequestPackage(ctx, r.Conf, request.ID, format)
+	if err != nil {
+		return "", handleError(err, "Error generating file.")
+	}
+
+	dlfile.ID = uuid.NewString()
+
+	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dlfile).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&request).Update("downloadable_file_id", dlfile.ID).Error; err != nil {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return "", handleError(err, "Error creating file")
+	}
+
+	return dlfile.ID, nil
+}
+
+// createDownloadLink creates a signed download link for the file.
+func (r *Resolver) createDownloadLink(
+	fileID string,
+	requestID *string,
+	options *model.DownloadLinkOptions,
+	public bool,
+) (*model.DownloadLink, error) {
+	opts := download.GrantOptions{Public: public}
+	if options != nil {
+		if options.ExpiresInMinutes != nil {
+			opts.TTL = time.Duration(*options.ExpiresInMinutes) * time.Minute
+			if opts.TTL <= 0 {
+				return nil, gqlerror.Errorf("Links must expire in at least one minute.")
+			}
+		}
+
+		opts.MaxDownloads = options.MaxDownloads
+	}
+
+	grant, err := download.CreateGrant(r.Conf.DB, model.GetKeyring(), fileID, requestID, opts)
+	if err != nil {
+		return nil, handleError(err, "Error creating download link.")
+	}
+
+	return &model.DownloadLink{
+		URL:       grant.Path,
+		GrantID:   grant.Grant.ID,
+		ExpiresAt: grant.Grant.ExpiresAt,
+		Code:      grant.Code,
+	}, nil
+}
@@ -60,6 +60,21 @@ func DeleteObjectByID[Object any](id string, db *gorm.DB, errMsg string) (*strin
 	return &id, nil
 }
 
+// findCategories finds the categories with the given IDs, ignoring any
+// that no longer exist.
+func findCategories(db *gorm.DB, ids []string) ([]*model.Category, error) {
+	categories := []*model.Category{}
+	if len(ids) == 0 {
+		return categories, nil
+	}
+
+	if err := db.Where("id IN ?", ids).Find(&categories).Error; err != nil {
+		return nil, handleError(err, "Error finding categories.")
+	}
+
+	return categories, nil
+}
+
 func MonoidRecordsToMonoidRecordResponses(monoidRecords []monoidprotocol.MonoidRecord) []model.MonoidRecordResponse {
 	var recordResponses []model.MonoidRecordResponse
 
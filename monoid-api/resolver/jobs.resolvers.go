@@ -4,13 +4,14 @@ package resolver
 // will be copied through when generating and any unknown code will be moved to the end.
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/monoid-privacy/monoid/dataloader"
 	"github.com/monoid-privacy/monoid/generated"
+	"github.com/monoid-privacy/monoid/joblog"
 	"github.com/monoid-privacy/monoid/model"
 	"gorm.io/gorm"
 )
@@ -26,22 +27,59 @@ func (r *jobResolver) SiloDefinition(ctx context.Context, obj *model.Job) (*mode
 
 // Logs is the resolver for the logs field.
 func (r *jobResolver) Logs(ctx context.Context, obj *model.Job) ([]string, error) {
-	if obj.LogObject == "" {
-		return []string{}, nil
+	entries, _, err := joblog.Read(ctx, r.Conf.DB, r.Conf.FileStore, obj, joblog.Filter{}, joblog.Page{Limit: -1})
+	if err != nil {
+		return nil, handleError(err, "Error getting logs.")
+	}
+
+	logLines := make([]string, len(entries))
+	for i, e := range entries {
+		logLines[i] = e.Message
+	}
+
+	return logLines, nil
+}
+
+// LogEntries is the resolver for the logEntries field.
+func (r *jobResolver) LogEntries(ctx context.Context, obj *model.Job, offset *int, limit int, levels []model.LogLevel) (*model.JobLogEntriesResult, error) {
+	page := joblog.Page{Limit: limit}
+	if offset != nil && *offset > 0 {
+		page.Offset = *offset
 	}
 
-	reader, err := r.Conf.FileStore.NewReader(ctx, obj.LogObject, true)
+	entries, total, err := joblog.Read(ctx, r.Conf.DB, r.Conf.FileStore, obj, joblog.Filter{Levels: levels}, page)
 	if err != nil {
-		return nil, handleError(err, "Error getting jobs")
+		return nil, handleError(err, "Error getting logs.")
 	}
 
-	logLines := []string{}
-	sc := bufio.NewScanner(reader)
-	for sc.Scan() {
-		logLines = append(logLines, sc.Text())
+	res := make([]*model.JobLogEntry, len(entries))
+	for i := range entries {
+		res[i] = &entries[i]
 	}
 
-	return logLines, nil
+	return &model.JobLogEntriesResult{
+		Entries:    res,
+		NumEntries: total,
+	}, nil
+}
+
+// Progress is the resolver for the progress field.
+func (r *jobResolver) Progress(ctx context.Context, obj *model.Job) ([]*model.JobProgress, error) {
+	if obj.JobType != model.JobTypeExecuteRequest {
+		return []*model.JobProgress{}, nil
+	}
+
+	progress, err := r.jobProgress(obj)
+	if err != nil {
+		return nil, handleError(err, "Error getting job progress.")
+	}
+
+	return progress, nil
+}
+
+// SiloDefinition is the resolver for the siloDefinition field.
+func (r *jobProgressResolver) SiloDefinition(ctx context.Context, obj *model.JobProgress) (*model.SiloDefinition, error) {
+	return dataloader.SiloDefinition(ctx, obj.SiloDefinitionID)
 }
 
 // CancelJob is the resolver for the cancelJob field.
@@ -71,6 +109,16 @@ func (r *mutationResolver) CancelJob(ctx context.Context, id string) (*model.Job
 	return &job, nil
 }
 
+// JobLogs is the resolver for the jobLogs field.
+func (r *subscriptionResolver) JobLogs(ctx context.Context, jobID string, levels []model.LogLevel) (<-chan *model.JobLogEntry, error) {
+	ch, err := joblog.Tail(ctx, r.Conf.DB, r.Conf.FileStore, jobID, joblog.Filter{Levels: levels}, time.Second)
+	if err != nil {
+		return nil, handleError(err, "Error finding job.")
+	}
+
+	return ch, nil
+}
+
 // Jobs is the resolver for the jobs field.
 func (r *workspaceResolver) Jobs(ctx context.Context, obj *model.Workspace, jobType string, resourceID *string, status []*model.JobStatus, query *string, limit int, offset int) (*model.JobsResult, error) {
 	jobs := []*model.Job{}
@@ -123,4 +171,12 @@ func (r *workspaceResolver) Job(ctx context.Context, obj *model.Workspace, id st
 // Job returns generated.JobResolver implementation.
 func (r *Resolver) Job() generated.JobResolver { return &jobResolver{r} }
 
+// JobProgress returns generated.JobProgressResolver implementation.
+func (r *Resolver) JobProgress() generated.JobProgressResolver { return &jobProgressResolver{r} }
+
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
 type jobResolver struct{ *Resolver }
+type jobProgressResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
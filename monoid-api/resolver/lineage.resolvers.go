@@ -0,0 +1,278 @@
+package resolver
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/dataloader"
+	"github.com/monoid-privacy/monoid/generated"
+	"github.com/monoid-privacy/monoid/lineage"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/workflow"
+	"github.com/rs/zerolog/log"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
+)
+
+// Upstream is the resolver for the upstream field.
+func (r *dataSourceResolver) Upstream(ctx context.Context, obj *model.DataSource) ([]*model.LineageEdge, error) {
+	edges := []*model.LineageEdge{}
+	if err := r.Conf.DB.Where("to_data_source_id = ?", obj.ID).Find(&edges).Error; err != nil {
+		return nil, handleError(err, "Error finding lineage edges.")
+	}
+
+	return edges, nil
+}
+
+// Downstream is the resolver for the downstream field.
+func (r *dataSourceResolver) Downstream(ctx context.Context, obj *model.DataSource) ([]*model.LineageEdge, error) {
+	edges := []*model.LineageEdge{}
+	if err := r.Conf.DB.Where("from_data_source_id = ?", obj.ID).Find(&edges).Error; err != nil {
+		return nil, handleError(err, "Error finding lineage edges.")
+	}
+
+	return edges, nil
+}
+
+// FromDataSource is the resolver for the fromDataSource field.
+func (r *lineageEdgeResolver) FromDataSource(ctx context.Context, obj *model.LineageEdge) (*model.DataSource, error) {
+	return dataloader.DataSource(ctx, obj.FromDataSourceID)
+}
+
+// ToDataSource is the resolver for the toDataSource field.
+func (r *lineageEdgeResolver) ToDataSource(ctx context.Context, obj *model.LineageEdge) (*model.DataSource, error) {
+	return dataloader.DataSource(ctx, obj.ToDataSourceID)
+}
+
+// FromProperty is the resolver for the fromProperty field.
+func (r *lineageEdgeResolver) FromProperty(ctx context.Context, obj *model.LineageEdge) (*model.Property, error) {
+	if obj.FromPropertyID == nil {
+		return nil, nil
+	}
+
+	return findObjectByID[model.Property](*obj.FromPropertyID, r.Conf.DB, "Error finding property.")
+}
+
+// ToProperty is the resolver for the toProperty field.
+func (r *lineageEdgeResolver) ToProperty(ctx context.Context, obj *model.LineageEdge) (*model.Property, error) {
+	if obj.ToPropertyID == nil {
+		return nil, nil
+	}
+
+	return findObjectByID[model.Property](*obj.ToPropertyID, r.Conf.DB, "Error finding property.")
+}
+
+// DataSource is the resolver for the dataSource field.
+func (r *lineageWarningResolver) DataSource(ctx context.Context, obj *model.LineageWarning) (*model.DataSource, error) {
+	return dataloader.DataSource(ctx, obj.DataSourceID)
+}
+
+// UpstreamDataSource is the resolver for the upstreamDataSource field.
+func (r *lineageWarningResolver) UpstreamDataSource(ctx context.Context, obj *model.LineageWarning) (*model.DataSource, error) {
+	return dataloader.DataSource(ctx, obj.UpstreamDataSourceID)
+}
+
+// CreateLineageEdge is the resolver for the createLineageEdge field.
+func (r *mutationResolver) CreateLineageEdge(ctx context.Context, input model.CreateLineageEdgeInput) (*model.LineageEdge, error) {
+	if input.FromDataSourceID == input.ToDataSourceID {
+		return nil, gqlerror.Errorf("A data source cannot be linked to itself.")
+	}
+
+	if (input.FromPropertyID == nil) != (input.ToPropertyID == nil) {
+		return nil, gqlerror.Errorf("Both properties must be set for a property edge.")
+	}
+
+	count := int64(0)
+	if err := r.Conf.DB.Model(&model.DataSource{}).Joins(
+		"JOIN silo_definitions ON silo_definitions.id = data_sources.silo_definition_id",
+	).Where("silo_definitions.workspace_id = ?", input.WorkspaceID).Where(
+		"data_sources.id IN ?", []string{input.FromDataSourceID, input.ToDataSourceID},
+	).Count(&count).Error; err != nil || count != 2 {
+		return nil, handleError(err, "Error finding data sources.")
+	}
+
+	if input.FromPropertyID != nil {
+		for _, p := range []struct {
+			propertyID   string
+			dataSourceID string
+		}{
+			{*input.FromPropertyID, input.FromDataSourceID},
+			{*input.ToPropertyID, input.ToDataSourceID},
+		} {
+			property := model.Property{}
+			if err := r.Conf.DB.Where("id = ?", p.propertyID).Where(
+				"data_source_id = ?", p.dataSourceID,
+			).First(&property).Error; err != nil {
+				return nil, handleError(err, "Error finding property.")
+			}
+		}
+	}
+
+	edge := model.LineageEdge{
+		ID:               uuid.NewString(),
+		WorkspaceID:      input.WorkspaceID,
+		FromDataSourceID: input.FromDataSourceID,
+		ToDataSourceID:   input.ToDataSourceID,
+		FromPropertyID:   input.FromPropertyID,
+		ToPropertyID:     input.ToPropertyID,
+		Type:             model.LineageEdgeTypeManual,
+	}
+
+	if err := r.Conf.DB.Create(&edge).Error; err != nil {
+		return nil, handleError(err, "Error creating lineage edge.")
+	}
+
+	return &edge, nil
+}
+
+// DeleteLineageEdge is the resolver for the deleteLineageEdge field.
+func (r *mutationResolver) DeleteLineageEdge(ctx context.Context, id string) (*string, error) {
+	return DeleteObjectByID[model.LineageEdge](id, r.Conf.DB, "Error deleting lineage edge.")
+}
+
+// InferLineage is the resolver for the inferLineage field.
+func (r *mutationResolver) InferLineage(ctx context.Context, workspaceID string) (*model.Job, error) {
+	// Only infer the lineage once at a time, since each run replaces the
+	// inferred edges.
+	running := model.Job{}
+	if err := r.Conf.DB.Where("workspace_id = ?", workspaceID).Where(
+		"job_type = ?", model.JobTypeInferLineage,
+	).Where("status IN ?", []model.JobStatus{
+		model.JobStatusQueued, model.JobStatusRunning,
+	}).First(&running).Error; err == nil {
+		return &running, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, handleError(err, "Error finding jobs.")
+	}
+
+	job := model.Job{
+		ID:          uuid.NewString(),
+		WorkspaceID: workspaceID,
+		JobType:     model.JobTypeInferLineage,
+		Status:      model.JobStatusQueued,
+		ResourceID:  workspaceID,
+	}
+
+	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+
+		options := client.StartWorkflowOptions{
+			ID:        job.ID,
+			TaskQueue: workflow.DockerRunnerQueue,
+		}
+
+		sf := workflow.Workflow{
+			Conf: r.Conf,
+		}
+
+		wf, err := r.Conf.TemporalClient.ExecuteWorkflow(
+			context.Background(),
+			options,
+			sf.InferLineageWorkflow,
+			workflow.InferLineageArgs{
+				WorkspaceID: workspaceID,
+				JobID:       job.ID,
+			},
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&job).Update("temporal_workflow_id", wf.GetID()).Error; err != nil {
+			log.Err(err).Msg("Error uploading workflow ID")
+		}
+
+		return nil
+	}); err != nil {
+		return nil, handleError(err, "Error running job.")
+	}
+
+	return &job, nil
+}
+
+// LineageWarnings is the resolver for the lineageWarnings field.
+func (r *requestResolver) LineageWarnings(ctx context.Context, obj *model.Request) ([]*model.LineageWarning, error) {
+	if obj.Type != model.UserDataRequestTypeDelete {
+		return []*model.LineageWarning{}, nil
+	}
+
+	edges := []*model.LineageEdge{}
+	if err := r.Conf.DB.Where("workspace_id = ?", obj.WorkspaceID).Find(&edges).Error; err != nil {
+		return nil, handleError(err, "Error finding lineage edges.")
+	}
+
+	if len(edges) == 0 {
+		return []*model.LineageWarning{}, nil
+	}
+
+	linkedIDs := []string{}
+	if err := r.Conf.DB.Model(&model.Property{}).Joins(
+		"JOIN data_sources ON data_sources.id = properties.data_source_id",
+	).Joins(
+		"JOIN silo_definitions ON silo_definitions.id = data_sources.silo_definition_id",
+	).Where("silo_definitions.workspace_id = ?", obj.WorkspaceID).Where(
+		"properties.user_primary_key_id IS NOT NULL",
+	).Where("data_sources.deleted_at IS NULL").Distinct().Pluck(
+		"properties.data_source_id", &linkedIDs,
+	).Error; err != nil {
+		return nil, handleError(err, "Error finding linked data sources.")
+	}
+
+	linked := map[string]bool{}
+	for _, id := range linkedIDs {
+		linked[id] = true
+	}
+
+	return lineage.DeletionWarnings(edges, linked), nil
+}
+
+// Lineage is the resolver for the lineage field.
+func (r *workspaceResolver) Lineage(ctx context.Context, obj *model.Workspace) (*model.LineageGraph, error) {
+	edges := []*model.LineageEdge{}
+	if err := r.Conf.DB.Where("workspace_id = ?", obj.ID).Find(&edges).Error; err != nil {
+		return nil, handleError(err, "Error finding lineage edges.")
+	}
+
+	ids := []string{}
+	seen := map[string]bool{}
+
+	for _, e := range edges {
+		for _, id := range []string{e.FromDataSourceID, e.ToDataSourceID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	dataSources := []*model.DataSource{}
+	if len(ids) != 0 {
+		if err := r.Conf.DB.Where("id IN ?", ids).Find(&dataSources).Error; err != nil {
+			return nil, handleError(err, "Error finding data sources.")
+		}
+	}
+
+	return &model.LineageGraph{
+		DataSources: dataSources,
+		Edges:       edges,
+	}, nil
+}
+
+// LineageEdge returns generated.LineageEdgeResolver implementation.
+func (r *Resolver) LineageEdge() generated.LineageEdgeResolver { return &lineageEdgeResolver{r} }
+
+// LineageWarning returns generated.LineageWarningResolver implementation.
+func (r *Resolver) LineageWarning() generated.LineageWarningResolver {
+	return &lineageWarningResolver{r}
+}
+
+type lineageEdgeResolver struct{ *Resolver }
+type lineageWarningResolver struct{ *Resolver }
@@ -0,0 +1,54 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/recordstore"
+)
+
+// maxRecordsLimit is the most records that can be requested in a page.
+const maxRecordsLimit = 1000
+
+// defaultRecordsLimit is the size of a page of records if no limit is given.
+const defaultRecordsLimit = 100
+
+// queryResultRecords returns a page of the records in the query result, or all
+// the records from offset on if limit is negative. Results that were stored
+// before records were streamed to the file store are read from the database.
+func (r *Resolver) queryResultRecords(
+	ctx context.Context,
+	obj *model.QueryResult,
+	offset int,
+	limit int,
+) ([]json.RawMessage, error) {
+	if obj.RecordsPath != nil {
+		records, err := recordstore.ReadPage(ctx, r.Conf.FileStore, *obj.RecordsPath, offset, limit)
+		if err != nil {
+			return nil, handleError(err, "Error reading records.")
+		}
+
+		return records, nil
+	}
+
+	if obj.Records == nil {
+		return nil, nil
+	}
+
+	records := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(*obj.Records), &records); err != nil {
+		return nil, handleError(err, "Error reading records.")
+	}
+
+	if offset > len(records) {
+		offset = len(records)
+	}
+
+	end := offset + limit
+	if limit < 0 || end > len(records) {
+		end = len(records)
+	}
+
+	return records[offset:end], nil
+}
@@ -0,0 +1,232 @@
+package resolver
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/workflow"
+	"github.com/monoid-privacy/monoid/workflow/requestworkflow"
+	"github.com/rs/zerolog/log"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// startRequestJob starts a job to execute the request, and sets it as the request's
+// current job. If siloDefinitionIDs or requestStatusIDs are set, the job only runs
+// on those silos and data sources.
+func (r *Resolver) startRequestJob(
+	ctx context.Context,
+	db *gorm.DB,
+	request *model.Request,
+	siloDefinitionIDs []string,
+	requestStatusIDs []string,
+) error {
+	job := model.Job{
+		ID:          uuid.NewString(),
+		WorkspaceID: request.WorkspaceID,
+		JobType:     model.JobTypeExecuteRequest,
+		Status:      model.JobStatusQueued,
+		ResourceID:  request.ID,
+	}
+
+	options := client.StartWorkflowOptions{
+		ID:        job.ID,
+		TaskQueue: workflow.DockerRunnerQueue,
+	}
+
+	sf := requestworkflow.RequestWorkflow{
+		Conf: r.Conf,
+	}
+
+	wf, err := r.Conf.TemporalClient.ExecuteWorkflow(ctx, options, sf.ExecuteRequestWorkflow, requestworkflow.ExecuteRequestArgs{
+		RequestID:         request.ID,
+		WorkspaceID:       request.WorkspaceID,
+		JobID:             job.ID,
+		VerifyDeletion:    request.Type == model.UserDataRequestTypeDelete && request.VerifyDeletion,
+		SiloDefinitionIDs: siloDefinitionIDs,
+		RequestStatusIDs:  requestStatusIDs,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&job).Update("temporal_workflow_id", wf.GetID()).Error; err != nil {
+			log.Err(err).Msg("Error uploading workflow ID")
+		}
+
+		if err := tx.Model(request).Update("job_id", &job.ID).Error; err != nil {
+			log.Err(err).Msg("Error updating job ID")
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	request.JobID = &job.ID
+	request.Job = &job
+
+	return nil
+}
+
+// runningRequestJob returns the request's current job if it is still running.
+func (r *Resolver) runningRequestJob(db *gorm.DB, request *model.Request) (*model.Job, error) {
+	if request.JobID == nil {
+		return nil, nil
+	}
+
+	job := model.Job{}
+	if err := db.Where("id = ?", *request.JobID).First(&job).Error; err != nil {
+		return nil, err
+	}
+
+	if job.Status != model.JobStatusQueued && job.Status != model.JobStatusRunning {
+		return nil, nil
+	}
+
+	return &job, nil
+}
+
+// retryRequestStatuses resets the request statuses that haven't been executed, and
+// starts a job to run the request on them again.
+func (r *Resolver) retryRequestStatuses(
+	ctx context.Context,
+	request *model.Request,
+	statuses []model.RequestStatus,
+) (*model.Request, error) {
+	siloIDs := []string{}
+	seenSilos := map[string]bool{}
+	statusIDs := []string{}
+
+	for _, s := range statuses {
+		if s.Status == model.RequestStatusTypeExecuted {
+			continue
+		}
+
+		statusIDs = append(statusIDs, s.ID)
+
+		if !seenSilos[s.DataSource.SiloDefinitionID] {
+			seenSilos[s.DataSource.SiloDefinitionID] = true
+			siloIDs = append(siloIDs, s.DataSource.SiloDefinitionID)
+		}
+	}
+
+	if len(statusIDs) == 0 {
+		return nil, gqlerror.Errorf("There is nothing to retry.")
+	}
+
+	// The request is locked until the job is started, so that concurrent
+	// retries can't both start a job.
+	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(
+			"id = ?", request.ID,
+		).First(request).Error; err != nil {
+			return handleError(err, "Error finding request.")
+		}
+
+		if request.JobID == nil {
+			return gqlerror.Errorf("The request hasn't been executed yet.")
+		}
+
+		job, err := r.runningRequestJob(tx, request)
+		if err != nil {
+			return handleError(err, "Error finding request job.")
+		}
+
+		if job != nil {
+			return gqlerror.Errorf("The request is still running.")
+		}
+
+		if err := tx.Model(&model.RequestStatus{}).Where(
+			"id IN ?", statusIDs,
+		).Updates(map[string]interface{}{
+			"status":                model.RequestStatusTypeCreated,
+			"residual_record_count": nil,
+			"verified_at":           nil,
+			"verification_error":    nil,
+		}).Error; err != nil {
+			return handleError(err, "Error updating request statuses.")
+		}
+
+		// The request's package doesn't have the results of the retried data
+		// sources, so it's generated again once they're done.
+		if err := tx.Model(request).Update("downloadable_file_id", nil).Error; err != nil {
+			return handleError(err, "Error updating request.")
+		}
+
+		request.DownloadableFileID = nil
+		request.DownloadableFile = nil
+
+		if err := r.startRequestJob(ctx, tx, request, siloIDs, statusIDs); err != nil {
+			return handleError(err, "Error running job.")
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// finishedRequestStatuses are the statuses of data sources that the request
+// is done running on.
+var finishedRequestStatuses = []model.RequestStatusType{
+	model.RequestStatusTypeExecuted,
+	model.RequestStatusTypeFailed,
+	model.RequestStatusTypeVerificationFailed,
+	model.RequestStatusTypeCancelled,
+}
+
+// jobProgress returns the request job's progress on each silo, with the
+// number of the silo's data sources that the request is done running on.
+func (r *Resolver) jobProgress(job *model.Job) ([]*model.JobProgress, error) {
+	progress := []*model.JobProgress{}
+	if err := r.Conf.DB.Where("job_id = ?", job.ID).Order("created_at").Find(&progress).Error; err != nil {
+		return nil, err
+	}
+
+	if len(progress) == 0 {
+		return progress, nil
+	}
+
+	type siloCount struct {
+		SiloDefinitionID string
+		Total            int
+		Completed        int
+	}
+
+	counts := []siloCount{}
+	if err := r.Conf.DB.Model(&model.RequestStatus{}).Select(
+		"data_sources.silo_definition_id, COUNT(*) AS total, "+
+			"SUM(CASE WHEN request_statuses.status IN ? THEN 1 ELSE 0 END) AS completed",
+		finishedRequestStatuses,
+	).Joins(
+		"JOIN data_sources ON data_sources.id = request_statuses.data_source_id",
+	).Where(
+		"request_statuses.request_id = ?", job.ResourceID,
+	).Group("data_sources.silo_definition_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	countMap := map[string]siloCount{}
+	for _, c := range counts {
+		countMap[c.SiloDefinitionID] = c
+	}
+
+	for _, p := range progress {
+		p.DataSourcesTotal = countMap[p.SiloDefinitionID].Total
+		p.DataSourcesCompleted = countMap[p.SiloDefinitionID].Completed
+	}
+
+	return progress, nil
+}
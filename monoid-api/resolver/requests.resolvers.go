@@ -13,14 +13,12 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/monoid-privacy/monoid/dataloader"
+	"github.com/monoid-privacy/monoid/download"
 	"github.com/monoid-privacy/monoid/generated"
 	"github.com/monoid-privacy/monoid/model"
-	"github.com/monoid-privacy/monoid/requests"
-	"github.com/monoid-privacy/monoid/workflow"
 	"github.com/monoid-privacy/monoid/workflow/requestworkflow"
 	"github.com/rs/zerolog/log"
 	"github.com/vektah/gqlparser/v2/gqlerror"
-	"go.temporal.io/sdk/client"
 	"gorm.io/gorm"
 )
 
@@ -29,6 +27,16 @@ func (r *dataSourceResolver) RequestStatuses(ctx context.Context, obj *model.Dat
 	return findChildObjects[model.RequestStatus](r.Conf.DB, obj.ID, "data_source_id")
 }
 
+// AccessLogs is the resolver for the accessLogs field.
+func (r *downloadGrantResolver) AccessLogs(ctx context.Context, obj *model.DownloadGrant) ([]*model.DownloadAccessLog, error) {
+	logs := []*model.DownloadAccessLog{}
+	if err := r.Conf.DB.Where("download_grant_id = ?", obj.ID).Order("created_at DESC").Find(&logs).Error; err != nil {
+		return nil, handleError(err, "Error finding access logs.")
+	}
+
+	return logs, nil
+}
+
 // CreateUserPrimaryKey is the resolver for the createUserPrimaryKey field.
 func (r *mutationResolver) CreateUserPrimaryKey(ctx context.Context, input model.CreateUserPrimaryKeyInput) (*model.UserPrimaryKey, error) {
 	userPrimaryKey := model.UserPrimaryKey{
@@ -103,6 +111,11 @@ func (r *mutationResolver) UpdateRequestStatus(ctx context.Context, input model.
 		}
 
 		if _, err := io.Copy(wr, input.ResultData.File); err != nil {
+			wr.Close()
+			return nil, handleError(err, "Error uploading file.")
+		}
+
+		if err := wr.Close(); err != nil {
 			return nil, handleError(err, "Error uploading file.")
 		}
 
@@ -140,6 +153,10 @@ func (r *mutationResolver) UpdateRequestStatus(ctx context.Context, input model.
 		return nil, handleError(err, "Error updating status")
 	}
 
+	if _, err := model.RecomputeRequestStatus(r.Conf.DB, status.RequestID); err != nil {
+		log.Err(err).Msg("Error updating request status.")
+	}
+
 	if status.Request.Job != nil {
 		if err := r.Conf.TemporalClient.SignalWorkflow(
 			ctx,
@@ -161,9 +178,26 @@ func (r *mutationResolver) UpdateRequestStatus(ctx context.Context, input model.
 // CreateUserDataRequest is the resolver for the createUserDataRequest field.
 func (r *mutationResolver) CreateUserDataRequest(ctx context.Context, input *model.UserDataRequestInput) (*model.Request, error) {
 	request := model.Request{
-		ID:          uuid.NewString(),
-		WorkspaceID: input.WorkspaceID,
-		Type:        input.Type,
+		ID:           uuid.NewString(),
+		WorkspaceID:  input.WorkspaceID,
+		Type:         input.Type,
+		ExportFormat: input.ExportFormat,
+	}
+
+	if input.VerifyDeletion != nil {
+		request.VerifyDeletion = *input.VerifyDeletion
+	} else {
+		workspace := model.Workspace{}
+		if err := r.Conf.DB.Where("id = ?", input.WorkspaceID).First(&workspace).Error; err != nil {
+			return nil, handleError(err, "Error finding workspace.")
+		}
+
+		settings := model.WorkspaceSettings{}
+		if err := json.Unmarshal(workspace.Settings, &settings); err != nil {
+			return nil, handleError(err, "Error getting workspace settings.")
+		}
+
+		request.VerifyDeletion = settings.VerifyDeletions
 	}
 
 	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
@@ -237,141 +271,142 @@ func (r *mutationResolver) CreateUserDataRequest(ctx context.Context, input *mod
 	return &request, nil
 }
 
-// ExecuteUserDataRequest is the resolver for the executeUserDataRequest field.
-func (r *mutationResolver) ExecuteUserDataRequest(ctx context.Context, requestID string) (*model.Request, error) {
+// UpdateRequestExportFormat is the resolver for the updateRequestExportFormat field.
+func (r *mutationResolver) UpdateRequestExportFormat(ctx context.Context, requestID string, exportFormat *model.ExportFormat) (*model.Request, error) {
 	request := model.Request{}
 	if err := r.Conf.DB.Where("id = ?", requestID).First(&request).Error; err != nil {
-		return nil, handleError(err, "Error finding request")
+		return nil, handleError(err, "Error finding request.")
 	}
 
-	job := model.Job{
-		ID:          uuid.NewString(),
-		WorkspaceID: request.WorkspaceID,
-		JobType:     model.JobTypeExecuteRequest,
-		Status:      model.JobStatusQueued,
-		ResourceID:  requestID,
+	if exportFormat != nil && !exportFormat.IsValid() {
+		return nil, gqlerror.Errorf("Invalid export format.")
 	}
 
-	options := client.StartWorkflowOptions{
-		ID:        job.ID,
-		TaskQueue: workflow.DockerRunnerQueue,
+	if err := r.Conf.DB.Model(&request).Update("export_format", exportFormat).Error; err != nil {
+		return nil, handleError(err, "Error updating export format.")
 	}
 
-	sf := requestworkflow.RequestWorkflow{
-		Conf: r.Conf,
-	}
+	request.ExportFormat = exportFormat
 
-	wf, err := r.Conf.TemporalClient.ExecuteWorkflow(ctx, options, sf.ExecuteRequestWorkflow, requestworkflow.ExecuteRequestArgs{
-		RequestID:   requestID,
-		WorkspaceID: request.WorkspaceID,
-		JobID:       job.ID,
-	})
+	return &request, nil
+}
 
-	if err != nil {
-		return nil, handleError(err, "Error executing job")
+// ExecuteUserDataRequest is the resolver for the executeUserDataRequest field.
+func (r *mutationResolver) ExecuteUserDataRequest(ctx context.Context, requestID string) (*model.Request, error) {
+	request := model.Request{}
+	if err := r.Conf.DB.Where("id = ?", requestID).First(&request).Error; err != nil {
+		return nil, handleError(err, "Error finding request")
 	}
 
-	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&job).Error; err != nil {
-			return err
-		}
-
-		if err != nil {
-			return err
-		}
+	if err := r.startRequestJob(ctx, r.Conf.DB, &request, nil, nil); err != nil {
+		return nil, handleError(err, "Error executing job.")
+	}
 
-		if err := tx.Model(&job).Update("temporal_workflow_id", wf.GetID()).Error; err != nil {
-			log.Err(err).Msg("Error uploading workflow ID")
-		}
+	return &request, nil
+}
 
-		if err := tx.Model(&request).Update("job_id", &job.ID).Error; err != nil {
-			log.Err(err).Msg("Error updating job ID")
-		}
+// RetryRequestStatus is the resolver for the retryRequestStatus field.
+func (r *mutationResolver) RetryRequestStatus(ctx context.Context, requestStatusID string) (*model.Request, error) {
+	status := model.RequestStatus{}
+	if err := r.Conf.DB.Where("id = ?", requestStatusID).Preload("DataSource").First(&status).Error; err != nil {
+		return nil, handleError(err, "Error finding request status.")
+	}
 
-		return nil
+	if status.Status == model.RequestStatusTypeExecuted {
+		return nil, gqlerror.Errorf("The request has already been executed on this data source.")
+	}
 
-	}); err != nil {
-		return nil, handleError(err, "Error running job.")
+	request := model.Request{}
+	if err := r.Conf.DB.Where("id = ?", status.RequestID).First(&request).Error; err != nil {
+		return nil, handleError(err, "Error finding request.")
 	}
 
-	return &request, nil
+	return r.retryRequestStatuses(ctx, &request, []model.RequestStatus{status})
 }
 
-// LinkPropertyToPrimaryKey is the resolver for the linkPropertyToPrimaryKey field.
-func (r *mutationResolver) LinkPropertyToPrimaryKey(ctx context.Context, propertyID string, userPrimaryKeyID *string) (*model.Property, error) {
-	var property model.Property
-	if err := r.Conf.DB.Where("id = ?", propertyID).First(&property).Error; err != nil {
-		return nil, handleError(err, "Error linking property to primary key.")
+// RetrySiloRequest is the resolver for the retrySiloRequest field.
+func (r *mutationResolver) RetrySiloRequest(ctx context.Context, requestID string, siloDefinitionID string) (*model.Request, error) {
+	request := model.Request{}
+	if err := r.Conf.DB.Where("id = ?", requestID).First(&request).Error; err != nil {
+		return nil, handleError(err, "Error finding request.")
 	}
 
-	if err := r.Conf.DB.Model(&property).Update("user_primary_key_id", userPrimaryKeyID).Error; err != nil {
-		return nil, handleError(err, "Error linking property to primary key.")
+	statuses := []model.RequestStatus{}
+	if err := r.Conf.DB.Preload("DataSource").Joins(
+		"JOIN data_sources ON data_sources.id = request_statuses.data_source_id",
+	).Where("request_statuses.request_id = ?", requestID).Where(
+		"data_sources.silo_definition_id = ?", siloDefinitionID,
+	).Find(&statuses).Error; err != nil {
+		return nil, handleError(err, "Error finding request statuses.")
 	}
 
-	return &property, nil
+	return r.retryRequestStatuses(ctx, &request, statuses)
 }
 
-// GenerateRequestDownloadLink is the resolver for the generateRequestDownloadLink field.
-func (r *mutationResolver) GenerateRequestDownloadLink(ctx context.Context, requestID string) (*model.DownloadLink, error) {
+// CancelSiloRequest is the resolver for the cancelSiloRequest field.
+func (r *mutationResolver) CancelSiloRequest(ctx context.Context, requestID string, siloDefinitionID string) (*model.Request, error) {
 	request := model.Request{}
-
-	if err := r.Conf.DB.Where("id = ?", requestID).Preload("Job").First(&request).Error; err != nil {
-		return nil, handleError(err, "Could not find the request")
+	if err := r.Conf.DB.Where("id = ?", requestID).First(&request).Error; err != nil {
+		return nil, handleError(err, "Error finding request.")
 	}
 
-	status, err := request.Status()
+	job, err := r.runningRequestJob(r.Conf.DB, &request)
 	if err != nil {
-		return nil, err
+		return nil, handleError(err, "Error finding request job.")
 	}
 
-	if status == model.FullRequestStatusInProgress ||
-		status == model.FullRequestStatusCreated ||
-		status == model.FullRequestStatusFailed {
+	if job == nil {
+		return nil, gqlerror.Errorf("The request isn't running.")
+	}
+
+	if job.TemporalWorkflowID == "" {
 		return nil, handleError(
-			fmt.Errorf("request must be completed to get file results"),
-			"The request must be completed in order to get file URLs.",
+			fmt.Errorf("workflow id is nil"),
+			"Job is still initializing, try again in a few seconds.",
 		)
 	}
 
-	if request.DownloadableFileID != nil {
-		return &model.DownloadLink{
-			URL: "/downloads/" + *request.DownloadableFileID,
-		}, nil
+	if err := r.Conf.TemporalClient.SignalWorkflow(
+		ctx,
+		job.TemporalWorkflowID,
+		"",
+		requestworkflow.CancelSiloSignalChannel,
+		requestworkflow.CancelSiloSignal{SiloDefinitionID: siloDefinitionID},
+	); err != nil {
+		return nil, handleError(err, "Error cancelling silo request.")
 	}
 
-	res, err := requests.GenerateRequestTar(ctx, r.Conf, request.ID)
-	if err != nil {
-		return nil, handleError(err, "Error generating file.")
-	}
+	return &request, nil
+}
 
-	dlfile := model.DownloadableFile{
-		ID:          uuid.NewString(),
-		StoragePath: res,
+// LinkPropertyToPrimaryKey is the resolver for the linkPropertyToPrimaryKey field.
+func (r *mutationResolver) LinkPropertyToPrimaryKey(ctx context.Context, propertyID string, userPrimaryKeyID *string) (*model.Property, error) {
+	var property model.Property
+	if err := r.Conf.DB.Where("id = ?", propertyID).First(&property).Error; err != nil {
+		return nil, handleError(err, "Error linking property to primary key.")
 	}
 
-	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&dlfile).Error; err != nil {
-			return err
-		}
+	if err := r.Conf.DB.Model(&property).Update("user_primary_key_id", userPrimaryKeyID).Error; err != nil {
+		return nil, handleError(err, "Error linking property to primary key.")
+	}
 
-		if err := tx.Model(&request).Update("downloadable_file_id", dlfile.ID).Error; err != nil {
-			return err
-		}
+	return &property, nil
+}
 
-		return nil
-	}); err != nil {
-		return nil, handleError(err, "Error creating file")
+// GenerateRequestDownloadLink is the resolver for the generateRequestDownloadLink field.
+func (r *mutationResolver) GenerateRequestDownloadLink(ctx context.Context, requestID string, options *model.DownloadLinkOptions) (*model.DownloadLink, error) {
+	fileID, err := r.requestDownloadableFile(ctx, requestID)
+	if err != nil {
+		return nil, err
 	}
 
-	return &model.DownloadLink{
-		URL: "/downloads/" + *request.DownloadableFileID,
-	}, nil
+	return r.createDownloadLink(fileID, &requestID, options, false)
 }
 
 // GenerateQueryResultDownloadLink is the resolver for the generateQueryResultDownloadLink field.
-func (r *mutationResolver) GenerateQueryResultDownloadLink(ctx context.Context, queryResultID string) (*model.DownloadLink, error) {
+func (r *mutationResolver) GenerateQueryResultDownloadLink(ctx context.Context, queryResultID string, options *model.DownloadLinkOptions) (*model.DownloadLink, error) {
 	qr := model.QueryResult{}
-	if err := r.Conf.DB.Where("id = ?", queryResultID).First(&qr).Error; err != nil {
+	if err := r.Conf.DB.Where("id = ?", queryResultID).Preload("RequestStatus").First(&qr).Error; err != nil {
 		return nil, handleError(err, "Could not find result")
 	}
 
@@ -385,9 +420,11 @@ func (r *mutationResolver) GenerateQueryResultDownloadLink(ctx context.Context,
 			return nil, handleError(err, "Error reading file")
 		}
 
+		fileName := "result.tar.gz"
 		dlfile := model.DownloadableFile{
 			ID:          uuid.NewString(),
 			StoragePath: fileData.FilePath,
+			FileName:    &fileName,
 		}
 
 		if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
@@ -403,11 +440,31 @@ func (r *mutationResolver) GenerateQueryResultDownloadLink(ctx context.Context,
 		}); err != nil {
 			return nil, handleError(err, "Error creating file")
 		}
+
+		qr.DownloadableFileID = &dlfile.ID
 	}
 
-	return &model.DownloadLink{
-		URL: "/downloads/" + *qr.DownloadableFileID,
-	}, nil
+	return r.createDownloadLink(*qr.DownloadableFileID, &qr.RequestStatus.RequestID, options, false)
+}
+
+// GeneratePublicRequestDownloadLink is the resolver for the generatePublicRequestDownloadLink field.
+func (r *mutationResolver) GeneratePublicRequestDownloadLink(ctx context.Context, requestID string, options *model.DownloadLinkOptions) (*model.DownloadLink, error) {
+	fileID, err := r.requestDownloadableFile(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.createDownloadLink(fileID, &requestID, options, true)
+}
+
+// RevokeDownloadLink is the resolver for the revokeDownloadLink field.
+func (r *mutationResolver) RevokeDownloadLink(ctx context.Context, id string) (*model.DownloadGrant, error) {
+	grant, err := download.RevokeGrant(r.Conf.DB, id)
+	if err != nil {
+		return nil, handleError(err, "Error revoking download link.")
+	}
+
+	return grant, nil
 }
 
 // UserPrimaryKey is the resolver for the userPrimaryKey field.
@@ -464,15 +521,70 @@ func (r *queryResultResolver) RequestStatus(ctx context.Context, obj *model.Quer
 }
 
 // Records is the resolver for the records field.
-func (r *queryResultResolver) Records(ctx context.Context, obj *model.QueryResult) (*string, error) {
-	if obj.Records == nil || obj.ResultType != model.ResultTypeRecordsJSON {
+func (r *queryResultResolver) Records(ctx context.Context, obj *model.QueryResult, offset *int, limit *int) (*string, error) {
+	if obj.ResultType != model.ResultTypeRecordsJSON {
 		return nil, nil
 	}
 
-	s := string(*obj.Records)
+	doffset := 0
+	if offset != nil {
+		doffset = *offset
+	}
+
+	if doffset < 0 {
+		return nil, gqlerror.Errorf("Offset must be at least 0.")
+	}
+
+	dlimit := defaultRecordsLimit
+	if limit != nil {
+		dlimit = *limit
+
+		if dlimit < 0 || dlimit > maxRecordsLimit {
+			return nil, gqlerror.Errorf("Limit must be between 0 and %d.", maxRecordsLimit)
+		}
+	}
+
+	records, err := r.queryResultRecords(ctx, obj, doffset, dlimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if records == nil {
+		return nil, nil
+	}
+
+	res, err := json.Marshal(records)
+	if err != nil {
+		return nil, handleError(err, "Error reading records.")
+	}
+
+	s := string(res)
 	return &s, nil
 }
 
+// NumRecords is the resolver for the numRecords field.
+func (r *queryResultResolver) NumRecords(ctx context.Context, obj *model.QueryResult) (*int, error) {
+	if obj.ResultType != model.ResultTypeRecordsJSON {
+		return nil, nil
+	}
+
+	if obj.RecordCount != nil {
+		return obj.RecordCount, nil
+	}
+
+	if obj.Records == nil {
+		return nil, nil
+	}
+
+	records := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(*obj.Records), &records); err != nil {
+		return nil, handleError(err, "Error reading records.")
+	}
+
+	count := len(records)
+	return &count, nil
+}
+
 // PrimaryKeyValues is the resolver for the primaryKeyValues field.
 func (r *requestResolver) PrimaryKeyValues(ctx context.Context, obj *model.Request) ([]*model.PrimaryKeyValue, error) {
 	return findChildObjects[model.PrimaryKeyValue](r.Conf.DB, obj.ID, "request_id")
@@ -554,6 +666,25 @@ func (r *requestResolver) Status(ctx context.Context, obj *model.Request) (model
 	return status, nil
 }
 
+// DownloadGrants is the resolver for the downloadGrants field.
+func (r *requestResolver) DownloadGrants(ctx context.Context, obj *model.Request) ([]*model.DownloadGrant, error) {
+	grants := []*model.DownloadGrant{}
+	if err := r.Conf.DB.Where("request_id = ?", obj.ID).Order("created_at DESC").Find(&grants).Error; err != nil {
+		return nil, handleError(err, "Error finding download links.")
+	}
+
+	return grants, nil
+}
+
+// Job is the resolver for the job field.
+func (r *requestResolver) Job(ctx context.Context, obj *model.Request) (*model.Job, error) {
+	if obj.JobID == nil {
+		return nil, nil
+	}
+
+	return dataloader.Job(ctx, *obj.JobID)
+}
+
 // Request is the resolver for the request field.
 func (r *requestStatusResolver) Request(ctx context.Context, obj *model.RequestStatus) (*model.Request, error) {
 	return findObjectByID[model.Request](obj.RequestID, r.Conf.DB, "Error finding request.")
@@ -609,6 +740,9 @@ func (r *workspaceResolver) UserPrimaryKeys(ctx context.Context, obj *model.Work
 	return findChildObjects[model.UserPrimaryKey](r.Conf.DB, obj.ID, "workspace_id")
 }
 
+// DownloadGrant returns generated.DownloadGrantResolver implementation.
+func (r *Resolver) DownloadGrant() generated.DownloadGrantResolver { return &downloadGrantResolver{r} }
+
 // PrimaryKeyValue returns generated.PrimaryKeyValueResolver implementation.
 func (r *Resolver) PrimaryKeyValue() generated.PrimaryKeyValueResolver {
 	return &primaryKeyValueResolver{r}
@@ -623,6 +757,7 @@ func (r *Resolver) Request() generated.RequestResolver { return &requestResolver
 // RequestStatus returns generated.RequestStatusResolver implementation.
 func (r *Resolver) RequestStatus() generated.RequestStatusResolver { return &requestStatusResolver{r} }
 
+type downloadGrantResolver struct{ *Resolver }
 type primaryKeyValueResolver struct{ *Resolver }
 type queryResultResolver struct{ *Resolver }
 type requestResolver struct{ *Resolver }
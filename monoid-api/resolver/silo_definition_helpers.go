@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
@@ -14,7 +15,26 @@ type validateResult struct {
 	message string
 }
 
+// validateOptions are the checks that are run when validating a silo.
+type validateOptions struct {
+	// checkSchema checks the config against the version's schema.
+	checkSchema bool
+	// schemaOnly skips the connector's validation.
+	schemaOnly bool
+}
+
 func (r *Resolver) validateSiloDef(ctx context.Context, workflowID string, siloDefinition model.SiloDefinition) (*validateResult, error) {
+	return r.validateSiloDefWithOptions(ctx, workflowID, siloDefinition, validateOptions{})
+}
+
+// validateSiloDefWithOptions validates the silo's config on a worker, which
+// resolves any secrets the config references.
+func (r *Resolver) validateSiloDefWithOptions(
+	ctx context.Context,
+	workflowID string,
+	siloDefinition model.SiloDefinition,
+	opts validateOptions,
+) (*validateResult, error) {
 	options := client.StartWorkflowOptions{
 		ID:        workflowID,
 		TaskQueue: workflow.DockerRunnerQueue,
@@ -31,8 +51,11 @@ func (r *Resolver) validateSiloDef(ctx context.Context, workflowID string, siloD
 	}
 
 	we, err := r.Conf.TemporalClient.ExecuteWorkflow(ctx, options, sf.ValidateDSWorkflow, workflow.ValidateDSArgs{
-		SiloSpecID: siloDefinition.SiloSpecificationID,
-		Config:     confSecret,
+		SiloSpecID:        siloDefinition.SiloSpecificationID,
+		SiloSpecVersionID: siloDefinition.SiloSpecificationVersionID,
+		Config:            confSecret,
+		CheckSchema:       opts.checkSchema,
+		SchemaOnly:        opts.schemaOnly,
 	})
 	if err != nil {
 		return nil, err
@@ -63,3 +86,114 @@ func (r *Resolver) validateSiloDef(ctx context.Context, workflowID string, siloD
 		message: "",
 	}, nil
 }
+
+// upgradeSiloDef moves the silo to the version of its specification, after
+// checking that its config is valid for the version's schema and that the
+// version's connector validates it. The silo's SiloSpecification must be
+// preloaded.
+func (r *Resolver) upgradeSiloDef(
+	ctx context.Context,
+	siloDefinition *model.SiloDefinition,
+	version *model.SiloSpecificationVersion,
+) (*validateResult, error) {
+	if siloDefinition.VersionPinned {
+		return &validateResult{message: "The silo is pinned to its version."}, nil
+	}
+
+	return r.setSiloDefVersion(ctx, siloDefinition, version, "upgrade", true)
+}
+
+// rollbackSiloDef moves the silo back to the version it was on before its last
+// upgrade. Rolling back is allowed on pinned silos, and doesn't run the
+// connector's validation, since the silo has already run on the version. The
+// silo's SiloSpecification and PreviousSiloSpecificationVersion must be
+// preloaded.
+func (r *Resolver) rollbackSiloDef(
+	ctx context.Context,
+	siloDefinition *model.SiloDefinition,
+) (*validateResult, error) {
+	if siloDefinition.PreviousSiloSpecificationVersion == nil {
+		return &validateResult{message: "The silo doesn't have a version to roll back to."}, nil
+	}
+
+	return r.setSiloDefVersion(ctx, siloDefinition, siloDefinition.PreviousSiloSpecificationVersion, "rollback", false)
+}
+
+// setSiloDefVersion moves the silo to the version, after checking that its
+// config is valid for the version's schema, and, if validate is set, that the
+// version's connector validates it. action is the analytics action that's
+// tracked.
+func (r *Resolver) setSiloDefVersion(
+	ctx context.Context,
+	siloDefinition *model.SiloDefinition,
+	version *model.SiloSpecificationVersion,
+	action string,
+	validate bool,
+) (*validateResult, error) {
+	if version.SiloSpecificationID != siloDefinition.SiloSpecificationID {
+		return &validateResult{message: "The version isn't for the silo's specification."}, nil
+	}
+
+	currentID := siloDefinition.SiloSpecificationVersionID
+	if currentID == nil {
+		current, err := model.RecordSiloSpecificationVersion(r.Conf.DB, &siloDefinition.SiloSpecification)
+		if err != nil {
+			return nil, err
+		}
+
+		currentID = &current.ID
+	}
+
+	if *currentID == version.ID {
+		return &validateResult{
+			message: fmt.Sprintf("The silo is already on version %d.", version.Version),
+		}, nil
+	}
+
+	candidate := *siloDefinition
+	candidate.SiloSpecificationVersionID = &version.ID
+
+	// The config is checked against the version's schema on a worker, since
+	// its secrets have to be resolved first.
+	runConnector := validate && !siloDefinition.SiloSpecification.Manual
+	if runConnector || version.Schema != nil {
+		res, err := r.validateSiloDefWithOptions(
+			ctx,
+			fmt.Sprintf(
+				"ws-%s/silo-%s-%s-%s-v%d",
+				siloDefinition.WorkspaceID,
+				version.DockerImage,
+				siloDefinition.ID,
+				action,
+				version.Version,
+			),
+			candidate,
+			validateOptions{
+				checkSchema: true,
+				schemaOnly:  !runConnector,
+			},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !res.success {
+			return &validateResult{message: fmt.Sprintf(
+				"Version %d can't be used with the silo's config: %s", version.Version, res.message,
+			)}, nil
+		}
+	}
+
+	if err := siloDefinition.SetVersion(r.Conf.DB, version.ID, *currentID); err != nil {
+		return nil, err
+	}
+
+	r.Conf.AnalyticsIngestor.Track("siloAction", nil, map[string]interface{}{
+		"action":      action,
+		"siloId":      siloDefinition.ID,
+		"workspaceId": siloDefinition.WorkspaceID,
+	})
+
+	return &validateResult{success: true}, nil
+}
@@ -13,8 +13,11 @@ import (
 	"github.com/monoid-privacy/monoid/generated"
 	"github.com/monoid-privacy/monoid/jsonschema"
 	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/workflow"
 	"github.com/rs/zerolog/log"
 	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -28,6 +31,20 @@ func (r *mutationResolver) CreateSiloDefinition(ctx context.Context, input *mode
 		SiloSpecificationID: input.SiloSpecificationID,
 	}
 
+	policy, err := model.NewExecutionPolicy(input.ExecutionPolicy)
+	if err != nil {
+		return nil, gqlerror.Errorf("Invalid execution policy: %s.", err.Error())
+	}
+
+	siloDefinition.ExecutionPolicy = policy
+
+	limits, err := model.NewExecutionLimits(input.ExecutionLimits)
+	if err != nil {
+		return nil, gqlerror.Errorf("Invalid execution limits: %s.", err.Error())
+	}
+
+	siloDefinition.ExecutionLimits = limits
+
 	if input.SiloData != nil {
 		siloDefinition.Config = model.SecretString(*input.SiloData)
 	}
@@ -38,9 +55,22 @@ func (r *mutationResolver) CreateSiloDefinition(ctx context.Context, input *mode
 	}
 
 	siloDefinition.SiloSpecification = siloSpec
+
+	// The silo is configured against the specification's current version,
+	// and keeps running it until it's upgraded.
+	if !siloSpec.Manual {
+		version, err := model.RecordSiloSpecificationVersion(r.Conf.DB, &siloSpec)
+		if err != nil {
+			return nil, handleError(err, "Error finding silo specification version.")
+		}
+
+		siloDefinition.SiloSpecificationVersionID = &version.ID
+	}
+
 	analyticsData := map[string]interface{}{
-		"action": "create",
-		"siloId": siloDefinition.ID,
+		"action":      "create",
+		"siloId":      siloDefinition.ID,
+		"workspaceId": siloDefinition.WorkspaceID,
 	}
 
 	if !siloSpec.Manual {
@@ -78,7 +108,9 @@ func (r *mutationResolver) UpdateSiloDefinition(ctx context.Context, input *mode
 	if err := r.Conf.DB.Where(
 		"id = ?",
 		input.ID,
-	).Preload("SiloSpecification").First(&siloDefinition).Error; err != nil {
+	).Preload("SiloSpecification").Preload(
+		"SiloSpecificationVersion",
+	).First(&siloDefinition).Error; err != nil {
 		return nil, handleError(err, "Error finding silo definition.")
 	}
 
@@ -88,6 +120,24 @@ func (r *mutationResolver) UpdateSiloDefinition(ctx context.Context, input *mode
 
 	siloDefinition.Description = input.Description
 
+	if input.ExecutionPolicy != nil {
+		policy, err := model.NewExecutionPolicy(input.ExecutionPolicy)
+		if err != nil {
+			return nil, gqlerror.Errorf("Invalid execution policy: %s.", err.Error())
+		}
+
+		siloDefinition.ExecutionPolicy = policy
+	}
+
+	if input.ExecutionLimits != nil {
+		limits, err := model.NewExecutionLimits(input.ExecutionLimits)
+		if err != nil {
+			return nil, gqlerror.Errorf("Invalid execution limits: %s.", err.Error())
+		}
+
+		siloDefinition.ExecutionLimits = limits
+	}
+
 	if input.SiloData != nil {
 		data := map[string]interface{}{}
 		if err := json.Unmarshal([]byte(*input.SiloData), &data); err != nil {
@@ -99,7 +149,7 @@ func (r *mutationResolver) UpdateSiloDefinition(ctx context.Context, input *mode
 			log.Err(err).Msg("Error unmarshalling old config.")
 		}
 
-		schemaStr := siloDefinition.SiloSpecification.Schema
+		schemaStr := siloDefinition.EffectiveSpecification().Schema
 		if schemaStr != nil {
 			schema := jsonschema.Schema{}
 			if err := json.Unmarshal([]byte(*schemaStr), &schema); err != nil {
@@ -120,8 +170,9 @@ func (r *mutationResolver) UpdateSiloDefinition(ctx context.Context, input *mode
 	}
 
 	analyticsData := map[string]interface{}{
-		"action": "update",
-		"siloId": siloDefinition.ID,
+		"action":      "update",
+		"siloId":      siloDefinition.ID,
+		"workspaceId": siloDefinition.WorkspaceID,
 	}
 
 	// Validate the definition before saving it
@@ -168,8 +219,9 @@ func (r *mutationResolver) DeleteSiloDefinition(ctx context.Context, id string)
 	}
 
 	r.Conf.AnalyticsIngestor.Track("siloAction", nil, map[string]interface{}{
-		"action": "delete",
-		"siloId": id,
+		"action":      "delete",
+		"siloId":      id,
+		"workspaceId": siloDefinition.WorkspaceID,
 	})
 
 	// TODO: Check that deletes properly cascade to datasources (12m)
@@ -177,6 +229,140 @@ func (r *mutationResolver) DeleteSiloDefinition(ctx context.Context, id string)
 	return id, nil
 }
 
+// UpgradeSiloDefinition is the resolver for the upgradeSiloDefinition field.
+func (r *mutationResolver) UpgradeSiloDefinition(ctx context.Context, input model.UpgradeSiloDefinitionInput) (*model.SiloDefinition, error) {
+	siloDefinition := model.SiloDefinition{}
+	if err := r.Conf.DB.Where(
+		"id = ?",
+		input.ID,
+	).Preload("SiloSpecification").First(&siloDefinition).Error; err != nil {
+		return nil, handleError(err, "Error finding silo definition.")
+	}
+
+	version := &model.SiloSpecificationVersion{}
+	if input.SiloSpecificationVersionID != nil {
+		if err := r.Conf.DB.Where(
+			"id = ?",
+			*input.SiloSpecificationVersionID,
+		).First(version).Error; err != nil {
+			return nil, handleError(err, "Error finding silo specification version.")
+		}
+	} else {
+		v, err := model.RecordSiloSpecificationVersion(r.Conf.DB, &siloDefinition.SiloSpecification)
+		if err != nil {
+			return nil, handleError(err, "Error finding silo specification version.")
+		}
+
+		version = v
+	}
+
+	res, err := r.upgradeSiloDef(ctx, &siloDefinition, version)
+	if err != nil {
+		return nil, handleError(err, "Error upgrading silo definition.")
+	}
+
+	if !res.success {
+		return nil, gqlerror.Errorf(res.message)
+	}
+
+	return &siloDefinition, nil
+}
+
+// RollbackSiloDefinition is the resolver for the rollbackSiloDefinition field.
+func (r *mutationResolver) RollbackSiloDefinition(ctx context.Context, id string) (*model.SiloDefinition, error) {
+	siloDefinition := model.SiloDefinition{}
+	if err := r.Conf.DB.Where(
+		"id = ?",
+		id,
+	).Preload("SiloSpecification").Preload(
+		"PreviousSiloSpecificationVersion",
+	).First(&siloDefinition).Error; err != nil {
+		return nil, handleError(err, "Error finding silo definition.")
+	}
+
+	res, err := r.rollbackSiloDef(ctx, &siloDefinition)
+	if err != nil {
+		return nil, handleError(err, "Error rolling back silo definition.")
+	}
+
+	if !res.success {
+		return nil, gqlerror.Errorf(res.message)
+	}
+
+	return &siloDefinition, nil
+}
+
+// PinSiloDefinitionVersion is the resolver for the pinSiloDefinitionVersion field.
+func (r *mutationResolver) PinSiloDefinitionVersion(ctx context.Context, id string, pinned bool) (*model.SiloDefinition, error) {
+	siloDefinition := model.SiloDefinition{}
+	if err := r.Conf.DB.Where("id = ?", id).First(&siloDefinition).Error; err != nil {
+		return nil, handleError(err, "Error finding silo definition.")
+	}
+
+	siloDefinition.VersionPinned = pinned
+	if err := r.Conf.DB.Model(&siloDefinition).Update("version_pinned", pinned).Error; err != nil {
+		return nil, handleError(err, "Error updating silo definition.")
+	}
+
+	return &siloDefinition, nil
+}
+
+// UpgradeSiloDefinitions is the resolver for the upgradeSiloDefinitions field.
+func (r *mutationResolver) UpgradeSiloDefinitions(ctx context.Context, workspaceID string, siloSpecificationID string) (*model.Job, error) {
+	siloSpec := model.SiloSpecification{}
+	if err := r.Conf.DB.Where("id = ?", siloSpecificationID).First(&siloSpec).Error; err != nil {
+		return nil, handleError(err, "Error finding silo specification.")
+	}
+
+	job := model.Job{
+		ID:          uuid.NewString(),
+		WorkspaceID: workspaceID,
+		JobType:     model.JobTypeUpgradeSilos,
+		Status:      model.JobStatusQueued,
+		ResourceID:  siloSpecificationID,
+	}
+
+	if err := r.Conf.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+
+		options := client.StartWorkflowOptions{
+			ID:        job.ID,
+			TaskQueue: workflow.DockerRunnerQueue,
+		}
+
+		sf := workflow.Workflow{
+			Conf: r.Conf,
+		}
+
+		wf, err := r.Conf.TemporalClient.ExecuteWorkflow(
+			context.Background(),
+			options,
+			sf.UpgradeSilosWorkflow,
+			workflow.UpgradeSilosArgs{
+				WorkspaceID: workspaceID,
+				SiloSpecID:  siloSpecificationID,
+				JobID:       job.ID,
+			},
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&job).Update("temporal_workflow_id", wf.GetID()).Error; err != nil {
+			log.Err(err).Msg("Error uploading workflow ID")
+		}
+
+		return nil
+	}); err != nil {
+		return nil, handleError(err, "Error running job.")
+	}
+
+	return &job, nil
+}
+
 // SiloDefinition is the resolver for the siloDefinition field.
 func (r *queryResolver) SiloDefinition(ctx context.Context, id string) (*model.SiloDefinition, error) {
 	silo := &model.SiloDefinition{}
@@ -217,6 +403,17 @@ func (r *siloDefinitionResolver) SiloConfig(ctx context.Context, obj *model.Silo
 		return nil, err
 	}
 
+	// The config is hidden with the schema of the silo's version, since
+	// that's the one it was configured against.
+	if obj.SiloSpecificationVersionID != nil {
+		version := model.SiloSpecificationVersion{}
+		if err := r.Conf.DB.Where("id = ?", *obj.SiloSpecificationVersionID).First(&version).Error; err != nil {
+			return nil, err
+		}
+
+		siloSpec = version.Apply(siloSpec)
+	}
+
 	res := map[string]interface{}{}
 	if err := json.Unmarshal([]byte(obj.Config), &res); err != nil {
 		return nil, handleError(err, "Error decoding config.")
@@ -236,6 +433,41 @@ func (r *siloDefinitionResolver) SiloConfig(ctx context.Context, obj *model.Silo
 	return res, nil
 }
 
+// EffectiveExecutionPolicy is the resolver for the effectiveExecutionPolicy field.
+func (r *siloDefinitionResolver) EffectiveExecutionPolicy(ctx context.Context, obj *model.SiloDefinition) (*model.ExecutionPolicy, error) {
+	spec, err := dataloader.SiloSpecification(ctx, obj.SiloSpecificationID)
+	if err != nil {
+		return nil, handleError(err, "Error finding silo specification.")
+	}
+
+	policy := obj.ExecutionPolicy.Merge(spec.ExecutionPolicy)
+	policy = policy.Merge(&model.DefaultExecutionPolicy)
+
+	return &policy, nil
+}
+
+// SiloSpecificationVersion is the resolver for the siloSpecificationVersion field.
+func (r *siloDefinitionResolver) SiloSpecificationVersion(ctx context.Context, obj *model.SiloDefinition) (*model.SiloSpecificationVersion, error) {
+	if obj.SiloSpecificationVersionID == nil {
+		return nil, nil
+	}
+
+	return findObjectByID[model.SiloSpecificationVersion](
+		*obj.SiloSpecificationVersionID, r.Conf.DB, "Error finding silo specification version.",
+	)
+}
+
+// PreviousSiloSpecificationVersion is the resolver for the previousSiloSpecificationVersion field.
+func (r *siloDefinitionResolver) PreviousSiloSpecificationVersion(ctx context.Context, obj *model.SiloDefinition) (*model.SiloSpecificationVersion, error) {
+	if obj.PreviousSiloSpecificationVersionID == nil {
+		return nil, nil
+	}
+
+	return findObjectByID[model.SiloSpecificationVersion](
+		*obj.PreviousSiloSpecificationVersionID, r.Conf.DB, "Error finding silo specification version.",
+	)
+}
+
 // SiloDefinitions is the resolver for the siloDefinitions field.
 func (r *workspaceResolver) SiloDefinitions(ctx context.Context, obj *model.Workspace) ([]*model.SiloDefinition, error) {
 	defs := []*model.SiloDefinition{}
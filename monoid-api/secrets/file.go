@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileBackend reads secrets from a JSON file that maps secret paths to
+// their keys and values, e.g. {"db/prod": {"password": "..."}}. It's meant
+// for local development and tests, in place of a real secret store.
+type FileBackend struct {
+	Path string
+}
+
+// NewFileBackend creates a backend that reads from the file at path.
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{Path: path}
+}
+
+func (f *FileBackend) Get(ctx context.Context, path string, key string) (interface{}, error) {
+	// The file is read on every lookup, so changes are picked up without
+	// restarting.
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("error decoding secrets file: %w", err)
+	}
+
+	secret, ok := secrets[path]
+	if !ok {
+		return nil, fmt.Errorf("secret %s not found", path)
+	}
+
+	val, ok := secret[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+
+	return val, nil
+}
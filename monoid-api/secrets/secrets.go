@@ -0,0 +1,143 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ReferenceKey is the key of an object in a silo config that references a
+// secret, e.g. {"$secret": "vault://db/prod#password"}.
+const ReferenceKey = "$secret"
+
+// Backend looks up secrets in an external secret store.
+type Backend interface {
+	// Get returns the value of the key in the secret stored at path.
+	Get(ctx context.Context, path string, key string) (interface{}, error)
+}
+
+// Reference is a parsed secret reference of the form scheme://path#key.
+type Reference struct {
+	Scheme string
+	Path   string
+	Key    string
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("%s://%s#%s", r.Scheme, r.Path, r.Key)
+}
+
+// ParseReference parses a reference of the form scheme://path#key.
+func ParseReference(ref string) (Reference, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return Reference{}, fmt.Errorf("invalid secret reference %q", ref)
+	}
+
+	path := strings.Trim(u.Host+u.Path, "/")
+	if u.Scheme == "" || path == "" || u.Fragment == "" {
+		return Reference{}, fmt.Errorf(
+			"secret reference %q must be of the form scheme://path#key", ref,
+		)
+	}
+
+	return Reference{
+		Scheme: u.Scheme,
+		Path:   path,
+		Key:    u.Fragment,
+	}, nil
+}
+
+// reference returns the reference if the value is a secret reference object.
+func reference(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+
+	ref, ok := m[ReferenceKey].(string)
+	return ref, ok
+}
+
+// Resolver replaces secret references in silo configs with their values.
+type Resolver struct {
+	backends map[string]Backend
+}
+
+// NewResolver creates a resolver with no backends.
+func NewResolver() *Resolver {
+	return &Resolver{
+		backends: map[string]Backend{},
+	}
+}
+
+// Register sets the backend used to resolve references with the scheme.
+func (r *Resolver) Register(scheme string, backend Backend) {
+	r.backends[scheme] = backend
+}
+
+// Resolve returns a copy of the config with every secret reference replaced
+// by its value. The config itself isn't modified, so the resolved values
+// are never persisted.
+func (r *Resolver) Resolve(
+	ctx context.Context,
+	conf map[string]interface{},
+) (map[string]interface{}, error) {
+	res, err := r.resolve(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(map[string]interface{}), nil
+}
+
+func (r *Resolver) resolve(ctx context.Context, v interface{}) (interface{}, error) {
+	if refStr, ok := reference(v); ok {
+		ref, err := ParseReference(refStr)
+		if err != nil {
+			return nil, err
+		}
+
+		backend, ok := r.backends[ref.Scheme]
+		if !ok {
+			return nil, fmt.Errorf("no secrets backend configured for %s", ref.Scheme)
+		}
+
+		val, err := backend.Get(ctx, ref.Path, ref.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving secret %s: %w", ref, err)
+		}
+
+		return val, nil
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			resolved, err := r.resolve(ctx, val)
+			if err != nil {
+				return nil, err
+			}
+
+			res[k] = resolved
+		}
+
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, val := range t {
+			resolved, err := r.resolve(ctx, val)
+			if err != nil {
+				return nil, err
+			}
+
+			res[i] = resolved
+		}
+
+		return res, nil
+	}
+
+	return v, nil
+}
@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("vault://db/prod#password")
+	require.NoError(t, err)
+	assert.Equal(t, Reference{Scheme: "vault", Path: "db/prod", Key: "password"}, ref)
+
+	for _, invalid := range []string{"db/prod#password", "vault://db/prod", "vault://#password"} {
+		_, err := ParseReference(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "secrets.json")
+	require.NoError(t, os.WriteFile(fp, []byte(`{
+		"db/prod": {"password": "hunter2", "port": 5432}
+	}`), 0600))
+
+	// The file backend stands in for vault.
+	r := NewResolver()
+	r.Register("vault", NewFileBackend(fp))
+
+	conf := map[string]interface{}{
+		"username": "admin",
+		"password": map[string]interface{}{ReferenceKey: "vault://db/prod#password"},
+		"hosts": []interface{}{
+			map[string]interface{}{
+				"port": map[string]interface{}{ReferenceKey: "vault://db/prod#port"},
+			},
+		},
+	}
+
+	res, err := r.Resolve(context.Background(), conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "admin", res["username"])
+	assert.Equal(t, "hunter2", res["password"])
+	assert.Equal(t, float64(5432), res["hosts"].([]interface{})[0].(map[string]interface{})["port"])
+
+	// The original config isn't modified.
+	assert.Equal(t, map[string]interface{}{ReferenceKey: "vault://db/prod#password"}, conf["password"])
+
+	for _, ref := range []string{"vault://db/prod#missing", "vault://db/dev#password", "kms://key#value"} {
+		_, err := r.Resolve(context.Background(), map[string]interface{}{
+			"password": map[string]interface{}{ReferenceKey: ref},
+		})
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestVaultBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+
+		if r.URL.Path != "/v1/secret/data/db/prod" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data": map[string]interface{}{"password": "hunter2"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	v := NewVaultBackend(srv.URL, "token")
+
+	val, err := v.Get(context.Background(), "db/prod", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", val)
+
+	_, err = v.Get(context.Background(), "db/dev", "password")
+	assert.Error(t, err)
+
+	_, err = v.Get(context.Background(), "db/prod", "missing")
+	assert.Error(t, err)
+
+	v.Token = "wrong"
+	_, err = v.Get(context.Background(), "db/prod", "password")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VaultBackend reads secrets from a HashiCorp Vault KV version 2 engine.
+type VaultBackend struct {
+	Address   string
+	Token     string
+	Namespace string
+
+	// Mount is the path the KV engine is mounted at, defaults to "secret".
+	Mount string
+
+	Client *http.Client
+}
+
+// NewVaultBackend creates a backend for the Vault server at address.
+func NewVaultBackend(address string, token string) *VaultBackend {
+	return &VaultBackend{
+		Address: strings.TrimRight(address, "/"),
+		Token:   token,
+		Mount:   "secret",
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type vaultKVResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (v *VaultBackend) Get(ctx context.Context, path string, key string) (interface{}, error) {
+	segments := []string{}
+	for _, s := range strings.Split(path, "/") {
+		segments = append(segments, url.PathEscape(s))
+	}
+
+	u := fmt.Sprintf("%s/v1/%s/data/%s", v.Address, v.Mount, strings.Join(segments, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	res := vaultKVResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("error decoding vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"vault returned status %d: %s", resp.StatusCode, strings.Join(res.Errors, ", "),
+		)
+	}
+
+	val, ok := res.Data.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+
+	return val, nil
+}
@@ -1,5 +1,7 @@
 package specimport
 
+import "github.com/monoid-privacy/monoid/model"
+
 type IntegrationManifestEntry struct {
 	ID          string `yaml:"id"`
 	Name        string `yaml:"name"`
@@ -8,6 +10,25 @@ type IntegrationManifestEntry struct {
 	DockerTag   string `yaml:"dockerTag"`
 	Logo        string `yaml:"logo"`
 	Manual      bool   `yaml:"manual"`
+
+	// ExecutionPolicy is the default execution policy for silos of the
+	// integration.
+	ExecutionPolicy *model.ExecutionPolicy `yaml:"executionPolicy,omitempty"`
+
+	// ExecutionLimits cap the executions against all silos of the
+	// integration together.
+	ExecutionLimits *model.ExecutionLimits `yaml:"executionLimits,omitempty"`
+
+	// RequestBatching is set if the integration's connector supports
+	// batches of requests.
+	RequestBatching *model.RequestBatching `yaml:"requestBatching,omitempty"`
+
+	// DockerDigest pins the integration's image. It's resolved from the
+	// registry when the integration is loaded if it isn't set.
+	DockerDigest *string `yaml:"dockerDigest,omitempty"`
+
+	// RunProfile is the sandbox that the integration's connector runs in.
+	RunProfile *model.RunProfile `yaml:"runProfile,omitempty"`
 }
 
 type IntegrationFullSpecEntry struct {
@@ -74,6 +74,24 @@ func AddFile(tarWriter *tar.Writer, filePath string, fileContent []byte, mode in
 	return err
 }
 
+// AddFileFromReader adds a file with the contents of the reader to the tar.
+// size must be the number of bytes in the reader.
+func AddFileFromReader(tarWriter *tar.Writer, filePath string, r io.Reader, size int64, mode int64) error {
+	header := &tar.Header{
+		Name: filePath,
+		Mode: mode,
+		Size: size,
+	}
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := io.CopyN(tarWriter, r, size)
+
+	return err
+}
+
 func CopyTarToDir(tr *tar.Reader, dest string) error {
 	for {
 		header, err := tr.Next()
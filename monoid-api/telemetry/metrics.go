@@ -0,0 +1,114 @@
+// Package telemetry contains the Prometheus metrics and OpenTelemetry tracing
+// that are shared by the server and the worker.
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "monoid"
+
+var (
+	// ResolverDuration is the time taken by GraphQL resolvers.
+	ResolverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "resolver_duration_seconds",
+		Help:      "Time taken to run GraphQL resolvers.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"object", "field"})
+
+	// DataloaderBatchSize is the number of keys loaded in each dataloader batch.
+	DataloaderBatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "dataloader",
+		Name:      "batch_size",
+		Help:      "Number of keys loaded in each dataloader batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"loader"})
+
+	// ContainerStartDuration is the time taken to create and start a connector's
+	// container.
+	ContainerStartDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "container",
+		Name:      "start_duration_seconds",
+		Help:      "Time taken to create and start a connector container.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"image", "command"})
+
+	// ContainerRunDuration is the time a connector's container ran for, from
+	// when it started until it exited.
+	ContainerRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "container",
+		Name:      "run_duration_seconds",
+		Help:      "Time a connector container ran for, from start to exit.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{"image", "command"})
+
+	// ContainerStopDuration is the time taken to remove a connector's container.
+	ContainerStopDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "container",
+		Name:      "stop_duration_seconds",
+		Help:      "Time taken to remove a connector container.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"image"})
+
+	// ContainerExits counts the exit codes of connector containers.
+	ContainerExits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "container",
+		Name:      "exits_total",
+		Help:      "Number of connector container exits, by exit code.",
+	}, []string{"image", "command", "exit_code"})
+
+	// RecordsProcessed counts the records received from each silo for requests.
+	RecordsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "requests",
+		Name:      "records_processed_total",
+		Help:      "Number of records received from silos for user data requests.",
+	}, []string{"silo_definition_id"})
+
+	// BytesProcessed counts the bytes written to the file store for each silo's
+	// request results.
+	BytesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "requests",
+		Name:      "bytes_processed_total",
+		Help:      "Number of bytes of request results written to the file store.",
+	}, []string{"silo_definition_id"})
+
+	// Discoveries counts the discoveries made by scans of each silo.
+	Discoveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "discovery",
+		Name:      "discoveries_total",
+		Help:      "Number of discoveries made by silo scans.",
+	}, []string{"silo_definition_id"})
+)
+
+// MetricsHandler serves the metrics in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ServeMetrics serves the metrics at /metrics on addr in the background. The
+// metrics aren't authenticated, so addr shouldn't be publicly reachable.
+func ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Err(err).Msg("Error serving metrics")
+		}
+	}()
+}
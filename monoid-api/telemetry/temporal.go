@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.temporal.io/sdk/interceptor"
+)
+
+// TemporalInterceptor returns an interceptor that propagates spans through
+// Temporal, so workflows and activities are traced as children of the span
+// that started them. It should be set on the client, so workers created from
+// the client use it too.
+func TemporalInterceptor() interceptor.Interceptor {
+	return interceptor.NewTracingInterceptor(&temporalTracer{tracer: Tracer()})
+}
+
+type temporalSpanContextKey struct{}
+
+// temporalTracer implements Temporal's tracer with OpenTelemetry.
+type temporalTracer struct {
+	interceptor.BaseTracer
+	tracer trace.Tracer
+}
+
+// temporalSpan is a span that was started in this process.
+type temporalSpan struct {
+	trace.Span
+}
+
+func (s *temporalSpan) Finish(opts *interceptor.TracerFinishSpanOptions) {
+	if opts.Error != nil {
+		s.RecordError(opts.Error)
+		s.SetStatus(codes.Error, opts.Error.Error())
+	}
+
+	s.End()
+}
+
+// temporalSpanRef is a reference to a span that was read from a Temporal header.
+type temporalSpanRef struct {
+	trace.SpanContext
+}
+
+func (t *temporalTracer) Options() interceptor.TracerOptions {
+	return interceptor.TracerOptions{
+		SpanContextKey: temporalSpanContextKey{},
+		HeaderKey:      "_tracer-data",
+	}
+}
+
+func (t *temporalTracer) UnmarshalSpan(m map[string]string) (interceptor.TracerSpanRef, error) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(m))
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil, fmt.Errorf("no span in the header")
+	}
+
+	return &temporalSpanRef{sc}, nil
+}
+
+func (t *temporalTracer) MarshalSpan(span interceptor.TracerSpan) (map[string]string, error) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(
+		trace.ContextWithSpan(context.Background(), span.(*temporalSpan).Span),
+		carrier,
+	)
+
+	return carrier, nil
+}
+
+func (t *temporalTracer) SpanFromContext(ctx context.Context) interceptor.TracerSpan {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+
+	return &temporalSpan{span}
+}
+
+func (t *temporalTracer) ContextWithSpan(ctx context.Context, span interceptor.TracerSpan) context.Context {
+	return trace.ContextWithSpan(ctx, span.(*temporalSpan).Span)
+}
+
+func (t *temporalTracer) StartSpan(opts *interceptor.TracerStartSpanOptions) (interceptor.TracerSpan, error) {
+	ctx := context.Background()
+
+	switch parent := opts.Parent.(type) {
+	case *temporalSpan:
+		ctx = trace.ContextWithSpan(ctx, parent.Span)
+	case *temporalSpanRef:
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent.SpanContext)
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(opts.Tags))
+	for k, v := range opts.Tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+
+	_, span := t.tracer.Start(
+		ctx,
+		opts.Operation+":"+opts.Name,
+		trace.WithTimestamp(opts.Time),
+		trace.WithAttributes(attrs...),
+	)
+
+	return &temporalSpan{span}, nil
+}
@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.temporal.io/sdk/interceptor"
+)
+
+func TestTemporalSpanPropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer := &temporalTracer{tracer: sdktrace.NewTracerProvider().Tracer("test")}
+
+	parent, err := tracer.StartSpan(&interceptor.TracerStartSpanOptions{
+		Operation: "StartWorkflow",
+		Name:      "ExecuteRequestWorkflow",
+		Time:      time.Now(),
+	})
+	require.NoError(t, err)
+	defer parent.Finish(&interceptor.TracerFinishSpanOptions{})
+
+	header, err := tracer.MarshalSpan(parent)
+	require.NoError(t, err)
+
+	ref, err := tracer.UnmarshalSpan(header)
+	require.NoError(t, err)
+
+	child, err := tracer.StartSpan(&interceptor.TracerStartSpanOptions{
+		Parent:    ref,
+		Operation: "RunWorkflow",
+		Name:      "ExecuteRequestWorkflow",
+		Time:      time.Now(),
+	})
+	require.NoError(t, err)
+	defer child.Finish(&interceptor.TracerFinishSpanOptions{})
+
+	parentCtx := parent.(*temporalSpan).SpanContext()
+	childCtx := child.(*temporalSpan).SpanContext()
+
+	assert.Equal(t, parentCtx.TraceID(), childCtx.TraceID())
+	assert.NotEqual(t, parentCtx.SpanID(), childCtx.SpanID())
+
+	_, err = tracer.UnmarshalSpan(map[string]string{})
+	assert.Error(t, err)
+}
@@ -6,18 +6,26 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/discovery"
+	"github.com/monoid-privacy/monoid/joblog"
 	"github.com/monoid-privacy/monoid/jsonschema"
+	"github.com/monoid-privacy/monoid/lineage"
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
 	"github.com/monoid-privacy/monoid/scanner"
 	"github.com/monoid-privacy/monoid/scanner/basicscanner"
+	"github.com/monoid-privacy/monoid/telemetry"
 
 	"github.com/google/uuid"
 	"github.com/mitchellh/mapstructure"
 	"go.temporal.io/sdk/activity"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func dedupCategories(
@@ -40,6 +48,7 @@ func dedupCategories(
 		data, err := json.Marshal(model.NewCategoryDiscovery{
 			PropertyID: &propertyID,
 			CategoryID: cat.CategoryID,
+			Confidence: cat.Confidence,
 		})
 
 		if err != nil {
@@ -154,16 +163,46 @@ func getPropertyDiscoveries(
 	return res
 }
 
+// scanCoverage is the part of the silo that a discovery run re-computed the
+// sample-based discoveries for.
+type scanCoverage struct {
+	// unsampledSources and unsampledProperties are the IDs of the data sources
+	// that weren't sampled in the run, and their properties.
+	unsampledSources    map[string]bool
+	unsampledProperties map[string]bool
+	// primaryKeyLinks is false if primary key links couldn't be suggested.
+	primaryKeyLinks bool
+}
+
+// stale returns true if the open discovery wasn't made again in a run with the
+// coverage because it no longer applies, rather than because the run skipped it.
+func (c scanCoverage) stale(d *model.DataDiscovery, data model.DataDiscoveryData) bool {
+	switch d.Type {
+	case model.DiscoveryTypeCategoryFound:
+		return false
+	case model.DiscoveryTypePrimaryKeyLink:
+		pd, ok := data.(model.PrimaryKeyLinkDiscovery)
+		return ok && c.primaryKeyLinks && !c.unsampledProperties[pd.PropertyID]
+	default:
+		return true
+	}
+}
+
 // processDiscoveries processes the list of new discoveries, eliminating any duplicates,
 // updating them instead of creating, and closing any discoveries that are no longer relevant.
+// Property discoveries for the data sources that weren't sampled are not updated, since
+// their categories were not re-computed in this run. Once processed, the open discoveries
+// are handled by any matching discovery policies.
 // Returns the number of new discoveries made.
 func processDiscoveries(
 	ctx context.Context,
-	db *gorm.DB,
+	conf *config.BaseConfig,
 	silo *model.SiloDefinition,
 	discoveries []*model.DataDiscovery,
+	coverage scanCoverage,
 ) (int, error) {
 	logger := activity.GetLogger(ctx)
+	db := conf.DB
 
 	openDiscoveries := []*model.DataDiscovery{}
 	if err := db.Where("silo_definition_id = ?", silo.ID).Where(
@@ -194,6 +233,10 @@ func processDiscoveries(
 
 	nDiscoveries := 0
 
+	// The discoveries that are still open after processing, which the
+	// discovery policies are run against.
+	pending := []*model.DataDiscovery{}
+
 	if err := db.Transaction(func(tx *gorm.DB) error {
 		currDiscoveries := map[interface{}]bool{}
 
@@ -218,10 +261,19 @@ func processDiscoveries(
 					return err
 				}
 
+				pending = append(pending, d)
 				nDiscoveries += 1
 				continue
 			}
 
+			pending = append(pending, oldDiscovery)
+
+			// Keep the categories from the last sample if the source wasn't scanned.
+			if pd, ok := ds.(model.NewPropertyDiscovery); ok &&
+				pd.DataSourceId != nil && coverage.unsampledSources[*pd.DataSourceId] {
+				continue
+			}
+
 			// If this is an old discovery, then update it's data.
 			if err := db.Model(oldDiscovery).Updates(model.DataDiscovery{
 				Data: d.Data,
@@ -233,8 +285,9 @@ func processDiscoveries(
 		// If any currently open discovery no longer has a corresponding discovery in
 		// the new list of discoveries, then we assume that the change has been reversed.
 		// In order to maintain an appropriate audit trail, the discovery is closed, and
-		// rejected. This does not happen for category-related discoveries, since those
-		// may be non-deterministic based on the scan.
+		// rejected. This does not happen for category-related discoveries, or primary
+		// key discoveries for properties that weren't sampled, since those may be
+		// non-deterministic based on the scan.
 		for _, d := range openDiscoveries {
 			ds, err := d.DeserializeData()
 			if err != nil {
@@ -247,7 +300,7 @@ func processDiscoveries(
 				Type: d.Type,
 			}]
 
-			if ok || d.Type == model.DiscoveryTypeCategoryFound {
+			if ok || !coverage.stale(d, ds) {
 				continue
 			}
 
@@ -261,9 +314,152 @@ func processDiscoveries(
 		return 0, err
 	}
 
+	if err := applyDiscoveryPolicies(ctx, conf, silo, pending); err != nil {
+		logger.Error("Error applying discovery policies", "error", err)
+	}
+
 	return nDiscoveries, nil
 }
 
+// discoveryPolicyTarget gets the information needed to evaluate discovery policies
+// against the discovery d. sources and properties map IDs to the silo's data sources.
+func discoveryPolicyTarget(
+	d *model.DataDiscovery,
+	sources map[string]*model.DataSource,
+	properties map[string]*model.DataSource,
+) (discovery.PolicyTarget, error) {
+	target := discovery.PolicyTarget{Type: d.Type}
+
+	data, err := d.DeserializeData()
+	if err != nil {
+		return target, err
+	}
+
+	var source *model.DataSource
+
+	switch dd := data.(type) {
+	case model.NewDataSourceDiscovery:
+		target.SchemaName = dd.Name
+		target.SchemaGroup = dd.Group
+	case model.NewPropertyDiscovery:
+		if dd.DataSourceId != nil {
+			source = sources[*dd.DataSourceId]
+		}
+	case model.NewCategoryDiscovery:
+		if dd.PropertyID != nil {
+			source = properties[*dd.PropertyID]
+		}
+
+		target.Confidence = dd.Confidence
+	case model.DataSourceMissingDiscovery:
+		source = sources[dd.ID]
+	case model.PropertyMissingDiscovery:
+		source = properties[dd.ID]
+	case model.PrimaryKeyLinkDiscovery:
+		source = properties[dd.PropertyID]
+		target.Confidence = &dd.Confidence
+	}
+
+	if source != nil {
+		target.SchemaName = source.Name
+		target.SchemaGroup = source.Group
+	}
+
+	return target, nil
+}
+
+// applyDiscoveryPolicies accepts or rejects the discoveries that match the
+// discovery policies for the silo, and records which policy handled them.
+func applyDiscoveryPolicies(
+	ctx context.Context,
+	conf *config.BaseConfig,
+	silo *model.SiloDefinition,
+	discoveries []*model.DataDiscovery,
+) error {
+	logger := activity.GetLogger(ctx)
+
+	if len(discoveries) == 0 {
+		return nil
+	}
+
+	policies := []*model.DiscoveryPolicy{}
+	if err := conf.DB.Where("workspace_id = ?", silo.WorkspaceID).Where(
+		"(silo_definition_id IS NULL OR silo_definition_id = ?)", silo.ID,
+	).Order("created_at asc").Find(&policies).Error; err != nil {
+		return err
+	}
+
+	if len(policies) == 0 {
+		return nil
+	}
+
+	discovery.SortPolicies(policies)
+
+	dataSources := []*model.DataSource{}
+	if err := conf.DB.Preload("Properties").Where(
+		"silo_definition_id = ?", silo.ID,
+	).Find(&dataSources).Error; err != nil {
+		return err
+	}
+
+	sources := map[string]*model.DataSource{}
+	properties := map[string]*model.DataSource{}
+
+	for _, ds := range dataSources {
+		sources[ds.ID] = ds
+
+		for _, p := range ds.Properties {
+			properties[p.ID] = ds
+		}
+	}
+
+	nApplied := 0
+
+	for _, d := range discoveries {
+		target, err := discoveryPolicyTarget(d, sources, properties)
+		if err != nil {
+			logger.Error("Error deserializing data", "error", err)
+			continue
+		}
+
+		policy := discovery.MatchPolicy(policies, target)
+		if policy == nil {
+			continue
+		}
+
+		if _, errs := discovery.ApplyDiscoveries(
+			conf, []*model.DataDiscovery{d}, policy.Action,
+		); len(errs) != 0 {
+			logger.Error("Error applying discovery", "id", d.ID, "error", errs[0])
+			continue
+		}
+
+		if err := conf.DB.Model(d).Updates(model.DataDiscovery{
+			AutoApplied: true,
+			PolicyID:    &policy.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		nApplied += 1
+	}
+
+	logger.Info("Applied discovery policies", "applied", nApplied)
+
+	return nil
+}
+
+// ruleConfidence converts the confidence of a scanner match into
+// a DiscoveryConfidence.
+func ruleConfidence(m scanner.RuleMatch) *model.DiscoveryConfidence {
+	c := model.DiscoveryConfidence(strings.ToUpper(m.Confidence))
+	if !c.IsValid() {
+		return nil
+	}
+
+	return &c
+}
+
 // getCategories finds the new category discoveries from the
 // result of scanProtocol and the data source and
 // property names.
@@ -283,6 +479,7 @@ func getCategories(
 			for i, m := range matches {
 				res[i] = model.NewCategoryDiscovery{
 					CategoryID: m.RuleName,
+					Confidence: ruleConfidence(m),
 				}
 			}
 
@@ -295,12 +492,14 @@ func getCategories(
 
 // scanProtocol runs the PII scan using the monoid protocol,
 // and returns a 2D map, the first dimension of which is a DataSourceMatcher
-// key, and the second of which has the property path as a key.
+// key, and the second of which has the property path as a key. The scanned
+// records are also added to the sampler, which is used to infer lineage.
 func scanProtocol(
 	ctx context.Context,
 	mp monoidprotocol.MonoidProtocol,
 	config map[string]interface{},
 	schemas []monoidprotocol.MonoidSchema,
+	sampler *lineage.Sampler,
 ) (map[DataSourceMatcher]map[string][]scanner.RuleMatch, error) {
 	logger := activity.GetLogger(ctx)
 
@@ -336,6 +535,8 @@ func scanProtocol(
 		if err := matcher.Scan(&record); err != nil {
 			logger.Error("Error scanning record: %v", err)
 		}
+
+		sampler.Add(record.SchemaName, record.SchemaGroup, record.Data)
 	}
 
 	// Get all the rule matches from each schema
@@ -364,39 +565,185 @@ func scanProtocol(
 	return res, nil
 }
 
+// rescanInterval is the longest that a data source with an unchanged schema
+// will go without being re-sampled by the PII scanner.
+const rescanInterval = 7 * 24 * time.Hour
+
+// needsScan returns true if the data source should be sampled by the scanner,
+// either because it is new, its schema changed, or it hasn't been sampled recently.
+func needsScan(source *model.DataSource, fingerprint string, now time.Time) bool {
+	if source == nil || source.SchemaFingerprint == nil || source.LastScannedAt == nil {
+		return true
+	}
+
+	if *source.SchemaFingerprint != fingerprint {
+		return true
+	}
+
+	return now.Sub(*source.LastScannedAt) >= rescanInterval
+}
+
+// savePropertySamples stores the hashes of the values sampled for each of the
+// data source's properties.
+func savePropertySamples(db *gorm.DB, source *model.DataSource, sampler *lineage.Sampler) error {
+	samples := []model.PropertySample{}
+
+	for _, p := range source.Properties {
+		hashes := sampler.Hashes(source.Name, source.Group, p.Name)
+		if len(hashes) == 0 {
+			continue
+		}
+
+		data, err := json.Marshal(hashes)
+		if err != nil {
+			return err
+		}
+
+		samples = append(samples, model.PropertySample{
+			PropertyID: p.ID,
+			Hashes:     data,
+		})
+	}
+
+	if len(samples) == 0 {
+		return nil
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "property_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hashes", "updated_at"}),
+	}).Create(&samples).Error
+}
+
+// getPrimaryKeyDiscoveries suggests links to user primary keys for the properties of
+// the data sources that don't have any properties linked to a primary key yet.
+func getPrimaryKeyDiscoveries(
+	db *gorm.DB,
+	silo *model.SiloDefinition,
+	sources []model.DataSource,
+	categoryMatches map[DataSourceMatcher]map[string][]scanner.RuleMatch,
+	sampler *lineage.Sampler,
+) ([]*model.DataDiscovery, error) {
+	keys := []*model.UserPrimaryKey{}
+	if err := db.Where("workspace_id = ?", silo.WorkspaceID).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	type linkedRow struct {
+		Name             string
+		UserPrimaryKeyID string
+		Hashes           datatypes.JSON
+	}
+
+	rows := []linkedRow{}
+	if err := db.Table("properties").Select(
+		"properties.name, properties.user_primary_key_id, property_samples.hashes",
+	).Joins(
+		"JOIN property_samples ON property_samples.property_id = properties.id",
+	).Joins(
+		"JOIN data_sources ON data_sources.id = properties.data_source_id",
+	).Joins(
+		"JOIN silo_definitions ON silo_definitions.id = data_sources.silo_definition_id",
+	).Where("silo_definitions.workspace_id = ?", silo.WorkspaceID).Where(
+		"properties.user_primary_key_id IS NOT NULL AND properties.deleted_at IS NULL",
+	).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	linked := make([]discovery.LinkedSample, 0, len(rows))
+	for _, r := range rows {
+		hashes := []string{}
+		if err := json.Unmarshal(r.Hashes, &hashes); err != nil {
+			continue
+		}
+
+		linked = append(linked, discovery.LinkedSample{
+			PropertyName:     r.Name,
+			UserPrimaryKeyID: r.UserPrimaryKeyID,
+			Hashes:           hashes,
+		})
+	}
+
+	candidates := []discovery.PrimaryKeyCandidate{}
+
+L:
+	for _, s := range sources {
+		for _, p := range s.Properties {
+			if p.UserPrimaryKeyID != nil {
+				continue L
+			}
+		}
+
+		for _, p := range s.Properties {
+			categoryIDs := []string{}
+			for _, c := range p.Categories {
+				categoryIDs = append(categoryIDs, c.ID)
+			}
+
+			for _, c := range getCategories(categoryMatches, NewDataSourceMatcher(s.Name, s.Group), p.Name) {
+				categoryIDs = append(categoryIDs, c.CategoryID)
+			}
+
+			candidates = append(candidates, discovery.PrimaryKeyCandidate{
+				PropertyID:  p.ID,
+				Name:        p.Name,
+				CategoryIDs: categoryIDs,
+				Hashes:      sampler.Hashes(s.Name, s.Group, p.Name),
+			})
+		}
+	}
+
+	res := []*model.DataDiscovery{}
+	for _, link := range discovery.SuggestPrimaryKeyLinks(candidates, keys, linked) {
+		data, err := json.Marshal(link)
+		if err != nil {
+			continue
+		}
+
+		res = append(res, &model.DataDiscovery{
+			ID:     uuid.NewString(),
+			Type:   model.DiscoveryTypePrimaryKeyLink,
+			Status: model.DiscoveryStatusOpen,
+			Data:   data,
+		})
+	}
+
+	return res, nil
+}
+
 // DetectDSArgs are the arguments passed into a the activity.
 type DetectDSArgs struct {
-	SiloID        string
-	LogObjectName string
+	SiloID string
+	JobID  string
+
+	// FullScan forces every data source to be sampled, even if its
+	// schema hasn't changed since the last scan.
+	FullScan bool
 }
 
 // DetectDataSources scans for the data sources for a data silo, and returns the number of
 // discoveries that were made.
 func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (int, error) {
 	logger := activity.GetLogger(ctx)
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-
-	L:
-		for {
-			select {
-			case <-ticker.C:
-				activity.RecordHeartbeat(ctx)
 
-			// End the heartbeats if the context is cancelled.
-			case <-ctx.Done():
-				break L
-			}
-		}
-	}()
+	stopHeartbeat := StartHeartbeat(ctx)
+	defer stopHeartbeat()
 
 	dataSilo := model.SiloDefinition{}
 	if err := a.Conf.DB.Preload(
 		"SiloSpecification",
+	).Preload(
+		"SiloSpecificationVersion",
 	).Where("id = ?", args.SiloID).First(&dataSilo).Error; err != nil {
 		return 0, err
 	}
 
+	siloSpec := dataSilo.EffectiveSpecification()
+
 	logger.Info("Getting schemas")
 
 	// Create a temporary directory that can be used by the docker container
@@ -407,10 +754,12 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 
 	defer os.RemoveAll(dir)
 
-	mp, err := a.Conf.ProtocolFactory.NewMonoidProtocol(
-		dataSilo.SiloSpecification.DockerImage,
-		dataSilo.SiloSpecification.DockerTag,
+	mp, err := monoidprotocol.NewMonoidProtocol(
+		a.Conf.ProtocolFactory,
+		siloSpec.DockerImage,
+		siloSpec.DockerTag,
 		dir,
+		siloSpec.ConnectorOptions(),
 	)
 
 	if err != nil {
@@ -430,12 +779,21 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 		return 0, err
 	}
 
-	go func() {
-		wr, _, err := a.Conf.FileStore.NewWriter(context.Background(), args.LogObjectName, true)
+	var jw *joblog.Writer
+	if args.JobID != "" {
+		// The log is written with a background context, so the cancellation
+		// can still be logged.
+		jw, err = joblog.NewWriter(context.Background(), a.Conf.DB, a.Conf.FileStore, args.JobID)
 		if err != nil {
-			logger.Error("Error opening log writer: %v", err)
+			logger.Error("Error opening log writer", "error", err)
 		}
 
+		jw.SetSiloDefinitionID(dataSilo.ID)
+	}
+
+	ForwardSandboxViolations(ctx, mp, jw)
+
+	go func() {
 	L:
 		for {
 			select {
@@ -444,13 +802,17 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 					break L
 				}
 
-				if _, err := wr.Write([]byte(logMsg.Message + "\n")); err != nil {
+				if err := jw.Write(model.JobLogEntry{
+					Level:   model.LogLevelInfo,
+					Source:  joblog.SourceContainer,
+					Message: logMsg.Message,
+				}); err != nil {
 					logger.Error("Error writing", err)
 				}
 			case <-ctx.Done():
 				logger.Info("Task Cancelled")
 
-				if _, err := wr.Write([]byte("Task cancelled\n")); err != nil {
+				if err := jw.Log(model.LogLevelWarn, "Task cancelled"); err != nil {
 					logger.Error("Error writing", err)
 				}
 
@@ -459,7 +821,7 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 		}
 
 		logger.Debug("Close")
-		wr.Close()
+		jw.Close()
 	}()
 
 	if err := mp.InitConn(ctx); err != nil {
@@ -473,18 +835,20 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 		return 0, err
 	}
 
+	conf, err = a.Conf.ResolveSiloConfig(ctx, conf)
+	if err != nil {
+		logger.Error("Error resolving secrets", "error", err)
+		return 0, err
+	}
+
 	logger.Info("pulling schema")
+	jw.Log(model.LogLevelInfo, "Pulling schema")
 
 	schemas, err := mp.Schema(ctx, conf)
 
 	if err != nil {
 		logger.Error("Error running schema", err)
-		return 0, err
-	}
-
-	matches, err := scanProtocol(ctx, mp, conf, schemas.Schemas)
-	if err != nil {
-		logger.Error("Error running scan", "error", err)
+		jw.Log(model.LogLevelError, "Error pulling schema: "+err.Error())
 		return 0, err
 	}
 
@@ -505,6 +869,77 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 		sourceMap[NewDataSourceMatcher(s.Name, s.Group)] = &scp
 	}
 
+	// Only sample the data sources that are new, have changed, or are due
+	// for a rescan.
+	now := time.Now()
+	fingerprints := map[DataSourceMatcher]string{}
+	scanSchemas := []monoidprotocol.MonoidSchema{}
+
+	for _, schema := range schemas.Schemas {
+		sourceMatcher := NewDataSourceMatcher(schema.Name, schema.Group)
+
+		fingerprint, err := SchemaFingerprint(schema.JsonSchema)
+		if err != nil {
+			logger.Error("Error computing schema fingerprint", "error", err)
+			scanSchemas = append(scanSchemas, schema)
+			continue
+		}
+
+		fingerprints[sourceMatcher] = fingerprint
+
+		if args.FullScan || needsScan(sourceMap[sourceMatcher], fingerprint, now) {
+			scanSchemas = append(scanSchemas, schema)
+		}
+	}
+
+	logger.Info(
+		"Scanning data sources",
+		"scanned", len(scanSchemas),
+		"skipped", len(schemas.Schemas)-len(scanSchemas),
+	)
+	jw.Log(model.LogLevelInfo, fmt.Sprintf(
+		"Scanning %d data sources, skipping %d that haven't changed",
+		len(scanSchemas), len(schemas.Schemas)-len(scanSchemas),
+	))
+
+	sampler, err := lineage.NewSampler(model.GetKeyring(), dataSilo.WorkspaceID)
+	if err != nil {
+		logger.Error("Error creating sampler", "error", err)
+		return 0, err
+	}
+
+	matches := map[DataSourceMatcher]map[string][]scanner.RuleMatch{}
+	if len(scanSchemas) != 0 {
+		matches, err = scanProtocol(ctx, mp, conf, scanSchemas, sampler)
+		if err != nil {
+			logger.Error("Error running scan", "error", err)
+			jw.Log(model.LogLevelError, "Error running scan: "+err.Error())
+			return 0, err
+		}
+	}
+
+	scanned := map[DataSourceMatcher]bool{}
+	for _, schema := range scanSchemas {
+		scanned[NewDataSourceMatcher(schema.Name, schema.Group)] = true
+	}
+
+	coverage := scanCoverage{
+		unsampledSources:    map[string]bool{},
+		unsampledProperties: map[string]bool{},
+		primaryKeyLinks:     true,
+	}
+
+	for m, s := range sourceMap {
+		if scanned[m] {
+			continue
+		}
+
+		coverage.unsampledSources[s.ID] = true
+		for _, p := range s.Properties {
+			coverage.unsampledProperties[p.ID] = true
+		}
+	}
+
 	dataDiscoveries := []*model.DataDiscovery{}
 
 	// The data sources that are in the new schemas
@@ -592,10 +1027,43 @@ func (a *Activity) DetectDataSources(ctx context.Context, args DetectDSArgs) (in
 		})
 	}
 
-	nDiscoveries, err := processDiscoveries(ctx, a.Conf.DB, &dataSilo, dataDiscoveries)
+	pkDiscoveries, err := getPrimaryKeyDiscoveries(a.Conf.DB, &dataSilo, sources, matches, sampler)
+	if err != nil {
+		logger.Error("Error suggesting primary key links", "error", err)
+		coverage.primaryKeyLinks = false
+	}
+
+	dataDiscoveries = append(dataDiscoveries, pkDiscoveries...)
+
+	nDiscoveries, err := processDiscoveries(
+		ctx, a.Conf, &dataSilo, dataDiscoveries, coverage,
+	)
 	if err != nil {
 		return 0, err
 	}
 
+	telemetry.Discoveries.WithLabelValues(dataSilo.ID).Add(float64(nDiscoveries))
+	jw.Log(model.LogLevelInfo, fmt.Sprintf("Found %d discoveries", nDiscoveries))
+
+	// Record the fingerprints of the data sources that were sampled, so they
+	// can be skipped on the next run if they don't change.
+	for m, s := range sourceMap {
+		fingerprint, ok := fingerprints[m]
+		if !ok || !scanned[m] {
+			continue
+		}
+
+		if err := a.Conf.DB.Model(s).Updates(model.DataSource{
+			SchemaFingerprint: &fingerprint,
+			LastScannedAt:     &now,
+		}).Error; err != nil {
+			logger.Error("Error updating schema fingerprint", "error", err)
+		}
+
+		if err := savePropertySamples(a.Conf.DB, s, sampler); err != nil {
+			logger.Error("Error saving property samples", "error", err)
+		}
+	}
+
 	return nDiscoveries, nil
 }
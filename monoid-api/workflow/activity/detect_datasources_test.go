@@ -0,0 +1,122 @@
+package activity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	users := monoidprotocol.MonoidSchemaJsonSchema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"email": map[string]interface{}{"type": "string"},
+			"name":  map[string]interface{}{"type": "string"},
+		},
+	}
+
+	base, err := SchemaFingerprint(users)
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		schema monoidprotocol.MonoidSchemaJsonSchema
+		same   bool
+	}{
+		{
+			name: "unchanged",
+			schema: monoidprotocol.MonoidSchemaJsonSchema{
+				"properties": map[string]interface{}{
+					"name":  map[string]interface{}{"type": "string"},
+					"email": map[string]interface{}{"type": "string"},
+				},
+				"type": "object",
+			},
+			same: true,
+		},
+		{
+			name: "property_added",
+			schema: monoidprotocol.MonoidSchemaJsonSchema{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"email": map[string]interface{}{"type": "string"},
+					"name":  map[string]interface{}{"type": "string"},
+					"phone": map[string]interface{}{"type": "string"},
+				},
+			},
+			same: false,
+		},
+		{
+			name: "type_changed",
+			schema: monoidprotocol.MonoidSchemaJsonSchema{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"email": map[string]interface{}{"type": "string"},
+					"name":  map[string]interface{}{"type": "integer"},
+				},
+			},
+			same: false,
+		},
+		{
+			name:   "empty",
+			schema: nil,
+			same:   false,
+		},
+	} {
+		fingerprint, err := SchemaFingerprint(tc.schema)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.same, fingerprint == base, tc.name)
+	}
+}
+
+func TestNeedsScan(t *testing.T) {
+	now := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Hour)
+	stale := now.Add(-rescanInterval)
+
+	for _, tc := range []struct {
+		name   string
+		source *model.DataSource
+		scan   bool
+	}{
+		{
+			name:   "new_source",
+			source: nil,
+			scan:   true,
+		},
+		{
+			name:   "unchanged",
+			source: &model.DataSource{SchemaFingerprint: ptr("fp"), LastScannedAt: &recent},
+			scan:   false,
+		},
+		{
+			name:   "changed",
+			source: &model.DataSource{SchemaFingerprint: ptr("old_fp"), LastScannedAt: &recent},
+			scan:   true,
+		},
+		{
+			name:   "missing_fingerprint",
+			source: &model.DataSource{LastScannedAt: &recent},
+			scan:   true,
+		},
+		{
+			name:   "never_scanned",
+			source: &model.DataSource{SchemaFingerprint: ptr("fp")},
+			scan:   true,
+		},
+		{
+			name:   "unchanged_stale",
+			source: &model.DataSource{SchemaFingerprint: ptr("fp"), LastScannedAt: &stale},
+			scan:   true,
+		},
+	} {
+		assert.Equal(t, tc.scan, needsScan(tc.source, "fp", now), tc.name)
+	}
+}
@@ -0,0 +1,58 @@
+package activity
+
+import (
+	"context"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"go.temporal.io/sdk/activity"
+)
+
+// defaultHeartbeatInterval is how often heartbeats are recorded for
+// activities that don't have a heartbeat timeout.
+const defaultHeartbeatInterval = 10 * time.Second
+
+// FindExecutionPolicy returns the execution policy for the silo, with the
+// fields the silo doesn't set taken from its specification's policy.
+func (a *Activity) FindExecutionPolicy(ctx context.Context, siloDefinitionID string) (model.ExecutionPolicy, error) {
+	silo := model.SiloDefinition{}
+	if err := a.Conf.DB.Preload("SiloSpecification").Where(
+		"id = ?", siloDefinitionID,
+	).First(&silo).Error; err != nil {
+		return model.ExecutionPolicy{}, err
+	}
+
+	return silo.EffectiveExecutionPolicy(), nil
+}
+
+// StartHeartbeat records heartbeats for the activity in the background, so that
+// it isn't timed out while it waits on a connector. The heartbeats stop when the
+// returned function is called, or the activity's context is done.
+func StartHeartbeat(ctx context.Context) (stop func()) {
+	interval := activity.GetInfo(ctx).HeartbeatTimeout / 3
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				activity.RecordHeartbeat(ctx)
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
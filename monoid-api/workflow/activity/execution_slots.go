@@ -0,0 +1,101 @@
+package activity
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/execlimit"
+	"github.com/monoid-privacy/monoid/model"
+	"go.temporal.io/sdk/workflow"
+)
+
+// slotTTLMargin is added to the time an execution can take, to get how long
+// its slot is held for if it isn't released.
+const slotTTLMargin = 5 * time.Minute
+
+type AcquireSlotArgs struct {
+	HolderID string                 `json:"holderId"`
+	Limits   []model.ExecutionLimit `json:"limits"`
+	TTL      time.Duration          `json:"ttl"`
+}
+
+// FindExecutionLimits returns the limits that apply to executions against the silo.
+func (a *Activity) FindExecutionLimits(ctx context.Context, siloDefinitionID string) ([]model.ExecutionLimit, error) {
+	silo := model.SiloDefinition{}
+	if err := a.Conf.DB.Preload("SiloSpecification").Where(
+		"id = ?", siloDefinitionID,
+	).First(&silo).Error; err != nil {
+		return nil, err
+	}
+
+	return silo.ExecutionLimitList(), nil
+}
+
+// AcquireExecutionSlot tries to acquire a slot for an execution under each of
+// the limits.
+func (a *Activity) AcquireExecutionSlot(ctx context.Context, args AcquireSlotArgs) (execlimit.Result, error) {
+	return execlimit.Acquire(a.Conf.DB, args.HolderID, args.TTL, args.Limits)
+}
+
+// ReleaseExecutionSlot releases the slots held by the holder.
+func (a *Activity) ReleaseExecutionSlot(ctx context.Context, holderID string) error {
+	return execlimit.Release(a.Conf.DB, holderID)
+}
+
+// WithExecutionSlot waits until an execution is allowed under all of the limits,
+// then runs fn and releases the slot once it returns. fn is run right away if
+// there are no limits. policy is used to find how long fn can take.
+func WithExecutionSlot(
+	ctx workflow.Context,
+	limits []model.ExecutionLimit,
+	policy model.ExecutionPolicy,
+	fn func() error,
+) error {
+	// Workflows started before executions were limited don't have the slot
+	// activities in their history.
+	if len(limits) == 0 ||
+		workflow.GetVersion(ctx, "execution-slots", workflow.DefaultVersion, 1) == workflow.DefaultVersion {
+		return fn()
+	}
+
+	logger := workflow.GetLogger(ctx)
+	ac := Activity{}
+
+	var holderID string
+	if err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+		return uuid.NewString()
+	}).Get(&holderID); err != nil {
+		return err
+	}
+
+	args := AcquireSlotArgs{
+		HolderID: holderID,
+		Limits:   limits,
+		TTL:      policy.ActivityTimeout()*time.Duration(policy.Attempts()) + slotTTLMargin,
+	}
+
+	for {
+		res := execlimit.Result{}
+		if err := workflow.ExecuteActivity(ctx, ac.AcquireExecutionSlot, args).Get(ctx, &res); err != nil {
+			return err
+		}
+
+		if res.Acquired {
+			break
+		}
+
+		if err := workflow.Sleep(ctx, res.RetryAfter); err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		releaseCtx, _ := workflow.NewDisconnectedContext(ctx)
+		if err := workflow.ExecuteActivity(releaseCtx, ac.ReleaseExecutionSlot, holderID).Get(releaseCtx, nil); err != nil {
+			logger.Error("Error releasing execution slot", err)
+		}
+	}()
+
+	return fn()
+}
@@ -1,5 +1,13 @@
 package activity
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+)
+
 type DataSourceMatcher struct {
 	Group string
 	Name  string
@@ -16,3 +24,16 @@ func NewDataSourceMatcher(name string, group *string) DataSourceMatcher {
 		Group: gr,
 	}
 }
+
+// SchemaFingerprint returns a stable hash of a data source's JSON schema,
+// used to determine whether the schema has changed between discovery runs.
+func SchemaFingerprint(schema monoidprotocol.MonoidSchemaJsonSchema) (string, error) {
+	// json.Marshal sorts map keys, so the encoding is deterministic.
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
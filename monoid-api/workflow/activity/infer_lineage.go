@@ -0,0 +1,22 @@
+package activity
+
+import (
+	"context"
+
+	"github.com/monoid-privacy/monoid/lineage"
+	"go.temporal.io/sdk/activity"
+)
+
+// InferLineage re-infers the lineage edges in the workspace, and returns the
+// number of inferred edges.
+func (a *Activity) InferLineage(ctx context.Context, workspaceID string) (int, error) {
+	logger := activity.GetLogger(ctx)
+
+	edges, err := lineage.InferWorkspaceLineage(a.Conf.DB, workspaceID)
+	if err != nil {
+		logger.Error("Error inferring lineage", "error", err)
+		return 0, err
+	}
+
+	return len(edges), nil
+}
@@ -41,25 +41,18 @@ func (a *Activity) FindOrCreateJob(ctx context.Context, jobIn JobInput) (model.J
 		}
 	}
 
-	wr, path, err := a.Conf.FileStore.NewWriter(ctx, uuid.NewString(), false)
-	if err != nil {
-		logger.Error("Error creating file store")
-	}
-
-	wr.Close()
-
 	if err := a.Conf.DB.Model(&job).Update(
-		"log_object",
-		path,
-	).Update("temporal_workflow_id", activityInfo.WorkflowExecution.ID).Error; err != nil {
-		logger.Error("Error setting log object", err)
+		"temporal_workflow_id", activityInfo.WorkflowExecution.ID,
+	).Error; err != nil {
+		logger.Error("Error setting workflow ID", err)
 	}
 
 	a.Conf.AnalyticsIngestor.Track("job", nil, map[string]interface{}{
-		"jobId":   job.ID,
-		"jobType": job.JobType,
-		"args":    jobIn.AnalyticsArgs,
-		"action":  job.Status,
+		"jobId":       job.ID,
+		"jobType":     job.JobType,
+		"workspaceId": job.WorkspaceID,
+		"args":        jobIn.AnalyticsArgs,
+		"action":      job.Status,
 	})
 
 	return job, nil
@@ -78,10 +71,11 @@ func (a *Activity) UpdateJobStatus(ctx context.Context, statusIn JobStatusInput)
 	}
 
 	a.Conf.AnalyticsIngestor.Track("job", nil, map[string]interface{}{
-		"jobId":   job.ID,
-		"jobType": job.JobType,
-		"args":    statusIn.AnalyticsArgs,
-		"action":  statusIn.Status,
+		"jobId":       job.ID,
+		"jobType":     job.JobType,
+		"workspaceId": job.WorkspaceID,
+		"args":        statusIn.AnalyticsArgs,
+		"action":      statusIn.Status,
 	})
 
 	return a.Conf.DB.Updates(&model.Job{
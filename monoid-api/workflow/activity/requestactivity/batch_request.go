@@ -0,0 +1,148 @@
+package requestactivity
+
+import (
+	"context"
+
+	"github.com/monoid-privacy/monoid/model"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+)
+
+const (
+	// SiloBatchWorkflowName is the name of the workflow that collects a silo's
+	// requests into batches (RequestWorkflow.ExecuteSiloBatchWorkflow). It's
+	// referenced by name, since the workflow package depends on this one.
+	SiloBatchWorkflowName = "ExecuteSiloBatchWorkflow"
+
+	// SiloBatchRequestSignalChannel receives the requests to add to a silo's
+	// batch.
+	SiloBatchRequestSignalChannel = "silo-batch-request"
+
+	// SiloBatchResultSignalChannel receives the result of starting a request
+	// in a batch.
+	SiloBatchResultSignalChannel = "silo-batch-result"
+
+	// SiloBatchCancelSignalChannel receives the requests to remove from a
+	// silo's batch, because the workflow waiting for them was cancelled.
+	SiloBatchCancelSignalChannel = "silo-batch-cancel"
+)
+
+// SiloBatchWorkflowID returns the ID of the workflow that collects the silo's
+// requests into batches.
+func SiloBatchWorkflowID(siloDefinitionID string) string {
+	return "silo-batch-" + siloDefinitionID
+}
+
+// BatchRequestItem is a request to start on a silo in a batch.
+type BatchRequestItem struct {
+	RequestID string `json:"requestId"`
+
+	// RequestStatusIDs limits the request to some of the silo's data sources.
+	RequestStatusIDs []string `json:"requestStatusIds,omitempty"`
+
+	// JobID is the job that log entries are written for.
+	JobID string `json:"jobId,omitempty"`
+
+	// WorkflowID is the ID of the silo request workflow that's waiting for
+	// the result.
+	WorkflowID string `json:"workflowId,omitempty"`
+}
+
+// requestStatus returns the item's request status for the data source, or nil if
+// the request doesn't run on it. The data source's request statuses must be
+// loaded.
+func (item BatchRequestItem) requestStatus(ds *model.DataSource) *model.RequestStatus {
+	for i := range ds.RequestStatuses {
+		s := &ds.RequestStatuses[i]
+		if s.RequestID != item.RequestID {
+			continue
+		}
+
+		if len(item.RequestStatusIDs) == 0 {
+			return s
+		}
+
+		for _, id := range item.RequestStatusIDs {
+			if id == s.ID {
+				return s
+			}
+		}
+	}
+
+	return nil
+}
+
+// SiloBatchArgs contains the arguments to the silo batch workflow.
+type SiloBatchArgs struct {
+	SiloDefinitionID string                 `json:"siloDefinitionId"`
+	Batching         model.RequestBatching  `json:"batching"`
+	Policy           model.ExecutionPolicy  `json:"policy"`
+	Limits           []model.ExecutionLimit `json:"limits,omitempty"`
+
+	// Pending are the requests that were received, but not started, before
+	// the workflow continued as new.
+	Pending []BatchRequestItem `json:"pending,omitempty"`
+}
+
+// SiloBatchResultSignal is sent to a silo request workflow once its request
+// has been started in a batch.
+type SiloBatchResultSignal struct {
+	RequestID string              `json:"requestId"`
+	Result    RequestStatusResult `json:"result"`
+
+	// Error is set if the batch couldn't be started.
+	Error string `json:"error,omitempty"`
+}
+
+// EnqueueBatchRequestArgs contains the arguments to the EnqueueBatchRequestActivity.
+type EnqueueBatchRequestArgs struct {
+	Batch SiloBatchArgs    `json:"batch"`
+	Item  BatchRequestItem `json:"item"`
+}
+
+// EnqueueBatchRequestActivity adds the request to the silo's next batch, starting
+// the silo's batch workflow if it isn't running.
+func (a *RequestActivity) EnqueueBatchRequestActivity(
+	ctx context.Context,
+	args EnqueueBatchRequestArgs,
+) error {
+	_, err := a.Conf.TemporalClient.SignalWithStartWorkflow(
+		ctx,
+		SiloBatchWorkflowID(args.Batch.SiloDefinitionID),
+		SiloBatchRequestSignalChannel,
+		args.Item,
+		client.StartWorkflowOptions{
+			TaskQueue: activity.GetInfo(ctx).TaskQueue,
+		},
+		SiloBatchWorkflowName,
+		args.Batch,
+	)
+
+	return err
+}
+
+// StartBatchRequestArgs contains the arguments to the StartSiloBatchRequestActivity.
+type StartBatchRequestArgs struct {
+	SiloDefinitionID string             `json:"siloDefinitionId"`
+	Requests         []BatchRequestItem `json:"requests"`
+}
+
+// BatchRequestStatusResult is the status of each request in a batch, keyed by
+// request ID.
+type BatchRequestStatusResult struct {
+	Results map[string]RequestStatusResult `json:"results"`
+}
+
+// StartSiloBatchRequestActivity starts the requests on the silo with a single
+// connector invocation, and returns the status of each request.
+func (a *RequestActivity) StartSiloBatchRequestActivity(
+	ctx context.Context,
+	args StartBatchRequestArgs,
+) (BatchRequestStatusResult, error) {
+	results, err := a.startSiloRequests(ctx, args.SiloDefinitionID, args.Requests)
+	if err != nil {
+		return BatchRequestStatusResult{}, err
+	}
+
+	return BatchRequestStatusResult{Results: results}, nil
+}
@@ -2,6 +2,7 @@ package requestactivity
 
 import (
 	"context"
+	"time"
 
 	"github.com/monoid-privacy/monoid/model"
 )
@@ -29,18 +30,62 @@ type BatchUpdateRequestStatusArgs struct {
 	RequestID        string
 	SiloDefinitionID string
 	Status           model.RequestStatusType
+
+	// RequestStatusIDs limits the update to some of the silo's request statuses.
+	RequestStatusIDs []string
 }
 
+// BatchUpdateRequestStatusActivity updates the status of all of the request's data
+// sources in the silo that haven't already been executed.
 func (a *RequestActivity) BatchUpdateRequestStatusActivity(
 	ctx context.Context,
 	args BatchUpdateRequestStatusArgs,
 ) error {
-	return a.Conf.DB.Model(&model.RequestStatus{}).Where(
+	q := a.Conf.DB.Model(&model.RequestStatus{}).Where(
 		"request_id = ?",
 		args.RequestID,
 	).Where(
 		"data_source_id IN (?)", a.Conf.DB.Model(&model.DataSource{}).Select("id").Where(
 			"silo_definition_id = ?", args.SiloDefinitionID,
 		),
-	).Update("status", args.Status).Error
+	).Where("status <> ?", model.RequestStatusTypeExecuted)
+
+	if len(args.RequestStatusIDs) > 0 {
+		q = q.Where("id IN ?", args.RequestStatusIDs)
+	}
+
+	return q.Update("status", args.Status).Error
+}
+
+type RecomputeRequestStatusArgs struct {
+	RequestID string
+}
+
+// RecomputeRequestStatusActivity updates the request's status from the statuses of
+// its data sources.
+func (a *RequestActivity) RecomputeRequestStatusActivity(
+	ctx context.Context,
+	args RecomputeRequestStatusArgs,
+) error {
+	_, err := model.RecomputeRequestStatus(a.Conf.DB, args.RequestID)
+	return err
+}
+
+type FinishJobProgressArgs struct {
+	JobID            string
+	SiloDefinitionID string
+	Status           model.JobStatus
+}
+
+// FinishJobProgressActivity records that the job has finished running on the silo.
+func (a *RequestActivity) FinishJobProgressActivity(
+	ctx context.Context,
+	args FinishJobProgressArgs,
+) error {
+	return a.Conf.DB.Model(&model.JobProgress{}).Where(
+		"job_id = ? AND silo_definition_id = ?", args.JobID, args.SiloDefinitionID,
+	).Updates(map[string]interface{}{
+		"status":      args.Status,
+		"finished_at": time.Now(),
+	}).Error
 }
@@ -12,7 +12,7 @@ func (a *RequestActivity) FindDBSilos(args FindRequestArgs) ([]model.SiloDefinit
 	if err := a.Conf.DB.Where(
 		"workspace_id = ?",
 		args.WorkspaceID,
-	).Find(&defs).Error; err != nil {
+	).Preload("SiloSpecification").Find(&defs).Error; err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,40 @@
+package requestactivity
+
+import (
+	"context"
+
+	"github.com/monoid-privacy/monoid/joblog"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"go.temporal.io/sdk/activity"
+)
+
+// newJobLog creates a log writer for the job's entries about the silo. A nil
+// writer is returned if there's no job, or the log couldn't be created, since
+// the request shouldn't fail because its logs can't be written.
+func (a *RequestActivity) newJobLog(ctx context.Context, jobID string, siloDefinitionID string) *joblog.Writer {
+	if jobID == "" {
+		return nil
+	}
+
+	// The log is written with a background context, so entries about the
+	// activity being cancelled are still saved.
+	jw, err := joblog.NewWriter(context.Background(), a.Conf.DB, a.Conf.FileStore, jobID)
+	if err != nil {
+		activity.GetLogger(ctx).Error("Error creating job log", "error", err)
+		return nil
+	}
+
+	jw.SetSiloDefinitionID(siloDefinitionID)
+
+	return jw
+}
+
+// forwardContainerLogs writes the container's logs to the job log and the
+// activity logger.
+func forwardContainerLogs(ctx context.Context, jw *joblog.Writer, logChan <-chan monoidprotocol.MonoidLogMessage) {
+	logger := activity.GetLogger(ctx)
+
+	go jw.ForwardContainerLogs(logChan, func(message string) {
+		logger.Info("container-log", "log", message)
+	})
+}
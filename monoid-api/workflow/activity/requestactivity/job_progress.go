@@ -0,0 +1,65 @@
+package requestactivity
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"go.temporal.io/sdk/activity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// startJobProgress records that the job has started running on the silo. Errors
+// are logged rather than returned, since the request shouldn't fail because its
+// progress can't be saved.
+func (a *RequestActivity) startJobProgress(ctx context.Context, jobID string, siloDefinitionID string) {
+	if jobID == "" {
+		return
+	}
+
+	now := time.Now()
+
+	if err := a.Conf.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_id"}, {Name: "silo_definition_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "started_at"}),
+	}).Create(&model.JobProgress{
+		ID:               uuid.NewString(),
+		JobID:            jobID,
+		SiloDefinitionID: siloDefinitionID,
+		Status:           model.JobStatusRunning,
+		StartedAt:        &now,
+	}).Error; err != nil {
+		activity.GetLogger(ctx).Error("Error saving job progress", "error", err)
+	}
+}
+
+// addJobProgress adds to the job's progress counters for the silo.
+func (a *RequestActivity) addJobProgress(
+	ctx context.Context,
+	jobID string,
+	siloDefinitionID string,
+	counters map[string]int64,
+) {
+	if jobID == "" {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	for col, n := range counters {
+		if n != 0 {
+			updates[col] = gorm.Expr(col+" + ?", n)
+		}
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	if err := a.Conf.DB.Model(&model.JobProgress{}).Where(
+		"job_id = ? AND silo_definition_id = ?", jobID, siloDefinitionID,
+	).Updates(updates).Error; err != nil {
+		activity.GetLogger(ctx).Error("Error saving job progress", "error", err)
+	}
+}
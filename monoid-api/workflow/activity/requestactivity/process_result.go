@@ -15,6 +15,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/monoid-privacy/monoid/recordstore"
+	"github.com/monoid-privacy/monoid/redaction"
+	"github.com/monoid-privacy/monoid/telemetry"
 	monoidactivity "github.com/monoid-privacy/monoid/workflow/activity"
 	"go.temporal.io/sdk/activity"
 )
@@ -22,6 +25,9 @@ import (
 type ProcessRequestArgs struct {
 	ProtocolRequestStatus []monoidprotocol.MonoidRequestStatus
 	RequestStatusIDs      []string
+
+	// JobID is the job that log entries are written for.
+	JobID string
 }
 
 type ProcessRequestItem struct {
@@ -50,25 +56,33 @@ func copyMap[M map[string]interface{} | monoidprotocol.MonoidRecordData](m M) M
 func (a *RequestActivity) copyTarGzToStorage(
 	ctx context.Context,
 	sourcePath string,
-) (string, error) {
+) (path string, size int64, err error) {
 	wr, fp, err := a.Conf.FileStore.NewWriter(ctx, uuid.NewString(), false)
 
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	defer wr.Close()
+	// Closing the writer flushes the file to the store, so its error
+	// is returned if nothing else failed.
+	defer func() {
+		if closeErr := wr.Close(); closeErr != nil && err == nil {
+			path = ""
+			size = 0
+			err = closeErr
+		}
+	}()
 
 	fileReader, err := os.Open(sourcePath)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	defer fileReader.Close()
 
 	gz, err := gzip.NewReader(fileReader)
 	if err != nil {
-		return "", fmt.Errorf("file must be gzipped tar")
+		return "", 0, fmt.Errorf("file must be gzipped tar")
 	}
 
 	defer gz.Close()
@@ -76,26 +90,29 @@ func (a *RequestActivity) copyTarGzToStorage(
 	tr := tar.NewReader(gz)
 	_, err = tr.Next()
 	if err != nil {
-		return "", fmt.Errorf("file must be gzipped tar")
+		return "", 0, fmt.Errorf("file must be gzipped tar")
 	}
 
 	_, err = fileReader.Seek(0, io.SeekStart)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	_, err = io.Copy(wr, fileReader)
+	size, err = io.Copy(wr, fileReader)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	return fp, nil
+	return fp, size, nil
 }
 
 func (a *RequestActivity) ProcessRequestResults(
 	ctx context.Context,
 	args ProcessRequestArgs,
 ) (ProcessRequestResult, error) {
+	stopHeartbeat := monoidactivity.StartHeartbeat(ctx)
+	defer stopHeartbeat()
+
 	logger := activity.GetLogger(ctx)
 	resultMap := map[string]ProcessRequestItem{}
 	requestStatuses := []*model.RequestStatus{}
@@ -106,6 +123,9 @@ func (a *RequestActivity) ProcessRequestResults(
 		Preload("DataSource").
 		Preload("DataSource.SiloDefinition").
 		Preload("DataSource.SiloDefinition.SiloSpecification").
+		Preload("DataSource.SiloDefinition.SiloSpecificationVersion").
+		Preload("DataSource.Properties").
+		Preload("DataSource.Properties.Categories").
 		Preload("Request").
 		Where("id IN ?", args.RequestStatusIDs).Find(&requestStatuses).Error; err != nil {
 		return ProcessRequestResult{}, err
@@ -182,14 +202,22 @@ func (a *RequestActivity) ProcessRequestResults(
 		return ProcessRequestResult{}, nil
 	}
 
+	jw := a.newJobLog(ctx, args.JobID, siloDef.ID)
+	defer jw.Close()
+
 	if len(handles) > 0 {
-		siloSpec := siloDef.SiloSpecification
+		siloSpec := siloDef.EffectiveSpecification()
 
 		conf := map[string]interface{}{}
 		if err := json.Unmarshal([]byte(siloDef.Config), &conf); err != nil {
 			return ProcessRequestResult{}, err
 		}
 
+		conf, err := a.Conf.ResolveSiloConfig(ctx, conf)
+		if err != nil {
+			return ProcessRequestResult{}, err
+		}
+
 		// Create a temporary directory that can be used by the docker container
 		dir, err := ioutil.TempDir(a.Conf.TempStorePath, "monoid")
 		if err != nil {
@@ -199,8 +227,8 @@ func (a *RequestActivity) ProcessRequestResults(
 		defer os.RemoveAll(dir)
 
 		// Start the docker protocol
-		protocol, err := a.Conf.ProtocolFactory.NewMonoidProtocol(
-			siloSpec.DockerImage, siloSpec.DockerTag, dir,
+		protocol, err := monoidprotocol.NewMonoidProtocol(
+			a.Conf.ProtocolFactory, siloSpec.DockerImage, siloSpec.DockerTag, dir, siloSpec.ConnectorOptions(),
 		)
 		if err != nil {
 			return ProcessRequestResult{}, err
@@ -217,11 +245,8 @@ func (a *RequestActivity) ProcessRequestResults(
 			return ProcessRequestResult{}, err
 		}
 
-		go func() {
-			for l := range logChan {
-				logger.Info("container-log", "log", l.Message)
-			}
-		}()
+		forwardContainerLogs(ctx, jw, logChan)
+		monoidactivity.ForwardSandboxViolations(ctx, protocol, jw)
 
 		var wg sync.WaitGroup
 		var fileWg sync.WaitGroup
@@ -247,10 +272,18 @@ func (a *RequestActivity) ProcessRequestResults(
 		type queryResult struct {
 			resultType model.ResultType
 			data       any
+			records    *recordstore.Writer
+			redactor   *redaction.Redactor
+			err        error
 		}
 
 		queryResults := map[string]*queryResult{}
 
+		// The progress counters for the job, which are guarded by resultMutex
+		// while the files are copied.
+		recordsReceived := int64(0)
+		bytesWritten := int64(0)
+
 		for record := range recordCh {
 			dsm := monoidactivity.NewDataSourceMatcher(
 				record.SchemaName,
@@ -311,11 +344,13 @@ func (a *RequestActivity) ProcessRequestResults(
 
 					f := filepath.Join(dir, *record.File)
 
-					fp, err := a.copyTarGzToStorage(ctx, f)
+					fp, n, err := a.copyTarGzToStorage(ctx, f)
 					if err != nil {
 						logger.Error("Error copying file", err)
 					}
 
+					bytesWritten += n
+
 					queryResults[rs.ID].data = model.QueryResultFileData{
 						FilePath: fp,
 					}
@@ -323,23 +358,35 @@ func (a *RequestActivity) ProcessRequestResults(
 			case monoidprotocol.MonoidRequestStatusDataTypeRECORDS:
 				resultMutex.Lock()
 
-				_, ok := queryResults[rs.ID]
+				qr, ok := queryResults[rs.ID]
 				if !ok {
-					queryResults[rs.ID] = &queryResult{
+					qr = &queryResult{
 						resultType: model.ResultTypeRecordsJSON,
-						data:       []*monoidprotocol.MonoidRecordData{},
+					}
+
+					queryResults[rs.ID] = qr
+
+					// Records are only kept for query requests, and are streamed
+					// straight to the file store rather than held in memory. The
+					// export policies are applied before anything is written.
+					if request.Type == model.UserDataRequestTypeQuery {
+						qr.redactor = redaction.NewRedactor(a.Conf.EncryptionKey, rs.DataSource.Properties)
+						qr.records, qr.err = recordstore.NewWriter(ctx, a.Conf.FileStore, uuid.NewString())
 					}
 				}
 
-				data, ok := queryResults[rs.ID].data.([]*monoidprotocol.MonoidRecordData)
-				if !ok {
+				if qr.resultType != model.ResultTypeRecordsJSON {
 					logger.Warn("Error casting existing data")
 					resultMutex.Unlock()
 					continue
 				}
 
-				copiedData := copyMap(record.Data)
-				queryResults[rs.ID].data = append(data, &copiedData)
+				recordsReceived++
+
+				if qr.records != nil && qr.err == nil {
+					copiedData := copyMap(record.Data)
+					qr.err = qr.records.Write(qr.redactor.Apply(copiedData))
+				}
 
 				resultMutex.Unlock()
 			}
@@ -348,30 +395,81 @@ func (a *RequestActivity) ProcessRequestResults(
 		fileWg.Wait()
 		wg.Wait()
 
+		for _, qr := range queryResults {
+			if qr.records == nil {
+				continue
+			}
+
+			if err := qr.records.Close(); err != nil && qr.err == nil {
+				qr.err = err
+			}
+
+			bytesWritten += qr.records.Size()
+		}
+
+		a.addJobProgress(ctx, args.JobID, siloDef.ID, map[string]int64{
+			"records_received": recordsReceived,
+			"bytes_written":    bytesWritten,
+		})
+
+		telemetry.RecordsProcessed.WithLabelValues(siloDef.ID).Add(float64(recordsReceived))
+		telemetry.BytesProcessed.WithLabelValues(siloDef.ID).Add(float64(bytesWritten))
+
 		if result != 0 {
+			jw.Log(model.LogLevelError, fmt.Sprintf("Container exited with non-zero code (%d)", result))
 			return ProcessRequestResult{}, fmt.Errorf("container exited with non-zero code (%d)", result)
 		}
 
 		// Write the records back to the db
 		for rsID, qr := range queryResults {
 			if request.Type == model.UserDataRequestTypeQuery {
-				records, err := json.Marshal(qr.data)
-				if err != nil {
+				if qr.err != nil {
 					resultMap[rsID] = ProcessRequestItem{Error: &RequestStatusError{
-						Message: err.Error(),
+						Message: qr.err.Error(),
 					}}
 
 					continue
 				}
 
-				r := model.SecretString(records)
-
-				if err = a.Conf.DB.Create(&model.QueryResult{
+				queryResult := model.QueryResult{
 					ID:              uuid.NewString(),
 					RequestStatusID: rsID,
-					Records:         &r,
 					ResultType:      qr.resultType,
-				}).Error; err != nil {
+				}
+
+				if qr.records != nil {
+					path := qr.records.Path()
+					count := qr.records.Count()
+
+					queryResult.RecordsPath = &path
+					queryResult.RecordCount = &count
+					queryResult.Redacted = true
+
+					policies, err := json.Marshal(qr.redactor.Policies())
+					if err != nil {
+						resultMap[rsID] = ProcessRequestItem{Error: &RequestStatusError{
+							Message: err.Error(),
+						}}
+
+						continue
+					}
+
+					queryResult.RedactionPolicies = policies
+				} else {
+					records, err := json.Marshal(qr.data)
+					if err != nil {
+						resultMap[rsID] = ProcessRequestItem{Error: &RequestStatusError{
+							Message: err.Error(),
+						}}
+
+						continue
+					}
+
+					r := model.SecretString(records)
+					queryResult.Records = &r
+				}
+
+				if err = a.Conf.DB.Create(&queryResult).Error; err != nil {
 					resultMap[rsID] = ProcessRequestItem{Error: &RequestStatusError{
 						Message: err.Error(),
 					}}
@@ -384,6 +482,11 @@ func (a *RequestActivity) ProcessRequestResults(
 		}
 	}
 
+	dataSourceIDs := map[string]string{}
+	for _, rs := range requestStatuses {
+		dataSourceIDs[rs.ID] = rs.DataSource.ID
+	}
+
 	results := make([]ProcessRequestItem, len(args.RequestStatusIDs))
 
 	// Add all the results back to the map
@@ -399,6 +502,14 @@ func (a *RequestActivity) ProcessRequestResults(
 
 		res.RequestStatusID = s
 		results[i] = res
+
+		if dsID, ok := dataSourceIDs[s]; ok {
+			if res.Error != nil {
+				jw.LogDataSource(model.LogLevelError, dsID, "Error processing results: "+res.Error.Message)
+			} else {
+				jw.LogDataSource(model.LogLevelInfo, dsID, "Results processed")
+			}
+		}
 	}
 
 	return ProcessRequestResult{ResultItems: results}, nil
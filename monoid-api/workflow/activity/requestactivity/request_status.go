@@ -16,16 +16,21 @@ import (
 // RequestStatusArgs contains the arguments to the RequestStatus activity
 type RequestStatusArgs struct {
 	RequestStatusIDs []string `json:"requestStatusId"`
+
+	// JobID is the job that log entries are written for.
+	JobID string `json:"jobId,omitempty"`
 }
 
 func (a *RequestActivity) processSiloDefStatuses(
 	ctx context.Context,
+	jobID string,
 	statuses []model.RequestStatus,
 ) ([]RequestStatusItem, error) {
 	logger := activity.GetLogger(ctx)
 
 	resultMap := map[string]RequestStatusItem{}
 	dataSourceMap := map[monoidactivity.DataSourceMatcher]string{}
+	dataSourceIDs := map[string]string{}
 
 	if len(statuses) == 0 {
 		return []RequestStatusItem{}, nil
@@ -64,11 +69,17 @@ func (a *RequestActivity) processSiloDefStatuses(
 		dataSourceMap[monoidactivity.NewDataSourceMatcher(
 			rs.DataSource.Name, rs.DataSource.Group,
 		)] = rs.ID
+		dataSourceIDs[rs.ID] = rs.DataSource.ID
 
 		handles = append(handles, handle)
 	}
 
 	if len(handles) != 0 {
+		jw := a.newJobLog(ctx, jobID, siloDef.ID)
+		defer jw.Close()
+
+		a.addJobProgress(ctx, jobID, siloDef.ID, map[string]int64{"poll_count": 1})
+
 		// Create a temporary directory that can be used by the docker container
 		dir, err := ioutil.TempDir(a.Conf.TempStorePath, "monoid")
 		if err != nil {
@@ -77,10 +88,13 @@ func (a *RequestActivity) processSiloDefStatuses(
 
 		defer os.RemoveAll(dir)
 
-		protocol, err := a.Conf.ProtocolFactory.NewMonoidProtocol(
-			siloDef.SiloSpecification.DockerImage,
-			siloDef.SiloSpecification.DockerTag,
+		siloSpec := siloDef.EffectiveSpecification()
+		protocol, err := monoidprotocol.NewMonoidProtocol(
+			a.Conf.ProtocolFactory,
+			siloSpec.DockerImage,
+			siloSpec.DockerTag,
 			dir,
+			siloSpec.ConnectorOptions(),
 		)
 		if err != nil {
 			return nil, err
@@ -97,16 +111,18 @@ func (a *RequestActivity) processSiloDefStatuses(
 			return nil, err
 		}
 
-		go func() {
-			for l := range logChan {
-				logger.Info("container-log", "log", l.Message)
-			}
-		}()
+		forwardContainerLogs(ctx, jw, logChan)
+		monoidactivity.ForwardSandboxViolations(ctx, protocol, jw)
 
 		conf := map[string]interface{}{}
 		if err := json.Unmarshal([]byte(siloDef.Config), &conf); err != nil {
 			return nil, err
 		}
+
+		conf, err = a.Conf.ResolveSiloConfig(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
 		statCh, _, err := protocol.RequestStatus(ctx, conf, monoidprotocol.MonoidRequestsMessage{
 			Handles: handles,
 		})
@@ -120,6 +136,10 @@ func (a *RequestActivity) processSiloDefStatuses(
 			requestID, ok := dataSourceMap[monoidactivity.NewDataSourceMatcher(stat.SchemaName, stat.SchemaGroup)]
 			if !ok {
 				logger.Error("Did not find schema", stat.SchemaName, stat.SchemaGroup)
+			} else {
+				jw.LogDataSource(model.LogLevelInfo, dataSourceIDs[requestID], fmt.Sprintf(
+					"Request has status %s", stat.RequestStatus,
+				))
 			}
 
 			resultMap[requestID] = RequestStatusItem{
@@ -153,12 +173,16 @@ func (a *RequestActivity) RequestStatusActivity(
 	ctx context.Context,
 	args RequestStatusArgs,
 ) (RequestStatusResult, error) {
+	stopHeartbeat := monoidactivity.StartHeartbeat(ctx)
+	defer stopHeartbeat()
+
 	requestStatus := []model.RequestStatus{}
 
 	if err := a.Conf.DB.Model(model.RequestStatus{}).
 		Preload("DataSource").
 		Preload("DataSource.SiloDefinition").
 		Preload("DataSource.SiloDefinition.SiloSpecification").
+		Preload("DataSource.SiloDefinition.SiloSpecificationVersion").
 		Where("id = ?", args.RequestStatusIDs).First(&requestStatus).Error; err != nil {
 		return RequestStatusResult{}, err
 	}
@@ -175,7 +199,7 @@ func (a *RequestActivity) RequestStatusActivity(
 
 	results := []RequestStatusItem{}
 	for _, statuses := range siloMap {
-		res, err := a.processSiloDefStatuses(ctx, statuses)
+		res, err := a.processSiloDefStatuses(ctx, args.JobID, statuses)
 		if err != nil {
 			for _, s := range statuses {
 				results = append(results, RequestStatusItem{
@@ -7,11 +7,13 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/monoid-privacy/monoid/joblog"
 	"github.com/monoid-privacy/monoid/model"
 	monoidactivity "github.com/monoid-privacy/monoid/workflow/activity"
 
 	"github.com/monoid-privacy/monoid/monoidprotocol"
 	"go.temporal.io/sdk/activity"
+	"gorm.io/gorm"
 )
 
 func findSchema(
@@ -74,6 +76,12 @@ type RequestStatusResult struct {
 type StartRequestArgs struct {
 	SiloDefinitionID string `json:"siloDefinitionId"`
 	RequestID        string `json:"requestId"`
+
+	// RequestStatusIDs limits the request to some of the silo's data sources.
+	RequestStatusIDs []string `json:"requestStatusIds,omitempty"`
+
+	// JobID is the job that log entries are written for.
+	JobID string `json:"jobId,omitempty"`
 }
 
 // StartRequestOnDataSource starts the request and returns the status
@@ -83,248 +91,460 @@ func (a *RequestActivity) StartSiloRequestActivity(
 	ctx context.Context,
 	args StartRequestArgs,
 ) (RequestStatusResult, error) {
+	results, err := a.startSiloRequests(ctx, args.SiloDefinitionID, []BatchRequestItem{{
+		RequestID:        args.RequestID,
+		RequestStatusIDs: args.RequestStatusIDs,
+		JobID:            args.JobID,
+	}})
+
+	if err != nil {
+		return RequestStatusResult{}, err
+	}
+
+	return results[args.RequestID], nil
+}
+
+// startSiloRequests starts the requests on the silo, with a single connector
+// invocation for each request type, and returns the status of each request's
+// data sources, keyed by request ID.
+func (a *RequestActivity) startSiloRequests(
+	ctx context.Context,
+	siloDefinitionID string,
+	items []BatchRequestItem,
+) (map[string]RequestStatusResult, error) {
+	stopHeartbeat := monoidactivity.StartHeartbeat(ctx)
+	defer stopHeartbeat()
+
 	var conf map[string]interface{}
 	logger := activity.GetLogger(ctx)
 
 	siloDef := model.SiloDefinition{}
-	request := model.Request{}
+	requests := []model.Request{}
+
+	requestIDs := make([]string, len(items))
+	for i, item := range items {
+		requestIDs[i] = item.RequestID
+	}
 
 	if err := a.Conf.DB.Where(
 		"id = ?",
-		args.SiloDefinitionID,
-	).Preload("DataSources").Preload("DataSources.Properties").Preload("SiloSpecification").Preload(
+		siloDefinitionID,
+	).Preload("DataSources").Preload("DataSources.Properties").Preload("SiloSpecification").
+		Preload("SiloSpecificationVersion").Preload(
 		"DataSources.RequestStatuses",
-		"request_id = ?",
-		args.RequestID,
+		"request_id IN ?",
+		requestIDs,
 	).First(&siloDef).Error; err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
 	}
 
-	if siloDef.SiloSpecification.Manual {
-		statuses := make([]RequestStatusItem, 0, len(siloDef.DataSources))
+	// Each request is logged on its own job.
+	jobLogs := map[string]*joblog.Writer{}
 
-		for _, ds := range siloDef.DataSources {
-			if len(ds.RequestStatuses) != 0 {
-				statuses = append(statuses, RequestStatusItem{
-					FullyComplete:   ds.RequestStatuses[0].Status == model.RequestStatusTypeExecuted,
-					RequestStatusID: ds.RequestStatuses[0].ID,
-					Manual:          true,
-				})
+	for _, item := range items {
+		jw := a.newJobLog(ctx, item.JobID, siloDef.ID)
+		defer jw.Close()
+
+		jobLogs[item.RequestID] = jw
+		a.startJobProgress(ctx, item.JobID, siloDef.ID)
+	}
+
+	if siloDef.SiloSpecification.Manual {
+		results := make(map[string]RequestStatusResult, len(items))
+
+		for _, item := range items {
+			jobLogs[item.RequestID].Log(model.LogLevelInfo, fmt.Sprintf(
+				"%s is a manual silo, waiting for it to be marked as complete", siloDef.Name,
+			))
+
+			statuses := make([]RequestStatusItem, 0, len(siloDef.DataSources))
+
+			for _, ds := range siloDef.DataSources {
+				if reqStatus := item.requestStatus(ds); reqStatus != nil {
+					statuses = append(statuses, RequestStatusItem{
+						FullyComplete:   reqStatus.Status == model.RequestStatusTypeExecuted,
+						RequestStatusID: reqStatus.ID,
+						Manual:          true,
+					})
+				}
 			}
+
+			results[item.RequestID] = RequestStatusResult{ResultItems: statuses}
 		}
 
-		return RequestStatusResult{ResultItems: statuses}, nil
+		return results, nil
 	}
 
 	if err := a.Conf.DB.Where(
-		"id = ?",
-		args.RequestID,
-	).Preload("PrimaryKeyValues").First(&request).Error; err != nil {
-		return RequestStatusResult{}, err
+		"id IN ?",
+		requestIDs,
+	).Preload("PrimaryKeyValues").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	requestMap := make(map[string]*model.Request, len(requests))
+	for i := range requests {
+		requestMap[requests[i].ID] = &requests[i]
 	}
 
-	primaryKeyMap := make(map[string]*model.PrimaryKeyValue)
+	for _, id := range requestIDs {
+		request, ok := requestMap[id]
+		if !ok {
+			return nil, fmt.Errorf("request %s not found: %w", id, gorm.ErrRecordNotFound)
+		}
 
-	for _, primaryKeyValue := range request.PrimaryKeyValues {
-		primaryKeyValue := primaryKeyValue
-		primaryKeyMap[primaryKeyValue.UserPrimaryKeyID] = &primaryKeyValue
+		if request.Type != model.UserDataRequestTypeDelete && request.Type != model.UserDataRequestTypeQuery {
+			return nil, fmt.Errorf(
+				"unknown request type %s",
+				string(request.Type),
+			)
+		}
 	}
 
 	// Create a temporary directory that can be used by the docker container
 	dir, err := ioutil.TempDir(a.Conf.TempStorePath, "monoid")
 	if err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
 	}
 
 	defer os.RemoveAll(dir)
 
-	protocol, err := a.Conf.ProtocolFactory.NewMonoidProtocol(
-		siloDef.SiloSpecification.DockerImage,
-		siloDef.SiloSpecification.DockerTag,
+	siloSpec := siloDef.EffectiveSpecification()
+	protocol, err := monoidprotocol.NewMonoidProtocol(
+		a.Conf.ProtocolFactory,
+		siloSpec.DockerImage,
+		siloSpec.DockerTag,
 		dir,
+		siloSpec.ConnectorOptions(),
 	)
 	if err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
 	}
 
 	defer protocol.Teardown(ctx)
 
 	if err := protocol.InitConn(ctx); err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
 	}
 
 	logChan, err := protocol.AttachLogs(ctx)
 	if err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
+	}
+
+	// The container's logs can mention the identifiers of any of the requests
+	// in a batch, so they're only written to a job's log if it's the only
+	// request.
+	if len(items) == 1 {
+		forwardContainerLogs(ctx, jobLogs[items[0].RequestID], logChan)
+	} else {
+		forwardContainerLogs(ctx, nil, logChan)
 	}
 
-	go func() {
-		for l := range logChan {
-			logger.Info("container-log", "log", l.Message)
+	jws := make([]*joblog.Writer, 0, len(jobLogs))
+	for _, jw := range jobLogs {
+		jws = append(jws, jw)
+	}
+
+	monoidactivity.ForwardSandboxViolations(ctx, protocol, jws...)
+
+	for _, item := range items {
+		msg := fmt.Sprintf("Starting %s request on %s", requestMap[item.RequestID].Type, siloDef.Name)
+		if len(items) > 1 {
+			msg += fmt.Sprintf(" in a batch of %d requests", len(items))
 		}
-	}()
+
+		jobLogs[item.RequestID].Log(model.LogLevelInfo, msg)
+	}
 
 	if err := json.Unmarshal([]byte(siloDef.Config), &conf); err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
+	}
+
+	conf, err = a.Conf.ResolveSiloConfig(ctx, conf)
+	if err != nil {
+		return nil, err
 	}
 
 	sch, err := protocol.Schema(context.Background(), conf)
 
 	if err != nil {
-		return RequestStatusResult{}, err
+		return nil, err
 	}
 
-	identifiers := []monoidprotocol.MonoidQueryIdentifier{}
+	identifiers := map[model.UserDataRequestType][]monoidprotocol.MonoidQueryIdentifier{}
 	results := map[string]*RequestStatusItem{}
-	dsMap := map[monoidactivity.DataSourceMatcher]*model.DataSource{}
+	// Map of the data sources that are run to their request status ID
+	dsMap := map[requestDataSourceMatcher]string{}
 
 	// Map of request status ID to the corresponding data source
 	dsRequestIDMap := map[string]*model.DataSource{}
 
-	// Collect the query identifiers for each data source. If there are no
-	// query identifiers for the data source, update the result to fully
-	// complete
-L:
-	for _, ds := range siloDef.DataSources {
-		if len(ds.RequestStatuses) == 0 {
-			continue
-		}
+	// Map of request status ID to the ID of its request
+	statusRequestMap := map[string]string{}
 
-		requestStatus := ds.RequestStatuses[0]
-		dsRequestIDMap[requestStatus.ID] = ds
+	for _, item := range items {
+		request := requestMap[item.RequestID]
 
-		if requestStatus.Status == model.RequestStatusTypeExecuted {
-			results[requestStatus.ID] = &RequestStatusItem{FullyComplete: true}
-			continue
+		primaryKeyMap := make(map[string]*model.PrimaryKeyValue)
+
+		for _, primaryKeyValue := range request.PrimaryKeyValues {
+			primaryKeyValue := primaryKeyValue
+			primaryKeyMap[primaryKeyValue.UserPrimaryKeyID] = &primaryKeyValue
 		}
 
-		// Verify that the schema exists in the associated data source
-		schema, err := findSchema(ds, sch)
-		if err != nil {
-			logger.Error("Error finding schema", ds.Name, ds.Group)
-			results[requestStatus.ID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
-			continue
+		// The identifiers are only tagged with the request in batches, so
+		// connectors that don't support batching can still run single
+		// requests.
+		var requestID *string
+		if len(items) > 1 {
+			requestID = &request.ID
 		}
 
-		// Get the primary key from the current
-		pkProperties := []*model.Property{}
+		// Collect the query identifiers for each data source. If there are no
+		// query identifiers for the data source, update the result to fully
+		// complete
+	L:
+		for _, ds := range siloDef.DataSources {
+			requestStatus := item.requestStatus(ds)
+			if requestStatus == nil {
+				continue
+			}
+
+			dsRequestIDMap[requestStatus.ID] = ds
+			statusRequestMap[requestStatus.ID] = request.ID
 
-		for _, prop := range ds.Properties {
-			if prop.UserPrimaryKeyID != nil {
-				pkProperties = append(pkProperties, prop)
+			if requestStatus.Status == model.RequestStatusTypeExecuted {
+				results[requestStatus.ID] = &RequestStatusItem{FullyComplete: true}
+				continue
+			}
+
+			// Verify that the schema exists in the associated data source
+			schema, err := findSchema(ds, sch)
+			if err != nil {
+				logger.Error("Error finding schema", ds.Name, ds.Group)
+				jobLogs[request.ID].LogDataSource(model.LogLevelError, ds.ID, "Error finding schema: "+err.Error())
+				results[requestStatus.ID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
+				continue
 			}
+
+			// Get the primary key from the current
+			pkProperties := []*model.Property{}
+
+			for _, prop := range ds.Properties {
+				if prop.UserPrimaryKeyID != nil {
+					pkProperties = append(pkProperties, prop)
+				}
+			}
+
+			if len(pkProperties) == 0 {
+				logger.Warn("Data source has no properties linked to a primary key", "dataSource", ds.ID)
+				jobLogs[request.ID].LogDataSource(
+					model.LogLevelWarn, ds.ID, "Skipping data source, no properties are linked to a user identifier",
+				)
+				results[requestStatus.ID] = &RequestStatusItem{FullyComplete: true}
+				continue
+			}
+
+			// Get the list of identifiers to use with the action
+			dsIdentifiers := []monoidprotocol.MonoidQueryIdentifier{}
+
+			for _, p := range pkProperties {
+				pkVal, ok := primaryKeyMap[*p.UserPrimaryKeyID]
+				if !ok {
+					results[requestStatus.ID] = &RequestStatusItem{Error: &RequestStatusError{
+						Message: "missing value for user identifier",
+					}}
+					continue L
+				}
+
+				dsIdentifiers = append(dsIdentifiers, monoidprotocol.MonoidQueryIdentifier{
+					SchemaName:      ds.Name,
+					SchemaGroup:     ds.Group,
+					JsonSchema:      monoidprotocol.MonoidQueryIdentifierJsonSchema(schema.JsonSchema),
+					Identifier:      p.Name,
+					IdentifierQuery: pkVal.Value,
+					RequestId:       requestID,
+				})
+			}
+
+			identifiers[request.Type] = append(identifiers[request.Type], dsIdentifiers...)
+			dsMap[requestDataSourceMatcher{
+				requestID:         request.ID,
+				DataSourceMatcher: monoidactivity.NewDataSourceMatcher(ds.Name, ds.Group),
+			}] = requestStatus.ID
 		}
+	}
 
-		if len(pkProperties) == 0 {
-			results[requestStatus.ID] = &RequestStatusItem{FullyComplete: true}
+	// Run the delete/query requests to get handles for any data sources that
+	// aren't already complete.
+	for _, requestType := range []model.UserDataRequestType{
+		model.UserDataRequestTypeDelete,
+		model.UserDataRequestTypeQuery,
+	} {
+		if len(identifiers[requestType]) == 0 {
 			continue
 		}
 
-		// Get the list of identifiers to use with the action
-		for _, p := range pkProperties {
-			pkVal, ok := primaryKeyMap[*p.UserPrimaryKeyID]
-			if !ok {
-				results[requestStatus.ID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
-				continue L
-			}
-
-			identifiers = append(identifiers, monoidprotocol.MonoidQueryIdentifier{
-				SchemaName:      ds.Name,
-				SchemaGroup:     ds.Group,
-				JsonSchema:      monoidprotocol.MonoidQueryIdentifierJsonSchema(schema.JsonSchema),
-				Identifier:      p.Name,
-				IdentifierQuery: pkVal.Value,
-			})
+		if err := a.runSiloRequest(
+			ctx,
+			protocol,
+			conf,
+			requestType,
+			identifiers[requestType],
+			dsMap,
+			results,
+			jobLogs,
+			len(items) == 1,
+		); err != nil {
+			return nil, err
 		}
+	}
 
-		dsMap[monoidactivity.NewDataSourceMatcher(ds.Name, ds.Group)] = ds
+	resultMap := make(map[string]RequestStatusResult, len(items))
+	for _, item := range items {
+		resultMap[item.RequestID] = RequestStatusResult{
+			ResultItems: make([]RequestStatusItem, 0, len(siloDef.DataSources)),
+		}
 	}
 
-	// Run the delete/query request to get handles for any data sources that
-	// aren't already complete.
-	if len(identifiers) > 0 {
-		var reqChan chan monoidprotocol.MonoidRequestResult
-		var statusChan chan int64
-
-		// run the delete or query
-		switch request.Type {
-		case model.UserDataRequestTypeDelete:
-			reqChan, statusChan, err = protocol.Delete(ctx, conf, monoidprotocol.MonoidQuery{
-				Identifiers: identifiers,
-			})
-		case model.UserDataRequestTypeQuery:
-			reqChan, statusChan, err = protocol.Query(ctx, conf, monoidprotocol.MonoidQuery{
-				Identifiers: identifiers,
-			})
-		default:
-			return RequestStatusResult{}, fmt.Errorf(
-				"unknown request type %s",
-				string(request.Type),
-			)
+	for reqStatusID, ds := range dsRequestIDMap {
+		requestID := statusRequestMap[reqStatusID]
+		jw := jobLogs[requestID]
+
+		res, ok := results[reqStatusID]
+		if !ok {
+			res = &RequestStatusItem{Error: &RequestStatusError{Message: "No handle provided for data source."}}
 		}
 
-		if err != nil {
-			return RequestStatusResult{}, err
+		res.SchemaGroup = ds.Group
+		res.SchemaName = ds.Name
+		res.RequestStatusID = reqStatusID
+
+		r := resultMap[requestID]
+		r.ResultItems = append(r.ResultItems, *res)
+		resultMap[requestID] = r
+
+		if res.Error != nil {
+			jw.LogDataSource(model.LogLevelError, ds.ID, "Error starting request: "+res.Error.Message)
+		} else if res.RequestStatus != nil {
+			jw.LogDataSource(model.LogLevelInfo, ds.ID, fmt.Sprintf(
+				"Request started with status %s", res.RequestStatus.RequestStatus,
+			))
 		}
+	}
 
-		handleUpdates := map[string]monoidprotocol.MonoidRequestHandle{}
+	return resultMap, nil
+}
 
-		// Get the data source and update the result for the request status.
-		for res := range reqChan {
-			ds, ok := dsMap[monoidactivity.NewDataSourceMatcher(
-				res.Handle.SchemaName,
-				res.Handle.SchemaGroup,
-			)]
+// requestDataSourceMatcher matches a result from the connector to the data
+// source of the request it's for.
+type requestDataSourceMatcher struct {
+	monoidactivity.DataSourceMatcher
+	requestID string
+}
 
-			if !ok {
-				logger.Error("Could not find data source", res.Handle.SchemaName, res.Handle.SchemaGroup)
-				continue
-			}
+// runSiloRequest runs the delete or query with the identifiers, and updates the
+// results of the data sources that handles are returned for. If single is true,
+// the handles that aren't tagged with a request are for the only request.
+func (a *RequestActivity) runSiloRequest(
+	ctx context.Context,
+	protocol monoidprotocol.MonoidProtocol,
+	conf map[string]interface{},
+	requestType model.UserDataRequestType,
+	identifiers []monoidprotocol.MonoidQueryIdentifier,
+	dsMap map[requestDataSourceMatcher]string,
+	results map[string]*RequestStatusItem,
+	jobLogs map[string]*joblog.Writer,
+	single bool,
+) error {
+	logger := activity.GetLogger(ctx)
 
-			stat := res.Status
+	var reqChan chan monoidprotocol.MonoidRequestResult
+	var statusChan chan int64
+	var err error
+
+	// run the delete or query
+	switch requestType {
+	case model.UserDataRequestTypeDelete:
+		reqChan, statusChan, err = protocol.Delete(ctx, conf, monoidprotocol.MonoidQuery{
+			Identifiers: identifiers,
+		})
+	case model.UserDataRequestTypeQuery:
+		reqChan, statusChan, err = protocol.Query(ctx, conf, monoidprotocol.MonoidQuery{
+			Identifiers: identifiers,
+		})
+	}
 
-			results[ds.RequestStatuses[0].ID] = &RequestStatusItem{
-				RequestStatus: &stat,
-			}
+	if err != nil {
+		return err
+	}
 
-			handleUpdates[ds.RequestStatuses[0].ID] = res.Handle
+	// The request that untagged handles are for.
+	singleRequestID := ""
+	if single {
+		for m := range dsMap {
+			singleRequestID = m.requestID
+			break
 		}
+	}
 
-		// If the container fails, we fail the entire activity, since the results are not to be trusted
-		status := <-statusChan
-		if status != 0 {
-			return RequestStatusResult{}, fmt.Errorf("container exited with non-zero code (%d)", status)
+	handleUpdates := map[string]monoidprotocol.MonoidRequestHandle{}
+
+	// Get the data source and update the result for the request status.
+	for res := range reqChan {
+		requestID := singleRequestID
+		if res.Handle.RequestId != nil {
+			requestID = *res.Handle.RequestId
 		}
 
-		// Update the handles for the resulting statuses
-		for reqStatID, reqHandle := range handleUpdates {
-			handleJSON, err := json.Marshal(reqHandle)
-			if err != nil {
-				results[reqStatID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
-				continue
-			}
+		reqStatusID, ok := dsMap[requestDataSourceMatcher{
+			requestID: requestID,
+			DataSourceMatcher: monoidactivity.NewDataSourceMatcher(
+				res.Handle.SchemaName,
+				res.Handle.SchemaGroup,
+			),
+		}]
 
-			if err := a.Conf.DB.Model(&model.RequestStatus{ID: reqStatID}).Update(
-				"request_handle", model.SecretString(handleJSON),
-			).Error; err != nil {
-				results[reqStatID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
-				continue
-			}
+		if !ok {
+			logger.Error("Could not find data source", res.Handle.SchemaName, res.Handle.SchemaGroup, requestID)
+			continue
 		}
+
+		stat := res.Status
+
+		results[reqStatusID] = &RequestStatusItem{
+			RequestStatus: &stat,
+		}
+
+		handleUpdates[reqStatusID] = res.Handle
 	}
 
-	resultArr := make([]RequestStatusItem, 0, len(siloDef.DataSources))
-	for requestID, ds := range dsRequestIDMap {
-		res, ok := results[requestID]
-		if !ok {
-			res = &RequestStatusItem{Error: &RequestStatusError{Message: "No handle provided for data source."}}
+	// If the container fails, we fail the entire activity, since the results are not to be trusted
+	status := <-statusChan
+	if status != 0 {
+		for _, jw := range jobLogs {
+			jw.Log(model.LogLevelError, fmt.Sprintf("Container exited with non-zero code (%d)", status))
 		}
 
-		res.SchemaGroup = ds.Group
-		res.SchemaName = ds.Name
-		res.RequestStatusID = requestID
-		resultArr = append(resultArr, *res)
+		return fmt.Errorf("container exited with non-zero code (%d)", status)
+	}
+
+	// Update the handles for the resulting statuses
+	for reqStatID, reqHandle := range handleUpdates {
+		handleJSON, err := json.Marshal(reqHandle)
+		if err != nil {
+			results[reqStatID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
+			continue
+		}
+
+		if err := a.Conf.DB.Model(&model.RequestStatus{ID: reqStatID}).Update(
+			"request_handle", model.SecretString(handleJSON),
+		).Error; err != nil {
+			results[reqStatID] = &RequestStatusItem{Error: &RequestStatusError{Message: err.Error()}}
+			continue
+		}
 	}
 
-	return RequestStatusResult{ResultItems: resultArr}, nil
+	return nil
 }
@@ -0,0 +1,374 @@
+package requestactivity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	monoidactivity "github.com/monoid-privacy/monoid/workflow/activity"
+	"go.temporal.io/sdk/activity"
+)
+
+// verifyPollInterval is how often the status of a verification query that
+// is still in progress is checked.
+const verifyPollInterval = 30 * time.Second
+
+// VerifyDeletionArgs contains the arguments to the VerifyDeletionActivity.
+type VerifyDeletionArgs struct {
+	SiloDefinitionID string   `json:"siloDefinitionId"`
+	RequestID        string   `json:"requestId"`
+	RequestStatusIDs []string `json:"requestStatusIds"`
+
+	// JobID is the job that log entries are written for.
+	JobID string `json:"jobId,omitempty"`
+}
+
+type VerifyDeletionItem struct {
+	RequestStatusID string
+
+	// ResidualRecordCount is the number of records the query returned, and
+	// is nil if the query couldn't be run.
+	ResidualRecordCount *int
+	Error               *RequestStatusError
+}
+
+// Verified returns true if the query ran and returned no records.
+func (v *VerifyDeletionItem) Verified() bool {
+	return v.Error == nil && v.ResidualRecordCount != nil && *v.ResidualRecordCount == 0
+}
+
+type VerifyDeletionResult struct {
+	ResultItems []VerifyDeletionItem
+}
+
+// VerifyDeletionActivity re-runs the request's query against data sources that
+// have completed a deletion, and records the number of records that are still
+// returned for the user on each request status.
+func (a *RequestActivity) VerifyDeletionActivity(
+	ctx context.Context,
+	args VerifyDeletionArgs,
+) (VerifyDeletionResult, error) {
+	stopHeartbeat := monoidactivity.StartHeartbeat(ctx)
+	defer stopHeartbeat()
+
+	siloDef := model.SiloDefinition{}
+	request := model.Request{}
+
+	if err := a.Conf.DB.Where(
+		"id = ?",
+		args.SiloDefinitionID,
+	).Preload("DataSources").Preload("DataSources.Properties").Preload("SiloSpecification").
+		Preload("SiloSpecificationVersion").Preload(
+		"DataSources.RequestStatuses",
+		"id IN ?",
+		args.RequestStatusIDs,
+	).First(&siloDef).Error; err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	if err := a.Conf.DB.Where(
+		"id = ?",
+		args.RequestID,
+	).Preload("PrimaryKeyValues").First(&request).Error; err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	jw := a.newJobLog(ctx, args.JobID, siloDef.ID)
+	defer jw.Close()
+
+	if siloDef.SiloSpecification.Manual {
+		return VerifyDeletionResult{}, fmt.Errorf("manual silos can't be verified")
+	}
+
+	jw.Log(model.LogLevelInfo, fmt.Sprintf("Verifying deletion on %s", siloDef.Name))
+
+	primaryKeyMap := map[string]string{}
+	for _, pkv := range request.PrimaryKeyValues {
+		primaryKeyMap[pkv.UserPrimaryKeyID] = pkv.Value
+	}
+
+	// Create a temporary directory that can be used by the docker container
+	dir, err := ioutil.TempDir(a.Conf.TempStorePath, "monoid")
+	if err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	siloSpec := siloDef.EffectiveSpecification()
+	protocol, err := monoidprotocol.NewMonoidProtocol(
+		a.Conf.ProtocolFactory,
+		siloSpec.DockerImage,
+		siloSpec.DockerTag,
+		dir,
+		siloSpec.ConnectorOptions(),
+	)
+	if err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	defer protocol.Teardown(ctx)
+
+	if err := protocol.InitConn(ctx); err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	logChan, err := protocol.AttachLogs(ctx)
+	if err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	forwardContainerLogs(ctx, jw, logChan)
+	monoidactivity.ForwardSandboxViolations(ctx, protocol, jw)
+
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(siloDef.Config), &conf); err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	conf, err = a.Conf.ResolveSiloConfig(ctx, conf)
+	if err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	sch, err := protocol.Schema(ctx, conf)
+	if err != nil {
+		return VerifyDeletionResult{}, err
+	}
+
+	results := map[string]*VerifyDeletionItem{}
+	dsIDs := map[string]string{}
+	dsMap := map[monoidactivity.DataSourceMatcher]string{}
+	identifiers := []monoidprotocol.MonoidQueryIdentifier{}
+
+L:
+	for _, ds := range siloDef.DataSources {
+		if len(ds.RequestStatuses) == 0 {
+			continue
+		}
+
+		rsID := ds.RequestStatuses[0].ID
+		results[rsID] = &VerifyDeletionItem{RequestStatusID: rsID}
+		dsIDs[rsID] = ds.ID
+
+		schema, err := findSchema(ds, sch)
+		if err != nil {
+			results[rsID].Error = &RequestStatusError{Message: err.Error()}
+			continue
+		}
+
+		dsIdentifiers := []monoidprotocol.MonoidQueryIdentifier{}
+
+		for _, p := range ds.Properties {
+			if p.UserPrimaryKeyID == nil {
+				continue
+			}
+
+			value, ok := primaryKeyMap[*p.UserPrimaryKeyID]
+			if !ok {
+				results[rsID].Error = &RequestStatusError{Message: "missing identifier value for " + p.Name}
+				continue L
+			}
+
+			dsIdentifiers = append(dsIdentifiers, monoidprotocol.MonoidQueryIdentifier{
+				SchemaName:      ds.Name,
+				SchemaGroup:     ds.Group,
+				JsonSchema:      monoidprotocol.MonoidQueryIdentifierJsonSchema(schema.JsonSchema),
+				Identifier:      p.Name,
+				IdentifierQuery: value,
+			})
+		}
+
+		if len(dsIdentifiers) == 0 {
+			results[rsID].Error = &RequestStatusError{Message: "data source has no identifiers to query"}
+			continue
+		}
+
+		identifiers = append(identifiers, dsIdentifiers...)
+		dsMap[monoidactivity.NewDataSourceMatcher(ds.Name, ds.Group)] = rsID
+	}
+
+	if len(identifiers) > 0 {
+		counts, err := a.countRecords(ctx, protocol, conf, identifiers, dsMap)
+		if err != nil {
+			return VerifyDeletionResult{}, err
+		}
+
+		for rsID, res := range counts {
+			results[rsID].ResidualRecordCount = res.ResidualRecordCount
+			results[rsID].Error = res.Error
+		}
+	}
+
+	now := time.Now()
+	items := make([]VerifyDeletionItem, 0, len(results))
+
+	for rsID, res := range results {
+		if res.Error == nil && res.ResidualRecordCount == nil {
+			res.Error = &RequestStatusError{Message: "no result returned for data source"}
+		}
+
+		dsID := dsIDs[rsID]
+
+		switch {
+		case res.Error != nil:
+			jw.LogDataSource(model.LogLevelError, dsID, "Error verifying deletion: "+res.Error.Message)
+		case *res.ResidualRecordCount > 0:
+			jw.LogDataSource(model.LogLevelWarn, dsID, fmt.Sprintf(
+				"Deletion not verified, %d records remain", *res.ResidualRecordCount,
+			))
+		default:
+			jw.LogDataSource(model.LogLevelInfo, dsID, "Deletion verified")
+		}
+
+		updates := map[string]interface{}{
+			"residual_record_count": res.ResidualRecordCount,
+			"verified_at":           now,
+			"verification_error":    nil,
+		}
+
+		if res.Error != nil {
+			updates["verification_error"] = res.Error.Message
+		}
+
+		if err := a.Conf.DB.Model(&model.RequestStatus{ID: rsID}).Updates(updates).Error; err != nil {
+			return VerifyDeletionResult{}, err
+		}
+
+		items = append(items, *res)
+	}
+
+	return VerifyDeletionResult{ResultItems: items}, nil
+}
+
+// countRecords runs the query, waits for it to complete, and counts the records
+// returned for each data source in dsMap.
+func (a *RequestActivity) countRecords(
+	ctx context.Context,
+	protocol monoidprotocol.MonoidProtocol,
+	conf map[string]interface{},
+	identifiers []monoidprotocol.MonoidQueryIdentifier,
+	dsMap map[monoidactivity.DataSourceMatcher]string,
+) (map[string]*VerifyDeletionItem, error) {
+	reqChan, statusChan, err := protocol.Query(ctx, conf, monoidprotocol.MonoidQuery{
+		Identifiers: identifiers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	handles := map[monoidactivity.DataSourceMatcher]monoidprotocol.MonoidRequestHandle{}
+	statuses := map[monoidactivity.DataSourceMatcher]monoidprotocol.MonoidRequestStatus{}
+
+	for res := range reqChan {
+		dsm := monoidactivity.NewDataSourceMatcher(res.Handle.SchemaName, res.Handle.SchemaGroup)
+		if _, ok := dsMap[dsm]; !ok {
+			continue
+		}
+
+		handles[dsm] = res.Handle
+		statuses[dsm] = res.Status
+	}
+
+	if status := <-statusChan; status != 0 {
+		return nil, fmt.Errorf("container exited with non-zero code (%d)", status)
+	}
+
+	// Wait for any queries that are still running.
+	for {
+		pending := []monoidprotocol.MonoidRequestHandle{}
+		for dsm, s := range statuses {
+			if s.RequestStatus == monoidprotocol.MonoidRequestStatusRequestStatusPROGRESS {
+				pending = append(pending, handles[dsm])
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		activity.RecordHeartbeat(ctx, len(pending))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(verifyPollInterval):
+		}
+
+		statusCh, completeCh, err := protocol.RequestStatus(ctx, conf, monoidprotocol.MonoidRequestsMessage{
+			Handles: pending,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for s := range statusCh {
+			dsm := monoidactivity.NewDataSourceMatcher(s.SchemaName, s.SchemaGroup)
+			if _, ok := statuses[dsm]; ok {
+				statuses[dsm] = s
+			}
+		}
+
+		if status := <-completeCh; status != 0 {
+			return nil, fmt.Errorf("container exited with non-zero code (%d)", status)
+		}
+	}
+
+	results := map[string]*VerifyDeletionItem{}
+	resultHandles := []monoidprotocol.MonoidRequestHandle{}
+	zero := 0
+
+	for dsm, s := range statuses {
+		rsID := dsMap[dsm]
+
+		switch {
+		case s.RequestStatus == monoidprotocol.MonoidRequestStatusRequestStatusFAILED:
+			results[rsID] = &VerifyDeletionItem{Error: &RequestStatusError{Message: "verification query failed"}}
+		case s.DataType == nil || *s.DataType == monoidprotocol.MonoidRequestStatusDataTypeNONE:
+			results[rsID] = &VerifyDeletionItem{ResidualRecordCount: &zero}
+		default:
+			resultHandles = append(resultHandles, handles[dsm])
+		}
+	}
+
+	if len(resultHandles) == 0 {
+		return results, nil
+	}
+
+	recordCh, completeCh, err := protocol.RequestResults(ctx, conf, monoidprotocol.MonoidRequestsMessage{
+		Handles: resultHandles,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, h := range resultHandles {
+		counts[dsMap[monoidactivity.NewDataSourceMatcher(h.SchemaName, h.SchemaGroup)]] = 0
+	}
+
+	for record := range recordCh {
+		rsID, ok := dsMap[monoidactivity.NewDataSourceMatcher(record.SchemaName, record.SchemaGroup)]
+		if !ok {
+			continue
+		}
+
+		counts[rsID]++
+	}
+
+	if status := <-completeCh; status != 0 {
+		return nil, fmt.Errorf("container exited with non-zero code (%d)", status)
+	}
+
+	for rsID, count := range counts {
+		count := count
+		results[rsID] = &VerifyDeletionItem{ResidualRecordCount: &count}
+	}
+
+	return results, nil
+}
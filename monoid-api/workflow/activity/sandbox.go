@@ -0,0 +1,37 @@
+package activity
+
+import (
+	"context"
+
+	"github.com/monoid-privacy/monoid/joblog"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"go.temporal.io/sdk/activity"
+)
+
+// ForwardSandboxViolations writes the violations of the connector's run profile
+// to the job logs as warnings, if the protocol reports them.
+func ForwardSandboxViolations(ctx context.Context, mp monoidprotocol.MonoidProtocol, jws ...*joblog.Writer) {
+	sp, ok := mp.(monoidprotocol.SandboxedProtocol)
+	if !ok {
+		return
+	}
+
+	logger := activity.GetLogger(ctx)
+
+	violations, err := sp.AttachViolations(ctx)
+	if err != nil {
+		logger.Error("Error attaching sandbox violations", "error", err)
+		return
+	}
+
+	go func() {
+		for v := range violations {
+			logger.Warn("Sandbox violation", "message", v.Message)
+
+			for _, jw := range jws {
+				jw.Log(model.LogLevelWarn, "Sandbox violation: "+v.Message)
+			}
+		}
+	}()
+}
@@ -0,0 +1,153 @@
+package activity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/monoid-privacy/monoid/joblog"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"go.temporal.io/sdk/activity"
+)
+
+type FindSilosToUpgradeArgs struct {
+	WorkspaceID string
+	SiloSpecID  string
+}
+
+// SilosToUpgrade are the silos that are moved to a version of their
+// specification.
+type SilosToUpgrade struct {
+	VersionID         string
+	SiloDefinitionIDs []string
+}
+
+// FindSilosToUpgrade returns the workspace's silos of the specification that
+// aren't pinned, and aren't on the specification's current version.
+func (a *Activity) FindSilosToUpgrade(ctx context.Context, args FindSilosToUpgradeArgs) (SilosToUpgrade, error) {
+	spec := model.SiloSpecification{}
+	if err := a.Conf.DB.Where("id = ?", args.SiloSpecID).First(&spec).Error; err != nil {
+		return SilosToUpgrade{}, err
+	}
+
+	version, err := model.RecordSiloSpecificationVersion(a.Conf.DB, &spec)
+	if err != nil {
+		return SilosToUpgrade{}, err
+	}
+
+	ids := []string{}
+	if err := a.Conf.DB.Model(&model.SiloDefinition{}).Where(
+		"workspace_id = ? AND silo_specification_id = ? AND NOT version_pinned",
+		args.WorkspaceID,
+		args.SiloSpecID,
+	).Where(
+		"silo_specification_version_id IS NULL OR silo_specification_version_id != ?",
+		version.ID,
+	).Pluck("id", &ids).Error; err != nil {
+		return SilosToUpgrade{}, err
+	}
+
+	return SilosToUpgrade{
+		VersionID:         version.ID,
+		SiloDefinitionIDs: ids,
+	}, nil
+}
+
+type UpgradeSiloArgs struct {
+	JobID            string
+	SiloDefinitionID string
+	VersionID        string
+}
+
+// UpgradeSiloDefinition moves the silo to the version, after checking that its
+// config is valid for the version's schema and that the version's connector
+// validates it. The result is written to the job's log, and false is returned
+// if the silo couldn't be upgraded.
+func (a *Activity) UpgradeSiloDefinition(ctx context.Context, args UpgradeSiloArgs) (bool, error) {
+	logger := activity.GetLogger(ctx)
+
+	silo := model.SiloDefinition{}
+	if err := a.Conf.DB.Where("id = ?", args.SiloDefinitionID).Preload(
+		"SiloSpecification",
+	).First(&silo).Error; err != nil {
+		return false, err
+	}
+
+	version := model.SiloSpecificationVersion{}
+	if err := a.Conf.DB.Where("id = ?", args.VersionID).First(&version).Error; err != nil {
+		return false, err
+	}
+
+	jw, err := joblog.NewWriter(context.Background(), a.Conf.DB, a.Conf.FileStore, args.JobID)
+	if err != nil {
+		logger.Error("Error opening log writer", "error", err)
+	}
+
+	defer jw.Close()
+	jw.SetSiloDefinitionID(silo.ID)
+
+	fail := func(message string) (bool, error) {
+		jw.Log(model.LogLevelError, fmt.Sprintf("Couldn't upgrade %s: %s", silo.Name, message))
+		return false, nil
+	}
+
+	if silo.VersionPinned {
+		return fail("the silo is pinned to its version.")
+	}
+
+	currentID := silo.SiloSpecificationVersionID
+	if currentID == nil {
+		current, err := model.RecordSiloSpecificationVersion(a.Conf.DB, &silo.SiloSpecification)
+		if err != nil {
+			return false, err
+		}
+
+		currentID = &current.ID
+	}
+
+	if *currentID == version.ID {
+		jw.Log(model.LogLevelInfo, fmt.Sprintf("%s is already on version %d", silo.Name, version.Version))
+		return true, nil
+	}
+
+	conf, err := silo.Config.ValueBytes()
+	if err != nil {
+		return false, err
+	}
+
+	res, err := a.ValidateDataSiloDef(ctx, ValidateDSArgs{
+		SiloSpecID:        silo.SiloSpecificationID,
+		SiloSpecVersionID: &version.ID,
+		Config:            conf,
+		CheckSchema:       true,
+		SchemaOnly:        silo.SiloSpecification.Manual,
+	})
+
+	if err != nil {
+		logger.Error("Error validating silo", "error", err)
+		return fail("an error occurred while validating the silo.")
+	}
+
+	if res.Status == monoidprotocol.MonoidValidateMessageStatusFAILURE {
+		msg := "an error occurred while validating connection information."
+		if res.Message != nil {
+			msg = *res.Message
+		}
+
+		return fail(fmt.Sprintf("version %d can't be used with the silo's config: %s", version.Version, msg))
+	}
+
+	if err := silo.SetVersion(a.Conf.DB, version.ID, *currentID); err != nil {
+		return false, err
+	}
+
+	a.Conf.AnalyticsIngestor.Track("siloAction", nil, map[string]interface{}{
+		"action":      "upgrade",
+		"siloId":      silo.ID,
+		"workspaceId": silo.WorkspaceID,
+	})
+
+	jw.Log(model.LogLevelInfo, fmt.Sprintf("Upgraded %s to version %d", silo.Name, version.Version))
+
+	return true, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/monoid-privacy/monoid/jsonschema"
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
 	"go.temporal.io/sdk/activity"
@@ -12,7 +13,16 @@ import (
 
 type ValidateDSArgs struct {
 	SiloSpecID string
-	Config     []byte
+	// SiloSpecVersionID is the version of the specification to validate
+	// with, which defaults to the specification's current version.
+	SiloSpecVersionID *string
+	Config            []byte
+
+	// CheckSchema checks the config against the version's schema before
+	// the connector validates it.
+	CheckSchema bool
+	// SchemaOnly skips the connector's validation.
+	SchemaOnly bool
 }
 
 func (a *Activity) ValidateDataSiloDef(ctx context.Context, args ValidateDSArgs) (*monoidprotocol.MonoidValidateMessage, error) {
@@ -26,7 +36,54 @@ func (a *Activity) ValidateDataSiloDef(ctx context.Context, args ValidateDSArgs)
 		return nil, err
 	}
 
-	mp, err := a.Conf.ProtocolFactory.NewMonoidProtocol(spec.DockerImage, spec.DockerTag, "")
+	version := model.SiloSpecificationVersion{}
+	if args.SiloSpecVersionID != nil {
+		if err := a.Conf.DB.Where(
+			"id = ? AND silo_specification_id = ?",
+			*args.SiloSpecVersionID,
+			spec.ID,
+		).First(&version).Error; err != nil {
+			logger.Error("Could not find silo spec version: %v", err)
+			return nil, err
+		}
+
+		spec = version.Apply(spec)
+	}
+
+	confString := model.SecretString("")
+	if err := confString.Scan(args.Config); err != nil {
+		return nil, fmt.Errorf("error decrypting config: %v", err)
+	}
+
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(confString), &conf); err != nil {
+		return nil, fmt.Errorf("error decoding config: %v", err)
+	}
+
+	conf, err := a.Conf.ResolveSiloConfig(ctx, conf)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving secrets: %v", err)
+	}
+
+	if args.CheckSchema && spec.Schema != nil {
+		if err := jsonschema.Validate(conf, *spec.Schema); err != nil {
+			msg := fmt.Sprintf("the config isn't valid for the version's schema: %s", err.Error())
+			return &monoidprotocol.MonoidValidateMessage{
+				Status:  monoidprotocol.MonoidValidateMessageStatusFAILURE,
+				Message: &msg,
+			}, nil
+		}
+	}
+
+	if args.SchemaOnly {
+		return &monoidprotocol.MonoidValidateMessage{
+			Status: monoidprotocol.MonoidValidateMessageStatusSUCCESS,
+		}, nil
+	}
+
+	mp, err := monoidprotocol.NewMonoidProtocol(
+		a.Conf.ProtocolFactory, spec.DockerImage, spec.DockerTag, "", spec.ConnectorOptions(),
+	)
 	if err != nil {
 		logger.Error("Error creating docker client: %v", err)
 		return nil, err
@@ -50,21 +107,13 @@ func (a *Activity) ValidateDataSiloDef(ctx context.Context, args ValidateDSArgs)
 		}
 	}()
 
+	ForwardSandboxViolations(ctx, mp)
+
 	if err := mp.InitConn(ctx); err != nil {
 		logger.Error("Error creating docker connection: %v", err)
 		return nil, err
 	}
 
-	confString := model.SecretString("")
-	if err := confString.Scan(args.Config); err != nil {
-		return nil, fmt.Errorf("error decrypting config: %v", err)
-	}
-
-	conf := map[string]interface{}{}
-	if err := json.Unmarshal([]byte(confString), &conf); err != nil {
-		return nil, fmt.Errorf("error decoding config: %v", err)
-	}
-
 	logger.Info("validating")
 
 	validate, err := mp.Validate(ctx, conf)
@@ -13,6 +13,9 @@ type DetectDSArgs struct {
 	SiloDefID   string
 	WorkspaceID string
 	JobID       string
+
+	// FullScan forces every data source in the silo to be re-sampled.
+	FullScan bool
 }
 
 func (w *Workflow) DetectDSWorkflow(
@@ -24,7 +27,6 @@ func (w *Workflow) DetectDSWorkflow(
 		RetryPolicy: &temporal.RetryPolicy{
 			MaximumAttempts: 5,
 		},
-		HeartbeatTimeout: 2 * time.Second,
 	}
 
 	cleanupOptions := workflow.ActivityOptions{
@@ -72,13 +74,44 @@ func (w *Workflow) DetectDSWorkflow(
 		return err
 	}
 
+	policy := model.ExecutionPolicy{}
+	limits := []model.ExecutionLimit{}
+
+	// Workflows started before execution policies were added keep the
+	// options they were started with, and aren't limited.
+	detectOptions := options
+	detectOptions.HeartbeatTimeout = 2 * time.Second
+
+	if workflow.GetVersion(ctx, "execution-policy", workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+		if err := workflow.ExecuteActivity(ctx, ac.FindExecutionPolicy, args.SiloDefID).Get(ctx, &policy); err != nil {
+			return err
+		}
+
+		detectOptions = workflow.ActivityOptions{
+			StartToCloseTimeout: policy.ActivityTimeout(),
+			HeartbeatTimeout:    policy.HeartbeatTimeout(),
+			RetryPolicy: &temporal.RetryPolicy{
+				MaximumAttempts: policy.Attempts(),
+			},
+		}
+
+		if err := workflow.ExecuteActivity(ctx, ac.FindExecutionLimits, args.SiloDefID).Get(ctx, &limits); err != nil {
+			return err
+		}
+	}
+
+	detectCtx := workflow.WithActivityOptions(ctx, detectOptions)
+
 	numDiscoveries := 0
 
 	// Run the detection activity
-	err = workflow.ExecuteActivity(ctx, ac.DetectDataSources, activity.DetectDSArgs{
-		SiloID:        args.SiloDefID,
-		LogObjectName: job.LogObject,
-	}).Get(ctx, &numDiscoveries)
+	err = activity.WithExecutionSlot(ctx, limits, policy, func() error {
+		return workflow.ExecuteActivity(detectCtx, ac.DetectDataSources, activity.DetectDSArgs{
+			SiloID:   args.SiloDefID,
+			JobID:    job.ID,
+			FullScan: args.FullScan,
+		}).Get(ctx, &numDiscoveries)
+	})
 
 	if err != nil {
 		return err
@@ -0,0 +1,76 @@
+package workflow
+
+import (
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/workflow/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+type InferLineageArgs struct {
+	WorkspaceID string
+	JobID       string
+}
+
+// InferLineageWorkflow re-infers the lineage edges in the workspace, since
+// comparing every pair of data sources is too slow to do in a request.
+func (w *Workflow) InferLineageWorkflow(
+	ctx workflow.Context,
+	args InferLineageArgs,
+) (err error) {
+	options := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 10,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	}
+
+	cleanupOptions := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 1,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 2,
+		},
+	}
+
+	cleanupCtx, _ := workflow.NewDisconnectedContext(
+		workflow.WithActivityOptions(ctx, cleanupOptions),
+	)
+
+	ctx = workflow.WithActivityOptions(ctx, options)
+	ac := activity.Activity{}
+
+	defer func() {
+		status := model.JobStatusCompleted
+
+		if err != nil {
+			status = model.JobStatusFailed
+		}
+
+		terr := workflow.ExecuteActivity(cleanupCtx, ac.UpdateJobStatus, activity.JobStatusInput{
+			ID:     args.JobID,
+			Status: status,
+		}).Get(ctx, nil)
+
+		if terr != nil && err == nil {
+			err = terr
+		}
+	}()
+
+	job := model.Job{}
+	err = workflow.ExecuteActivity(ctx, ac.FindOrCreateJob, activity.JobInput{
+		ID:          args.JobID,
+		WorkspaceID: args.WorkspaceID,
+		JobType:     model.JobTypeInferLineage,
+		ResourceID:  args.WorkspaceID,
+		Status:      model.JobStatusRunning,
+	}).Get(ctx, &job)
+
+	if err != nil {
+		return err
+	}
+
+	numEdges := 0
+	return workflow.ExecuteActivity(ctx, ac.InferLineage, args.WorkspaceID).Get(ctx, &numEdges)
+}
@@ -14,6 +14,21 @@ type ExecuteRequestArgs struct {
 	RequestID   string
 	JobID       string
 	WorkspaceID string
+
+	// VerifyDeletion re-runs the query on each data source after a delete
+	// request completes.
+	VerifyDeletion bool
+
+	// SiloDefinitionIDs and RequestStatusIDs limit the request to some of
+	// its silos and data sources, when retrying.
+	SiloDefinitionIDs []string
+	RequestStatusIDs  []string
+}
+
+// SiloWorkflowID is the ID of the child workflow that runs a request on a
+// silo.
+func SiloWorkflowID(requestWorkflowID string, siloDefinitionID string) string {
+	return requestWorkflowID + "-silo-" + siloDefinitionID
 }
 
 type UpdateStatusSignal struct {
@@ -23,6 +38,13 @@ type UpdateStatusSignal struct {
 
 const UpdateStatusSignalChannel = "silo-update-status"
 
+// CancelSiloSignal cancels the request on one of its silos.
+type CancelSiloSignal struct {
+	SiloDefinitionID string
+}
+
+const CancelSiloSignalChannel = "cancel-silo"
+
 func (w *RequestWorkflow) ExecuteRequestWorkflow(
 	ctx workflow.Context,
 	args ExecuteRequestArgs,
@@ -38,14 +60,13 @@ func (w *RequestWorkflow) ExecuteRequestWorkflow(
 
 	ctx = workflow.WithActivityOptions(ctx, options)
 
+	ac := activity.Activity{}
 	reqAc := requestactivity.RequestActivity{}
 	status := model.JobStatusCompleted
 	hasSuccess := false
 
 	cleanupCtx, _ := workflow.NewDisconnectedContext(ctx)
 	defer func() {
-		ac := activity.Activity{}
-
 		if err != nil {
 			status = model.JobStatusFailed
 		}
@@ -57,13 +78,41 @@ func (w *RequestWorkflow) ExecuteRequestWorkflow(
 		terr := workflow.ExecuteActivity(cleanupCtx, ac.UpdateJobStatus, activity.JobStatusInput{
 			ID:     args.JobID,
 			Status: status,
-		}).Get(ctx, nil)
+		}).Get(cleanupCtx, nil)
 
 		if terr != nil && err == nil {
 			err = terr
 		}
+
+		// Workflows started before the request status was recomputed here
+		// don't have the activity in their history.
+		if workflow.GetVersion(cleanupCtx, "recompute-request-status", workflow.DefaultVersion, 1) ==
+			workflow.DefaultVersion {
+			return
+		}
+
+		// The job may only have run on some of the request's silos, so the
+		// request's status is computed from all of its data sources.
+		if terr := workflow.ExecuteActivity(
+			cleanupCtx,
+			reqAc.RecomputeRequestStatusActivity,
+			requestactivity.RecomputeRequestStatusArgs{RequestID: args.RequestID},
+		).Get(cleanupCtx, nil); terr != nil {
+			logger.Error("Error updating request status", terr)
+		}
 	}()
 
+	// Workflows started before jobs were marked as running don't have the
+	// activity in their history.
+	if workflow.GetVersion(ctx, "job-running-status", workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+		if err := workflow.ExecuteActivity(ctx, ac.UpdateJobStatus, activity.JobStatusInput{
+			ID:     args.JobID,
+			Status: model.JobStatusRunning,
+		}).Get(ctx, nil); err != nil {
+			logger.Error("Error updating job status", err)
+		}
+	}
+
 	silos := []model.SiloDefinition{}
 	if err := workflow.ExecuteActivity(ctx, reqAc.FindDBSilos, requestactivity.FindRequestArgs{
 		WorkspaceID: args.WorkspaceID,
@@ -71,18 +120,55 @@ func (w *RequestWorkflow) ExecuteRequestWorkflow(
 		return err
 	}
 
-	ctx = workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{})
+	if len(args.SiloDefinitionIDs) > 0 {
+		siloIDs := map[string]bool{}
+		for _, id := range args.SiloDefinitionIDs {
+			siloIDs[id] = true
+		}
+
+		filtered := make([]model.SiloDefinition, 0, len(args.SiloDefinitionIDs))
+		for _, silo := range silos {
+			if siloIDs[silo.ID] {
+				filtered = append(filtered, silo)
+			}
+		}
+
+		silos = filtered
+	}
+
+	workflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
 	sel := workflow.NewSelector(ctx)
 	silosComplete := 0
 
+	// Workflows started before the child workflows had fixed IDs started
+	// them with generated IDs.
+	siloWorkflowIDs := workflow.GetVersion(ctx, "silo-workflow-id", workflow.DefaultVersion, 1) !=
+		workflow.DefaultVersion
+
 	childExecutions := map[string]workflow.Execution{}
+	childCancels := map[string]workflow.CancelFunc{}
 
 	for i, silo := range silos {
 		i := i
 
-		future := workflow.ExecuteChildWorkflow(ctx, w.ExecuteSiloRequestWorkflow, SiloRequestArgs{
+		childOptions := workflow.ChildWorkflowOptions{}
+		if siloWorkflowIDs {
+			childOptions.WorkflowID = SiloWorkflowID(workflowID, silo.ID)
+		}
+
+		childCtx, cancelChild := workflow.WithCancel(ctx)
+		childCtx = workflow.WithChildOptions(childCtx, childOptions)
+		childCancels[silo.ID] = cancelChild
+
+		future := workflow.ExecuteChildWorkflow(childCtx, w.ExecuteSiloRequestWorkflow, SiloRequestArgs{
 			RequestID:        args.RequestID,
 			SiloDefinitionID: silo.ID,
+			VerifyDeletion:   args.VerifyDeletion,
+			RequestStatusIDs: args.RequestStatusIDs,
+			JobID:            args.JobID,
+			Policy:           silo.EffectiveExecutionPolicy(),
+			Limits:           silo.ExecutionLimitList(),
+			Batching:         silo.SiloSpecification.RequestBatching,
 		})
 
 		ce := workflow.Execution{}
@@ -134,6 +220,15 @@ func (w *RequestWorkflow) ExecuteRequestWorkflow(
 		}
 	})
 
+	cancelChan := workflow.GetSignalChannel(ctx, CancelSiloSignalChannel)
+	var cancelSignal CancelSiloSignal
+	sel.AddReceive(cancelChan, func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, &cancelSignal)
+		if cancel, ok := childCancels[cancelSignal.SiloDefinitionID]; ok {
+			cancel()
+		}
+	})
+
 	for silosComplete < len(silos) {
 		sel.Select(ctx)
 	}
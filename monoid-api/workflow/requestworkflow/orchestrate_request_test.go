@@ -42,6 +42,7 @@ func (s *orchestrateUnitTestSuite) tabularSetup() {
 
 	s.env.RegisterActivity(s.ra.FindDBSilos)
 	s.env.RegisterActivity(s.ac.UpdateJobStatus)
+	s.env.RegisterActivity(s.ra.RecomputeRequestStatusActivity)
 	s.env.RegisterWorkflow(s.rw.ExecuteRequestWorkflow)
 	s.env.RegisterWorkflow(s.rw.ExecuteSiloRequestWorkflow)
 }
@@ -102,11 +103,20 @@ func (s *orchestrateUnitTestSuite) TestSimpleOrchestrate() {
 				siloMap[silos[i].ID] = silos[i]
 			}
 
+			s.env.OnActivity(s.ac.UpdateJobStatus, mock.Anything, activity.JobStatusInput{
+				ID:     "test_job_id",
+				Status: model.JobStatusRunning,
+			}).Return(nil).Times(1)
+
 			s.env.OnActivity(s.ac.UpdateJobStatus, mock.Anything, activity.JobStatusInput{
 				ID:     "test_job_id",
 				Status: arg.resJobStatus,
 			}).Return(nil).Times(1)
 
+			s.env.OnActivity(s.ra.RecomputeRequestStatusActivity, mock.Anything, requestactivity.RecomputeRequestStatusArgs{
+				RequestID: requestArgs.RequestID,
+			}).Return(nil).Times(1)
+
 			s.env.OnActivity(s.ra.FindDBSilos, mock.Anything).Return(
 				silos, nil,
 			)
@@ -135,6 +145,51 @@ func (s *orchestrateUnitTestSuite) TestSimpleOrchestrate() {
 	}
 }
 
+// TestRetryOrchestrate verifies that a retry only runs on the requested silos.
+func (s *orchestrateUnitTestSuite) TestRetryOrchestrate() {
+	s.tabularSetup()
+
+	silos := []model.SiloDefinition{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+
+	requestArgs := ExecuteRequestArgs{
+		RequestID:         "test_request_id",
+		JobID:             "test_job_id",
+		WorkspaceID:       "test_workspace_id",
+		SiloDefinitionIDs: []string{silos[1].ID},
+		RequestStatusIDs:  []string{"test_status_id"},
+	}
+
+	s.env.OnActivity(s.ac.UpdateJobStatus, mock.Anything, activity.JobStatusInput{
+		ID:     "test_job_id",
+		Status: model.JobStatusRunning,
+	}).Return(nil).Times(1)
+
+	s.env.OnActivity(s.ac.UpdateJobStatus, mock.Anything, activity.JobStatusInput{
+		ID:     "test_job_id",
+		Status: model.JobStatusCompleted,
+	}).Return(nil).Times(1)
+
+	s.env.OnActivity(s.ra.RecomputeRequestStatusActivity, mock.Anything, requestactivity.RecomputeRequestStatusArgs{
+		RequestID: requestArgs.RequestID,
+	}).Return(nil).Times(1)
+
+	s.env.OnActivity(s.ra.FindDBSilos, mock.Anything).Return(silos, nil)
+
+	s.env.OnWorkflow(s.rw.ExecuteSiloRequestWorkflow, mock.Anything, SiloRequestArgs{
+		RequestID:        requestArgs.RequestID,
+		SiloDefinitionID: silos[1].ID,
+		RequestStatusIDs: []string{"test_status_id"},
+		JobID:            requestArgs.JobID,
+	}).Return(ExecuteSiloRequestResult{Status: model.FullRequestStatusExecuted}, nil).Times(1)
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteRequestWorkflow, requestArgs)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+
+	s.tabularAfter()
+}
+
 func TestOrchestrateSuite(t *testing.T) {
 	suite.Run(t, &orchestrateUnitTestSuite{})
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/monoid-privacy/monoid/workflow/activity"
 	"github.com/monoid-privacy/monoid/workflow/activity/requestactivity"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
@@ -13,9 +14,33 @@ import (
 type SiloRequestArgs struct {
 	SiloDefinitionID string `json:"siloDefinitionId"`
 	RequestID        string `json:"requestId"`
+
+	// VerifyDeletion re-runs the query on data sources once their delete
+	// completes, and marks any that still return records as VERIFICATION_FAILED.
+	VerifyDeletion bool `json:"verifyDeletion"`
+
+	// RequestStatusIDs limits the request to some of the silo's data sources.
+	RequestStatusIDs []string `json:"requestStatusIds,omitempty"`
+
+	// JobID is the job that log entries are written for.
+	JobID string `json:"jobId,omitempty"`
+
+	// Policy is the silo's execution policy. The defaults are used for the
+	// fields that it doesn't set.
+	Policy model.ExecutionPolicy `json:"policy"`
+
+	// Limits cap the executions against the silo. Each connector activity
+	// waits for a slot under the limits before it runs.
+	Limits []model.ExecutionLimit `json:"limits,omitempty"`
+
+	// Batching is set if the silo's requests are started in batches, with
+	// the requests on the silo that arrive around the same time.
+	Batching *model.RequestBatching `json:"batching,omitempty"`
 }
 
-const pollTime = 1 * time.Hour
+// verifyTimeout is the shortest timeout for the verification query, since it
+// may have to wait for the silo.
+const verifyTimeout = 30 * time.Minute
 
 func updateRequest(ctx workflow.Context, requestStatusID string, status model.RequestStatusType) error {
 	ac := requestactivity.RequestActivity{}
@@ -47,9 +72,10 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 ) (requestRes ExecuteSiloRequestResult, err error) {
 	logger := workflow.GetLogger(ctx)
 	options := workflow.ActivityOptions{
-		StartToCloseTimeout: time.Minute * 2,
+		StartToCloseTimeout: args.Policy.ActivityTimeout(),
+		HeartbeatTimeout:    args.Policy.HeartbeatTimeout(),
 		RetryPolicy: &temporal.RetryPolicy{
-			MaximumAttempts: 5,
+			MaximumAttempts: args.Policy.Attempts(),
 		},
 	}
 
@@ -61,16 +87,77 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 	reqStatus := requestactivity.RequestStatusResult{}
 	requestRes = ExecuteSiloRequestResult{Status: model.FullRequestStatusFailed}
 
-	if err := workflow.ExecuteActivity(ctx, ac.StartSiloRequestActivity, requestactivity.StartRequestArgs{
-		SiloDefinitionID: args.SiloDefinitionID,
-		RequestID:        args.RequestID,
-	}).Get(ctx, &reqStatus); err != nil {
+	// Record the silo's result on the job's progress, once everything else
+	// has finished.
+	defer func() {
+		if args.JobID == "" {
+			return
+		}
+
+		status := model.JobStatusFailed
+		if err == nil && ctx.Err() == nil {
+			switch requestRes.Status {
+			case model.FullRequestStatusExecuted:
+				status = model.JobStatusCompleted
+			case model.FullRequestStatusPartialFailed:
+				status = model.JobStatusPartialFailed
+			}
+		}
+
+		cleanupCtx, _ := workflow.NewDisconnectedContext(ctx)
+		if workflow.GetVersion(cleanupCtx, "finish-job-progress", workflow.DefaultVersion, 1) ==
+			workflow.DefaultVersion {
+			return
+		}
+
+		if terr := workflow.ExecuteActivity(
+			cleanupCtx,
+			ac.FinishJobProgressActivity,
+			requestactivity.FinishJobProgressArgs{
+				JobID:            args.JobID,
+				SiloDefinitionID: args.SiloDefinitionID,
+				Status:           status,
+			},
+		).Get(cleanupCtx, nil); terr != nil {
+			logger.Error("Error updating job progress", terr)
+		}
+	}()
+
+	// If the workflow is cancelled, mark the data sources that haven't been
+	// executed as cancelled.
+	defer func() {
+		if ctx.Err() == nil {
+			return
+		}
+
+		cleanupCtx, _ := workflow.NewDisconnectedContext(ctx)
+		if workflow.GetVersion(cleanupCtx, "cancel-request-statuses", workflow.DefaultVersion, 1) ==
+			workflow.DefaultVersion {
+			return
+		}
+
+		if terr := workflow.ExecuteActivity(
+			cleanupCtx,
+			ac.BatchUpdateRequestStatusActivity,
+			requestactivity.BatchUpdateRequestStatusArgs{
+				RequestID:        args.RequestID,
+				SiloDefinitionID: args.SiloDefinitionID,
+				RequestStatusIDs: args.RequestStatusIDs,
+				Status:           model.RequestStatusTypeCancelled,
+			},
+		).Get(cleanupCtx, nil); terr != nil {
+			logger.Error("Error cancelling request statuses", terr)
+		}
+	}()
+
+	if err := startSiloRequest(ctx, args, &reqStatus); err != nil {
 		if err := workflow.ExecuteActivity(
 			ctx,
 			ac.BatchUpdateRequestStatusActivity,
 			requestactivity.BatchUpdateRequestStatusArgs{
 				RequestID:        args.RequestID,
 				SiloDefinitionID: args.SiloDefinitionID,
+				RequestStatusIDs: args.RequestStatusIDs,
 				Status:           model.RequestStatusTypeFailed,
 			},
 		).Get(ctx, nil); err != nil {
@@ -83,6 +170,10 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 	processing := reqStatus.ResultItems
 	hasFailures := false
 
+	// The request statuses that were executed by this workflow, and can be
+	// verified.
+	executedIDs := []string{}
+
 	for len(processing) > 0 {
 		newProcessing := make([]requestactivity.RequestStatusItem, 0, len(processing))
 		type resultExtractTuple struct {
@@ -151,6 +242,7 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 			requestArgs := requestactivity.ProcessRequestArgs{
 				ProtocolRequestStatus: make([]monoidprotocol.MonoidRequestStatus, len(resultExtractData)),
 				RequestStatusIDs:      make([]string, len(resultExtractData)),
+				JobID:                 args.JobID,
 			}
 
 			for i, datum := range resultExtractData {
@@ -162,7 +254,9 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 
 			logger.Info("Calling process")
 			// Call the process activity to get data.
-			if err := workflow.ExecuteActivity(ctx, ac.ProcessRequestResults, requestArgs).Get(ctx, &res); err != nil {
+			if err := activity.WithExecutionSlot(ctx, args.Limits, args.Policy, func() error {
+				return workflow.ExecuteActivity(ctx, ac.ProcessRequestResults, requestArgs).Get(ctx, &res)
+			}); err != nil {
 				// If the activity itself fails, then all the input needs to be marked as failed.
 				logger.Error("Error processing results", err)
 
@@ -184,6 +278,7 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 						status = model.RequestStatusTypeFailed
 					} else {
 						requestRes.Status = model.FullRequestStatusPartialFailed
+						executedIDs = append(executedIDs, r.RequestStatusID)
 					}
 
 					if terr := updateRequest(ctx, r.RequestStatusID, status); terr != nil {
@@ -206,7 +301,7 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 			c.Receive(ctx, &signal)
 		})
 
-		timer := workflow.NewTimer(ctx, pollTime)
+		timer := workflow.NewTimer(ctx, args.Policy.PollInterval())
 		selector.AddFuture(timer, func(f workflow.Future) {
 			timerTriggered = true
 		})
@@ -220,9 +315,12 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 				if r.RequestStatusID == signal.RequestStatusID {
 					res := requestactivity.RequestStatusResult{}
 
-					if err := workflow.ExecuteActivity(ctx, ac.RequestStatusActivity, requestactivity.RequestStatusArgs{
-						RequestStatusIDs: []string{r.RequestStatusID},
-					}).Get(ctx, &res); err != nil {
+					if err := activity.WithExecutionSlot(ctx, args.Limits, args.Policy, func() error {
+						return workflow.ExecuteActivity(ctx, ac.RequestStatusActivity, requestactivity.RequestStatusArgs{
+							RequestStatusIDs: []string{r.RequestStatusID},
+							JobID:            args.JobID,
+						}).Get(ctx, &res)
+					}); err != nil {
 						return requestRes, err
 					}
 
@@ -283,18 +381,115 @@ func (w *RequestWorkflow) ExecuteSiloRequestWorkflow(
 
 		res := requestactivity.RequestStatusResult{}
 
-		if err := workflow.ExecuteActivity(ctx, ac.RequestStatusActivity, requestactivity.RequestStatusArgs{
-			RequestStatusIDs: statusIDs,
-		}).Get(ctx, &res); err != nil {
+		if err := activity.WithExecutionSlot(ctx, args.Limits, args.Policy, func() error {
+			return workflow.ExecuteActivity(ctx, ac.RequestStatusActivity, requestactivity.RequestStatusArgs{
+				RequestStatusIDs: statusIDs,
+				JobID:            args.JobID,
+			}).Get(ctx, &res)
+		}); err != nil {
 			return requestRes, err
 		}
 
 		processing = res.ResultItems
 	}
 
+	if args.VerifyDeletion && len(executedIDs) > 0 {
+		if !verifyDeletions(ctx, args, executedIDs) {
+			hasFailures = true
+		}
+	}
+
 	if !hasFailures {
 		requestRes.Status = model.FullRequestStatusExecuted
 	}
 
 	return requestRes, nil
 }
+
+// startSiloRequest starts the request on the silo, either on its own or in the
+// silo's next batch.
+func startSiloRequest(
+	ctx workflow.Context,
+	args SiloRequestArgs,
+	res *requestactivity.RequestStatusResult,
+) error {
+	if args.Batching != nil {
+		return startSiloRequestInBatch(ctx, args, res)
+	}
+
+	ac := requestactivity.RequestActivity{}
+
+	return activity.WithExecutionSlot(ctx, args.Limits, args.Policy, func() error {
+		return workflow.ExecuteActivity(ctx, ac.StartSiloRequestActivity, requestactivity.StartRequestArgs{
+			SiloDefinitionID: args.SiloDefinitionID,
+			RequestID:        args.RequestID,
+			RequestStatusIDs: args.RequestStatusIDs,
+			JobID:            args.JobID,
+		}).Get(ctx, res)
+	})
+}
+
+// verifyDeletions runs the verification query for the request statuses, and marks
+// the ones that still have records as VERIFICATION_FAILED. It returns false if any
+// of the deletions couldn't be verified.
+func verifyDeletions(ctx workflow.Context, args SiloRequestArgs, requestStatusIDs []string) bool {
+	logger := workflow.GetLogger(ctx)
+	ac := requestactivity.RequestActivity{}
+
+	// The query may have to wait for the silo, so it gets more time than
+	// the other activities.
+	timeout := args.Policy.ActivityTimeout()
+	if timeout < verifyTimeout {
+		timeout = verifyTimeout
+	}
+
+	verifyCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: timeout,
+		HeartbeatTimeout:    args.Policy.HeartbeatTimeout(),
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 2,
+		},
+	})
+
+	timeoutSeconds := int(timeout / time.Second)
+	attempts := 2
+	verifyPolicy := args.Policy
+	verifyPolicy.ActivityTimeoutSeconds = &timeoutSeconds
+	verifyPolicy.MaxAttempts = &attempts
+
+	res := requestactivity.VerifyDeletionResult{}
+	if err := activity.WithExecutionSlot(ctx, args.Limits, verifyPolicy, func() error {
+		return workflow.ExecuteActivity(verifyCtx, ac.VerifyDeletionActivity, requestactivity.VerifyDeletionArgs{
+			SiloDefinitionID: args.SiloDefinitionID,
+			RequestID:        args.RequestID,
+			RequestStatusIDs: requestStatusIDs,
+			JobID:            args.JobID,
+		}).Get(ctx, &res)
+	}); err != nil {
+		logger.Error("Error verifying deletion", err)
+
+		for _, id := range requestStatusIDs {
+			if terr := updateRequest(ctx, id, model.RequestStatusTypeVerificationFailed); terr != nil {
+				logger.Error("Error updating request", terr)
+			}
+		}
+
+		return false
+	}
+
+	verified := true
+
+	for _, r := range res.ResultItems {
+		if r.Verified() {
+			continue
+		}
+
+		verified = false
+
+		if terr := updateRequest(ctx, r.RequestStatusID, model.RequestStatusTypeVerificationFailed); terr != nil {
+			logger.Error("Error updating request", terr)
+		}
+	}
+
+	return verified
+}
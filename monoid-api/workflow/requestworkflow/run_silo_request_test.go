@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/monoid-privacy/monoid/config"
+	"github.com/monoid-privacy/monoid/execlimit"
 	"github.com/monoid-privacy/monoid/model"
 	"github.com/monoid-privacy/monoid/monoidprotocol"
+	"github.com/monoid-privacy/monoid/workflow/activity"
 	"github.com/monoid-privacy/monoid/workflow/activity/requestactivity"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -42,6 +45,8 @@ func (s *siloRequestUnitTestSuite) tabularSetup() {
 	s.env.RegisterActivity(s.ra.RequestStatusActivity)
 	s.env.RegisterActivity(s.ra.ProcessRequestResults)
 	s.env.RegisterActivity(s.ra.UpdateRequestStatusActivity)
+	s.env.RegisterActivity(s.ra.VerifyDeletionActivity)
+	s.env.RegisterActivity(s.ra.FinishJobProgressActivity)
 	s.env.RegisterWorkflow(s.rw.ExecuteSiloRequestWorkflow)
 }
 
@@ -249,6 +254,186 @@ func (s *siloRequestUnitTestSuite) TestDelayedSiloRequest() {
 	s.NoError(s.env.GetWorkflowError())
 }
 
+// TestJobProgress verifies that the silo's result is recorded on the job's progress.
+func (s *siloRequestUnitTestSuite) TestJobProgress() {
+	s.tabularSetup()
+	defer s.tabularAfter()
+
+	wfArgs := SiloRequestArgs{
+		SiloDefinitionID: uuid.NewString(),
+		RequestID:        uuid.NewString(),
+		JobID:            uuid.NewString(),
+	}
+
+	requestStatusID := uuid.NewString()
+
+	s.env.OnActivity(s.ra.StartSiloRequestActivity, mock.Anything, requestactivity.StartRequestArgs{
+		SiloDefinitionID: wfArgs.SiloDefinitionID,
+		RequestID:        wfArgs.RequestID,
+		JobID:            wfArgs.JobID,
+	}).Return(requestactivity.RequestStatusResult{
+		ResultItems: []requestactivity.RequestStatusItem{{
+			FullyComplete:   true,
+			RequestStatusID: requestStatusID,
+		}},
+	}, nil).Once()
+
+	s.env.OnActivity(s.ra.UpdateRequestStatusActivity, mock.Anything, requestactivity.UpdateRequestStatusArgs{
+		RequestStatusID: requestStatusID,
+		Status:          model.RequestStatusTypeExecuted,
+	}).Return(nil).Once()
+
+	s.env.OnActivity(s.ra.FinishJobProgressActivity, mock.Anything, requestactivity.FinishJobProgressArgs{
+		JobID:            wfArgs.JobID,
+		SiloDefinitionID: wfArgs.SiloDefinitionID,
+		Status:           model.JobStatusCompleted,
+	}).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteSiloRequestWorkflow, wfArgs)
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+// TestExecutionLimits verifies that connector activities wait for an execution
+// slot when the silo has limits, and release it afterwards.
+func (s *siloRequestUnitTestSuite) TestExecutionLimits() {
+	s.tabularSetup()
+	defer s.tabularAfter()
+
+	ac := &activity.Activity{}
+	s.env.RegisterActivity(ac.AcquireExecutionSlot)
+	s.env.RegisterActivity(ac.ReleaseExecutionSlot)
+
+	maxConcurrent := 2
+	wfArgs := SiloRequestArgs{
+		SiloDefinitionID: uuid.NewString(),
+		RequestID:        uuid.NewString(),
+	}
+	wfArgs.Limits = []model.ExecutionLimit{{
+		Key:    "silo:" + wfArgs.SiloDefinitionID,
+		Limits: model.ExecutionLimits{MaxConcurrent: &maxConcurrent},
+	}}
+
+	requestStatusID := uuid.NewString()
+	holderID := ""
+
+	matchLimits := mock.MatchedBy(func(args activity.AcquireSlotArgs) bool {
+		holderID = args.HolderID
+		return reflect.DeepEqual(args.Limits, wfArgs.Limits)
+	})
+
+	s.env.OnActivity(ac.AcquireExecutionSlot, mock.Anything, matchLimits).Return(
+		execlimit.Result{Acquired: false, RetryAfter: 10 * time.Second}, nil,
+	).Once()
+	s.env.OnActivity(ac.AcquireExecutionSlot, mock.Anything, matchLimits).Return(
+		execlimit.Result{Acquired: true}, nil,
+	).Once()
+
+	s.env.OnActivity(s.ra.StartSiloRequestActivity, mock.Anything, requestactivity.StartRequestArgs{
+		SiloDefinitionID: wfArgs.SiloDefinitionID,
+		RequestID:        wfArgs.RequestID,
+	}).Return(requestactivity.RequestStatusResult{
+		ResultItems: []requestactivity.RequestStatusItem{{
+			FullyComplete:   true,
+			RequestStatusID: requestStatusID,
+		}},
+	}, nil).Once()
+
+	s.env.OnActivity(ac.ReleaseExecutionSlot, mock.Anything, mock.MatchedBy(func(id string) bool {
+		return id == holderID
+	})).Return(nil).Once()
+
+	s.env.OnActivity(s.ra.UpdateRequestStatusActivity, mock.Anything, requestactivity.UpdateRequestStatusArgs{
+		RequestStatusID: requestStatusID,
+		Status:          model.RequestStatusTypeExecuted,
+	}).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteSiloRequestWorkflow, wfArgs)
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+// TestVerifyDeletion verifies that data sources that still return records after
+// a deletion are marked as failing verification.
+func (s *siloRequestUnitTestSuite) TestVerifyDeletion() {
+	for _, arg := range []struct {
+		name           string
+		residual       int
+		workflowResult model.FullRequestStatus
+	}{
+		{name: "verified", residual: 0, workflowResult: model.FullRequestStatusExecuted},
+		{name: "residual", residual: 3, workflowResult: model.FullRequestStatusPartialFailed},
+	} {
+		s.Run(arg.name, func() {
+			s.tabularSetup()
+			defer s.tabularAfter()
+
+			wfArgs := SiloRequestArgs{
+				SiloDefinitionID: uuid.NewString(),
+				RequestID:        uuid.NewString(),
+				VerifyDeletion:   true,
+			}
+
+			dt := monoidprotocol.MonoidRequestStatusDataTypeNONE
+			results := requestactivity.RequestStatusResult{
+				ResultItems: []requestactivity.RequestStatusItem{{
+					RequestStatus: &monoidprotocol.MonoidRequestStatus{
+						DataType:      &dt,
+						RequestStatus: monoidprotocol.MonoidRequestStatusRequestStatusCOMPLETE,
+						SchemaName:    "test_name",
+					},
+					RequestStatusID: uuid.NewString(),
+				}},
+			}
+
+			rsID := results.ResultItems[0].RequestStatusID
+
+			s.env.OnActivity(s.ra.StartSiloRequestActivity, mock.Anything, requestactivity.StartRequestArgs{
+				SiloDefinitionID: wfArgs.SiloDefinitionID,
+				RequestID:        wfArgs.RequestID,
+			}).Return(results, nil).Once()
+
+			s.env.OnActivity(s.ra.ProcessRequestResults, mock.Anything, mock.Anything).Return(
+				requestactivity.ProcessRequestResult{
+					ResultItems: []requestactivity.ProcessRequestItem{{RequestStatusID: rsID}},
+				}, nil,
+			).Once()
+
+			s.env.OnActivity(s.ra.UpdateRequestStatusActivity, mock.Anything, requestactivity.UpdateRequestStatusArgs{
+				RequestStatusID: rsID,
+				Status:          model.RequestStatusTypeExecuted,
+			}).Return(nil).Once()
+
+			residual := arg.residual
+			s.env.OnActivity(s.ra.VerifyDeletionActivity, mock.Anything, requestactivity.VerifyDeletionArgs{
+				SiloDefinitionID: wfArgs.SiloDefinitionID,
+				RequestID:        wfArgs.RequestID,
+				RequestStatusIDs: []string{rsID},
+			}).Return(requestactivity.VerifyDeletionResult{
+				ResultItems: []requestactivity.VerifyDeletionItem{{
+					RequestStatusID:     rsID,
+					ResidualRecordCount: &residual,
+				}},
+			}, nil).Once()
+
+			if arg.residual > 0 {
+				s.env.OnActivity(s.ra.UpdateRequestStatusActivity, mock.Anything, requestactivity.UpdateRequestStatusArgs{
+					RequestStatusID: rsID,
+					Status:          model.RequestStatusTypeVerificationFailed,
+				}).Return(nil).Once()
+			}
+
+			s.env.ExecuteWorkflow(s.rw.ExecuteSiloRequestWorkflow, wfArgs)
+			s.True(s.env.IsWorkflowCompleted())
+			s.NoError(s.env.GetWorkflowError())
+
+			res := ExecuteSiloRequestResult{}
+			s.NoError(s.env.GetWorkflowResult(&res))
+			s.Equal(arg.workflowResult, res.Status)
+		})
+	}
+}
+
 func TestSiloRequestSuite(t *testing.T) {
 	suite.Run(t, &siloRequestUnitTestSuite{})
 }
@@ -0,0 +1,305 @@
+package requestworkflow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/monoid-privacy/monoid/workflow/activity"
+	"github.com/monoid-privacy/monoid/workflow/activity/requestactivity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// maxBatchesPerRun is the number of batches that the batch workflow runs before
+// it continues as new, to keep its history small.
+const maxBatchesPerRun = 100
+
+// ExecuteSiloBatchWorkflow collects the requests on a silo into batches, and
+// starts each batch with a single connector invocation. The result for each
+// request is signalled back to the silo request workflow that's waiting for it.
+// The workflow finishes once there are no more requests waiting.
+func (w *RequestWorkflow) ExecuteSiloBatchWorkflow(
+	ctx workflow.Context,
+	args requestactivity.SiloBatchArgs,
+) error {
+	logger := workflow.GetLogger(ctx)
+	requestChan := workflow.GetSignalChannel(ctx, requestactivity.SiloBatchRequestSignalChannel)
+	cancels := newBatchCancels(ctx)
+
+	var pending []requestactivity.BatchRequestItem
+
+	// Workflows started before the window was measured from each request's
+	// arrival restart the window for every batch.
+	windowFromArrival := workflow.GetVersion(
+		ctx, "batch-window-start", workflow.DefaultVersion, 1,
+	) != workflow.DefaultVersion
+
+	// arrived is when each pending request was received. Requests carried over
+	// from the previous run are treated as arriving when it continued.
+	arrived := map[string]time.Time{}
+	receive := func(item requestactivity.BatchRequestItem) {
+		pending = append(pending, item)
+		if _, ok := arrived[batchItemKey(item)]; !ok {
+			arrived[batchItemKey(item)] = workflow.Now(ctx)
+		}
+	}
+
+	for _, item := range args.Pending {
+		receive(item)
+	}
+
+	args.Pending = nil
+
+	for batches := 0; ; batches++ {
+		var item requestactivity.BatchRequestItem
+		for requestChan.ReceiveAsync(&item) {
+			receive(item)
+		}
+
+		pending = cancels.filter(pending)
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if batches >= maxBatchesPerRun {
+			args.Pending = pending
+			return workflow.NewContinueAsNewError(ctx, w.ExecuteSiloBatchWorkflow, args)
+		}
+
+		// Wait for more requests until the batch is full, or the window
+		// since the batch's first request arrived has passed. Requests that
+		// arrived while the last batch was running have already waited for
+		// part of the window.
+		window := args.Batching.Window()
+		if windowFromArrival {
+			window -= workflow.Now(ctx).Sub(arrived[batchItemKey(pending[0])])
+			if window < 0 {
+				window = 0
+			}
+		}
+
+		timerCtx, cancelTimer := workflow.WithCancel(ctx)
+		timer := workflow.NewTimer(timerCtx, window)
+		windowDone := false
+
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(requestChan, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, &item)
+			receive(item)
+		})
+		selector.AddFuture(timer, func(f workflow.Future) {
+			windowDone = true
+		})
+
+		for !windowDone && len(uniqueBatchItems(pending)) < args.Batching.Size() {
+			selector.Select(ctx)
+		}
+
+		cancelTimer()
+
+		pending = uniqueBatchItems(pending)
+
+		size := args.Batching.Size()
+		if size > len(pending) {
+			size = len(pending)
+		}
+
+		batch := pending[:size]
+		pending = pending[size:]
+
+		for _, item := range batch {
+			delete(arrived, batchItemKey(item))
+		}
+
+		results := w.runSiloBatch(ctx, args, batch, cancels)
+
+		for _, item := range batch {
+			if _, ok := results[item.RequestID]; !ok {
+				continue
+			}
+
+			if err := workflow.SignalExternalWorkflow(
+				ctx,
+				item.WorkflowID,
+				"",
+				requestactivity.SiloBatchResultSignalChannel,
+				results[item.RequestID],
+			).Get(ctx, nil); err != nil {
+				logger.Error("Error sending batch result", "workflowId", item.WorkflowID, "error", err)
+			}
+		}
+	}
+}
+
+// runSiloBatch starts the batch of requests, and returns the result for each
+// request, keyed by request ID. The requests that are cancelled while the batch
+// waits for an execution slot aren't started, and don't have a result.
+func (w *RequestWorkflow) runSiloBatch(
+	ctx workflow.Context,
+	args requestactivity.SiloBatchArgs,
+	batch []requestactivity.BatchRequestItem,
+	cancels *batchCancels,
+) map[string]requestactivity.SiloBatchResultSignal {
+	ac := requestactivity.RequestActivity{}
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: args.Policy.ActivityTimeout(),
+		HeartbeatTimeout:    args.Policy.HeartbeatTimeout(),
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: args.Policy.Attempts(),
+		},
+	})
+
+	res := requestactivity.BatchRequestStatusResult{}
+	err := activity.WithExecutionSlot(ctx, args.Limits, args.Policy, func() error {
+		batch = cancels.filter(batch)
+		if len(batch) == 0 {
+			return nil
+		}
+
+		return workflow.ExecuteActivity(ctx, ac.StartSiloBatchRequestActivity, requestactivity.StartBatchRequestArgs{
+			SiloDefinitionID: args.SiloDefinitionID,
+			Requests:         batch,
+		}).Get(ctx, &res)
+	})
+
+	results := make(map[string]requestactivity.SiloBatchResultSignal, len(batch))
+
+	for _, item := range batch {
+		signal := requestactivity.SiloBatchResultSignal{RequestID: item.RequestID}
+
+		if err != nil {
+			signal.Error = err.Error()
+		} else if r, ok := res.Results[item.RequestID]; ok {
+			signal.Result = r
+		} else {
+			signal.Error = fmt.Sprintf("no result for request %s", item.RequestID)
+		}
+
+		results[item.RequestID] = signal
+	}
+
+	return results
+}
+
+// uniqueBatchItems removes the items that were added to the batch more than once,
+// which can happen if the activity that adds them is retried.
+func uniqueBatchItems(items []requestactivity.BatchRequestItem) []requestactivity.BatchRequestItem {
+	seen := map[string]bool{}
+	res := make([]requestactivity.BatchRequestItem, 0, len(items))
+
+	for _, item := range items {
+		key := batchItemKey(item)
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		res = append(res, item)
+	}
+
+	return res
+}
+
+func batchItemKey(item requestactivity.BatchRequestItem) string {
+	return item.WorkflowID + "/" + item.RequestID
+}
+
+// batchCancels tracks the requests that were cancelled before their batch was
+// started.
+type batchCancels struct {
+	ch        workflow.ReceiveChannel
+	cancelled map[string]bool
+}
+
+func newBatchCancels(ctx workflow.Context) *batchCancels {
+	return &batchCancels{
+		ch:        workflow.GetSignalChannel(ctx, requestactivity.SiloBatchCancelSignalChannel),
+		cancelled: map[string]bool{},
+	}
+}
+
+// filter returns the items that haven't been cancelled.
+func (c *batchCancels) filter(items []requestactivity.BatchRequestItem) []requestactivity.BatchRequestItem {
+	var item requestactivity.BatchRequestItem
+	for c.ch.ReceiveAsync(&item) {
+		c.cancelled[batchItemKey(item)] = true
+	}
+
+	res := make([]requestactivity.BatchRequestItem, 0, len(items))
+	for _, item := range items {
+		if !c.cancelled[batchItemKey(item)] {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+// startSiloRequestInBatch adds the request to the silo's next batch, and waits
+// for the result of starting it. The batch may be queued behind others and wait
+// for an execution slot, so there's no timeout on the wait. If the workflow is
+// cancelled, the request is removed from the batch.
+func startSiloRequestInBatch(
+	ctx workflow.Context,
+	args SiloRequestArgs,
+	res *requestactivity.RequestStatusResult,
+) error {
+	logger := workflow.GetLogger(ctx)
+	ac := requestactivity.RequestActivity{}
+	resultChan := workflow.GetSignalChannel(ctx, requestactivity.SiloBatchResultSignalChannel)
+
+	item := requestactivity.BatchRequestItem{
+		RequestID:        args.RequestID,
+		RequestStatusIDs: args.RequestStatusIDs,
+		JobID:            args.JobID,
+		WorkflowID:       workflow.GetInfo(ctx).WorkflowExecution.ID,
+	}
+
+	if err := workflow.ExecuteActivity(ctx, ac.EnqueueBatchRequestActivity, requestactivity.EnqueueBatchRequestArgs{
+		Batch: requestactivity.SiloBatchArgs{
+			SiloDefinitionID: args.SiloDefinitionID,
+			Batching:         *args.Batching,
+			Policy:           args.Policy,
+			Limits:           args.Limits,
+		},
+		Item: item,
+	}).Get(ctx, nil); err != nil {
+		return err
+	}
+
+	var signal requestactivity.SiloBatchResultSignal
+	received := false
+
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(resultChan, func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, &signal)
+		received = true
+	})
+	selector.AddReceive(ctx.Done(), func(c workflow.ReceiveChannel, more bool) {})
+	selector.Select(ctx)
+
+	if !received {
+		cleanupCtx, _ := workflow.NewDisconnectedContext(ctx)
+		if err := workflow.SignalExternalWorkflow(
+			cleanupCtx,
+			requestactivity.SiloBatchWorkflowID(args.SiloDefinitionID),
+			"",
+			requestactivity.SiloBatchCancelSignalChannel,
+			item,
+		).Get(cleanupCtx, nil); err != nil {
+			logger.Error("Error removing request from batch", "error", err)
+		}
+
+		return ctx.Err()
+	}
+
+	if signal.Error != "" {
+		return fmt.Errorf("error starting batch: %s", signal.Error)
+	}
+
+	*res = signal.Result
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package requestworkflow
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/workflow/activity/requestactivity"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestSiloBatch verifies that the pending requests are started in one batch,
+// and that each request's result is signalled back to its workflow.
+func (s *siloRequestUnitTestSuite) TestSiloBatch() {
+	s.tabularSetup()
+	defer s.tabularAfter()
+
+	s.env.RegisterActivity(s.ra.StartSiloBatchRequestActivity)
+	s.env.RegisterWorkflow(s.rw.ExecuteSiloBatchWorkflow)
+
+	items := []requestactivity.BatchRequestItem{
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+	}
+
+	args := requestactivity.SiloBatchArgs{
+		SiloDefinitionID: uuid.NewString(),
+		// The first request is added twice, as if the activity that added it
+		// was retried.
+		Pending: append(append([]requestactivity.BatchRequestItem{}, items...), items[0]),
+	}
+
+	results := map[string]requestactivity.RequestStatusResult{}
+	for _, item := range items {
+		results[item.RequestID] = requestactivity.RequestStatusResult{
+			ResultItems: []requestactivity.RequestStatusItem{{
+				FullyComplete:   true,
+				RequestStatusID: uuid.NewString(),
+			}},
+		}
+	}
+
+	s.env.OnActivity(s.ra.StartSiloBatchRequestActivity, mock.Anything, requestactivity.StartBatchRequestArgs{
+		SiloDefinitionID: args.SiloDefinitionID,
+		Requests:         items,
+	}).Return(requestactivity.BatchRequestStatusResult{Results: results}, nil).Once()
+
+	for _, item := range items {
+		s.env.OnSignalExternalWorkflow(
+			mock.Anything,
+			item.WorkflowID,
+			"",
+			requestactivity.SiloBatchResultSignalChannel,
+			requestactivity.SiloBatchResultSignal{
+				RequestID: item.RequestID,
+				Result:    results[item.RequestID],
+			},
+		).Return(nil).Once()
+	}
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteSiloBatchWorkflow, args)
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+// TestSiloRequestInBatch verifies that a silo with batching adds its request to
+// the silo's batch, and continues with the result that's signalled back.
+func (s *siloRequestUnitTestSuite) TestSiloRequestInBatch() {
+	s.tabularSetup()
+	defer s.tabularAfter()
+
+	s.env.RegisterActivity(s.ra.EnqueueBatchRequestActivity)
+
+	windowSeconds := 30
+	wfArgs := SiloRequestArgs{
+		SiloDefinitionID: uuid.NewString(),
+		RequestID:        uuid.NewString(),
+		Batching:         &model.RequestBatching{WindowSeconds: &windowSeconds},
+	}
+
+	requestStatusID := uuid.NewString()
+
+	s.env.OnActivity(s.ra.EnqueueBatchRequestActivity, mock.Anything, mock.MatchedBy(
+		func(args requestactivity.EnqueueBatchRequestArgs) bool {
+			return args.Batch.SiloDefinitionID == wfArgs.SiloDefinitionID &&
+				reflect.DeepEqual(args.Batch.Batching, *wfArgs.Batching) &&
+				args.Item.RequestID == wfArgs.RequestID &&
+				args.Item.WorkflowID != ""
+		},
+	)).Return(nil).Once()
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(requestactivity.SiloBatchResultSignalChannel, requestactivity.SiloBatchResultSignal{
+			RequestID: wfArgs.RequestID,
+			Result: requestactivity.RequestStatusResult{
+				ResultItems: []requestactivity.RequestStatusItem{{
+					FullyComplete:   true,
+					RequestStatusID: requestStatusID,
+				}},
+			},
+		})
+	}, 30*time.Second)
+
+	s.env.OnActivity(s.ra.UpdateRequestStatusActivity, mock.Anything, requestactivity.UpdateRequestStatusArgs{
+		RequestStatusID: requestStatusID,
+		Status:          model.RequestStatusTypeExecuted,
+	}).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteSiloRequestWorkflow, wfArgs)
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+
+	res := ExecuteSiloRequestResult{}
+	s.NoError(s.env.GetWorkflowResult(&res))
+	s.Equal(model.FullRequestStatusExecuted, res.Status)
+}
+
+// TestSiloBatchCancel verifies that a request that's cancelled before its batch
+// starts is removed from the batch.
+func (s *siloRequestUnitTestSuite) TestSiloBatchCancel() {
+	s.tabularSetup()
+	defer s.tabularAfter()
+
+	s.env.RegisterActivity(s.ra.StartSiloBatchRequestActivity)
+	s.env.RegisterWorkflow(s.rw.ExecuteSiloBatchWorkflow)
+
+	items := []requestactivity.BatchRequestItem{
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+	}
+
+	args := requestactivity.SiloBatchArgs{
+		SiloDefinitionID: uuid.NewString(),
+		Pending:          items,
+	}
+
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(requestactivity.SiloBatchCancelSignalChannel, items[0])
+	}, time.Second)
+
+	result := requestactivity.RequestStatusResult{
+		ResultItems: []requestactivity.RequestStatusItem{{
+			FullyComplete:   true,
+			RequestStatusID: uuid.NewString(),
+		}},
+	}
+
+	s.env.OnActivity(s.ra.StartSiloBatchRequestActivity, mock.Anything, requestactivity.StartBatchRequestArgs{
+		SiloDefinitionID: args.SiloDefinitionID,
+		Requests:         items[1:],
+	}).Return(requestactivity.BatchRequestStatusResult{
+		Results: map[string]requestactivity.RequestStatusResult{items[1].RequestID: result},
+	}, nil).Once()
+
+	s.env.OnSignalExternalWorkflow(
+		mock.Anything,
+		items[1].WorkflowID,
+		"",
+		requestactivity.SiloBatchResultSignalChannel,
+		requestactivity.SiloBatchResultSignal{
+			RequestID: items[1].RequestID,
+			Result:    result,
+		},
+	).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteSiloBatchWorkflow, args)
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+// TestSiloBatchWindowFromArrival verifies that the window for a request left
+// over from a full batch starts when the request arrived, rather than after
+// the batch before it has run.
+func (s *siloRequestUnitTestSuite) TestSiloBatchWindowFromArrival() {
+	s.tabularSetup()
+	defer s.tabularAfter()
+
+	s.env.RegisterActivity(s.ra.StartSiloBatchRequestActivity)
+	s.env.RegisterWorkflow(s.rw.ExecuteSiloBatchWorkflow)
+
+	items := []requestactivity.BatchRequestItem{
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+		{RequestID: uuid.NewString(), WorkflowID: uuid.NewString()},
+	}
+
+	maxSize := 2
+	windowSeconds := 30
+
+	args := requestactivity.SiloBatchArgs{
+		SiloDefinitionID: uuid.NewString(),
+		Batching:         model.RequestBatching{MaxSize: &maxSize, WindowSeconds: &windowSeconds},
+		Pending:          items,
+	}
+
+	start := s.env.Now()
+	var lastStarted time.Time
+
+	// The first batch is full, and takes 20 seconds to start.
+	s.env.OnActivity(s.ra.StartSiloBatchRequestActivity, mock.Anything, requestactivity.StartBatchRequestArgs{
+		SiloDefinitionID: args.SiloDefinitionID,
+		Requests:         items[:2],
+	}).After(20*time.Second).Return(requestactivity.BatchRequestStatusResult{}, nil).Once()
+
+	s.env.OnActivity(s.ra.StartSiloBatchRequestActivity, mock.Anything, requestactivity.StartBatchRequestArgs{
+		SiloDefinitionID: args.SiloDefinitionID,
+		Requests:         items[2:],
+	}).Return(func(ctx context.Context, args requestactivity.StartBatchRequestArgs) (requestactivity.BatchRequestStatusResult, error) {
+		lastStarted = s.env.Now()
+		return requestactivity.BatchRequestStatusResult{}, nil
+	}).Once()
+
+	for _, item := range items {
+		s.env.OnSignalExternalWorkflow(
+			mock.Anything,
+			item.WorkflowID,
+			"",
+			requestactivity.SiloBatchResultSignalChannel,
+			mock.Anything,
+		).Return(nil).Once()
+	}
+
+	s.env.ExecuteWorkflow(s.rw.ExecuteSiloBatchWorkflow, args)
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+
+	s.Equal(time.Duration(windowSeconds)*time.Second, lastStarted.Sub(start).Round(time.Second))
+}
@@ -0,0 +1,111 @@
+package workflow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/monoid-privacy/monoid/model"
+	"github.com/monoid-privacy/monoid/workflow/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+type UpgradeSilosArgs struct {
+	WorkspaceID string
+	SiloSpecID  string
+	JobID       string
+}
+
+// UpgradeSilosWorkflow upgrades the workspace's silos of the specification
+// that aren't pinned to the specification's current version, one at a time.
+// The job fails if any of the silos couldn't be upgraded.
+func (w *Workflow) UpgradeSilosWorkflow(
+	ctx workflow.Context,
+	args UpgradeSilosArgs,
+) (err error) {
+	options := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 2,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	}
+
+	// Upgrading runs the connector's validation, which isn't retried.
+	upgradeOptions := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 1,
+		},
+	}
+
+	cleanupOptions := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 1,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 2,
+		},
+	}
+
+	cleanupCtx, _ := workflow.NewDisconnectedContext(
+		workflow.WithActivityOptions(ctx, cleanupOptions),
+	)
+
+	upgradeCtx := workflow.WithActivityOptions(ctx, upgradeOptions)
+	ctx = workflow.WithActivityOptions(ctx, options)
+	ac := activity.Activity{}
+
+	defer func() {
+		status := model.JobStatusCompleted
+
+		if err != nil {
+			status = model.JobStatusFailed
+		}
+
+		terr := workflow.ExecuteActivity(cleanupCtx, ac.UpdateJobStatus, activity.JobStatusInput{
+			ID:     args.JobID,
+			Status: status,
+		}).Get(ctx, nil)
+
+		if terr != nil && err == nil {
+			err = terr
+		}
+	}()
+
+	job := model.Job{}
+	err = workflow.ExecuteActivity(ctx, ac.FindOrCreateJob, activity.JobInput{
+		ID:          args.JobID,
+		WorkspaceID: args.WorkspaceID,
+		JobType:     model.JobTypeUpgradeSilos,
+		ResourceID:  args.SiloSpecID,
+		Status:      model.JobStatusRunning,
+	}).Get(ctx, &job)
+
+	if err != nil {
+		return err
+	}
+
+	silos := activity.SilosToUpgrade{}
+	if err := workflow.ExecuteActivity(ctx, ac.FindSilosToUpgrade, activity.FindSilosToUpgradeArgs{
+		WorkspaceID: args.WorkspaceID,
+		SiloSpecID:  args.SiloSpecID,
+	}).Get(ctx, &silos); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, id := range silos.SiloDefinitionIDs {
+		upgraded := false
+		if err := workflow.ExecuteActivity(upgradeCtx, ac.UpgradeSiloDefinition, activity.UpgradeSiloArgs{
+			JobID:            job.ID,
+			SiloDefinitionID: id,
+			VersionID:        silos.VersionID,
+		}).Get(ctx, &upgraded); err != nil || !upgraded {
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d silos couldn't be upgraded", failed, len(silos.SiloDefinitionIDs))
+	}
+
+	return nil
+}
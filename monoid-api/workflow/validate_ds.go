@@ -11,7 +11,16 @@ import (
 
 type ValidateDSArgs struct {
 	SiloSpecID string
-	Config     []byte
+	// SiloSpecVersionID is the version of the specification to validate
+	// with, which defaults to the specification's current version.
+	SiloSpecVersionID *string
+	Config            []byte
+
+	// CheckSchema checks the config against the version's schema before
+	// the connector validates it.
+	CheckSchema bool
+	// SchemaOnly skips the connector's validation.
+	SchemaOnly bool
 }
 
 func (w *Workflow) ValidateDSWorkflow(ctx workflow.Context, args ValidateDSArgs) (monoidprotocol.MonoidValidateMessage, error) {
@@ -16,6 +16,7 @@ class MonoidQueryIdentifier(BaseModel):
     identifier: str
     identifier_query: Union[str, int]
     json_schema: Dict[str, Any]
+    request_id: Optional[str] = None
 
 
 class RecordType(Enum):
@@ -93,6 +94,7 @@ class MonoidRequestHandle(BaseModel):
     schema_name: str
     data: Optional[Dict[str, Any]] = None
     request_type: RequestType
+    request_id: Optional[str] = None
 
 
 class MonoidRequestsMessage(BaseModel):
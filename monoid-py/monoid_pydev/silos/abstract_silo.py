@@ -61,10 +61,10 @@ class AbstractSilo(ABC):
             data_store = data_stores[(
                 query_rule.schema_group, query_rule.schema_name)]
 
-            yield data_store.run_query_request(
+            yield self._with_request_id(data_store.run_query_request(
                 persistence_conf,
                 query_rule
-            )
+            ), query_rule.request_id)
 
     def delete(
         self,
@@ -83,10 +83,25 @@ class AbstractSilo(ABC):
             data_store = data_stores[(
                 query_rule.schema_group, query_rule.schema_name)]
 
-            yield data_store.run_delete_request(
+            yield self._with_request_id(data_store.run_delete_request(
                 persistence_conf,
                 query_rule
-            )
+            ), query_rule.request_id)
+
+    def _with_request_id(
+        self,
+        result: MonoidRequestResult,
+        request_id: Optional[str],
+    ) -> MonoidRequestResult:
+        """
+        Tags the result's handle with the ID of the request it was started
+        for, so that the results of a batch of requests can be matched back
+        to their requests.
+        """
+        if request_id is not None and result.handle.request_id is None:
+            result.handle.request_id = request_id
+
+        return result
 
     def request_results(
         self,